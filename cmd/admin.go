@@ -0,0 +1,260 @@
+package cmd
+
+import (
+	"os/user"
+
+	"github.com/b2network/b2-indexer/internal/handler"
+	"github.com/b2network/b2-indexer/internal/logic/admin"
+	"github.com/spf13/cobra"
+)
+
+const (
+	FlagOperator = "operator"
+	FlagTxOutput = "tx-output"
+	FlagB2TxHash = "b2-tx-hash"
+	FlagStatus   = "status"
+	FlagLimit    = "limit"
+	FlagHeight   = "height"
+	FlagTxIndex  = "tx-index"
+	FlagAction   = "action"
+	FlagTarget   = "target"
+)
+
+// addChangeFlags adds the flags of the audited admin changes
+func addChangeFlags(cmd *cobra.Command, force string) {
+	cmd.Flags().String(FlagOperator, "", "The operator recorded in the audit, the os user by default")
+	cmd.Flags().String(FlagReason, "", "The reason recorded in the audit, e.g. an incident id")
+	cmd.Flags().Bool(FlagForce, false, force)
+}
+
+func getChange(cmd *cobra.Command) (admin.Change, error) {
+	var change admin.Change
+	var err error
+	if change.Operator, err = cmd.Flags().GetString(FlagOperator); err != nil {
+		return change, err
+	}
+	if change.Operator == "" {
+		if u, err := user.Current(); err == nil {
+			change.Operator = u.Username
+		}
+	}
+	if change.Reason, err = cmd.Flags().GetString(FlagReason); err != nil {
+		return change, err
+	}
+	change.Force, err = cmd.Flags().GetBool(FlagForce)
+	return change, err
+}
+
+func buildDepositCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "deposit",
+		Short: "inspect and repair deposits",
+	}
+	cmd.AddCommand(
+		buildDepositShowCmd(),
+		buildDepositListCmd(),
+		buildDepositRetryCmd(),
+		buildDepositResolveCmd(),
+	)
+	return cmd
+}
+
+func buildDepositShowCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "show [txid]",
+		Short:   "show the deposits of an abelian tx with their mints and audits",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: interceptConfigs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return handler.HandleDepositShowCmd(GetServerContextFromCmd(cmd), cmd, args[0])
+		},
+	}
+	cmd.Flags().String(FlagHome, "./", "The application home directory")
+	return cmd
+}
+
+func buildDepositListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "list the latest deposits",
+		PreRunE: interceptConfigs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			var filter admin.DepositFilter
+			status, err := cmd.Flags().GetString(FlagStatus)
+			if err != nil {
+				return err
+			}
+			if status != "" {
+				b2TxStatus, err := admin.ParseDepositStatus(status)
+				if err != nil {
+					return err
+				}
+				filter.Status = &b2TxStatus
+			}
+			if filter.Limit, err = cmd.Flags().GetInt(FlagLimit); err != nil {
+				return err
+			}
+			return handler.HandleDepositListCmd(GetServerContextFromCmd(cmd), cmd, filter)
+		},
+	}
+	cmd.Flags().String(FlagHome, "./", "The application home directory")
+	cmd.Flags().String(FlagStatus, "", "Only list the deposits of a b2 tx status, a name such as insufficient_balance or a number")
+	cmd.Flags().Int(FlagLimit, admin.DefaultLimit, "The number of deposits listed")
+	return cmd
+}
+
+func buildDepositRetryCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "retry [txid]",
+		Short:   "put a failed deposit back to pending",
+		Long:    "retry resets the b2 tx status of a failed or reverted deposit, or of a deposit out of retries, to pending for the deposit service to mint it again; a recorded mint tx is checked on l2 first, deposits whose mint tx is pending or minted are never retried",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: interceptConfigs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			output, err := cmd.Flags().GetInt64(FlagTxOutput)
+			if err != nil {
+				return err
+			}
+			change, err := getChange(cmd)
+			if err != nil {
+				return err
+			}
+			return handler.HandleDepositRetryCmd(GetServerContextFromCmd(cmd), cmd, args[0], output, change)
+		},
+	}
+	cmd.Flags().String(FlagHome, "./", "The application home directory")
+	cmd.Flags().Int64(FlagTxOutput, 0, "The deposit output of the tx")
+	addChangeFlags(cmd, "Retry a deposit in any unminted status, also one whose mint tx nonce is not used yet")
+	return cmd
+}
+
+func buildDepositResolveCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "mark-resolved [txid]",
+		Short:   "mark a deposit the indexer will not mint as resolved",
+		Long:    "mark-resolved sets the b2 tx status of an unminted deposit to resolved, the deposit service and the reconciliation leave it alone; with --b2-tx-hash the deposit is marked minted by that l2 tx instead and checked against its rollup deposit",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: interceptConfigs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			output, err := cmd.Flags().GetInt64(FlagTxOutput)
+			if err != nil {
+				return err
+			}
+			b2TxHash, err := cmd.Flags().GetString(FlagB2TxHash)
+			if err != nil {
+				return err
+			}
+			change, err := getChange(cmd)
+			if err != nil {
+				return err
+			}
+			return handler.HandleDepositResolveCmd(GetServerContextFromCmd(cmd), cmd, args[0], output, b2TxHash, change)
+		},
+	}
+	cmd.Flags().String(FlagHome, "./", "The application home directory")
+	cmd.Flags().Int64(FlagTxOutput, 0, "The deposit output of the tx")
+	cmd.Flags().String(FlagB2TxHash, "", "The l2 tx that minted the deposit")
+	addChangeFlags(cmd, "Resolve a deposit whose mint may still be mined")
+	return cmd
+}
+
+func buildIndexAdminCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "index",
+		Short: "repair the abelian index cursor",
+	}
+	cmd.AddCommand(buildIndexSetCursorCmd())
+	return cmd
+}
+
+func buildIndexSetCursorCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "set-cursor",
+		Short:   "move the abelian index cursor",
+		Long:    "set-cursor moves the index cursor for the indexer to go on with tx --tx-index of block --height, 0 for the whole block; moving back reindexes the blocks, moving forward past unindexed blocks, before the start height, while an indexer runs or without an indexer heartbeat to check needs --force, heights beyond the block after the abelian tip are refused",
+		PreRunE: interceptConfigs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			height, err := cmd.Flags().GetInt64(FlagHeight)
+			if err != nil {
+				return err
+			}
+			txIndex, err := cmd.Flags().GetInt64(FlagTxIndex)
+			if err != nil {
+				return err
+			}
+			change, err := getChange(cmd)
+			if err != nil {
+				return err
+			}
+			return handler.HandleIndexSetCursorCmd(GetServerContextFromCmd(cmd), cmd, height, txIndex, change)
+		},
+	}
+	cmd.Flags().String(FlagHome, "./", "The application home directory")
+	cmd.Flags().Int64(FlagHeight, 0, "The next block indexed")
+	cmd.Flags().Int64(FlagTxIndex, 0, "The next tx indexed of the block, 0 for the whole block")
+	addChangeFlags(cmd, "Skip blocks, go before the start height or move the cursor of a running indexer")
+	_ = cmd.MarkFlagRequired(FlagHeight)
+	return cmd
+}
+
+func buildWalletCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "wallet",
+		Short: "inspect the l2 wallet minting the deposits",
+	}
+	cmd.AddCommand(buildWalletStatusCmd())
+	return cmd
+}
+
+func buildWalletStatusCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "status",
+		Short:   "show the balance, nonces and in-flight deposits of the bridge wallet",
+		PreRunE: interceptConfigs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return handler.HandleWalletStatusCmd(GetServerContextFromCmd(cmd), cmd)
+		},
+	}
+	cmd.Flags().String(FlagHome, "./", "The application home directory")
+	return cmd
+}
+
+func buildAuditCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "admin changes of the bridge state",
+	}
+	cmd.AddCommand(buildAuditListCmd())
+	return cmd
+}
+
+func buildAuditListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "list the latest admin changes",
+		PreRunE: interceptConfigs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			var filter admin.AuditFilter
+			var err error
+			if filter.Operator, err = cmd.Flags().GetString(FlagOperator); err != nil {
+				return err
+			}
+			if filter.Action, err = cmd.Flags().GetString(FlagAction); err != nil {
+				return err
+			}
+			if filter.Target, err = cmd.Flags().GetString(FlagTarget); err != nil {
+				return err
+			}
+			if filter.Limit, err = cmd.Flags().GetInt(FlagLimit); err != nil {
+				return err
+			}
+			return handler.HandleAuditListCmd(GetServerContextFromCmd(cmd), cmd, filter)
+		},
+	}
+	cmd.Flags().String(FlagHome, "./", "The application home directory")
+	cmd.Flags().String(FlagOperator, "", "Only list the changes of an operator")
+	cmd.Flags().String(FlagAction, "", "Only list the changes of an action, e.g. deposit.retry")
+	cmd.Flags().String(FlagTarget, "", "Only list the changes of a row, e.g. deposit_history:42")
+	cmd.Flags().Int(FlagLimit, admin.DefaultLimit, "The number of changes listed")
+	return cmd
+}
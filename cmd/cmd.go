@@ -3,16 +3,21 @@ package cmd
 import (
 	"context"
 	"os"
+	"strings"
 
+	"github.com/b2network/b2-indexer/config"
 	"github.com/b2network/b2-indexer/internal/handler"
 	"github.com/b2network/b2-indexer/internal/model"
 	"github.com/b2network/b2-indexer/internal/types"
+	cryptocmd "github.com/b2network/b2-indexer/pkg/crypto/cmd"
 	"github.com/b2network/b2-indexer/pkg/log"
 	"github.com/spf13/cobra"
 )
 
 const (
-	FlagHome = "home"
+	FlagHome    = "home"
+	FlagProfile = "profile"
+	FlagSet     = "set"
 )
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -37,25 +42,50 @@ func rootCmd() *cobra.Command {
 	}
 
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	rootCmd.PersistentFlags().String(FlagProfile, "", "The config profile, one of "+strings.Join(config.Profiles(), ", "))
+	rootCmd.PersistentFlags().StringArray(FlagSet, nil, "Override a config key as section.key=value, e.g. indexer.log-level=debug")
 	rootCmd.AddCommand(buildIndexCmd())
+	rootCmd.AddCommand(buildHTTPCmd())
+	rootCmd.AddCommand(buildWithdrawCmd())
+	rootCmd.AddCommand(buildMigrateCmd())
+	rootCmd.AddCommand(buildReindexCmd())
+	rootCmd.AddCommand(buildOutboxCmd())
+	rootCmd.AddCommand(buildReconcileCmd())
+	rootCmd.AddCommand(buildReservesCmd())
+	rootCmd.AddCommand(buildDepositCmd())
+	rootCmd.AddCommand(buildIndexAdminCmd())
+	rootCmd.AddCommand(buildWalletCmd())
+	rootCmd.AddCommand(buildAuditCmd())
+	rootCmd.AddCommand(buildConfigCmd())
+	rootCmd.AddCommand(cryptocmd.Crypto())
 	return rootCmd
 }
 
 func buildIndexCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "start",
-		Short: "start index tx service",
-		PreRunE: func(cmd *cobra.Command, _ []string) error {
-			home, err := cmd.Flags().GetString(FlagHome)
+		Use:     "start",
+		Short:   "start index tx service",
+		PreRunE: interceptConfigs,
+		Run: func(cmd *cobra.Command, _ []string) {
+			err := handler.HandleIndexCmd(GetServerContextFromCmd(cmd), cmd)
 			if err != nil {
-				return err
+				log.Error("start index tx service failed")
 			}
-			return handler.InterceptConfigsPreRunHandler(cmd, home)
 		},
+	}
+	cmd.Flags().String(FlagHome, "./", "The application home directory")
+	return cmd
+}
+
+func buildHTTPCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "http",
+		Short:   "start http api service",
+		PreRunE: interceptConfigs,
 		Run: func(cmd *cobra.Command, _ []string) {
-			err := handler.HandleIndexCmd(GetServerContextFromCmd(cmd), cmd)
+			err := handler.HandleHTTPCmd(GetServerContextFromCmd(cmd), cmd)
 			if err != nil {
-				log.Error("start index tx service failed")
+				log.Error("start http api service failed")
 			}
 		},
 	}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/handler"
+	"github.com/spf13/cobra"
+)
+
+const (
+	FlagForce = "force"
+)
+
+func buildConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "config tools",
+	}
+	cmd.AddCommand(
+		buildConfigInitCmd(),
+		buildConfigShowCmd(),
+		buildConfigValidateCmd(),
+		buildConfigEncryptCmd(),
+	)
+	return cmd
+}
+
+// interceptConfigs loads the configs and db of a command with the home and config flags
+func interceptConfigs(cmd *cobra.Command, _ []string) error {
+	home, err := cmd.Flags().GetString(FlagHome)
+	if err != nil {
+		return err
+	}
+	flags, err := configFlags(cmd)
+	if err != nil {
+		return err
+	}
+	return handler.InterceptConfigsPreRunHandler(cmd, home, flags)
+}
+
+// configFlags returns the --profile and --set flags of the root command, none for a command built alone
+func configFlags(cmd *cobra.Command) (handler.ConfigFlags, error) {
+	if cmd.Flags().Lookup(FlagProfile) == nil {
+		return handler.ConfigFlags{}, nil
+	}
+	profile, err := cmd.Flags().GetString(FlagProfile)
+	if err != nil {
+		return handler.ConfigFlags{}, err
+	}
+	set, err := cmd.Flags().GetStringArray(FlagSet)
+	if err != nil {
+		return handler.ConfigFlags{}, err
+	}
+	return handler.ConfigFlags{Profile: profile, Set: set}, nil
+}
+
+func buildConfigInitCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "write a commented config file of the profile",
+		Long:  "init writes " + config.ConfigFileName + " to the home directory with the defaults of --profile",
+		// the error is the output, not the usage
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			home, err := cmd.Flags().GetString(FlagHome)
+			if err != nil {
+				return err
+			}
+			profile, err := cmd.Flags().GetString(FlagProfile)
+			if err != nil {
+				return err
+			}
+			force, err := cmd.Flags().GetBool(FlagForce)
+			if err != nil {
+				return err
+			}
+			return handler.HandleConfigInitCmd(cmd, home, profile, force)
+		},
+	}
+	cmd.Flags().String(FlagHome, "./", "The application home directory")
+	cmd.Flags().Bool(FlagForce, false, "Overwrite an existing config file")
+	return cmd
+}
+
+func buildConfigShowCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "show",
+		Short: "print the effective config with the secrets redacted",
+		// the error is the output, not the usage
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			home, err := cmd.Flags().GetString(FlagHome)
+			if err != nil {
+				return err
+			}
+			flags, err := configFlags(cmd)
+			if err != nil {
+				return err
+			}
+			return handler.HandleConfigShowCmd(cmd, home, flags)
+		},
+	}
+	cmd.Flags().String(FlagHome, "./", "The application home directory")
+	return cmd
+}
+
+func buildConfigValidateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "check the configs of the enabled features",
+		Long:  "validate checks the required fields, address formats, url schemes and numeric ranges of the enabled features and reports all problems at once",
+		// the problems are the output, not the usage
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			home, err := cmd.Flags().GetString(FlagHome)
+			if err != nil {
+				return err
+			}
+			flags, err := configFlags(cmd)
+			if err != nil {
+				return err
+			}
+			return handler.HandleConfigValidateCmd(cmd, home, flags)
+		},
+	}
+	cmd.Flags().String(FlagHome, "./", "The application home directory")
+	return cmd
+}
+
+func buildConfigEncryptCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "encrypt",
+		Short: "encrypt a secret into an enc: config value",
+		Long: "encrypt reads a secret from the terminal or stdin and prints the enc: value of it, " +
+			"encrypted with the aes-256 key of " + config.SecretKeyEnv + " or " + config.SecretKeyFileEnv,
+		// the error is the output, not the usage
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return handler.HandleConfigEncryptCmd(cmd)
+		},
+	}
+	return cmd
+}
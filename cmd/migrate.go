@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"github.com/b2network/b2-indexer/internal/handler"
+	"github.com/spf13/cobra"
+)
+
+const (
+	FlagTo    = "to"
+	FlagSteps = "steps"
+)
+
+func buildMigrateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "db schema migrations",
+	}
+	cmd.AddCommand(
+		buildMigrateUpCmd(),
+		buildMigrateDownCmd(),
+		buildMigrateStatusCmd(),
+	)
+	return cmd
+}
+
+func buildMigrateUpCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "up",
+		Short:   "apply the pending migrations",
+		PreRunE: interceptConfigs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			to, err := cmd.Flags().GetInt64(FlagTo)
+			if err != nil {
+				return err
+			}
+			return handler.HandleMigrateUpCmd(GetServerContextFromCmd(cmd), cmd, to)
+		},
+	}
+	cmd.Flags().String(FlagHome, "./", "The application home directory")
+	cmd.Flags().Int64(FlagTo, 0, "The schema version to migrate to, 0 for the latest")
+	return cmd
+}
+
+func buildMigrateDownCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "down",
+		Short:   "revert the last migrations",
+		PreRunE: interceptConfigs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			steps, err := cmd.Flags().GetInt(FlagSteps)
+			if err != nil {
+				return err
+			}
+			return handler.HandleMigrateDownCmd(GetServerContextFromCmd(cmd), cmd, steps)
+		},
+	}
+	cmd.Flags().String(FlagHome, "./", "The application home directory")
+	cmd.Flags().Int(FlagSteps, 1, "The number of migrations to revert")
+	return cmd
+}
+
+func buildMigrateStatusCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "status",
+		Short:   "print the applied and pending migrations",
+		PreRunE: interceptConfigs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return handler.HandleMigrateStatusCmd(GetServerContextFromCmd(cmd), cmd)
+		},
+	}
+	cmd.Flags().String(FlagHome, "./", "The application home directory")
+	return cmd
+}
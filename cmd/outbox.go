@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/b2network/b2-indexer/internal/handler"
+	"github.com/b2network/b2-indexer/internal/outbox"
+	"github.com/spf13/cobra"
+)
+
+const (
+	FlagFromID      = "from-id"
+	FlagToID        = "to-id"
+	FlagAggregate   = "aggregate"
+	FlagAggregateID = "aggregate-id"
+)
+
+func buildOutboxCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "outbox",
+		Short: "deposit and withdraw change events",
+	}
+	cmd.AddCommand(buildOutboxReplayCmd(), buildOutboxUnparkCmd())
+	return cmd
+}
+
+func buildOutboxReplayCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "replay",
+		Short:   "publish outbox events again",
+		Long:    "replay publishes the outbox events selected by the flags to the configured sink again in id order, whether published or not, e.g. --set indexer.outbox.sink=stdout to print them",
+		PreRunE: interceptConfigs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			var filter outbox.ReplayFilter
+			var err error
+			if filter.FromID, err = cmd.Flags().GetInt64(FlagFromID); err != nil {
+				return err
+			}
+			if filter.ToID, err = cmd.Flags().GetInt64(FlagToID); err != nil {
+				return err
+			}
+			if filter.Aggregate, err = cmd.Flags().GetString(FlagAggregate); err != nil {
+				return err
+			}
+			if filter.AggregateID, err = cmd.Flags().GetInt64(FlagAggregateID); err != nil {
+				return err
+			}
+			if filter.AggregateID > 0 && filter.Aggregate == "" {
+				return fmt.Errorf("--%s requires --%s", FlagAggregateID, FlagAggregate)
+			}
+			return handler.HandleOutboxReplayCmd(GetServerContextFromCmd(cmd), cmd, filter)
+		},
+	}
+	cmd.Flags().String(FlagHome, "./", "The application home directory")
+	cmd.Flags().Int64(FlagFromID, 0, "The first event id to replay")
+	cmd.Flags().Int64(FlagToID, 0, "The last event id to replay, 0 for the latest")
+	cmd.Flags().String(FlagAggregate, "", "Only replay the events of a table: deposit_history, withdraw_history or withdraw_tx")
+	cmd.Flags().Int64(FlagAggregateID, 0, "Only replay the events of the row id of --aggregate")
+	return cmd
+}
+
+func buildOutboxUnparkCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "unpark",
+		Short:   "retry parked outbox events",
+		Long:    "unpark makes the outbox events parked after max-attempts pending again with their attempts reset, the relay publishes them and the later events of their rows; all parked events without flags",
+		PreRunE: interceptConfigs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			aggregate, err := cmd.Flags().GetString(FlagAggregate)
+			if err != nil {
+				return err
+			}
+			aggregateID, err := cmd.Flags().GetInt64(FlagAggregateID)
+			if err != nil {
+				return err
+			}
+			if aggregateID > 0 && aggregate == "" {
+				return fmt.Errorf("--%s requires --%s", FlagAggregateID, FlagAggregate)
+			}
+			return handler.HandleOutboxUnparkCmd(GetServerContextFromCmd(cmd), cmd, aggregate, aggregateID)
+		},
+	}
+	cmd.Flags().String(FlagHome, "./", "The application home directory")
+	cmd.Flags().String(FlagAggregate, "", "Only unpark the events of a table: deposit_history, withdraw_history or withdraw_tx")
+	cmd.Flags().Int64(FlagAggregateID, 0, "Only unpark the events of the row id of --aggregate")
+	return cmd
+}
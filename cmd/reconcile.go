@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"github.com/b2network/b2-indexer/internal/handler"
+	"github.com/spf13/cobra"
+)
+
+func buildReconcileCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "reconcile",
+		Short:   "reconcile the deposits with the l2 mint and burn events",
+		Long:    "reconcile checks that every deposit has exactly one mint event, that every mint event has its deposit and that the minted supply matches the confirmed deposits, saves the report to reconciliation_report and prints it; it fails when discrepancies were found",
+		PreRunE: interceptConfigs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return handler.HandleReconcileCmd(GetServerContextFromCmd(cmd), cmd)
+		},
+	}
+	cmd.Flags().String(FlagHome, "./", "The application home directory")
+	return cmd
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"github.com/b2network/b2-indexer/internal/handler"
+	"github.com/spf13/cobra"
+)
+
+const (
+	FlagFrom   = "from"
+	FlagDryRun = "dry-run"
+)
+
+func buildReindexCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "reindex",
+		Short:   "parse a block range again and insert the missing deposits",
+		Long:    "reindex parses the blocks --from..--to again without moving the index cursor, inserts the deposits missing from deposit_history and reports the deposits differing from the db rows",
+		PreRunE: interceptConfigs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			from, err := cmd.Flags().GetInt64(FlagFrom)
+			if err != nil {
+				return err
+			}
+			to, err := cmd.Flags().GetInt64(FlagTo)
+			if err != nil {
+				return err
+			}
+			dryRun, err := cmd.Flags().GetBool(FlagDryRun)
+			if err != nil {
+				return err
+			}
+			return handler.HandleReindexCmd(GetServerContextFromCmd(cmd), cmd, from, to, dryRun)
+		},
+	}
+	cmd.Flags().String(FlagHome, "./", "The application home directory")
+	cmd.Flags().Int64(FlagFrom, 0, "The first block height to reindex")
+	cmd.Flags().Int64(FlagTo, 0, "The last block height to reindex")
+	cmd.Flags().Bool(FlagDryRun, false, "Only report the missing and differing deposits")
+	_ = cmd.MarkFlagRequired(FlagFrom)
+	_ = cmd.MarkFlagRequired(FlagTo)
+	return cmd
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"github.com/b2network/b2-indexer/internal/handler"
+	"github.com/spf13/cobra"
+)
+
+const (
+	FlagOutput = "output"
+	FlagSigner = "signer"
+)
+
+func buildReservesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "reserves",
+		Short:   "sign a proof-of-reserves report",
+		Long:    "reserves reads the wABEL supply at the latest l2 block, the custody balance at the abelian tip and the confirmed deposits less the completed withdraws of the db, and prints the report signed with the bridge.reserves signer-key; it fails when the custody balance does not cover the wABEL supply",
+		PreRunE: interceptConfigs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			output, err := cmd.Flags().GetString(FlagOutput)
+			if err != nil {
+				return err
+			}
+			return handler.HandleReservesCmd(GetServerContextFromCmd(cmd), cmd, output)
+		},
+	}
+	cmd.Flags().String(FlagHome, "./", "The application home directory")
+	cmd.Flags().String(FlagOutput, "", "Write the signed report to this file instead of printing it")
+	cmd.AddCommand(buildReservesVerifyCmd())
+	return cmd
+}
+
+func buildReservesVerifyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify <file>",
+		Short: "verify the signature of a proof-of-reserves report",
+		Long:  "verify checks the signature of a signed report file, - for stdin, and prints the report; --signer requires it to be signed by that address",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			signer, err := cmd.Flags().GetString(FlagSigner)
+			if err != nil {
+				return err
+			}
+			return handler.HandleReservesVerifyCmd(cmd, args[0], signer)
+		},
+	}
+	cmd.Flags().String(FlagSigner, "", "The address the report must be signed by")
+	return cmd
+}
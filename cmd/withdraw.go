@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"strconv"
+
+	"github.com/b2network/b2-indexer/internal/handler"
+	"github.com/spf13/cobra"
+)
+
+const (
+	FlagReviewer = "reviewer"
+	FlagReason   = "reason"
+
+	FlagRefundTxHash = "refund-tx-hash"
+)
+
+func buildWithdrawCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "withdraw",
+		Short: "inspect withdraws, approve risk held withdraws and record refunds of rejected ones",
+	}
+	cmd.AddCommand(
+		buildWithdrawAwaitingCmd(),
+		buildWithdrawApproveCmd(),
+		buildWithdrawRejectCmd(),
+		buildWithdrawShowCmd(),
+		buildWithdrawRefundCmd(),
+	)
+	return cmd
+}
+
+func buildWithdrawAwaitingCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "awaiting",
+		Short:   "list withdraws awaiting approval",
+		PreRunE: interceptConfigs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return handler.HandleWithdrawAwaitingCmd(GetServerContextFromCmd(cmd), cmd)
+		},
+	}
+	cmd.Flags().String(FlagHome, "./", "The application home directory")
+	return cmd
+}
+
+func buildWithdrawApproveCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "approve [withdraw-id]",
+		Short:   "approve a withdraw awaiting approval",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: interceptConfigs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return err
+			}
+			reviewer, err := cmd.Flags().GetString(FlagReviewer)
+			if err != nil {
+				return err
+			}
+			return handler.HandleWithdrawApproveCmd(GetServerContextFromCmd(cmd), cmd, id, reviewer)
+		},
+	}
+	cmd.Flags().String(FlagHome, "./", "The application home directory")
+	cmd.Flags().String(FlagReviewer, "", "The reviewer name recorded with the approval")
+	return cmd
+}
+
+func buildWithdrawRejectCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "reject [withdraw-id]",
+		Short:   "reject a withdraw awaiting approval",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: interceptConfigs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return err
+			}
+			reviewer, err := cmd.Flags().GetString(FlagReviewer)
+			if err != nil {
+				return err
+			}
+			reason, err := cmd.Flags().GetString(FlagReason)
+			if err != nil {
+				return err
+			}
+			return handler.HandleWithdrawRejectCmd(GetServerContextFromCmd(cmd), cmd, id, reviewer, reason)
+		},
+	}
+	cmd.Flags().String(FlagHome, "./", "The application home directory")
+	cmd.Flags().String(FlagReviewer, "", "The reviewer name recorded with the rejection")
+	cmd.Flags().String(FlagReason, "", "The rejection reason")
+	return cmd
+}
+
+func buildWithdrawShowCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "show [withdraw-id|b2-tx-hash]",
+		Short:   "show a withdraw with its abelian txs, fee bumps and signatures",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: interceptConfigs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return handler.HandleWithdrawShowCmd(GetServerContextFromCmd(cmd), cmd, args[0])
+		},
+	}
+	cmd.Flags().String(FlagHome, "./", "The application home directory")
+	return cmd
+}
+
+func buildWithdrawRefundCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "mark-refunded [withdraw-id|b2-tx-hash]",
+		Short:   "mark a rejected withdraw as refunded on l2",
+		Long:    "mark-refunded records the l2 tx --refund-tx-hash minting the burn of a withdraw rejected by the risk engine back to its sender, the refund itself is minted by the operators; a tx not indexed as a rollup deposit or minting another value than the withdraw needs --force",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: interceptConfigs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			refundTxHash, err := cmd.Flags().GetString(FlagRefundTxHash)
+			if err != nil {
+				return err
+			}
+			change, err := getChange(cmd)
+			if err != nil {
+				return err
+			}
+			return handler.HandleWithdrawRefundCmd(GetServerContextFromCmd(cmd), cmd, args[0], refundTxHash, change)
+		},
+	}
+	cmd.Flags().String(FlagHome, "./", "The application home directory")
+	cmd.Flags().String(FlagRefundTxHash, "", "The l2 tx that minted the withdraw value back")
+	addChangeFlags(cmd, "Record a refund tx not indexed yet or minting another value")
+	return cmd
+}
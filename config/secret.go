@@ -0,0 +1,114 @@
+package config
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/b2network/b2-indexer/pkg/crypto"
+)
+
+const (
+	// SecretEncPrefix marks a hex aes-256 ciphertext of `abe-indexer crypto aes-enc`
+	SecretEncPrefix = "enc:"
+	// SecretFilePrefix marks the path of a file holding the value, e.g. a docker or kubernetes secret
+	SecretFilePrefix = "file:"
+
+	// SecretKeyEnv is the hex aes-256 key of the enc: values
+	SecretKeyEnv = "INDEXER_SECRET_KEY"
+	// SecretKeyFileEnv is the path of a file holding the hex aes-256 key of the enc: values
+	SecretKeyFileEnv = "INDEXER_SECRET_KEY_FILE"
+)
+
+var (
+	ErrSecret    = errors.New("invalid config secret")
+	ErrSecretKey = errors.New("invalid config secret key")
+)
+
+// SecretKey returns the key of the enc: values, read from INDEXER_SECRET_KEY or
+// the file of INDEXER_SECRET_KEY_FILE
+func SecretKey() ([]byte, error) {
+	hexKey := os.Getenv(SecretKeyEnv)
+	if keyFile := os.Getenv(SecretKeyFileEnv); keyFile != "" {
+		if hexKey != "" {
+			return nil, fmt.Errorf("%w: set %s or %s, not both", ErrSecretKey, SecretKeyEnv, SecretKeyFileEnv)
+		}
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrSecretKey, err)
+		}
+		hexKey = string(data)
+	}
+	hexKey = strings.TrimSpace(hexKey)
+	if hexKey == "" {
+		return nil, fmt.Errorf("%w: %s or %s is not set", ErrSecretKey, SecretKeyEnv, SecretKeyFileEnv)
+	}
+	key, err := hex.DecodeString(hexKey)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("%w: expected 32 hex bytes, `abe-indexer crypto gen-aes-key` generates one", ErrSecretKey)
+	}
+	return key, nil
+}
+
+// EncryptSecret returns the enc: value of plaintext
+func EncryptSecret(plaintext string, key []byte) (string, error) {
+	crypted, err := crypto.AesEncrypt([]byte(plaintext), key)
+	if err != nil {
+		return "", err
+	}
+	return SecretEncPrefix + hex.EncodeToString(crypted), nil
+}
+
+// resolveSecrets replaces the file: and enc: values of the secret fields, a file may
+// hold an enc: value. Relative files are relative to home. The key is only read when
+// a value is encrypted, the errors never contain a value.
+func resolveSecrets(cfg *AppConfig, home string) error {
+	var (
+		key    []byte
+		keyErr error
+		errs   []error
+	)
+	leafFields(reflect.ValueOf(cfg).Elem(), "", func(name string, field reflect.StructField, value reflect.Value) {
+		if field.Tag.Get("secret") == "" || value.Kind() != reflect.String {
+			return
+		}
+		s := value.String()
+		if ref, ok := strings.CutPrefix(s, SecretFilePrefix); ok {
+			if !path.IsAbs(ref) {
+				ref = path.Join(home, ref)
+			}
+			data, err := os.ReadFile(ref)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%w %s: %s", ErrSecret, name, err))
+				return
+			}
+			s = strings.TrimSpace(string(data))
+		}
+		if ciphertext, ok := strings.CutPrefix(s, SecretEncPrefix); ok {
+			if key == nil && keyErr == nil {
+				key, keyErr = SecretKey()
+			}
+			if keyErr != nil {
+				errs = append(errs, fmt.Errorf("%w %s: %w", ErrSecret, name, keyErr))
+				return
+			}
+			crypted, err := hex.DecodeString(strings.TrimSpace(ciphertext))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%w %s: enc: value is not hex", ErrSecret, name))
+				return
+			}
+			plaintext, err := crypto.AesDecrypt(crypted, key)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%w %s: %w", ErrSecret, name, err))
+				return
+			}
+			s = string(plaintext)
+		}
+		value.SetString(s)
+	})
+	return errors.Join(errs...)
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+//go:embed template.toml
+var configTemplate string
+
+// WriteTemplate writes the commented config file of profile, the values are the profile defaults
+func WriteTemplate(w io.Writer, profile string) error {
+	defaults, err := Defaults(profile)
+	if err != nil {
+		return err
+	}
+	values := make(map[string]interface{})
+	leafFields(reflect.ValueOf(defaults).Elem(), "", func(key string, _ reflect.StructField, value reflect.Value) {
+		values[key] = value.Interface()
+	})
+	tmpl, err := template.New(ConfigFileName).Funcs(template.FuncMap{
+		"profiles": func() string {
+			return strings.Join(Profiles(), ", ")
+		},
+		// json strings, numbers, bools and string arrays are toml values
+		"value": func(key string) (string, error) {
+			value, ok := values[key]
+			if !ok {
+				return "", fmt.Errorf("%w: %s", ErrUnknownKey, key)
+			}
+			if list, ok := value.([]string); ok && list == nil {
+				return "[]", nil
+			}
+			data, err := json.Marshal(value)
+			return string(data), err
+		},
+	}).Parse(configTemplate)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, defaults)
+}
@@ -0,0 +1,390 @@
+package config
+
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/b2network/b2-indexer/pkg/log"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var ErrInvalidConfig = errors.New("invalid config")
+
+// Validate checks the configs of the enabled features and returns all problems at once
+func Validate(cfg *Config, bitcoinCfg *BitcoinConfig, httpCfg *HTTPConfig) error {
+	errs := []error{cfg.Validate(), bitcoinCfg.Validate(), httpCfg.Validate()}
+	// the signer keys are in the order of the bridge public keys
+	if len(httpCfg.SignerKeys) > 0 && len(httpCfg.SignerKeys) != len(bitcoinCfg.Bridge.PublicKeys) {
+		v := newValidator(SectionHTTP, httpCfg)
+		v.addf("signer-keys", "%d keys for %d bridge publickeys", len(httpCfg.SignerKeys), len(bitcoinCfg.Bridge.PublicKeys))
+		errs = append(errs, v.err())
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks the indexer.toml config
+func (c *Config) Validate() error {
+	v := newValidator(SectionIndexer, c)
+	v.required("database-source", c.DatabaseSource, "")
+	switch {
+	case c.DatabaseDialect() == DialectSqlite:
+		if strings.TrimSpace(c.SqlitePath()) == "" {
+			v.addf("database-source", "sqlite source without a file path")
+		}
+	case strings.Contains(c.DatabaseSource, "://"):
+		v.url("database-source", c.DatabaseSource, "postgres", "postgresql")
+	}
+	logOpts := log.NewOptions()
+	logOpts.Level = c.LogLevel
+	logOpts.Format = c.LogFormat
+	if err := logOpts.Validate(); err != nil {
+		v.addf("log-level", "%s", err)
+	}
+	v.positive("database-max-open-conns", int64(c.DatabaseMaxOpenConns))
+	v.nonNegative("database-max-idle-conns", int64(c.DatabaseMaxIdleConns))
+	v.nonNegative("database-conn-max-lifetime", int64(c.DatabaseConnMaxLifetime))
+	// the health probes are served on the metrics port with the metrics off too
+	v.port("metrics-port", c.MetricsPort)
+	v.positive("health-stalled-threshold", c.HealthStalledThreshold)
+	v.nonNegative("health-ready-lag", c.HealthReadyLag)
+	if c.EnableLeaderElection {
+		v.positive("leader-lease-ttl", c.LeaderLeaseTTL)
+		// the replicas share the lease on a postgres server
+		if c.DatabaseDialect() == DialectSqlite {
+			v.addf("enable-leader-election", "requires a postgres database-source")
+		}
+	}
+	if c.Outbox.EnableRelay {
+		v.validateOutbox(c.Outbox)
+	}
+	if c.Webhook.EnableDispatcher {
+		v.validateWebhook(c.Webhook)
+	}
+	if c.Reconcile.EnableJob {
+		v.positive("reconcile.interval", c.Reconcile.Interval)
+	}
+	v.nonNegative("reconcile.grace-period", c.Reconcile.GracePeriod)
+	v.url("reconcile.alert-url", c.Reconcile.AlertURL, "http", "https")
+	return v.err()
+}
+
+func (v *validator) validateWebhook(webhook WebhookConfig) {
+	v.positive("webhook.max-attempts", int64(webhook.MaxAttempts))
+	v.positive("webhook.min-backoff", webhook.MinBackoff)
+	if webhook.MaxBackoff < webhook.MinBackoff {
+		v.addf("webhook.max-backoff", "%d, must not be below webhook.min-backoff %d", webhook.MaxBackoff, webhook.MinBackoff)
+	}
+	v.positive("webhook.timeout", webhook.Timeout)
+	v.positive("webhook.poll-interval", webhook.PollInterval)
+}
+
+func (v *validator) validateOutbox(outbox OutboxConfig) {
+	v.oneOf("outbox.sink", outbox.Sink, OutboxSinkWebhook, OutboxSinkNATS, OutboxSinkKafka, OutboxSinkFile, OutboxSinkStdout)
+	switch outbox.Sink {
+	case OutboxSinkWebhook:
+		v.required("outbox.sink-url", outbox.SinkURL, "outbox.sink webhook")
+		v.url("outbox.sink-url", outbox.SinkURL, "http", "https")
+	case OutboxSinkNATS:
+		v.required("outbox.sink-url", outbox.SinkURL, "outbox.sink nats")
+		v.url("outbox.sink-url", outbox.SinkURL, "nats", "tls")
+	case OutboxSinkKafka, OutboxSinkFile:
+		v.required("outbox.sink-url", outbox.SinkURL, "outbox.sink "+outbox.Sink)
+	}
+	if outbox.Sink == OutboxSinkNATS || outbox.Sink == OutboxSinkKafka {
+		v.required("outbox.sink-topic", outbox.SinkTopic, "outbox.sink "+outbox.Sink)
+	}
+	v.positive("outbox.batch-size", int64(outbox.BatchSize))
+	v.positive("outbox.poll-interval", outbox.PollInterval)
+	v.positive("outbox.publish-timeout", outbox.PublishTimeout)
+	v.positive("outbox.max-attempts", int64(outbox.MaxAttempts))
+	v.positive("outbox.max-backoff", outbox.MaxBackoff)
+}
+
+// Validate checks the bitcoin.toml config of the enabled indexer, rollup listener and withdraw
+func (c *BitcoinConfig) Validate() error {
+	v := newValidator(SectionBitcoin, c)
+	bridge := c.Bridge
+	if c.EnableIndexer || bridge.EnableWithdrawListener {
+		v.required("rpc-host", c.RPCHost, "enable-indexer or bridge.enable-withdraw-listener")
+		if strings.Contains(c.RPCHost, "://") {
+			v.url("rpc-host", c.RPCHost, "http", "https")
+		}
+		if c.RPCPort != "" {
+			v.port("rpc-port", c.RPCPort)
+		}
+	}
+	if c.EnableIndexer {
+		v.required("indexer-listen-address", c.IndexerListenAddress, "enable-indexer")
+		switch c.IndexerStart {
+		case "", "latest":
+		case "deployment":
+			if bridge.DeploymentHeight <= 0 {
+				v.addf("bridge.deployment-height", "required by indexer-start deployment")
+			}
+		default:
+			if height, err := strconv.ParseInt(c.IndexerStart, 10, 64); err != nil || height <= 0 {
+				v.addf("indexer-start", "%q is not latest, deployment or a block height", c.IndexerStart)
+			}
+		}
+		v.nonNegative("indexer-start-tx-index", c.IndexerStartTxIndex)
+
+		v.ethPrivKey("bridge.eth-priv-key", bridge.EthPrivKey, "enable-indexer")
+		v.required("bridge.aa-b2-api", bridge.AAB2PI, "enable-indexer")
+		v.url("bridge.aa-b2-api", bridge.AAB2PI, "http", "https")
+		if bridge.B2ExplorerURL != "" {
+			v.url("bridge.b2-explorer-url", bridge.B2ExplorerURL, "http", "https")
+		}
+	}
+	if c.EnableIndexer || bridge.EnableRollupListener || bridge.EnableWithdrawListener {
+		v.required("bridge.eth-rpc-url", bridge.EthRPCURL, "enable-indexer and the bridge listeners")
+		v.url("bridge.eth-rpc-url", bridge.EthRPCURL, "http", "https", "ws", "wss")
+	}
+	if c.EnableIndexer || bridge.EnableRollupListener {
+		v.ethAddress("bridge.contract-address", bridge.ContractAddress, "enable-indexer or bridge.enable-rollup-listener")
+	}
+	if bridge.EnableRollupListener {
+		v.hash("bridge.deposit", bridge.Deposit, "bridge.enable-rollup-listener")
+		v.hash("bridge.withdraw", bridge.Withdraw, "bridge.enable-rollup-listener")
+	}
+	if bridge.EnableWithdrawListener {
+		v.validateWithdraw(bridge)
+	}
+	if bridge.Reserves.SignerKey != "" {
+		v.validateReserves(c)
+	}
+	return v.err()
+}
+
+func (v *validator) validateReserves(c *BitcoinConfig) {
+	reserves := c.Bridge.Reserves
+	v.ethPrivKey("bridge.reserves.signer-key", reserves.SignerKey, "")
+	v.required("bridge.eth-rpc-url", c.Bridge.EthRPCURL, "bridge.reserves.signer-key")
+	v.url("bridge.eth-rpc-url", c.Bridge.EthRPCURL, "http", "https", "ws", "wss")
+	if reserves.WAbelAddress == "" {
+		v.ethAddress("bridge.contract-address", c.Bridge.ContractAddress, "bridge.reserves without wabel-address")
+	} else {
+		v.ethAddress("bridge.reserves.wabel-address", reserves.WAbelAddress, "")
+	}
+	if reserves.CustodyAddress == "" {
+		v.required("indexer-listen-address", c.IndexerListenAddress, "bridge.reserves without custody-address")
+	}
+	v.required("rpc-host", c.RPCHost, "bridge.reserves.signer-key")
+	v.required("bridge.reserves.balance-method", reserves.BalanceMethod, "bridge.reserves.signer-key")
+	v.nonNegative("bridge.reserves.cache-ttl", reserves.CacheTTL)
+}
+
+func (v *validator) validateWithdraw(bridge BridgeConfig) {
+	if len(bridge.PublicKeys) == 0 {
+		v.addf("bridge.publickeys", "required by bridge.enable-withdraw-listener")
+	}
+	for i, pubKey := range bridge.PublicKeys {
+		pubKeyByte, err := hex.DecodeString(pubKey)
+		if err == nil {
+			_, err = btcec.ParsePubKey(pubKeyByte)
+		}
+		if err != nil {
+			v.addf("bridge.publickeys", "key %d %q is not a hex secp256k1 public key", i, pubKey)
+		}
+	}
+	if bridge.MultisigNum <= 0 || bridge.MultisigNum > len(bridge.PublicKeys) {
+		v.addf("bridge.multisig-num", "%d, must be 1 to the %d publickeys", bridge.MultisigNum, len(bridge.PublicKeys))
+	}
+	v.positive("bridge.time-interval", bridge.TimeInterval)
+	v.oneOf("bridge.coin-selection", bridge.CoinSelection, "largest-first", "branch-and-bound")
+	v.oneOf("bridge.fee-source", bridge.FeeSource, "mempool", "node", "static")
+	if bridge.FeeSource == "static" {
+		v.positive("bridge.static-fee-rate", bridge.StaticFeeRate)
+	}
+	if bridge.FeeSource == "node" {
+		v.positive("bridge.fee-conf-target", bridge.FeeConfTarget)
+	}
+	v.nonNegative("bridge.min-fee-rate", bridge.MinFeeRate)
+	v.nonNegative("bridge.max-fee-rate", bridge.MaxFeeRate)
+	if bridge.MaxFeeRate > 0 && bridge.MaxFeeRate < bridge.MinFeeRate {
+		v.addf("bridge.max-fee-rate", "%d is below min-fee-rate %d", bridge.MaxFeeRate, bridge.MinFeeRate)
+	}
+	v.nonNegative("bridge.consolidate-fee-rate", bridge.ConsolidateFeeRate)
+	if bridge.ConsolidateFeeRate > 0 {
+		v.positive("bridge.consolidate-max-inputs", int64(bridge.ConsolidateMaxInputs))
+	}
+	if bridge.FeeBumpStrategy != "" {
+		v.oneOf("bridge.fee-bump-strategy", bridge.FeeBumpStrategy, "rbf", "cpfp")
+		v.positive("bridge.stuck-tx-age", bridge.StuckTxAge)
+		v.positive("bridge.fee-bump-max-times", int64(bridge.FeeBumpMaxTimes))
+	}
+	v.positive("bridge.batch-max-outputs", int64(bridge.BatchMaxOutputs))
+	v.nonNegative("bridge.batch-max-value", bridge.BatchMaxValue)
+	v.nonNegative("bridge.batch-min-age", bridge.BatchMinAge)
+	v.nonNegative("bridge.solo-withdraw-value", bridge.SoloWithdrawValue)
+
+	risk := bridge.Risk
+	v.nonNegative("bridge.risk.max-withdraw-value", risk.MaxWithdrawValue)
+	v.nonNegative("bridge.risk.approval-threshold", risk.ApprovalThreshold)
+	if risk.MaxWithdrawValue > 0 && risk.ApprovalThreshold > risk.MaxWithdrawValue {
+		v.addf("bridge.risk.approval-threshold", "%d is above max-withdraw-value %d, no withdraw would await approval",
+			risk.ApprovalThreshold, risk.MaxWithdrawValue)
+	}
+	v.nonNegative("bridge.risk.address-hour-limit", risk.AddressHourLimit)
+	v.nonNegative("bridge.risk.address-day-limit", risk.AddressDayLimit)
+	v.nonNegative("bridge.risk.global-hour-limit", risk.GlobalHourLimit)
+	v.nonNegative("bridge.risk.global-day-limit", risk.GlobalDayLimit)
+}
+
+// Validate checks the http.toml config
+func (c *HTTPConfig) Validate() error {
+	v := newValidator(SectionHTTP, c)
+	v.port("http-port", c.HTTPPort)
+	for _, ip := range strings.Split(c.IPWhiteList, ",") {
+		if ip = strings.TrimSpace(ip); ip != "" && net.ParseIP(ip) == nil {
+			v.addf("ip-white-list", "%q is not an ip", ip)
+		}
+	}
+	for i, key := range c.SignerKeys {
+		if !rsaPublicKey(key) {
+			v.addf("signer-keys", "key %d is not a hex rsa public key", i)
+		}
+	}
+	for _, approverKey := range c.ApproverKeys {
+		name, key, ok := strings.Cut(strings.TrimSpace(approverKey), ":")
+		if !ok || name == "" || !rsaPublicKey(key) {
+			v.addf("approver-keys", "%q is not name:key with a hex rsa public key", name)
+		}
+	}
+	v.positive("signer-request-expire", c.SignerRequestExpire)
+	return v.err()
+}
+
+func rsaPublicKey(key string) bool {
+	keyByte, err := hex.DecodeString(key)
+	if err != nil {
+		return false
+	}
+	_, err = x509.ParsePKIXPublicKey(keyByte)
+	return err == nil
+}
+
+// validator collects the problems of a config section, each names the key and its env
+type validator struct {
+	section string
+	envs    map[string]string
+	errs    []error
+}
+
+func newValidator(section string, cfg interface{}) *validator {
+	envs := make(map[string]string)
+	leafFields(reflect.ValueOf(cfg).Elem(), "", func(key string, field reflect.StructField, _ reflect.Value) {
+		if env := field.Tag.Get("env"); env != "" {
+			envs[key] = env
+		}
+	})
+	return &validator{section: section, envs: envs}
+}
+
+func (v *validator) addf(key string, format string, args ...interface{}) {
+	if env, ok := v.envs[key]; ok {
+		key = fmt.Sprintf("%s (%s)", key, env)
+	}
+	v.errs = append(v.errs, fmt.Errorf("%w: %s.%s: %s", ErrInvalidConfig, v.section, key, fmt.Sprintf(format, args...)))
+}
+
+func (v *validator) err() error {
+	return errors.Join(v.errs...)
+}
+
+func (v *validator) required(key string, value string, by string) {
+	if strings.TrimSpace(value) != "" {
+		return
+	}
+	if by == "" {
+		v.addf(key, "required")
+	} else {
+		v.addf(key, "required by %s", by)
+	}
+}
+
+// url checks value is an url of schemes, empty values are left to required
+func (v *validator) url(key string, value string, schemes ...string) {
+	if value == "" {
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		v.addf(key, "%s", err)
+		return
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme && u.Host != "" {
+			return
+		}
+	}
+	v.addf(key, "%q is not an %s url", value, strings.Join(schemes, ", "))
+}
+
+func (v *validator) port(key string, value string) {
+	port, err := strconv.ParseUint(value, 10, 16)
+	if err != nil || port == 0 {
+		v.addf(key, "%q is not a port", value)
+	}
+}
+
+func (v *validator) positive(key string, value int64) {
+	if value <= 0 {
+		v.addf(key, "%d, must be positive", value)
+	}
+}
+
+func (v *validator) nonNegative(key string, value int64) {
+	if value < 0 {
+		v.addf(key, "%d, must not be negative", value)
+	}
+}
+
+func (v *validator) oneOf(key string, value string, values ...string) {
+	for _, valid := range values {
+		if value == valid {
+			return
+		}
+	}
+	v.addf(key, "%q, must be one of %s", value, strings.Join(values, ", "))
+}
+
+// ethPrivKey checks the key without ever reporting it
+func (v *validator) ethPrivKey(key string, value string, by string) {
+	if value == "" {
+		v.required(key, value, by)
+		return
+	}
+	if _, err := crypto.HexToECDSA(strings.TrimPrefix(value, "0x")); err != nil {
+		v.addf(key, "not a hex secp256k1 private key")
+	}
+}
+
+func (v *validator) ethAddress(key string, value string, by string) {
+	if value == "" {
+		v.required(key, value, by)
+		return
+	}
+	if !common.IsHexAddress(value) {
+		v.addf(key, "%q is not an eth address", value)
+	}
+}
+
+func (v *validator) hash(key string, value string, by string) {
+	if value == "" {
+		v.required(key, value, by)
+		return
+	}
+	hash := strings.TrimPrefix(value, "0x")
+	if _, err := hex.DecodeString(hash); err != nil || len(hash) != 2*common.HashLength {
+		v.addf(key, "%q is not a 32 bytes hex hash", value)
+	}
+}
@@ -0,0 +1,97 @@
+package e2e
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/b2network/b2-indexer/pkg/aa"
+)
+
+// AAStub is a local aa api resolving the l2 address of the sender of an abelian tx
+type AAStub struct {
+	server  *httptest.Server
+	network string
+
+	mu    sync.Mutex
+	users map[string]*aaUser
+	calls map[string]int
+}
+
+// aaUser is the resolution of a tx, notFound lookups answer address not found first
+type aaUser struct {
+	from     string
+	address  string
+	notFound int
+}
+
+// NewAAStub starts a stub of network, it is closed at the end of the test
+func NewAAStub(t testing.TB, network string) *AAStub {
+	s := &AAStub{
+		network: network,
+		users:   make(map[string]*aaUser),
+		calls:   make(map[string]int),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// URL returns the aa-b2-api of the stub
+func (s *AAStub) URL() string {
+	return s.server.URL
+}
+
+// Register resolves txID sent by from to address once notFound lookups answered not found
+func (s *AAStub) Register(txID, from, address string, notFound int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[txID] = &aaUser{from: from, address: address, notFound: notFound}
+}
+
+// Calls returns the number of lookups of txID
+func (s *AAStub) Calls(txID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[txID]
+}
+
+func (s *AAStub) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/api/bridge/hash" {
+		http.NotFound(w, r)
+		return
+	}
+	txID := r.URL.Query().Get("hash")
+
+	notFound, _ := strconv.Atoi(aa.AddressNotFoundErrCode)
+	s.mu.Lock()
+	s.calls[txID]++
+	user, ok := s.users[txID]
+	var resp map[string]interface{}
+	switch {
+	case !ok:
+		resp = map[string]interface{}{"code": notFound, "message": "address not found"}
+	case user.notFound > 0:
+		user.notFound--
+		resp = map[string]interface{}{
+			"code":    notFound,
+			"message": "address not found",
+			"data":    map[string]string{"from_network": s.network, "from_address": user.from},
+		}
+	default:
+		resp = map[string]interface{}{
+			"code": 0,
+			"data": map[string]string{
+				"to_address":   user.address,
+				"from_network": s.network,
+				"from_address": user.from,
+			},
+		}
+	}
+	s.mu.Unlock()
+
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,116 @@
+package e2e
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/b2network/b2-indexer/internal/migration"
+	logger "github.com/b2network/b2-indexer/pkg/log"
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// DatabaseSourceEnv is the postgres dsn the scenarios run against, sqlite when unset
+const DatabaseSourceEnv = "E2E_DATABASE_SOURCE"
+
+var gormConfig = &gorm.Config{
+	Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+}
+
+// OpenDB returns an empty db of the test migrated to the latest version: a schema of the
+// postgres of DatabaseSourceEnv or a sqlite file
+func OpenDB(t testing.TB) *gorm.DB {
+	if dsn := os.Getenv(DatabaseSourceEnv); dsn != "" {
+		return openPostgres(t, dsn)
+	}
+	return openSqlite(t)
+}
+
+func openSqlite(t testing.TB) *gorm.DB {
+	dsn := filepath.Join(t.TempDir(), "e2e.db") + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := gorm.Open(sqlite.Open(dsn), gormConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// one writer at a time, the services queue for the connection
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	migrate(t, db)
+	return db
+}
+
+// openPostgres migrates a new schema dropped at the end of the test
+func openPostgres(t testing.TB, dsn string) *gorm.DB {
+	admin, err := gorm.Open(postgres.Open(dsn), gormConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adminDB, err := admin.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = adminDB.Close() })
+
+	suffix := make([]byte, 6)
+	if _, err = rand.Read(suffix); err != nil {
+		t.Fatal(err)
+	}
+	schema := "e2e_" + hex.EncodeToString(suffix)
+	if err = admin.Exec(fmt.Sprintf("CREATE SCHEMA %s", schema)).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.Exec(fmt.Sprintf("DROP SCHEMA %s CASCADE", schema))
+	})
+
+	db, err := gorm.Open(postgres.Open(withSearchPath(dsn, schema)), gormConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	migrate(t, db)
+	return db
+}
+
+// migrate brings db to the schema version of the build
+func migrate(t testing.TB, db *gorm.DB) {
+	migrator, err := migration.New(db, logger.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = migrator.Up(0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// withSearchPath sets the search_path of a url or keyword/value dsn
+func withSearchPath(dsn, schema string) string {
+	if strings.Contains(dsn, "://") {
+		u, err := url.Parse(dsn)
+		if err == nil {
+			query := u.Query()
+			query.Set("search_path", schema)
+			u.RawQuery = query.Encode()
+			return u.String()
+		}
+	}
+	return dsn + " search_path=" + schema
+}
@@ -0,0 +1,24 @@
+package e2e_test
+
+import (
+	"testing"
+
+	"github.com/b2network/b2-indexer/internal/e2e"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScenarios(t *testing.T) {
+	if testing.Short() {
+		t.Skip("e2e scenarios skipped in short mode")
+	}
+	scenarios, err := e2e.LoadScenarios("testdata")
+	require.NoError(t, err)
+	require.NotEmpty(t, scenarios)
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.Name, func(t *testing.T) {
+			t.Parallel()
+			scenario.Run(t)
+		})
+	}
+}
@@ -0,0 +1,179 @@
+// Package e2e runs the bridge end to end: the abelian indexer, the bridge deposit
+// and the rollup listener services against a mock abec node, a simulated rollup,
+// an aa api stub and a db, driven by the yaml scenarios of testdata.
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/logic/indexer"
+	"github.com/b2network/b2-indexer/internal/logic/rollup"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/testutil/abecmock"
+	"github.com/b2network/b2-indexer/internal/testutil/evmsim"
+	"github.com/b2network/b2-indexer/internal/types"
+	"github.com/b2network/b2-indexer/pkg/event/bridge"
+	logger "github.com/b2network/b2-indexer/pkg/log"
+	"github.com/cometbft/cometbft/libs/service"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"gorm.io/gorm"
+)
+
+const (
+	Network       = "Abelian Testnetwork"
+	ListenAddress = "0xE37e799D5077682FA0a244D46E5649F71457BD09"
+
+	ServiceIndexer = "indexer"
+	ServiceDeposit = "deposit"
+	ServiceRollup  = "rollup"
+
+	// MineInterval is the block time of the simulated rollup
+	MineInterval = 50 * time.Millisecond
+)
+
+// Services are the services of a harness in start order
+var Services = []string{ServiceIndexer, ServiceDeposit, ServiceRollup}
+
+var shortenOnce sync.Once
+
+// shortenIntervals makes the service loops poll in milliseconds instead of seconds
+func shortenIntervals() {
+	shortenOnce.Do(func() {
+		indexer.NewBlockWaitTimeout = 100 * time.Millisecond
+		indexer.IndexTxTimeout = time.Millisecond
+		indexer.IndexBlockTimeout = 10 * time.Millisecond
+		indexer.BatchDepositWaitTimeout = 100 * time.Millisecond
+		indexer.HandleDepositTimeout = 10 * time.Millisecond
+		indexer.CheckDepositTimeout = 10 * time.Millisecond
+		rollup.WaitHandleTime = 100 * time.Millisecond
+	})
+}
+
+// Harness wires the services of the bridge to in-process fakes of their dependencies
+type Harness struct {
+	Node *abecmock.Node
+	Sim  *evmsim.Backend
+	AA   *AAStub
+	DB   *gorm.DB
+
+	btcIndexer types.TxIndexer
+	bridge     *indexer.Bridge
+	bitcoinCfg *config.BitcoinConfig
+	running    map[string]service.Service
+}
+
+// New returns a harness whose deposits need confirmations abelian blocks, the
+// running services are stopped at the end of the test
+func New(t testing.TB, confirmations uint64) *Harness {
+	shortenIntervals()
+	h := &Harness{
+		Node:    abecmock.New(t),
+		Sim:     evmsim.New(t),
+		AA:      NewAAStub(t, Network),
+		DB:      OpenDB(t),
+		running: make(map[string]service.Service),
+	}
+	h.bitcoinCfg = &config.BitcoinConfig{
+		NetworkName: Network,
+		RPCHost:     h.Node.URL(),
+		Bridge: config.BridgeConfig{
+			EthRPCURL:            "simulated://",
+			EthPrivKey:           h.Sim.PrivKeyHex(),
+			ContractAddress:      h.Sim.Contract.Hex(),
+			AAB2PI:               h.AA.URL(),
+			Deposit:              hexutil.Encode(bridge.MintWAbelHash),
+			Withdraw:             common.Hash{}.Hex(),
+			EnableRollupListener: true,
+		},
+	}
+	var err error
+	h.btcIndexer, err = indexer.NewAbelianIndexer(logger.NewNopLogger(), h.bitcoinCfg, ListenAddress, confirmations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.bridge, err = indexer.NewBridgeWithClient(h.Sim, h.bitcoinCfg.Bridge, t.TempDir(), logger.NewNopLogger(), Network)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the rollup listener scans from the contract deployment
+	deployed, err := h.Sim.BlockNumber(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = h.DB.Create(&model.RollupIndex{Base: model.Base{ID: 1}, B2IndexBlock: deployed}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	h.Sim.AutoCommit(MineInterval)
+	t.Cleanup(func() {
+		if err := h.Stop(h.Running()...); err != nil {
+			t.Error(err)
+		}
+	})
+	return h
+}
+
+// newService returns a new instance of the service name
+func (h *Harness) newService(name string) (service.Service, error) {
+	switch name {
+	case ServiceIndexer:
+		// the cursor of a new db starts at the first block after the genesis
+		return indexer.NewIndexerService(h.btcIndexer, h.DB, logger.NewNopLogger(), indexer.IndexStart{Height: 1}), nil
+	case ServiceDeposit:
+		return indexer.NewBridgeDepositService(h.bridge, h.btcIndexer, h.DB, logger.NewNopLogger(), h.bitcoinCfg.Bridge), nil
+	case ServiceRollup:
+		return rollup.NewRollupService(h.Sim, h.bitcoinCfg, h.DB, logger.NewNopLogger()), nil
+	}
+	return nil, fmt.Errorf("unknown service %q", name)
+}
+
+// Start starts the services names, a stopped service starts again from the db
+func (h *Harness) Start(names ...string) error {
+	for _, name := range names {
+		if _, ok := h.running[name]; ok {
+			return fmt.Errorf("service %s already running", name)
+		}
+		svc, err := h.newService(name)
+		if err != nil {
+			return err
+		}
+		if err = svc.Start(); err != nil {
+			return fmt.Errorf("start %s: %w", name, err)
+		}
+		h.running[name] = svc
+	}
+	return nil
+}
+
+// Stop stops the services names after their in-flight work
+func (h *Harness) Stop(names ...string) error {
+	for _, name := range names {
+		svc, ok := h.running[name]
+		if !ok {
+			return fmt.Errorf("service %s not running", name)
+		}
+		delete(h.running, name)
+		if err := svc.Stop(); err != nil {
+			return fmt.Errorf("stop %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Running returns the names of the running services
+func (h *Harness) Running() []string {
+	names := make([]string, 0, len(h.running))
+	for name := range h.running {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,386 @@
+package e2e
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/testutil/abecmock"
+	"github.com/ethereum/go-ethereum/common"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultFrom is the abelian sender of the deposits without from
+	DefaultFrom = "abe36f503e14f9fe13950e009d89de269031aab054223858cc4241224b95c9fd"
+	// DefaultAA is the l2 address the aa api resolves for the deposits without aa
+	DefaultAA = "0x5A0b54D5dc17e0AadC383d2db43B0a0D3E029c4c"
+
+	DefaultTimeout = 30 * time.Second
+
+	pollInterval = 50 * time.Millisecond
+)
+
+// mintUnit is the wei minted per abelian unit deposited
+var mintUnit = big.NewInt(1e11)
+
+var depositStatuses = model.DepositB2TxStatusNames
+
+var checkStatuses = map[string]int{
+	"success": model.B2CheckStatusSuccess,
+	"pending": model.B2CheckStatusPending,
+	"failed":  model.B2CheckStatusFailed,
+}
+
+// Scenario starts services, runs its steps in order and waits for the expected tables
+type Scenario struct {
+	Name string `yaml:"name"`
+	// Confirmations is the indexer-listen-target-confirmations of the deposits
+	Confirmations uint64 `yaml:"confirmations"`
+	// Services are started before the steps, all when unset
+	Services []string `yaml:"services"`
+	// Timeout bounds each wait and the final expect, DefaultTimeout when unset
+	Timeout time.Duration `yaml:"timeout"`
+	Steps   []Step        `yaml:"steps"`
+	Expect  Expect        `yaml:"expect"`
+}
+
+// Step is one action of a scenario, exactly one field is set
+type Step struct {
+	// Block mines an abelian block of deposit txs
+	Block []Deposit `yaml:"block"`
+	// Blocks mines empty abelian blocks
+	Blocks int `yaml:"blocks"`
+	// Reorg drops the abelian blocks from the height on
+	Reorg int64 `yaml:"reorg"`
+	// Start and Stop the services, a restarted service resumes from the db
+	Start []string `yaml:"start"`
+	Stop  []string `yaml:"stop"`
+	// Sleep lets the running services go on for a while
+	Sleep time.Duration `yaml:"sleep"`
+	// Wait until the tables are as expected
+	Wait *Expect `yaml:"wait"`
+}
+
+// Deposit is an abelian tx of a deposit memo to the listen address
+type Deposit struct {
+	// Tx names the tx in the expectations, a name used again is the same tx mined
+	// again, e.g. after a reorg
+	Tx    string `yaml:"tx"`
+	Value int64  `yaml:"value"`
+	// From is the abelian sender, DefaultFrom when unset
+	From string `yaml:"from"`
+	// AA is the l2 address the aa api resolves, DefaultAA when unset
+	AA string `yaml:"aa"`
+	// AANotFound lookups answer address not found before AA is resolved
+	AANotFound int `yaml:"aa_not_found"`
+}
+
+// Expect is the expected table state, unset fields are not checked
+type Expect struct {
+	// Deposits are the deposit_history rows by tx name
+	Deposits map[string]DepositState `yaml:"deposits"`
+	// RollupDeposits is the number of rollup_deposit_history rows
+	RollupDeposits *int `yaml:"rollup_deposits"`
+	// Minted is the wABEL balance of l2 addresses in abelian units
+	Minted map[string]int64 `yaml:"minted"`
+	// IndexBlock is the last abelian block of the btc_index cursor
+	IndexBlock *int64 `yaml:"index_block"`
+}
+
+// DepositState is the expected deposit_history row of a tx
+type DepositState struct {
+	// Absent expects no row
+	Absent bool `yaml:"absent"`
+	// B2TxStatus and B2TxCheck are status names, e.g. success or pending
+	B2TxStatus     string `yaml:"b2_tx_status"`
+	B2TxCheck      string `yaml:"b2_tx_check"`
+	B2TxRetry      *int   `yaml:"b2_tx_retry"`
+	BtcBlockNumber *int64 `yaml:"btc_block_number"`
+	BtcValue       *int64 `yaml:"btc_value"`
+	// AACalls is the number of aa api lookups of the tx
+	AACalls *int `yaml:"aa_calls"`
+}
+
+// LoadScenarios reads the *.yaml scenarios of dir by file name
+func LoadScenarios(dir string) ([]*Scenario, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	scenarios := make([]*Scenario, 0, len(files))
+	for _, file := range files {
+		scenario, err := LoadScenario(file)
+		if err != nil {
+			return nil, err
+		}
+		scenarios = append(scenarios, scenario)
+	}
+	return scenarios, nil
+}
+
+// LoadScenario reads a yaml scenario, the name defaults to the file name
+func LoadScenario(file string) (*Scenario, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	var scenario Scenario
+	if err = decoder.Decode(&scenario); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if scenario.Name == "" {
+		scenario.Name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+	if err = scenario.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return &scenario, nil
+}
+
+// validate checks the steps and the status names before anything runs
+func (s *Scenario) validate() error {
+	if s.Services == nil {
+		s.Services = Services
+	}
+	if s.Timeout == 0 {
+		s.Timeout = DefaultTimeout
+	}
+	txs := make(map[string]bool)
+	for i, step := range s.Steps {
+		set := 0
+		for _, isSet := range []bool{
+			step.Block != nil, step.Blocks != 0, step.Reorg != 0, step.Start != nil,
+			step.Stop != nil, step.Sleep != 0, step.Wait != nil,
+		} {
+			if isSet {
+				set++
+			}
+		}
+		if set != 1 {
+			return fmt.Errorf("step %d: %d actions, expected one", i+1, set)
+		}
+		for _, deposit := range step.Block {
+			if deposit.Tx == "" {
+				return fmt.Errorf("step %d: deposit without tx name", i+1)
+			}
+			txs[deposit.Tx] = true
+		}
+		if step.Wait != nil {
+			if err := step.Wait.validate(txs); err != nil {
+				return fmt.Errorf("step %d: %w", i+1, err)
+			}
+		}
+	}
+	return s.Expect.validate(txs)
+}
+
+func (e *Expect) validate(txs map[string]bool) error {
+	for tx, state := range e.Deposits {
+		if !txs[tx] {
+			return fmt.Errorf("expect of unknown deposit tx %q", tx)
+		}
+		if _, ok := depositStatuses[state.B2TxStatus]; state.B2TxStatus != "" && !ok {
+			return fmt.Errorf("unknown b2_tx_status %q", state.B2TxStatus)
+		}
+		if _, ok := checkStatuses[state.B2TxCheck]; state.B2TxCheck != "" && !ok {
+			return fmt.Errorf("unknown b2_tx_check %q", state.B2TxCheck)
+		}
+	}
+	for address := range e.Minted {
+		if !common.IsHexAddress(address) {
+			return fmt.Errorf("minted of invalid address %q", address)
+		}
+	}
+	return nil
+}
+
+// Run runs the scenario on a new harness
+func (s *Scenario) Run(t *testing.T) {
+	r := &runner{scenario: s, harness: New(t, s.Confirmations)}
+	if err := r.harness.Start(s.Services...); err != nil {
+		t.Fatal(err)
+	}
+	for i, step := range s.Steps {
+		if err := r.step(step); err != nil {
+			t.Fatalf("step %d: %v", i+1, err)
+		}
+	}
+	if err := r.wait(s.Expect); err != nil {
+		t.Fatalf("expect: %v", err)
+	}
+}
+
+type runner struct {
+	scenario *Scenario
+	harness  *Harness
+}
+
+// txID is the abelian tx id of the tx name
+func txID(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:])
+}
+
+func (r *runner) step(step Step) error {
+	h := r.harness
+	switch {
+	case step.Block != nil:
+		txs := make([]abecmock.Tx, 0, len(step.Block))
+		for _, deposit := range step.Block {
+			from, aa := deposit.From, deposit.AA
+			if from == "" {
+				from = DefaultFrom
+			}
+			if aa == "" {
+				aa = DefaultAA
+			}
+			id := txID(deposit.Tx)
+			h.AA.Register(id, from, aa, deposit.AANotFound)
+			txs = append(txs, abecmock.Tx{
+				TxID: id,
+				Memo: abecmock.DepositMemo(from, ListenAddress, aa, deposit.Value),
+			})
+		}
+		h.Node.AddBlock(txs...)
+	case step.Blocks != 0:
+		h.Node.AddBlocks(step.Blocks)
+	case step.Reorg != 0:
+		h.Node.Reorg(step.Reorg)
+	case step.Start != nil:
+		return h.Start(step.Start...)
+	case step.Stop != nil:
+		return h.Stop(step.Stop...)
+	case step.Sleep != 0:
+		time.Sleep(step.Sleep)
+	case step.Wait != nil:
+		return r.wait(*step.Wait)
+	}
+	return nil
+}
+
+// wait polls the tables until they are as expected or the scenario timeout
+func (r *runner) wait(expect Expect) error {
+	deadline := time.Now().Add(r.scenario.Timeout)
+	for {
+		mismatches, err := r.check(expect)
+		if err != nil {
+			return err
+		}
+		if len(mismatches) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("not reached in %s: %s", r.scenario.Timeout, strings.Join(mismatches, "; "))
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// check returns how the tables differ from expect
+func (r *runner) check(expect Expect) ([]string, error) {
+	h := r.harness
+	var mismatches []string
+	mismatch := func(format string, args ...interface{}) {
+		mismatches = append(mismatches, fmt.Sprintf(format, args...))
+	}
+
+	names := make([]string, 0, len(expect.Deposits))
+	for name := range expect.Deposits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		want := expect.Deposits[name]
+		var deposit model.Deposit
+		err := h.DB.Where(fmt.Sprintf("%s = ?", model.Deposit{}.Column().BtcTxHash), txID(name)).First(&deposit).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if !want.Absent {
+				mismatch("deposit %s not indexed", name)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if want.Absent {
+			mismatch("deposit %s indexed", name)
+			continue
+		}
+		if status, ok := depositStatuses[want.B2TxStatus]; ok && deposit.B2TxStatus != status {
+			mismatch("deposit %s b2_tx_status %s, expected %s", name, statusName(depositStatuses, deposit.B2TxStatus), want.B2TxStatus)
+		}
+		if check, ok := checkStatuses[want.B2TxCheck]; ok && deposit.B2TxCheck != check {
+			mismatch("deposit %s b2_tx_check %s, expected %s", name, statusName(checkStatuses, deposit.B2TxCheck), want.B2TxCheck)
+		}
+		if want.B2TxRetry != nil && deposit.B2TxRetry != *want.B2TxRetry {
+			mismatch("deposit %s b2_tx_retry %d, expected %d", name, deposit.B2TxRetry, *want.B2TxRetry)
+		}
+		if want.BtcBlockNumber != nil && deposit.BtcBlockNumber != *want.BtcBlockNumber {
+			mismatch("deposit %s btc_block_number %d, expected %d", name, deposit.BtcBlockNumber, *want.BtcBlockNumber)
+		}
+		if want.BtcValue != nil && deposit.BtcValue != *want.BtcValue {
+			mismatch("deposit %s btc_value %d, expected %d", name, deposit.BtcValue, *want.BtcValue)
+		}
+		if want.AACalls != nil && h.AA.Calls(txID(name)) != *want.AACalls {
+			mismatch("deposit %s aa lookups %d, expected %d", name, h.AA.Calls(txID(name)), *want.AACalls)
+		}
+	}
+
+	if expect.RollupDeposits != nil {
+		var count int64
+		if err := h.DB.Model(&model.RollupDeposit{}).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count != int64(*expect.RollupDeposits) {
+			mismatch("%d rollup deposits, expected %d", count, *expect.RollupDeposits)
+		}
+	}
+
+	for address, want := range expect.Minted {
+		balance, err := h.Sim.BalanceAt(context.Background(), common.HexToAddress(address), nil)
+		if err != nil {
+			return nil, err
+		}
+		minted := new(big.Int).Div(balance, mintUnit)
+		if minted.Cmp(big.NewInt(want)) != 0 {
+			mismatch("minted %s to %s, expected %d", minted, address, want)
+		}
+	}
+
+	if expect.IndexBlock != nil {
+		var btcIndex model.BtcIndex
+		err := h.DB.First(&btcIndex, 1).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if btcIndex.BtcIndexBlock != *expect.IndexBlock {
+			mismatch("index block %d, expected %d", btcIndex.BtcIndexBlock, *expect.IndexBlock)
+		}
+	}
+	return mismatches, nil
+}
+
+func statusName(statuses map[string]int, status int) string {
+	for name, value := range statuses {
+		if value == status {
+			return name
+		}
+	}
+	return fmt.Sprintf("%d", status)
+}
@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"context"
+	"strings"
+
+	"github.com/b2network/b2-indexer/internal/logic/admin"
+	"github.com/b2network/b2-indexer/internal/logic/indexer"
+	"github.com/b2network/b2-indexer/internal/model"
+	logger "github.com/b2network/b2-indexer/pkg/log"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/spf13/cobra"
+)
+
+func newAdmin(ctx *model.Context, cmd *cobra.Command) (*admin.Admin, error) {
+	db, err := GetDBContextFromCmd(cmd)
+	if err != nil {
+		logger.Errorw("failed to get db context", "error", err.Error())
+		return nil, err
+	}
+	if err = checkSchema(ctx, db); err != nil {
+		return nil, err
+	}
+	return admin.NewAdmin(db, newLogger(ctx, "[admin]")), nil
+}
+
+// HandleDepositShowCmd prints the deposits of an abelian tx with their mints and audits
+func HandleDepositShowCmd(ctx *model.Context, cmd *cobra.Command, txHash string) error {
+	a, err := newAdmin(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	detail, err := a.Deposit(txHash)
+	if err != nil {
+		return err
+	}
+	return printJSON(cmd, detail)
+}
+
+// HandleDepositListCmd prints the latest deposits of filter
+func HandleDepositListCmd(ctx *model.Context, cmd *cobra.Command, filter admin.DepositFilter) error {
+	a, err := newAdmin(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	deposits, err := a.Deposits(filter)
+	if err != nil {
+		return err
+	}
+	return printJSON(cmd, deposits)
+}
+
+// HandleDepositRetryCmd puts a deposit back to pending for the deposit service to mint it again,
+// its recorded mint tx is checked on l2 first
+func HandleDepositRetryCmd(ctx *model.Context, cmd *cobra.Command, txHash string, output int64, change admin.Change) error {
+	a, err := newAdmin(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	client, err := indexer.DialEthClient(ctx.BitcoinConfig.Bridge.EthRPCURL)
+	if err != nil {
+		logger.Errorw("failed to dial eth rpc", "error", err.Error())
+		return err
+	}
+	defer client.Close()
+	deposit, err := a.RetryDeposit(context.Background(), client, txHash, output, change)
+	if err != nil {
+		return err
+	}
+	return printJSON(cmd, deposit)
+}
+
+// HandleDepositResolveCmd marks a deposit resolved, or minted by the l2 tx b2TxHash
+func HandleDepositResolveCmd(ctx *model.Context, cmd *cobra.Command, txHash string, output int64, b2TxHash string, change admin.Change) error {
+	a, err := newAdmin(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	deposit, err := a.ResolveDeposit(txHash, output, b2TxHash, change)
+	if err != nil {
+		return err
+	}
+	return printJSON(cmd, deposit)
+}
+
+// HandleIndexSetCursorCmd moves the abelian index cursor, checked against the abelian tip
+func HandleIndexSetCursorCmd(ctx *model.Context, cmd *cobra.Command, height int64, txIndex int64, change admin.Change) error {
+	a, err := newAdmin(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	bitcoinCfg := ctx.BitcoinConfig
+	bidxer, err := indexer.NewAbelianIndexer(newLogger(ctx, "[admin]"), bitcoinCfg, bitcoinCfg.IndexerListenAddress, bitcoinCfg.IndexerListenTargetConfirmations)
+	if err != nil {
+		logger.Errorw("failed to new bitcoin indexer indexer", "error", err.Error())
+		return err
+	}
+	tip, err := bidxer.LatestBlock()
+	if err != nil {
+		logger.Errorw("failed to get latest block", "error", err.Error())
+		return err
+	}
+	btcIndex, err := a.SetCursor(height, txIndex, tip, change)
+	if err != nil {
+		return err
+	}
+	return printJSON(cmd, btcIndex)
+}
+
+// HandleWithdrawShowCmd prints a withdraw of an id or b2 tx hash with its abelian txs and signatures
+func HandleWithdrawShowCmd(ctx *model.Context, cmd *cobra.Command, idOrB2TxHash string) error {
+	a, err := newAdmin(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	detail, err := a.Withdraw(idOrB2TxHash)
+	if err != nil {
+		return err
+	}
+	return printJSON(cmd, detail)
+}
+
+// HandleWithdrawRefundCmd marks a risk rejected withdraw as refunded by an l2 tx
+func HandleWithdrawRefundCmd(ctx *model.Context, cmd *cobra.Command, idOrB2TxHash string, refundTxHash string, change admin.Change) error {
+	a, err := newAdmin(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	withdraw, err := a.RefundWithdraw(idOrB2TxHash, refundTxHash, change)
+	if err != nil {
+		return err
+	}
+	return printJSON(cmd, withdraw)
+}
+
+// HandleWalletStatusCmd prints the l2 balance, nonces and in-flight deposits of the bridge eth-priv-key wallet
+func HandleWalletStatusCmd(ctx *model.Context, cmd *cobra.Command) error {
+	a, err := newAdmin(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	bridgeCfg := ctx.BitcoinConfig.Bridge
+	privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(bridgeCfg.EthPrivKey, "0x"))
+	if err != nil {
+		return err
+	}
+	client, err := indexer.DialEthClient(bridgeCfg.EthRPCURL)
+	if err != nil {
+		logger.Errorw("failed to dial eth rpc", "error", err.Error())
+		return err
+	}
+	defer client.Close()
+	status, err := a.WalletStatus(context.Background(), client, crypto.PubkeyToAddress(privateKey.PublicKey))
+	if err != nil {
+		return err
+	}
+	return printJSON(cmd, status)
+}
+
+// HandleAuditListCmd prints the latest admin audits of filter
+func HandleAuditListCmd(ctx *model.Context, cmd *cobra.Command, filter admin.AuditFilter) error {
+	a, err := newAdmin(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	audits, err := a.Audits(filter)
+	if err != nil {
+		return err
+	}
+	return printJSON(cmd, audits)
+}
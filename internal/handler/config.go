@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// HandleConfigInitCmd writes the commented config file of profile to home
+func HandleConfigInitCmd(cmd *cobra.Command, home string, profile string, force bool) error {
+	configFile := path.Join(home, config.ConfigFileName)
+	flag := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	file, err := os.OpenFile(configFile, flag, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s exists, --force overwrites it", configFile)
+	}
+	if err != nil {
+		return err
+	}
+	if err = config.WriteTemplate(file, profile); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	cmd.Printf("wrote %s\n", configFile)
+	return nil
+}
+
+// HandleConfigShowCmd prints the effective config of home with the secrets redacted
+func HandleConfigShowCmd(cmd *cobra.Command, home string, flags ConfigFlags) error {
+	appCfg, err := config.Load(home, flags.Profile, flags.Set)
+	if err != nil {
+		return err
+	}
+	return printJSON(cmd, appCfg.Redacted())
+}
+
+// HandleConfigValidateCmd checks the configs of home without connecting to the db
+// or the nodes, every problem is printed
+func HandleConfigValidateCmd(cmd *cobra.Command, home string, flags ConfigFlags) error {
+	appCfg, err := config.Load(home, flags.Profile, flags.Set)
+	if err != nil {
+		return err
+	}
+	if err = appCfg.Validate(); err != nil {
+		return err
+	}
+	cmd.Println("config ok")
+	return nil
+}
+
+// HandleConfigEncryptCmd prints the enc: config value of a secret read from the terminal
+// or stdin, encrypted with the key of INDEXER_SECRET_KEY or INDEXER_SECRET_KEY_FILE
+func HandleConfigEncryptCmd(cmd *cobra.Command) error {
+	key, err := config.SecretKey()
+	if err != nil {
+		return err
+	}
+	var secret []byte
+	if term.IsTerminal(syscall.Stdin) {
+		fmt.Fprint(cmd.ErrOrStderr(), "Enter secret: ")
+		secret, err = term.ReadPassword(syscall.Stdin)
+		fmt.Fprintln(cmd.ErrOrStderr())
+	} else {
+		secret, err = io.ReadAll(cmd.InOrStdin())
+	}
+	if err != nil {
+		return err
+	}
+	value := strings.TrimRight(string(secret), "\r\n")
+	if value == "" {
+		return errors.New("empty secret")
+	}
+	encrypted, err := config.EncryptSecret(value, key)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), encrypted)
+	return nil
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/logic/indexer"
+	"github.com/b2network/b2-indexer/internal/logic/reserves"
+	"github.com/b2network/b2-indexer/internal/logic/risk"
+	"github.com/b2network/b2-indexer/internal/logic/webhook"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/server"
+	logger "github.com/b2network/b2-indexer/pkg/log"
+	"github.com/spf13/cobra"
+)
+
+func HandleHTTPCmd(ctx *model.Context, cmd *cobra.Command) error {
+	db, err := GetDBContextFromCmd(cmd)
+	if err != nil {
+		logger.Errorw("failed to get db context", "error", err.Error())
+		return err
+	}
+	if err = checkSchema(ctx, db); err != nil {
+		return err
+	}
+	httpLogger := newLogger(ctx, "[http-server]")
+	signer, err := indexer.NewWithdrawSigner(ctx.BitcoinConfig, db, httpLogger)
+	if err != nil {
+		logger.Errorw("failed to create withdraw signer", "error", err.Error())
+		return err
+	}
+
+	riskEngine := risk.NewEngine(ctx.BitcoinConfig.Bridge.Risk, config.ChainParams(ctx.BitcoinConfig.NetworkName), db, httpLogger)
+
+	reporter, err := newReserveReporter(ctx, db, httpLogger)
+	if errors.Is(err, reserves.ErrNoSignerKey) {
+		httpLogger.Infow("no proof-of-reserves report without bridge.reserves.signer-key")
+	} else if err != nil {
+		logger.Errorw("failed to create reserves reporter", "error", err.Error())
+		return err
+	}
+
+	httpServer := server.NewServer(ctx.HTTPConfig, signer, riskEngine, webhook.NewManager(db), reporter, httpLogger)
+	if err = httpServer.Start(); err != nil {
+		logger.Errorw("failed to start http server", "error", err.Error())
+		return err
+	}
+	defer func() {
+		if err := httpServer.Stop(); err != nil {
+			logger.Errorf("stop err:%v", err.Error())
+		}
+	}()
+
+	// wait quit
+	code := WaitForQuitSignals()
+	logger.Infow("http server stop!!!", "quit code", code)
+	return nil
+}
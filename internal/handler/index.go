@@ -8,11 +8,21 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/health"
+	"github.com/b2network/b2-indexer/internal/leader"
 	"github.com/b2network/b2-indexer/internal/logic/indexer"
+	"github.com/b2network/b2-indexer/internal/logic/reconcile"
+	"github.com/b2network/b2-indexer/internal/logic/rollup"
+	"github.com/b2network/b2-indexer/internal/logic/webhook"
+	"github.com/b2network/b2-indexer/internal/metrics"
 	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/outbox"
+	"github.com/b2network/b2-indexer/internal/supervisor"
 	"github.com/b2network/b2-indexer/internal/types"
 	logger "github.com/b2network/b2-indexer/pkg/log"
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/cometbft/cometbft/libs/service"
+	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/spf13/cobra"
 	"gorm.io/gorm"
 )
@@ -20,162 +30,169 @@ import (
 func HandleIndexCmd(ctx *model.Context, cmd *cobra.Command) (err error) {
 	//home := ctx.Config.RootDir
 	bitcoinCfg := ctx.BitcoinConfig
-	context, cancel := osContext.WithCancel(osContext.Background())
-	defer cancel()
+	checker := health.NewChecker(time.Duration(ctx.Config.HealthStalledThreshold)*time.Second, ctx.Config.HealthReadyLag)
+	db, err := GetDBContextFromCmd(cmd)
+	if err != nil {
+		logger.Errorw("failed to get db context", "error", err.Error())
+		return err
+	}
+	if err = checkSchema(ctx, db); err != nil {
+		return err
+	}
+	checker.AddCheck("db", health.DBCheck(db))
+
+	sup := supervisor.New(newLogger(ctx, "[supervisor]"))
 	if bitcoinCfg.EnableIndexer {
-		err = runIndexerService(ctx, cmd, context)
+		err = addIndexerServices(ctx, sup, checker, db)
 		if err != nil {
 			return err
 		}
 	}
+	if bitcoinCfg.Bridge.EnableRollupListener {
+		ethCli, err := ethclient.Dial(bitcoinCfg.Bridge.EthRPCURL)
+		if err != nil {
+			logger.Errorw("failed to create eth client", "error", err.Error())
+			return err
+		}
+		defer ethCli.Close()
+		addRollupListenerService(ctx, sup, checker, db, ethCli)
+	}
+	if bitcoinCfg.Bridge.EnableWithdrawListener {
+		closeClients, err := addWithdrawService(ctx, sup, checker, db)
+		if err != nil {
+			return err
+		}
+		defer closeClients()
+	}
+	if ctx.Config.Outbox.EnableRelay {
+		closeSink, err := addOutboxRelayService(ctx, sup, checker, db)
+		if err != nil {
+			return err
+		}
+		defer closeSink()
+	}
+	if ctx.Config.Webhook.EnableDispatcher {
+		addWebhookDispatcherService(ctx, sup, checker, db)
+	}
+	if ctx.Config.Reconcile.EnableJob {
+		addReconcileService(ctx, sup, checker, db)
+	}
 
-	//if bitcoinCfg.Bridge.EnableRollupListener {
-	//	err = runRollupListenerService(ctx, cmd)
-	//	if err != nil {
-	//		return err
-	//	}
-	//}
-
-	//if bitcoinCfg.Bridge.EnableWithdrawListener {
-	//	err = runWithDrawService(ctx, cmd)
-	//	if err != nil {
-	//		return err
-	//	}
-	//}
-
-	// wait quit
-	code := WaitForQuitSignals()
-	logger.Infow("server stop!!!", "quit code", code)
-	return nil
-}
-
-func runIndexerService(ctx *model.Context, cmd *cobra.Command, context osContext.Context) error {
-	//home := ctx.Config.RootDir
-	bitcoinCfg := ctx.BitcoinConfig
-	logger.Infow("bitcoin index service starting!!!")
-
-	bidxLogger := newLogger(ctx, "[bitcoin-indexer]")
-	//bidxer, err := indexer.NewBitcoinIndexer(bidxLogger, ctx, bitcoinCfg.IndexerListenAddress, bitcoinCfg.IndexerListenTargetConfirmations)
-
-	bidxer, err := indexer.NewAbelianIndexer(bidxLogger, bitcoinCfg, bitcoinCfg.IndexerListenAddress, bitcoinCfg.IndexerListenTargetConfirmations)
-	if err != nil {
-		logger.Errorw("failed to new bitcoin indexer indexer", "error", err.Error())
+	// the probes are served with or without the metrics
+	metricsServer := metrics.NewServer(ctx.Config.MetricsPort, ctx.Config.EnableMetrics, newLogger(ctx, "[metrics-server]"))
+	metricsServer.Handle("/healthz", checker.HealthzHandler())
+	metricsServer.Handle("/readyz", checker.ReadyzHandler())
+	if err = metricsServer.Start(); err != nil {
+		logger.Errorw("failed to start metrics server", "error", err.Error())
 		return err
 	}
-
 	defer func() {
-		bidxer.Stop()
+		if err := metricsServer.Stop(); err != nil {
+			logger.Errorf("stop err:%v", err.Error())
+		}
 	}()
 
-	//go func() {
-	err = startIndexProvider(bidxer, bidxLogger, cmd)
-	if err != nil {
-		return err
-	}
-	//}()
-
-	<-time.After(2 * time.Second) // assume server started successfully
-
-	if bidxer == nil {
-		return fmt.Errorf("failed to new bitcoin indexer indexer:%v", err.Error())
+	// with leader election only the leader runs the services
+	var writers service.Service = sup
+	if ctx.Config.EnableLeaderElection {
+		writers, err = newLeaderElector(ctx, sup, checker, db)
+		if err != nil {
+			return err
+		}
 	}
-
-	// start l1->l2 bridge service
-	//go func() {
-	err = startBridgeProvider(ctx, bitcoinCfg, context, bidxer, cmd)
-	if err != nil {
+	if err = writers.Start(); err != nil {
+		logger.Errorw("failed to start services", "error", err.Error())
 		return err
 	}
-	//}()
 
-	<-context.Done()
+	// wait quit
+	code := WaitForQuitSignals()
+	logger.Infow("server stop!!!", "quit code", code)
+	// stop the services, in-flight db writes and l2 sends finish first
+	if err = writers.Stop(); err != nil {
+		logger.Errorf("stop err:%v", err.Error())
+	}
 	return nil
 }
 
-func startBridgeProvider(ctx *model.Context, bitcoinCfg *config.BitcoinConfig, context osContext.Context, bidxer types.BitcoinTxIndexer, cmd *cobra.Command) error {
-	home := ctx.Config.RootDir
-	//bitcoinParam := config.ChainParams(bitcoinCfg.NetworkName)
-	db, err := GetDBContextFromCmd(cmd)
-	if err != nil {
-		logger.Errorw("failed to get db context", "error", err.Error())
-		return err
-	}
-	bridgeLogger := newLogger(ctx, "[bridge-deposit]")
-	bridge, err := indexer.NewBridge(bitcoinCfg.Bridge, home, bridgeLogger, bitcoinCfg.NetworkName)
-	if err != nil {
-		logger.Errorw("failed to create bitcoin bridge", "error", err.Error())
-		return err
+// newLeaderElector returns an elector running the supervised services while this replica holds
+// the leader lease, writes on db are fenced by the lease token
+func newLeaderElector(ctx *model.Context, sup *supervisor.Supervisor, checker *health.Checker, db *gorm.DB) (*leader.Elector, error) {
+	if ctx.Config.LeaderLeaseTTL <= 0 {
+		return nil, fmt.Errorf("invalid leader lease ttl: %d", ctx.Config.LeaderLeaseTTL)
 	}
-
-	bridgeService := indexer.NewBridgeDepositService(bridge, bidxer, db, bridgeLogger, bitcoinCfg.Bridge)
-	bridgeErrCh := make(chan error)
-	go func() {
-		if err := bridgeService.Start(); err != nil {
-			bridgeErrCh <- err
-			//return err
+	holder := ctx.Config.LeaderID
+	if holder == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			logger.Errorw("failed to get hostname", "error", err.Error())
+			return nil, err
 		}
-	}()
-
-	select {
-	case err := <-bridgeErrCh:
-		return err
-	case <-context.Done():
-
+		holder = hostname
 	}
-
-	defer func() {
-		if err = bridgeService.Stop(); err != nil {
+	fence := leader.NewFence(leader.LeaseName, holder)
+	if err := db.Use(fence); err != nil {
+		logger.Errorw("failed to register leader fence", "error", err.Error())
+		return nil, err
+	}
+	checker.SetLeader(fence)
+	demoted := func() {
+		if err := sup.Stop(); err != nil {
 			logger.Errorf("stop err:%v", err.Error())
 		}
-	}()
-
-	return nil
+		if err := sup.Reset(); err != nil {
+			logger.Errorf("reset err:%v", err.Error())
+		}
+	}
+	ttl := time.Duration(ctx.Config.LeaderLeaseTTL) * time.Second
+	return leader.NewElector(db, fence, ttl, sup.Start, demoted, newLogger(ctx, "[leader]")), nil
 }
 
-func startIndexProvider(bidxer types.BitcoinTxIndexer, bidxLogger logger.Logger, cmd *cobra.Command) error {
-
-	//bitcoinParam := config.ChainParams(bitcoinCfg.NetworkName)
-	//bidxLogger := newLogger(ctx, "[bitcoin-indexer]")
-	//bidxer, err := indexer.NewBitcoinIndexer(bidxLogger, bclient, bitcoinParam, bitcoinCfg.IndexerListenAddress, bitcoinCfg.IndexerListenTargetConfirmations)
-	//if err != nil {
-	//	logger.Errorw("failed to new bitcoin indexer indexer", "error", err.Error())
-	//	return nil, err
-	//}
-	// check bitcoin core status, whether the request succeed
-	_, err := bidxer.BlockChainInfo()
+// addIndexerServices supervises the abelian indexer and the l1->l2 bridge deposit services
+func addIndexerServices(ctx *model.Context, sup *supervisor.Supervisor, checker *health.Checker, db *gorm.DB) error {
+	home := ctx.Config.RootDir
+	bitcoinCfg := ctx.BitcoinConfig
+	bidxLogger := newLogger(ctx, "[bitcoin-indexer]")
+	//bidxer, err := indexer.NewBitcoinIndexer(bidxLogger, ctx, bitcoinCfg.IndexerListenAddress, bitcoinCfg.IndexerListenTargetConfirmations)
+	bidxer, err := indexer.NewAbelianIndexer(bidxLogger, bitcoinCfg, bitcoinCfg.IndexerListenAddress, bitcoinCfg.IndexerListenTargetConfirmations)
 	if err != nil {
-		logger.Errorw("failed to get bitcoin core status", "error", err.Error())
+		logger.Errorw("failed to new bitcoin indexer indexer", "error", err.Error())
 		return err
 	}
-
-	db, err := GetDBContextFromCmd(cmd)
+	indexStart, err := indexer.ParseIndexStart(bitcoinCfg)
 	if err != nil {
-		logger.Errorw("failed to get db context", "error", err.Error())
+		logger.Errorw("failed to parse indexer start", "error", err.Error())
 		return err
 	}
-
-	bindexerService := indexer.NewIndexerService(bidxer, db, bidxLogger)
-
-	err = bindexerService.CheckDb()
-	if err != nil {
-		logger.Errorw("failed to get db context", "error", err.Error())
+	checker.AddCheck("abec", func(osContext.Context) error {
+		_, err := bidxer.LatestBlock()
 		return err
-	}
+	})
 
-	errCh := make(chan error)
-	go func() {
-		if err := bindexerService.Start(); err != nil {
-			if err != nil {
-				errCh <- err
-			}
+	indexerEntry := sup.Add(indexer.ServiceName, func() (supervisor.Service, error) {
+		// check bitcoin core status, whether the request succeed
+		if _, err := bidxer.BlockChainInfo(); err != nil {
+			logger.Errorw("failed to get bitcoin core status", "error", err.Error())
+			return nil, err
 		}
-	}()
+		return indexer.NewIndexerService(bidxer, db, bidxLogger, indexStart), nil
+	})
+	checker.AddService(indexerEntry)
+	checker.AddIndex()
 
-	select {
-	case err := <-errCh:
+	// start l1->l2 bridge service
+	bridgeLogger := newLogger(ctx, "[bridge-deposit]")
+	bridge, err := indexer.NewBridge(bitcoinCfg.Bridge, home, bridgeLogger, bitcoinCfg.NetworkName)
+	if err != nil {
+		logger.Errorw("failed to create bitcoin bridge", "error", err.Error())
 		return err
-	case <-time.After(5 * time.Second): // assume server started successfully
 	}
+	checker.AddCheck("evm", bridge.Ping)
+	bridgeEntry := sup.Add(indexer.BridgeDepositServiceName, func() (supervisor.Service, error) {
+		return indexer.NewBridgeDepositService(bridge, bidxer, db, bridgeLogger, bitcoinCfg.Bridge), nil
+	})
+	checker.AddService(bridgeEntry)
+	checker.AddComponent(health.ComponentBridgeDeposit)
 	return nil
 }
 
@@ -213,110 +230,86 @@ func runEpsService(ctx *model.Context, cmd *cobra.Command) error {
 	return nil
 }
 
-func runRollupListenerService(ctx *model.Context, cmd *cobra.Command) error {
-	//	logger.Infow("rollup indexer service starting...")
-	//	db, err := GetDBContextFromCmd(cmd)
-	//	if err != nil {
-	//		logger.Errorw("failed to get db context", "error", err.Error())
-	//		return err
-	//	}
-	//
-	//	//btclient, err := rpcclient.New(&rpcclient.ConnConfig{
-	//	//	Host:         bitcoinCfg.RPCHost + ":" + bitcoinCfg.RPCPort,
-	//	//	User:         bitcoinCfg.RPCUser,
-	//	//	Pass:         bitcoinCfg.RPCPass,
-	//	//	HTTPPostMode: true, // Bitcoin core only supports HTTP POST mode
-	//	//	DisableTLS:   true, // Bitcoin core does not provide TLS by default
-	//	//}, nil)
-	//	//if err != nil {
-	//	//	logger.Errorw("EVMListenerService failed to create bitcoin client", "error", err.Error())
-	//	//	return err
-	//	//}
-	//	//defer func() {
-	//	//	btclient.Shutdown()
-	//	//}()
-	//
-	//	ethlient, err := ethclient.Dial(bitcoinCfg.Bridge.EthRPCURL)
-	//	if err != nil {
-	//		logger.Errorw("EVMListenerService failed to create eth client", "error", err.Error())
-	//		return err
-	//	}
-	//	defer func() {
-	//		ethlient.Close()
-	//	}()
-	//
-	//	rollupLogger := newLogger(ctx, "[rollup-service]")
-	//	if err != nil {
-	//		return err
-	//	}
-	//	rollupService := rollup.NewIndexerService(ethlient, bitcoinCfg, db, rollupLogger)
-	//
-	//	epsErrCh := make(chan error)
-	//	go func() {
-	//		if err := rollupService.OnStart(); err != nil {
-	//			epsErrCh <- err
-	//		}
-	//	}()
-	//
-	//	select {
-	//	case err := <-epsErrCh:
-	//		return err
-	//	case <-time.After(5 * time.Second): // assume server started successfully
-	//	}
-	return nil
+// addRollupListenerService supervises the rollup deposit event indexer
+func addRollupListenerService(ctx *model.Context, sup *supervisor.Supervisor, checker *health.Checker, db *gorm.DB, ethCli *ethclient.Client) {
+	rollupLogger := newLogger(ctx, "[rollup-service]")
+	rollupEntry := sup.Add(rollup.IndexerServiceName, func() (supervisor.Service, error) {
+		return rollup.NewRollupService(ethCli, ctx.BitcoinConfig, db, rollupLogger), nil
+	})
+	checker.AddService(rollupEntry)
 }
 
-func runWithDrawService(ctx *model.Context, cmd *cobra.Command) error {
-	//	logger.Infow("withdraw service starting...")
-	//	db, err := GetDBContextFromCmd(cmd)
-	//	if err != nil {
-	//		logger.Errorw("failed to get db context", "error", err.Error())
-	//		return err
-	//	}
-	//
-	//	btclient, err := rpcclient.New(&rpcclient.ConnConfig{
-	//		Host:         bitcoinCfg.RPCHost + ":" + bitcoinCfg.RPCPort,
-	//		User:         bitcoinCfg.RPCUser,
-	//		Pass:         bitcoinCfg.RPCPass,
-	//		HTTPPostMode: true, // Bitcoin core only supports HTTP POST mode
-	//		DisableTLS:   true, // Bitcoin core does not provide TLS by default
-	//	}, nil)
-	//	if err != nil {
-	//		logger.Errorw("EVMListenerService failed to create bitcoin client", "error", err.Error())
-	//		return err
-	//	}
-	//	defer func() {
-	//		btclient.Shutdown()
-	//	}()
-	//
-	//	ethlient, err := ethclient.Dial(bitcoinCfg.Bridge.EthRPCURL)
-	//	if err != nil {
-	//		logger.Errorw("EVMListenerService failed to create eth client", "error", err.Error())
-	//		return err
-	//	}
-	//	defer func() {
-	//		ethlient.Close()
-	//	}()
-	//
-	//	bridgeLogger := newLogger(ctx, "[bridge-withdraw]")
-	//	if err != nil {
-	//		return err
-	//	}
-	//	withdrawService := bitcoin.NewBridgeWithdrawService(btclient, ethlient, bitcoinCfg, db, bridgeLogger)
-	//
-	//	epsErrCh := make(chan error)
-	//	go func() {
-	//		if err := withdrawService.OnStart(); err != nil {
-	//			epsErrCh <- err
-	//		}
-	//	}()
-	//
-	//	select {
-	//	case err := <-epsErrCh:
-	//		return err
-	//	case <-time.After(5 * time.Second): // assume server started successfully
-	//	}
-	return nil
+// addWithdrawService supervises the l2->l1 bridge withdraw service, it returns a func closing the node clients
+func addWithdrawService(ctx *model.Context, sup *supervisor.Supervisor, checker *health.Checker, db *gorm.DB) (func(), error) {
+	bitcoinCfg := ctx.BitcoinConfig
+	btcCli, err := rpcclient.New(&rpcclient.ConnConfig{
+		Host:         bitcoinCfg.RPCHost + ":" + bitcoinCfg.RPCPort,
+		User:         bitcoinCfg.RPCUser,
+		Pass:         bitcoinCfg.RPCPass,
+		HTTPPostMode: true, // Bitcoin core only supports HTTP POST mode
+		DisableTLS:   bitcoinCfg.DisableTLS,
+	}, nil)
+	if err != nil {
+		logger.Errorw("failed to create bitcoin client", "error", err.Error())
+		return nil, err
+	}
+	ethCli, err := ethclient.Dial(bitcoinCfg.Bridge.EthRPCURL)
+	if err != nil {
+		btcCli.Shutdown()
+		logger.Errorw("failed to create eth client", "error", err.Error())
+		return nil, err
+	}
+
+	withdrawLogger := newLogger(ctx, "[bridge-withdraw]")
+	withdrawEntry := sup.Add(indexer.BridgeWithdrawServiceName, func() (supervisor.Service, error) {
+		withdrawService, err := indexer.NewBridgeWithdrawService(btcCli, ethCli, bitcoinCfg, db, withdrawLogger)
+		if err != nil {
+			logger.Errorw("failed to create bridge withdraw service", "error", err.Error())
+			return nil, err
+		}
+		return withdrawService, nil
+	})
+	checker.AddService(withdrawEntry)
+	checker.AddComponent(health.ComponentBridgeWithdraw)
+	return func() {
+		ethCli.Close()
+		btcCli.Shutdown()
+	}, nil
+}
+
+// addOutboxRelayService supervises the outbox relay, it returns a func closing the sink
+func addOutboxRelayService(ctx *model.Context, sup *supervisor.Supervisor, checker *health.Checker, db *gorm.DB) (func(), error) {
+	sink, err := outbox.NewSink(ctx.Config.Outbox)
+	if err != nil {
+		logger.Errorw("failed to create outbox sink", "error", err.Error())
+		return nil, err
+	}
+	relayLogger := newLogger(ctx, "[outbox-relay]")
+	relayEntry := sup.Add(outbox.RelayServiceName, func() (supervisor.Service, error) {
+		return outbox.NewRelay(ctx.Config.Outbox, sink, db, relayLogger), nil
+	})
+	checker.AddService(relayEntry)
+	return func() {
+		if err := sink.Close(); err != nil {
+			logger.Errorf("close outbox sink err:%v", err.Error())
+		}
+	}, nil
+}
+
+func addWebhookDispatcherService(ctx *model.Context, sup *supervisor.Supervisor, checker *health.Checker, db *gorm.DB) {
+	dispatcherLogger := newLogger(ctx, "[webhook-dispatcher]")
+	dispatcherEntry := sup.Add(webhook.DispatcherServiceName, func() (supervisor.Service, error) {
+		return webhook.NewDispatcher(ctx.Config.Webhook, db, dispatcherLogger), nil
+	})
+	checker.AddService(dispatcherEntry)
+}
+
+func addReconcileService(ctx *model.Context, sup *supervisor.Supervisor, checker *health.Checker, db *gorm.DB) {
+	reconcileLogger := newLogger(ctx, "[reconcile]")
+	reconcileEntry := sup.Add(reconcile.ServiceName, func() (supervisor.Service, error) {
+		return reconcile.NewService(ctx.Config.Reconcile, db, reconcileLogger), nil
+	})
+	checker.AddService(reconcileEntry)
 }
 
 func GetDBContextFromCmd(cmd *cobra.Command) (*gorm.DB, error) {
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"github.com/b2network/b2-indexer/internal/migration"
+	"github.com/b2network/b2-indexer/internal/model"
+	logger "github.com/b2network/b2-indexer/pkg/log"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+// checkSchema refuses to run the services against a schema version other than the one of this build
+func checkSchema(ctx *model.Context, db *gorm.DB) error {
+	migrator, err := migration.New(db, newLogger(ctx, "[migration]"))
+	if err != nil {
+		return err
+	}
+	if err = migrator.Check(); err != nil {
+		logger.Errorw("failed to check db schema", "error", err.Error())
+		return err
+	}
+	return nil
+}
+
+func newMigrator(ctx *model.Context, cmd *cobra.Command) (*migration.Migrator, error) {
+	db, err := GetDBContextFromCmd(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return migration.New(db, newLogger(ctx, "[migration]"))
+}
+
+// HandleMigrateUpCmd applies the pending migrations up to version target, 0 for the latest
+func HandleMigrateUpCmd(ctx *model.Context, cmd *cobra.Command, target int64) error {
+	migrator, err := newMigrator(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	if _, err = migrator.Up(target); err != nil {
+		return err
+	}
+	return printMigrateStatus(cmd, migrator)
+}
+
+// HandleMigrateDownCmd reverts the last steps migrations
+func HandleMigrateDownCmd(ctx *model.Context, cmd *cobra.Command, steps int) error {
+	migrator, err := newMigrator(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	if _, err = migrator.Down(steps); err != nil {
+		return err
+	}
+	return printMigrateStatus(cmd, migrator)
+}
+
+// HandleMigrateStatusCmd prints the state of every migration
+func HandleMigrateStatusCmd(ctx *model.Context, cmd *cobra.Command) error {
+	migrator, err := newMigrator(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	return printMigrateStatus(cmd, migrator)
+}
+
+func printMigrateStatus(cmd *cobra.Command, migrator *migration.Migrator) error {
+	statusList, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+	return printJSON(cmd, statusList)
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/outbox"
+	logger "github.com/b2network/b2-indexer/pkg/log"
+	"github.com/spf13/cobra"
+)
+
+// HandleOutboxReplayCmd publishes the outbox events of filter to the sink again
+func HandleOutboxReplayCmd(ctx *model.Context, cmd *cobra.Command, filter outbox.ReplayFilter) error {
+	db, err := GetDBContextFromCmd(cmd)
+	if err != nil {
+		logger.Errorw("failed to get db context", "error", err.Error())
+		return err
+	}
+	if err = checkSchema(ctx, db); err != nil {
+		return err
+	}
+	sink, err := outbox.NewSink(ctx.Config.Outbox)
+	if err != nil {
+		logger.Errorw("failed to create outbox sink", "error", err.Error())
+		return err
+	}
+	defer sink.Close()
+	replayed, err := outbox.Replay(context.Background(), db, sink, filter)
+	logger.Infow("outbox events replayed", "replayed", replayed)
+	return err
+}
+
+// HandleOutboxUnparkCmd makes the parked outbox events of a row, or of all rows, pending again
+func HandleOutboxUnparkCmd(ctx *model.Context, cmd *cobra.Command, aggregate string, aggregateID int64) error {
+	db, err := GetDBContextFromCmd(cmd)
+	if err != nil {
+		logger.Errorw("failed to get db context", "error", err.Error())
+		return err
+	}
+	if err = checkSchema(ctx, db); err != nil {
+		return err
+	}
+	unparked, err := outbox.Unpark(db, aggregate, aggregateID)
+	if err != nil {
+		return err
+	}
+	logger.Infow("outbox events unparked", "unparked", unparked)
+	return nil
+}
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/b2network/b2-indexer/internal/logic/reconcile"
+	"github.com/b2network/b2-indexer/internal/model"
+	logger "github.com/b2network/b2-indexer/pkg/log"
+	"github.com/spf13/cobra"
+)
+
+// HandleReconcileCmd runs a reconciliation and prints its report, it fails with discrepancies
+func HandleReconcileCmd(ctx *model.Context, cmd *cobra.Command) error {
+	db, err := GetDBContextFromCmd(cmd)
+	if err != nil {
+		logger.Errorw("failed to get db context", "error", err.Error())
+		return err
+	}
+	if err = checkSchema(ctx, db); err != nil {
+		return err
+	}
+	report, err := reconcile.NewReconciler(ctx.Config.Reconcile, db, newLogger(ctx, "[reconcile]")).Run(context.Background())
+	if report != nil {
+		if printErr := printJSON(cmd, report); printErr != nil {
+			return printErr
+		}
+	}
+	if err != nil {
+		logger.Errorw("failed to reconcile", "error", err.Error())
+		return err
+	}
+	if report.Discrepancies > 0 {
+		return fmt.Errorf("reconciliation report %d: %d discrepancies", report.ID, report.Discrepancies)
+	}
+	return nil
+}
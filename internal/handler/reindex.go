@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"github.com/b2network/b2-indexer/internal/logic/indexer"
+	"github.com/b2network/b2-indexer/internal/model"
+	logger "github.com/b2network/b2-indexer/pkg/log"
+	"github.com/spf13/cobra"
+)
+
+// HandleReindexCmd parses the blocks from..to again and inserts the missing deposits, the index cursor is kept
+func HandleReindexCmd(ctx *model.Context, cmd *cobra.Command, from, to int64, dryRun bool) error {
+	db, err := GetDBContextFromCmd(cmd)
+	if err != nil {
+		logger.Errorw("failed to get db context", "error", err.Error())
+		return err
+	}
+	if err = checkSchema(ctx, db); err != nil {
+		return err
+	}
+	bitcoinCfg := ctx.BitcoinConfig
+	reindexLogger := newLogger(ctx, "[reindex]")
+	bidxer, err := indexer.NewAbelianIndexer(reindexLogger, bitcoinCfg, bitcoinCfg.IndexerListenAddress, bitcoinCfg.IndexerListenTargetConfirmations)
+	if err != nil {
+		logger.Errorw("failed to new bitcoin indexer indexer", "error", err.Error())
+		return err
+	}
+	report, err := indexer.NewReindexer(bidxer, db, reindexLogger).Reindex(from, to, dryRun)
+	if err != nil {
+		logger.Errorw("failed to reindex", "error", err.Error())
+		// print the deposits handled before the error
+		if report != nil {
+			_ = printJSON(cmd, report)
+		}
+		return err
+	}
+	return printJSON(cmd, report)
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/b2network/b2-indexer/internal/logic/indexer"
+	"github.com/b2network/b2-indexer/internal/logic/reserves"
+	"github.com/b2network/b2-indexer/internal/model"
+	logger "github.com/b2network/b2-indexer/pkg/log"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+// newReserveReporter returns the reporter of the bridge reading the l2 rpc and the abelian rpc-host
+func newReserveReporter(ctx *model.Context, db *gorm.DB, log logger.Logger) (*reserves.Reporter, error) {
+	bitcoinCfg := ctx.BitcoinConfig
+	if bitcoinCfg.Bridge.Reserves.SignerKey == "" {
+		return nil, reserves.ErrNoSignerKey
+	}
+	l2, err := indexer.DialEthClient(bitcoinCfg.Bridge.EthRPCURL)
+	if err != nil {
+		return nil, err
+	}
+	node, err := indexer.NewAbelianIndexer(log, bitcoinCfg, bitcoinCfg.IndexerListenAddress, bitcoinCfg.IndexerListenTargetConfirmations)
+	if err != nil {
+		return nil, err
+	}
+	return reserves.NewReporter(bitcoinCfg, db, l2, node.(*indexer.AbelianIndexer), log)
+}
+
+// HandleReservesCmd signs a proof-of-reserves report and prints it or writes it to output,
+// it fails when the reserves do not cover the wABEL supply
+func HandleReservesCmd(ctx *model.Context, cmd *cobra.Command, output string) error {
+	db, err := GetDBContextFromCmd(cmd)
+	if err != nil {
+		logger.Errorw("failed to get db context", "error", err.Error())
+		return err
+	}
+	if err = checkSchema(ctx, db); err != nil {
+		return err
+	}
+	reporter, err := newReserveReporter(ctx, db, newLogger(ctx, "[reserves]"))
+	if err != nil {
+		logger.Errorw("failed to create reserves reporter", "error", err.Error())
+		return err
+	}
+	signed, err := reporter.Build(context.Background())
+	if err != nil {
+		logger.Errorw("failed to build reserves report", "error", err.Error())
+		return err
+	}
+	if output == "" {
+		err = printJSON(cmd, signed)
+	} else {
+		err = writeJSONFile(output, signed)
+	}
+	if err != nil {
+		return err
+	}
+	report, err := reserves.Verify(signed)
+	if err != nil {
+		return err
+	}
+	if !report.Backed {
+		return fmt.Errorf("reserves %d do not cover the outstanding wABEL %d", report.Abelian.Balance, report.L2.Outstanding)
+	}
+	return nil
+}
+
+// HandleReservesVerifyCmd verifies the signed report of file, - for stdin, and prints it
+func HandleReservesVerifyCmd(cmd *cobra.Command, file string, signer string) error {
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = io.ReadAll(cmd.InOrStdin())
+	} else {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return err
+	}
+	signed := &reserves.SignedReport{}
+	if err = json.Unmarshal(data, signed); err != nil {
+		return err
+	}
+	report, err := reserves.Verify(signed)
+	if err != nil {
+		return err
+	}
+	if signer != "" && common.HexToAddress(signer) != common.HexToAddress(signed.Signer) {
+		return fmt.Errorf("%w: signed by %s, not %s", reserves.ErrInvalidSignature, signed.Signer, signer)
+	}
+	if err = printJSON(cmd, report); err != nil {
+		return err
+	}
+	cmd.Printf("signature valid, signed by %s\n", signed.Signer)
+	return nil
+}
+
+func writeJSONFile(file string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(data, '\n'), 0o600)
+}
@@ -4,16 +4,14 @@ import (
 	"context"
 	"errors"
 	"strconv"
-	"time"
 
 	"github.com/b2network/b2-indexer/config"
 	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/storage"
 	"github.com/b2network/b2-indexer/internal/types"
 	logger "github.com/b2network/b2-indexer/pkg/log"
 	"github.com/spf13/cobra"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	gormlog "gorm.io/gorm/logger"
 )
 
 // type serverContext string
@@ -38,29 +36,38 @@ func NewDefaultContext() *model.Context {
 	return NewContext(
 		config.DefaultConfig(),
 		config.DefaultBitcoinConfig(),
+		config.DefaultHTTPConfig(),
 	)
 }
 
-func NewContext(cfg *config.Config, btcCfg *config.BitcoinConfig) *model.Context {
+func NewContext(cfg *config.Config, btcCfg *config.BitcoinConfig, httpCfg *config.HTTPConfig) *model.Context {
 	return &model.Context{
 		Config:        cfg,
 		BitcoinConfig: btcCfg,
+		HTTPConfig:    httpCfg,
 	}
 }
 
-func InterceptConfigsPreRunHandler(cmd *cobra.Command, home string) error {
-	cfg, err := config.LoadConfig(home)
+// ConfigFlags are the config overrides of the command line
+type ConfigFlags struct {
+	// Profile defines the defaults the config is based on
+	Profile string
+	// Set are section.key=value overrides
+	Set []string
+}
+
+func InterceptConfigsPreRunHandler(cmd *cobra.Command, home string, flags ConfigFlags) error {
+	appCfg, err := config.Load(home, flags.Profile, flags.Set)
 	if err != nil {
 		return err
 	}
-	if home != "" {
-		cfg.RootDir = home
-	}
-
-	bitcoinCfg, err := config.LoadBitcoinConfig(home)
-	if err != nil {
+	// refuse to start with an invalid config instead of failing deep in a service
+	if err := appCfg.Validate(); err != nil {
 		return err
 	}
+	cfg := &appCfg.Indexer
+
+	logger.Init(cfg.LogLevel, cfg.LogFormat)
 
 	//the version no db,next open
 	db, err := NewDB(cfg)
@@ -71,9 +78,7 @@ func InterceptConfigsPreRunHandler(cmd *cobra.Command, home string) error {
 	//set db to context
 	ctx := context.WithValue(cmd.Context(), types.DBContextKey, db)
 	cmd.SetContext(ctx)
-
-	logger.Init(cfg.LogLevel, cfg.LogFormat)
-	serverCtx := NewContext(cfg, bitcoinCfg)
+	serverCtx := NewContext(cfg, &appCfg.Bitcoin, &appCfg.HTTP)
 	return SetCmdServerContext(cmd, serverCtx)
 }
 
@@ -101,35 +106,7 @@ func SetCmdServerContext(cmd *cobra.Command, serverCtx *model.Context) error {
 	return nil
 }
 
-// NewDB creates a new database connection.
-// default use postgres driver
+// NewDB connects to the postgres or sqlite db of database-source
 func NewDB(cfg *config.Config) (*gorm.DB, error) {
-
-	var DB *gorm.DB
-	var err error
-	for i := 0; i < 2; i++ {
-		// waiting for db server start complete
-		time.Sleep(10 * time.Second)
-
-		DB, err = gorm.Open(postgres.Open(cfg.DatabaseSource), &gorm.Config{
-			Logger: gormlog.Default.LogMode(gormlog.Info),
-		})
-		if err == nil {
-			break
-		}
-	}
-
-	if err != nil {
-		return nil, err
-	}
-
-	sqlDB, err := DB.DB()
-	if err != nil {
-		return nil, err
-	}
-	// set db conn limit
-	sqlDB.SetMaxIdleConns(cfg.DatabaseMaxIdleConns)
-	sqlDB.SetMaxOpenConns(cfg.DatabaseMaxOpenConns)
-	sqlDB.SetConnMaxLifetime(time.Duration(cfg.DatabaseConnMaxLifetime) * time.Second)
-	return DB, nil
+	return storage.Open(cfg)
 }
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"encoding/json"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/logic/risk"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/spf13/cobra"
+)
+
+func newRiskEngine(ctx *model.Context, cmd *cobra.Command) (*risk.Engine, error) {
+	db, err := GetDBContextFromCmd(cmd)
+	if err != nil {
+		return nil, err
+	}
+	bitcoinCfg := ctx.BitcoinConfig
+	return risk.NewEngine(bitcoinCfg.Bridge.Risk, config.ChainParams(bitcoinCfg.NetworkName), db, newLogger(ctx, "[withdraw-risk]")), nil
+}
+
+// HandleWithdrawAwaitingCmd prints the withdraws awaiting manual approval
+func HandleWithdrawAwaitingCmd(ctx *model.Context, cmd *cobra.Command) error {
+	engine, err := newRiskEngine(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	withdrawList, err := engine.AwaitingApproval()
+	if err != nil {
+		return err
+	}
+	return printJSON(cmd, withdrawList)
+}
+
+// HandleWithdrawApproveCmd approves a withdraw awaiting manual approval
+func HandleWithdrawApproveCmd(ctx *model.Context, cmd *cobra.Command, id int64, reviewer string) error {
+	engine, err := newRiskEngine(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	withdraw, err := engine.Approve(id, reviewer)
+	if err != nil {
+		return err
+	}
+	return printJSON(cmd, withdraw)
+}
+
+// HandleWithdrawRejectCmd rejects a withdraw awaiting manual approval
+func HandleWithdrawRejectCmd(ctx *model.Context, cmd *cobra.Command, id int64, reviewer string, reason string) error {
+	engine, err := newRiskEngine(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	withdraw, err := engine.Reject(id, reviewer, reason)
+	if err != nil {
+		return err
+	}
+	return printJSON(cmd, withdraw)
+}
+
+func printJSON(cmd *cobra.Command, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	cmd.Println(string(data))
+	return nil
+}
@@ -0,0 +1,275 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+
+	RoleLeader   = "leader"
+	RoleFollower = "follower"
+
+	// CheckTimeout bounds a dependency check
+	CheckTimeout = 5 * time.Second
+)
+
+var (
+	ErrNotRunning = errors.New("service not running")
+	ErrStalled    = errors.New("stalled")
+	ErrCatchingUp = errors.New("catching up")
+	ErrNoIndex    = errors.New("index progress not reported")
+)
+
+// Service is a service whose running state is reported, e.g. a service.BaseService or a supervised entry
+type Service interface {
+	String() string
+	IsRunning() bool
+}
+
+// Leader reports whether this replica leads, a follower runs no services
+type Leader interface {
+	IsLeader() bool
+	ElectedAt() time.Time
+}
+
+// Check reports whether a dependency, e.g. the db or a node rpc, is reachable
+type Check func(ctx context.Context) error
+
+// ComponentStatus is the liveness of a service loop
+type ComponentStatus struct {
+	LastBeat time.Time `json:"last_beat"`
+	Status   string    `json:"status"`
+}
+
+// Report is the body of the health and readiness endpoints
+type Report struct {
+	Status     string                     `json:"status"`
+	Role       string                     `json:"role,omitempty"`
+	Services   map[string]string          `json:"services,omitempty"`
+	Components map[string]ComponentStatus `json:"components,omitempty"`
+	Checks     map[string]string          `json:"checks,omitempty"`
+	Index      *IndexState                `json:"index,omitempty"`
+}
+
+// Checker reports the health and readiness of the registered services
+type Checker struct {
+	mu         sync.RWMutex
+	stalled    time.Duration
+	readyLag   int64
+	state      *state
+	services   []Service
+	components map[string]time.Time
+	checks     map[string]Check
+	index      bool
+	leader     Leader
+}
+
+// NewChecker returns a checker, a component without a beat for stalled is stalled
+// and the index is not ready while it lags more than readyLag blocks
+func NewChecker(stalled time.Duration, readyLag int64) *Checker {
+	return &Checker{
+		stalled:    stalled,
+		readyLag:   readyLag,
+		state:      defaultState,
+		components: make(map[string]time.Time),
+		checks:     make(map[string]Check),
+	}
+}
+
+// AddService reports the running state of svc
+func (c *Checker) AddService(svc Service) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.services = append(c.services, svc)
+}
+
+// AddComponent expects beats of component from now on
+func (c *Checker) AddComponent(component string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.components[component] = time.Now()
+}
+
+// AddIndex expects the indexer beats and gates readiness on the index lag
+func (c *Checker) AddIndex() {
+	c.AddComponent(ComponentIndexer)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.index = true
+}
+
+// SetLeader reports the services, loops and index only while leader leads
+func (c *Checker) SetLeader(leader Leader) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.leader = leader
+}
+
+// AddCheck adds a dependency check to readiness
+func (c *Checker) AddCheck(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = check
+}
+
+// Health reports whether the services run and their loops are not stalled
+func (c *Checker) Health() Report {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	report := Report{
+		Status:     StatusOK,
+		Services:   make(map[string]string),
+		Components: make(map[string]ComponentStatus),
+	}
+	// loops are expected to beat from the election on
+	var electedAt time.Time
+	if c.leader != nil {
+		if !c.leader.IsLeader() {
+			report.Role = RoleFollower
+			return report
+		}
+		report.Role = RoleLeader
+		electedAt = c.leader.ElectedAt()
+	}
+	for _, svc := range c.services {
+		if svc.IsRunning() {
+			report.Services[svc.String()] = StatusOK
+		} else {
+			report.Services[svc.String()] = ErrNotRunning.Error()
+			report.Status = StatusFail
+		}
+	}
+	now := time.Now()
+	for component, addedAt := range c.components {
+		beat, ok := c.state.lastBeat(component)
+		since := addedAt
+		if electedAt.After(since) {
+			since = electedAt
+		}
+		if ok && beat.After(since) {
+			since = beat
+		}
+		status := ComponentStatus{LastBeat: beat, Status: StatusOK}
+		if c.stalled > 0 && now.Sub(since) > c.stalled {
+			status.Status = ErrStalled.Error()
+			report.Status = StatusFail
+		}
+		report.Components[component] = status
+	}
+	if index, ok := c.state.indexState(); ok {
+		report.Index = &index
+	}
+	return report
+}
+
+// Ready reports whether the service is healthy, its dependencies are reachable and the index caught up
+func (c *Checker) Ready(ctx context.Context) Report {
+	report := c.Health()
+
+	c.mu.RLock()
+	checks := make(map[string]Check, len(c.checks))
+	for name, check := range c.checks {
+		checks[name] = check
+	}
+	// the index of a follower is not advanced
+	index := c.index && report.Role != RoleFollower
+	c.mu.RUnlock()
+
+	report.Checks = make(map[string]string, len(checks)+1)
+	results := runChecks(ctx, checks)
+	for name, err := range results {
+		if err != nil {
+			report.Checks[name] = err.Error()
+			report.Status = StatusFail
+		} else {
+			report.Checks[name] = StatusOK
+		}
+	}
+	if index {
+		switch {
+		case report.Index == nil:
+			report.Checks[ComponentIndexer] = ErrNoIndex.Error()
+			report.Status = StatusFail
+		case report.Index.Lag > c.readyLag:
+			report.Checks[ComponentIndexer] = ErrCatchingUp.Error()
+			report.Status = StatusFail
+		default:
+			report.Checks[ComponentIndexer] = StatusOK
+		}
+	}
+	return report
+}
+
+// runChecks runs the checks concurrently, a check not done within CheckTimeout fails
+func runChecks(ctx context.Context, checks map[string]Check) map[string]error {
+	ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+	defer cancel()
+	type result struct {
+		name string
+		err  error
+	}
+	resultCh := make(chan result, len(checks))
+	for name, check := range checks {
+		go func(name string, check Check) {
+			resultCh <- result{name: name, err: check(ctx)}
+		}(name, check)
+	}
+	results := make(map[string]error, len(checks))
+	for len(results) < len(checks) {
+		select {
+		case r := <-resultCh:
+			results[r.name] = r.err
+		case <-ctx.Done():
+			for name := range checks {
+				if _, ok := results[name]; !ok {
+					results[name] = ctx.Err()
+				}
+			}
+		}
+	}
+	return results
+}
+
+// HealthzHandler serves the health report, 503 when unhealthy
+func (c *Checker) HealthzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		writeReport(w, c.Health())
+	})
+}
+
+// ReadyzHandler serves the readiness report, 503 when not ready
+func (c *Checker) ReadyzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, c.Ready(r.Context()))
+	})
+}
+
+func writeReport(w http.ResponseWriter, report Report) {
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// DBCheck pings the database of db
+func DBCheck(db *gorm.DB) Check {
+	return func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}
+}
@@ -0,0 +1,134 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cometbft/cometbft/libs/service"
+	"github.com/stretchr/testify/require"
+)
+
+type testService struct {
+	service.BaseService
+}
+
+func newTestService() *testService {
+	s := &testService{}
+	s.BaseService = *service.NewBaseService(nil, "TestService", s)
+	return s
+}
+
+func newTestChecker(stalled time.Duration, readyLag int64) *Checker {
+	c := NewChecker(stalled, readyLag)
+	c.state = &state{beats: make(map[string]time.Time)}
+	return c
+}
+
+func TestHealthServices(t *testing.T) {
+	c := newTestChecker(time.Minute, 0)
+	svc := newTestService()
+	c.AddService(svc)
+	require.Equal(t, StatusFail, c.Health().Status)
+
+	require.NoError(t, svc.Start())
+	require.Equal(t, StatusOK, c.Health().Status)
+
+	require.NoError(t, svc.Stop())
+	require.Equal(t, StatusFail, c.Health().Status)
+}
+
+func TestHealthStalled(t *testing.T) {
+	c := newTestChecker(time.Minute, 0)
+	c.AddComponent(ComponentBridgeDeposit)
+	// a new component has the stalled threshold to beat
+	require.Equal(t, StatusOK, c.Health().Status)
+
+	c.components[ComponentBridgeDeposit] = time.Now().Add(-2 * time.Minute)
+	report := c.Health()
+	require.Equal(t, StatusFail, report.Status)
+	require.Equal(t, ErrStalled.Error(), report.Components[ComponentBridgeDeposit].Status)
+
+	c.state.beats[ComponentBridgeDeposit] = time.Now()
+	require.Equal(t, StatusOK, c.Health().Status)
+}
+
+type testLeader struct {
+	leading   bool
+	electedAt time.Time
+}
+
+func (l *testLeader) IsLeader() bool       { return l.leading }
+func (l *testLeader) ElectedAt() time.Time { return l.electedAt }
+
+func TestHealthFollower(t *testing.T) {
+	c := newTestChecker(time.Minute, 2)
+	c.AddService(newTestService())
+	c.AddIndex()
+	l := &testLeader{}
+	c.SetLeader(l)
+	// a follower runs no services and does not index
+	report := c.Ready(context.Background())
+	require.Equal(t, StatusOK, report.Status)
+	require.Equal(t, RoleFollower, report.Role)
+
+	// the loops have the stalled threshold to beat from the election on
+	c.components[ComponentIndexer] = time.Now().Add(-2 * time.Minute)
+	l.leading, l.electedAt = true, time.Now()
+	report = c.Health()
+	require.Equal(t, RoleLeader, report.Role)
+	require.Equal(t, StatusOK, report.Components[ComponentIndexer].Status)
+	require.Equal(t, ErrNotRunning.Error(), report.Services["TestService"])
+}
+
+func TestReadyIndexLag(t *testing.T) {
+	c := newTestChecker(time.Minute, 2)
+	c.AddIndex()
+	report := c.Ready(context.Background())
+	require.Equal(t, StatusFail, report.Status)
+	require.Equal(t, ErrNoIndex.Error(), report.Checks[ComponentIndexer])
+
+	// catching up
+	c.state.index = IndexState{Height: 10, LatestBlock: 20, Lag: 10}
+	c.state.hasIndex = true
+	report = c.Ready(context.Background())
+	require.Equal(t, StatusFail, report.Status)
+	require.Equal(t, ErrCatchingUp.Error(), report.Checks[ComponentIndexer])
+
+	c.state.index = IndexState{Height: 18, LatestBlock: 20, Lag: 2}
+	require.Equal(t, StatusOK, c.Ready(context.Background()).Status)
+	// the index lag does not fail liveness
+	c.state.index.Lag = 100
+	require.Equal(t, StatusOK, c.Health().Status)
+}
+
+func TestReadyChecks(t *testing.T) {
+	c := newTestChecker(time.Minute, 0)
+	c.AddCheck("db", func(context.Context) error { return nil })
+	c.AddCheck("evm", func(context.Context) error { return errors.New("connection refused") })
+
+	rec := httptest.NewRecorder()
+	c.ReadyzHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.Contains(t, rec.Body.String(), "connection refused")
+
+	rec = httptest.NewRecorder()
+	c.HealthzHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestRunChecksTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	results := runChecks(ctx, map[string]Check{
+		"slow": func(ctx context.Context) error {
+			<-ctx.Done()
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		},
+	})
+	require.ErrorIs(t, results["slow"], context.DeadlineExceeded)
+}
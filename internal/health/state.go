@@ -0,0 +1,76 @@
+package health
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// ComponentIndexer beats on every block commit and while the index is caught up
+	ComponentIndexer = "indexer"
+	// ComponentBridgeDeposit beats on every deposit loop iteration
+	ComponentBridgeDeposit = "bridge_deposit"
+	// ComponentBridgeWithdraw beats on every withdraw loop iteration
+	ComponentBridgeWithdraw = "bridge_withdraw"
+)
+
+// IndexState is the progress of the indexer
+type IndexState struct {
+	Height      int64     `json:"height"`
+	LatestBlock int64     `json:"latest_block"`
+	Lag         int64     `json:"lag"`
+	LastCommit  time.Time `json:"last_commit"`
+}
+
+// state holds the progress reported by the services
+type state struct {
+	mu       sync.RWMutex
+	beats    map[string]time.Time
+	index    IndexState
+	hasIndex bool
+}
+
+var defaultState = &state{beats: make(map[string]time.Time)}
+
+// Beat records an iteration of the loop of component
+func Beat(component string) {
+	defaultState.mu.Lock()
+	defer defaultState.mu.Unlock()
+	defaultState.beats[component] = time.Now()
+}
+
+// IndexProgress records the index height against the node latest block
+func IndexProgress(height int64, latestBlock int64) {
+	defaultState.mu.Lock()
+	defer defaultState.mu.Unlock()
+	defaultState.index.Height = height
+	defaultState.index.LatestBlock = latestBlock
+	defaultState.index.Lag = latestBlock - height
+	defaultState.hasIndex = true
+}
+
+// BlockCommitted records the commit of block height and beats the indexer
+func BlockCommitted(height int64, latestBlock int64) {
+	now := time.Now()
+	defaultState.mu.Lock()
+	defer defaultState.mu.Unlock()
+	defaultState.index.Height = height
+	defaultState.index.LatestBlock = latestBlock
+	defaultState.index.Lag = latestBlock - height
+	defaultState.index.LastCommit = now
+	defaultState.hasIndex = true
+	defaultState.beats[ComponentIndexer] = now
+}
+
+func (s *state) lastBeat(component string) (time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	beat, ok := s.beats[component]
+	return beat, ok
+}
+
+func (s *state) indexState() (IndexState, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.index, s.hasIndex
+}
@@ -0,0 +1,210 @@
+package leader
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/b2network/b2-indexer/internal/metrics"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/supervisor"
+	"github.com/b2network/b2-indexer/pkg/log"
+	"github.com/cometbft/cometbft/libs/service"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	ElectorName = "LeaderElector"
+
+	// LeaseName is the lease of the indexer writers
+	LeaseName = "indexer"
+)
+
+// Elector campaigns for the lease and runs the writers while it holds it.
+// The lease is renewed every third of its ttl, a follower takes over once the
+// lease of the leader expired or was released.
+type Elector struct {
+	service.BaseService
+	db    *gorm.DB
+	fence *Fence
+	ttl   time.Duration
+	log   log.Logger
+	loops *supervisor.Loops
+
+	// elected starts and demoted stops the writers
+	elected  func() error
+	demoted  func()
+	mu       sync.Mutex
+	writing  bool
+	stopping atomic.Bool
+}
+
+// NewElector returns a new elector instance, fence must be registered on db
+func NewElector(db *gorm.DB, fence *Fence, ttl time.Duration, elected func() error, demoted func(), logger log.Logger) *Elector {
+	e := &Elector{
+		db:      db,
+		fence:   fence,
+		ttl:     ttl,
+		elected: elected,
+		demoted: demoted,
+		log:     logger,
+	}
+	e.BaseService = *service.NewBaseService(nil, ElectorName, e)
+	return e
+}
+
+// OnStart campaigns for the lease
+func (e *Elector) OnStart() error {
+	e.stopping.Store(false)
+	e.loops = supervisor.NewLoops()
+	e.loops.Go(func() error {
+		for {
+			e.campaign()
+			if !e.loops.Sleep(e.ttl / 3) {
+				return nil
+			}
+		}
+	})
+	return nil
+}
+
+// OnStop stops the writers while still renewing the lease, then releases it
+// so that a follower takes over without waiting for the lease to expire
+func (e *Elector) OnStop() {
+	e.stopping.Store(true)
+	e.stopWriters()
+	e.loops.Stop()
+	if token := e.fence.Token(); token != 0 {
+		e.fence.revoke()
+		metrics.Leader.Set(0)
+		if err := e.release(token); err != nil {
+			e.log.Errorw("leader release lease err", "error", err)
+		}
+	}
+}
+
+// campaign renews the lease while leading, otherwise it tries to acquire it
+func (e *Elector) campaign() {
+	start := time.Now()
+	if token := e.fence.Token(); token != 0 {
+		renewed, err := e.renew(token)
+		switch {
+		case err != nil:
+			e.log.Errorw("leader renew lease err", "error", err)
+			// keep leading until the lease expires, the db may recover before
+			if !e.fence.Valid() {
+				e.demote("lease expired")
+			}
+		case !renewed:
+			e.demote("lease lost")
+		default:
+			e.fence.extend(start.Add(e.ttl))
+		}
+		return
+	}
+	if e.stopping.Load() {
+		return
+	}
+	token, acquired, err := e.acquire()
+	if err != nil {
+		e.log.Errorw("leader acquire lease err", "error", err)
+		return
+	}
+	if !acquired {
+		return
+	}
+	e.fence.grant(token, start.Add(e.ttl))
+	metrics.Leader.Set(1)
+	metrics.LeaderTransitions.Inc()
+	e.log.Infow("leader elected", "holder", e.fence.Holder(), "token", token)
+	if err := e.startWriters(); err != nil {
+		e.log.Errorw("leader start writers err", "error", err)
+		e.demote("start writers failed")
+		if err := e.release(token); err != nil {
+			e.log.Errorw("leader release lease err", "error", err)
+		}
+	}
+}
+
+// demote revokes the token first, writes of the stopping writers fail from now on
+func (e *Elector) demote(reason string) {
+	e.log.Warnw("leader demoted", "holder", e.fence.Holder(), "token", e.fence.Token(), "reason", reason)
+	e.fence.revoke()
+	metrics.Leader.Set(0)
+	e.stopWriters()
+}
+
+func (e *Elector) startWriters() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.writing {
+		return nil
+	}
+	if err := e.elected(); err != nil {
+		return err
+	}
+	e.writing = true
+	return nil
+}
+
+func (e *Elector) stopWriters() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.writing {
+		return
+	}
+	e.demoted()
+	e.writing = false
+}
+
+// acquire takes over an expired or released lease with the next token
+func (e *Elector) acquire() (int64, bool, error) {
+	err := e.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.LeaderLease{
+		Name:      LeaseName,
+		ExpiresAt: time.Unix(0, 0),
+	}).Error
+	if err != nil {
+		return 0, false, err
+	}
+	var lease model.LeaderLease
+	result := e.db.Model(&lease).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: model.LeaderLease{}.Column().Token}}}).
+		Where(fmt.Sprintf("%s = ?", model.LeaderLease{}.Column().Name), LeaseName).
+		Where(fmt.Sprintf("%s <= now()", model.LeaderLease{}.Column().ExpiresAt)).
+		Updates(map[string]interface{}{
+			model.LeaderLease{}.Column().Holder:    e.fence.Holder(),
+			model.LeaderLease{}.Column().Token:     gorm.Expr(fmt.Sprintf("%s + 1", model.LeaderLease{}.Column().Token)),
+			model.LeaderLease{}.Column().ExpiresAt: e.expiresAt(),
+		})
+	if result.Error != nil {
+		return 0, false, result.Error
+	}
+	return lease.Token, result.RowsAffected == 1, nil
+}
+
+// renew extends the lease if it is still held with token
+func (e *Elector) renew(token int64) (bool, error) {
+	result := e.db.Model(&model.LeaderLease{}).
+		Where(fmt.Sprintf("%s = ?", model.LeaderLease{}.Column().Name), LeaseName).
+		Where(fmt.Sprintf("%s = ?", model.LeaderLease{}.Column().Holder), e.fence.Holder()).
+		Where(fmt.Sprintf("%s = ?", model.LeaderLease{}.Column().Token), token).
+		Where(fmt.Sprintf("%s > now()", model.LeaderLease{}.Column().ExpiresAt)).
+		Update(model.LeaderLease{}.Column().ExpiresAt, e.expiresAt())
+	return result.RowsAffected == 1, result.Error
+}
+
+// release expires the lease if it is still held with token
+func (e *Elector) release(token int64) error {
+	return e.db.Model(&model.LeaderLease{}).
+		Where(fmt.Sprintf("%s = ?", model.LeaderLease{}.Column().Name), LeaseName).
+		Where(fmt.Sprintf("%s = ?", model.LeaderLease{}.Column().Holder), e.fence.Holder()).
+		Where(fmt.Sprintf("%s = ?", model.LeaderLease{}.Column().Token), token).
+		Update(model.LeaderLease{}.Column().ExpiresAt, gorm.Expr("now()")).Error
+}
+
+// expiresAt uses the db clock, the replicas clocks may differ
+func (e *Elector) expiresAt() clause.Expr {
+	return gorm.Expr("now() + make_interval(secs => ?)", e.ttl.Seconds())
+}
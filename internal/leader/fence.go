@@ -0,0 +1,146 @@
+package leader
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/b2network/b2-indexer/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// PluginName is the gorm plugin name of the fence
+	PluginName = "leader:fence"
+
+	callbackName = "leader:fence"
+)
+
+var (
+	ErrNotLeader = errors.New("not the leader")
+	ErrFenced    = errors.New("fencing token superseded")
+)
+
+// Fence holds the fencing token of the lease while this replica leads.
+// Registered as gorm plugin, every create, update and delete checks in its
+// transaction that the token is still current and holds a share lock on the
+// lease, a new leader can only take over once the write committed.
+type Fence struct {
+	name      string
+	holder    string
+	token     atomic.Int64
+	expiry    atomic.Int64
+	electedAt atomic.Int64
+}
+
+// NewFence returns the fence of holder for the lease name
+func NewFence(name, holder string) *Fence {
+	return &Fence{
+		name:   name,
+		holder: holder,
+	}
+}
+
+// Name implements gorm.Plugin
+func (f *Fence) Name() string {
+	return PluginName
+}
+
+// Initialize implements gorm.Plugin by checking the token on writes
+func (f *Fence) Initialize(db *gorm.DB) error {
+	err := db.Callback().Create().After("gorm:begin_transaction").Before("gorm:before_create").Register(callbackName, f.fenceWrite)
+	if err != nil {
+		return err
+	}
+	err = db.Callback().Update().After("gorm:begin_transaction").Before("gorm:before_update").Register(callbackName, f.fenceWrite)
+	if err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("gorm:begin_transaction").Before("gorm:before_delete").Register(callbackName, f.fenceWrite)
+}
+
+func (f *Fence) fenceWrite(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Table == (model.LeaderLease{}).TableName() {
+		return
+	}
+	// a new session on the connection of the statement, i.e. its transaction
+	if err := f.Check(db.Session(&gorm.Session{NewDB: true})); err != nil {
+		_ = db.AddError(fmt.Errorf("%s: %w", db.Statement.Table, err))
+	}
+}
+
+// Holder returns the replica id
+func (f *Fence) Holder() string {
+	return f.holder
+}
+
+// Token returns the fencing token, 0 when not leading
+func (f *Fence) Token() int64 {
+	return f.token.Load()
+}
+
+// IsLeader implements health.Leader
+func (f *Fence) IsLeader() bool {
+	return f.Token() != 0
+}
+
+// ElectedAt implements health.Leader
+func (f *Fence) ElectedAt() time.Time {
+	return time.Unix(0, f.electedAt.Load())
+}
+
+// Valid reports whether the lease did not expire by the local clock
+func (f *Fence) Valid() bool {
+	return f.IsLeader() && time.Now().UnixNano() < f.expiry.Load()
+}
+
+func (f *Fence) grant(token int64, expiry time.Time) {
+	f.expiry.Store(expiry.UnixNano())
+	f.electedAt.Store(time.Now().UnixNano())
+	f.token.Store(token)
+}
+
+func (f *Fence) extend(expiry time.Time) {
+	f.expiry.Store(expiry.UnixNano())
+}
+
+func (f *Fence) revoke() {
+	f.token.Store(0)
+}
+
+// Check verifies on db that the lease is held with the current token,
+// within a transaction the lease row stays share locked until it ends
+func (f *Fence) Check(db *gorm.DB) error {
+	token := f.Token()
+	if token == 0 {
+		return ErrNotLeader
+	}
+	var lease model.LeaderLease
+	err := db.Clauses(clause.Locking{Strength: "SHARE"}).
+		Select(model.LeaderLease{}.Column().Token).
+		Where(fmt.Sprintf("%s = ?", model.LeaderLease{}.Column().Name), f.name).
+		Where(fmt.Sprintf("%s = ?", model.LeaderLease{}.Column().Holder), f.holder).
+		Where(fmt.Sprintf("%s = ?", model.LeaderLease{}.Column().Token), token).
+		Where(fmt.Sprintf("%s > now()", model.LeaderLease{}.Column().ExpiresAt)).
+		Take(&lease).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrFenced
+	}
+	return err
+}
+
+// Verify is called before side effects outside the db, e.g. sending a mint or
+// broadcasting a withdraw. Without leader election on db it always passes.
+func Verify(db *gorm.DB) error {
+	plugin, ok := db.Config.Plugins[PluginName]
+	if !ok {
+		return nil
+	}
+	fence := plugin.(*Fence)
+	if !fence.Valid() {
+		return ErrNotLeader
+	}
+	return fence.Check(db)
+}
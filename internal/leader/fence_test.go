@@ -0,0 +1,42 @@
+package leader
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestFenceLease(t *testing.T) {
+	f := NewFence(LeaseName, "replica-0")
+	require.False(t, f.IsLeader())
+	require.False(t, f.Valid())
+
+	f.grant(3, time.Now().Add(time.Minute))
+	require.True(t, f.IsLeader())
+	require.True(t, f.Valid())
+	require.Equal(t, int64(3), f.Token())
+
+	// the local lease expired without renewal
+	f.extend(time.Now().Add(-time.Second))
+	require.True(t, f.IsLeader())
+	require.False(t, f.Valid())
+
+	f.revoke()
+	require.False(t, f.IsLeader())
+	require.ErrorIs(t, f.Check(nil), ErrNotLeader)
+}
+
+func TestVerify(t *testing.T) {
+	// without leader election sends are not fenced
+	db := &gorm.DB{Config: &gorm.Config{Plugins: map[string]gorm.Plugin{}}}
+	require.NoError(t, Verify(db))
+
+	f := NewFence(LeaseName, "replica-0")
+	db.Config.Plugins[PluginName] = f
+	require.ErrorIs(t, Verify(db), ErrNotLeader)
+
+	f.grant(1, time.Now().Add(-time.Second))
+	require.ErrorIs(t, Verify(db), ErrNotLeader)
+}
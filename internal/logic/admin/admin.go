@@ -0,0 +1,109 @@
+// Package admin lets operators inspect and repair the bridge state, every repair is
+// written to the admin audit table in the transaction of the change.
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/storage"
+	"github.com/b2network/b2-indexer/pkg/log"
+	"gorm.io/gorm"
+)
+
+// DefaultLimit is the number of rows listed when no limit is given
+const DefaultLimit = 50
+
+var (
+	ErrOperatorRequired = errors.New("operator is required")
+	ErrReasonRequired   = errors.New("reason is required")
+)
+
+// Change is who repairs the bridge state and why
+type Change struct {
+	Operator string
+	Reason   string
+	// Force overrides the safety checks of the action, the override is audited
+	Force bool
+}
+
+func (c Change) validate() error {
+	if c.Operator == "" {
+		return ErrOperatorRequired
+	}
+	if c.Reason == "" {
+		return ErrReasonRequired
+	}
+	return nil
+}
+
+// Admin inspects and repairs deposits, the index cursor and withdraws
+type Admin struct {
+	db    *gorm.DB
+	store storage.Store
+	log   log.Logger
+}
+
+// NewAdmin returns an admin of the bridge state in db
+func NewAdmin(db *gorm.DB, log log.Logger) *Admin {
+	return &Admin{db: db, store: storage.New(db), log: log}
+}
+
+// audit writes the change of the row target from before to after
+func audit(store storage.Store, action string, target string, change Change, forced bool, before, after interface{}) error {
+	beforeJSON, err := json.Marshal(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+	return store.Audits().Create(&model.AdminAudit{
+		Operator: change.Operator,
+		Action:   action,
+		Target:   target,
+		Reason:   change.Reason,
+		Forced:   forced,
+		Before:   model.JSON(beforeJSON),
+		After:    model.JSON(afterJSON),
+	})
+}
+
+func target(table string, id int64) string {
+	return fmt.Sprintf("%s:%d", table, id)
+}
+
+// AuditFilter selects the audits listed, empty fields match all audits
+type AuditFilter struct {
+	Operator string
+	Action   string
+	Target   string
+	Limit    int
+}
+
+// Audits returns the latest audits of filter
+func (a *Admin) Audits(filter AuditFilter) ([]model.AdminAudit, error) {
+	query := a.db.Model(&model.AdminAudit{})
+	if filter.Operator != "" {
+		query = query.Where(fmt.Sprintf("%s = ?", model.AdminAudit{}.Column().Operator), filter.Operator)
+	}
+	if filter.Action != "" {
+		query = query.Where(fmt.Sprintf("%s = ?", model.AdminAudit{}.Column().Action), filter.Action)
+	}
+	if filter.Target != "" {
+		query = query.Where(fmt.Sprintf("%s = ?", model.AdminAudit{}.Column().Target), filter.Target)
+	}
+	var audits []model.AdminAudit
+	err := query.Order("id DESC").Limit(limit(filter.Limit)).Find(&audits).Error
+	return audits, err
+}
+
+func limit(n int) int {
+	if n <= 0 {
+		return DefaultLimit
+	}
+	return n
+}
@@ -0,0 +1,398 @@
+package admin_test
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/leader"
+	"github.com/b2network/b2-indexer/internal/logic/admin"
+	"github.com/b2network/b2-indexer/internal/logic/indexer"
+	"github.com/b2network/b2-indexer/internal/migration"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/storage"
+	"github.com/b2network/b2-indexer/pkg/log"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func openSqlite(t *testing.T) *gorm.DB {
+	db, err := storage.Open(&config.Config{
+		DatabaseSource: "sqlite://" + filepath.Join(t.TempDir(), "indexer.db"),
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	migrator, err := migration.New(db, log.NewNopLogger())
+	require.NoError(t, err)
+	_, err = migrator.Up(0)
+	require.NoError(t, err)
+	return db
+}
+
+func createDeposit(t *testing.T, db *gorm.DB, deposit model.Deposit) model.Deposit {
+	// the zero success status is not inserted over the column default
+	status := deposit.B2TxStatus
+	require.NoError(t, db.Create(&deposit).Error)
+	deposit.B2TxStatus = status
+	require.NoError(t, db.Model(&model.Deposit{}).Where("id = ?", deposit.ID).
+		UpdateColumn(model.Deposit{}.Column().B2TxStatus, status).Error)
+	return deposit
+}
+
+var change = admin.Change{Operator: "ops", Reason: "INC-1"}
+
+func TestChangeRequired(t *testing.T) {
+	a := admin.NewAdmin(openSqlite(t), log.NewNopLogger())
+	_, err := a.RetryDeposit(context.Background(), mintClient{}, "a", 0, admin.Change{Reason: "INC-1"})
+	require.ErrorIs(t, err, admin.ErrOperatorRequired)
+	_, err = a.ResolveDeposit("a", 0, "", admin.Change{Operator: "ops"})
+	require.ErrorIs(t, err, admin.ErrReasonRequired)
+	_, err = a.SetCursor(10, 0, 100, admin.Change{Operator: "ops"})
+	require.ErrorIs(t, err, admin.ErrReasonRequired)
+}
+
+func TestRetryDeposit(t *testing.T) {
+	db := openSqlite(t)
+	a := admin.NewAdmin(db, log.NewNopLogger())
+	createDeposit(t, db, model.Deposit{BtcTxHash: "failed", B2TxStatus: model.DepositB2TxStatusFailed, B2TxRetry: 3})
+	createDeposit(t, db, model.Deposit{BtcTxHash: "exhausted", B2TxStatus: model.DepositB2TxStatusInsufficientBalance, B2TxRetry: indexer.DepositMaxRetry + 1})
+	createDeposit(t, db, model.Deposit{BtcTxHash: "retrying", B2TxStatus: model.DepositB2TxStatusInsufficientBalance, B2TxRetry: 2})
+	createDeposit(t, db, model.Deposit{BtcTxHash: "mining", B2TxStatus: model.DepositB2TxStatusWaitMined})
+	createDeposit(t, db, model.Deposit{BtcTxHash: "minted", B2TxStatus: model.DepositB2TxStatusSuccess})
+	createDeposit(t, db, model.Deposit{BtcTxHash: "unconfirmed", B2TxStatus: model.DepositB2TxStatusFailed, ListenerStatus: model.ListenerStatusPending})
+
+	for _, txHash := range []string{"failed", "exhausted"} {
+		deposit, err := a.RetryDeposit(context.Background(), mintClient{}, txHash, 0, change)
+		require.NoError(t, err, txHash)
+		require.Equal(t, model.DepositB2TxStatusPending, deposit.B2TxStatus)
+		require.Zero(t, deposit.B2TxRetry)
+	}
+	_, err := a.RetryDeposit(context.Background(), mintClient{}, "failed", 1, change)
+	require.ErrorIs(t, err, admin.ErrDepositNotFound)
+	for _, txHash := range []string{"retrying", "mining", "minted", "unconfirmed"} {
+		_, err = a.RetryDeposit(context.Background(), mintClient{}, txHash, 0, change)
+		require.ErrorIs(t, err, admin.ErrNotRetryable, txHash)
+	}
+	forced := change
+	forced.Force = true
+	_, err = a.RetryDeposit(context.Background(), mintClient{}, "mining", 0, forced)
+	require.NoError(t, err)
+	for _, txHash := range []string{"minted", "unconfirmed"} {
+		_, err = a.RetryDeposit(context.Background(), mintClient{}, txHash, 0, forced)
+		require.ErrorIs(t, err, admin.ErrNotRetryable, txHash)
+	}
+
+	detail, err := a.Deposit("failed")
+	require.NoError(t, err)
+	require.Len(t, detail.Audits, 1)
+	retried := detail.Audits[0]
+	require.Equal(t, model.AdminActionDepositRetry, retried.Action)
+	require.Equal(t, "ops", retried.Operator)
+	require.Equal(t, "INC-1", retried.Reason)
+	require.False(t, retried.Forced)
+	var before, after model.Deposit
+	require.NoError(t, json.Unmarshal([]byte(retried.Before), &before))
+	require.NoError(t, json.Unmarshal([]byte(retried.After), &after))
+	require.Equal(t, model.DepositB2TxStatusFailed, before.B2TxStatus)
+	require.Equal(t, 3, before.B2TxRetry)
+	require.Equal(t, model.DepositB2TxStatusPending, after.B2TxStatus)
+
+	audits, err := a.Audits(admin.AuditFilter{Action: model.AdminActionDepositRetry})
+	require.NoError(t, err)
+	require.Len(t, audits, 3)
+	require.True(t, audits[0].Forced)
+}
+
+// mintClient is an l2 with the receipts and the pending txs of the deposit mints
+type mintClient struct {
+	nonce    uint64
+	receipts map[string]uint64
+	pending  map[string]bool
+}
+
+func (c mintClient) NonceAt(context.Context, common.Address, *big.Int) (uint64, error) {
+	return c.nonce, nil
+}
+
+func (c mintClient) TransactionReceipt(_ context.Context, hash common.Hash) (*ethtypes.Receipt, error) {
+	status, ok := c.receipts[hash.Hex()]
+	if !ok {
+		return nil, ethereum.NotFound
+	}
+	return &ethtypes.Receipt{Status: status, BlockNumber: big.NewInt(1)}, nil
+}
+
+func (c mintClient) TransactionByHash(_ context.Context, hash common.Hash) (*ethtypes.Transaction, bool, error) {
+	if c.pending[hash.Hex()] {
+		return ethtypes.NewTx(&ethtypes.LegacyTx{}), true, nil
+	}
+	return nil, false, ethereum.NotFound
+}
+
+func TestRetryDepositMintTx(t *testing.T) {
+	db := openSqlite(t)
+	a := admin.NewAdmin(db, log.NewNopLogger())
+	mintTx := func(i int64) string { return common.BigToHash(big.NewInt(i)).Hex() }
+	from := "0x00000000000000000000000000000000000000b2"
+	createDeposit(t, db, model.Deposit{BtcTxHash: "reverted", B2TxStatus: model.DepositB2TxStatusWaitMined, B2TxHash: mintTx(1), B2TxFrom: from, B2TxNonce: 1})
+	createDeposit(t, db, model.Deposit{BtcTxHash: "replaced", B2TxStatus: model.DepositB2TxStatusIsPending, B2TxHash: mintTx(2), B2TxFrom: from, B2TxNonce: 2})
+	createDeposit(t, db, model.Deposit{BtcTxHash: "sent", B2TxStatus: model.DepositB2TxStatusWaitMined, B2TxHash: mintTx(3), B2TxFrom: from, B2TxNonce: 5})
+	createDeposit(t, db, model.Deposit{BtcTxHash: "minted", B2TxStatus: model.DepositB2TxStatusContextDeadlineExceeded, B2TxHash: mintTx(4), B2TxFrom: from, B2TxNonce: 3})
+	createDeposit(t, db, model.Deposit{BtcTxHash: "dropped", B2TxStatus: model.DepositB2TxStatusNonceToLow, B2TxHash: mintTx(5), B2TxFrom: from, B2TxNonce: 6})
+	client := mintClient{
+		nonce:    5,
+		receipts: map[string]uint64{mintTx(1): ethtypes.ReceiptStatusFailed, mintTx(4): ethtypes.ReceiptStatusSuccessful},
+		pending:  map[string]bool{mintTx(3): true},
+	}
+	forced := change
+	forced.Force = true
+
+	// the mint reverted or another tx took its nonce, it is never mined
+	for _, txHash := range []string{"reverted", "replaced"} {
+		deposit, err := a.RetryDeposit(context.Background(), client, txHash, 0, change)
+		require.NoError(t, err, txHash)
+		require.Equal(t, model.DepositB2TxStatusPending, deposit.B2TxStatus)
+	}
+	// pending or minted, also forced
+	for _, txHash := range []string{"sent", "minted"} {
+		_, err := a.RetryDeposit(context.Background(), client, txHash, 0, forced)
+		require.ErrorIs(t, err, admin.ErrNotRetryable, txHash)
+	}
+	// its nonce is not used yet, the tx may be broadcast again
+	_, err := a.RetryDeposit(context.Background(), client, "dropped", 0, change)
+	require.ErrorIs(t, err, admin.ErrNotRetryable)
+	_, err = a.RetryDeposit(context.Background(), client, "dropped", 0, forced)
+	require.NoError(t, err)
+
+	audits, err := a.Audits(admin.AuditFilter{Action: model.AdminActionDepositRetry})
+	require.NoError(t, err)
+	require.Len(t, audits, 3)
+	require.True(t, audits[0].Forced)
+	require.False(t, audits[1].Forced)
+}
+
+func TestResolveDeposit(t *testing.T) {
+	db := openSqlite(t)
+	a := admin.NewAdmin(db, log.NewNopLogger())
+	createDeposit(t, db, model.Deposit{BtcTxHash: "failed", B2TxStatus: model.DepositB2TxStatusFailed})
+	createDeposit(t, db, model.Deposit{BtcTxHash: "mining", B2TxStatus: model.DepositB2TxStatusIsPending})
+	createDeposit(t, db, model.Deposit{BtcTxHash: "minted", B2TxStatus: model.DepositB2TxStatusTxHashExist})
+	createDeposit(t, db, model.Deposit{BtcTxHash: "elsewhere", BtcTxOutput: 1, B2TxStatus: model.DepositB2TxStatusAAAddressNotFound})
+	require.NoError(t, db.Create(&model.RollupDeposit{BtcTxHash: "elsewhere", B2TxHash: "0x01", B2TxFrom: "0xff"}).Error)
+
+	deposit, err := a.ResolveDeposit("failed", 0, "", change)
+	require.NoError(t, err)
+	require.Equal(t, model.DepositB2TxStatusResolved, deposit.B2TxStatus)
+	_, err = a.ResolveDeposit("failed", 0, "", change)
+	require.ErrorIs(t, err, admin.ErrNotResolvable)
+	_, err = a.ResolveDeposit("minted", 0, "", change)
+	require.ErrorIs(t, err, admin.ErrNotResolvable)
+	_, err = a.ResolveDeposit("mining", 0, "", change)
+	require.ErrorIs(t, err, admin.ErrNotResolvable)
+	_, err = a.ResolveDeposit("mining", 0, "", admin.Change{Operator: "ops", Reason: "INC-1", Force: true})
+	require.NoError(t, err)
+
+	// marked minted by the l2 tx, for the deposit service to check
+	_, err = a.ResolveDeposit("elsewhere", 1, "0x02", change)
+	require.ErrorIs(t, err, admin.ErrMintNotFound)
+	deposit, err = a.ResolveDeposit("elsewhere", 1, "0x01", change)
+	require.NoError(t, err)
+	require.Equal(t, model.DepositB2TxStatusSuccess, deposit.B2TxStatus)
+	require.Equal(t, "0x01", deposit.B2TxHash)
+	require.Equal(t, "0xff", deposit.B2TxFrom)
+	require.Equal(t, model.B2CheckStatusPending, deposit.B2TxCheck)
+
+	detail, err := a.Deposit("elsewhere")
+	require.NoError(t, err)
+	require.Len(t, detail.Mints, 1)
+	require.Len(t, detail.Audits, 1)
+	require.Equal(t, model.AdminActionDepositResolve, detail.Audits[0].Action)
+
+	status, err := admin.ParseDepositStatus("resolved")
+	require.NoError(t, err)
+	resolved, err := a.Deposits(admin.DepositFilter{Status: &status})
+	require.NoError(t, err)
+	require.Len(t, resolved, 2)
+	_, err = a.Deposit("unknown")
+	require.ErrorIs(t, err, admin.ErrDepositNotFound)
+}
+
+func TestParseDepositStatus(t *testing.T) {
+	status, err := admin.ParseDepositStatus("Insufficient_Balance")
+	require.NoError(t, err)
+	require.Equal(t, model.DepositB2TxStatusInsufficientBalance, status)
+	status, err = admin.ParseDepositStatus("13")
+	require.NoError(t, err)
+	require.Equal(t, model.DepositB2TxStatusResolved, status)
+	_, err = admin.ParseDepositStatus("99")
+	require.ErrorIs(t, err, admin.ErrUnknownStatus)
+	_, err = admin.ParseDepositStatus("minting")
+	require.ErrorIs(t, err, admin.ErrUnknownStatus)
+}
+
+func TestSetCursor(t *testing.T) {
+	db := openSqlite(t)
+	a := admin.NewAdmin(db, log.NewNopLogger())
+	_, err := a.SetCursor(100, 0, 200, change)
+	require.ErrorIs(t, err, admin.ErrNoCursor)
+	// indexed from block 100 up to tx 3 of block 150
+	require.NoError(t, db.Create(&model.BtcIndex{
+		Base:          model.Base{ID: 1},
+		BtcIndexBlock: 150, BtcIndexTx: 3,
+		StartHeight: 100,
+	}).Error)
+
+	// no indexer heartbeat to check
+	_, err = a.SetCursor(150, 4, 200, change)
+	require.ErrorIs(t, err, admin.ErrUnsafeCursor)
+	// the indexer stopped
+	store := storage.New(db)
+	require.NoError(t, store.Index().SaveHeartbeat(indexer.HeartbeatName("host/1"), "host/1", -time.Second))
+
+	_, err = a.SetCursor(0, 0, 200, change)
+	require.ErrorIs(t, err, admin.ErrInvalidCursor)
+	_, err = a.SetCursor(202, 0, 200, admin.Change{Operator: "ops", Reason: "INC-1", Force: true})
+	require.ErrorIs(t, err, admin.ErrUnsafeCursor)
+	// past the next tx 4 of block 150, before the start
+	for _, height := range []int64{151, 99} {
+		_, err = a.SetCursor(height, 0, 200, change)
+		require.ErrorIs(t, err, admin.ErrUnsafeCursor, height)
+	}
+	btcIndex, err := a.SetCursor(150, 4, 200, change)
+	require.NoError(t, err)
+	require.Equal(t, int64(150), btcIndex.BtcIndexBlock)
+	require.Equal(t, int64(3), btcIndex.BtcIndexTx)
+	btcIndex, err = a.SetCursor(120, 0, 200, change)
+	require.NoError(t, err)
+	require.Equal(t, int64(119), btcIndex.BtcIndexBlock)
+	require.Zero(t, btcIndex.BtcIndexTx)
+	require.Equal(t, int64(100), btcIndex.StartHeight)
+
+	// indexers are running without leader election, one stopping leaves the other beating
+	require.NoError(t, store.Index().SaveHeartbeat(indexer.HeartbeatName("host/1"), "host/1", time.Minute))
+	require.NoError(t, store.Index().SaveHeartbeat(indexer.HeartbeatName("host/2"), "host/2", time.Minute))
+	require.NoError(t, store.Index().SaveHeartbeat(indexer.HeartbeatName("host/1"), "host/1", 0))
+	_, err = a.SetCursor(110, 0, 200, change)
+	require.ErrorIs(t, err, admin.ErrUnsafeCursor)
+	require.ErrorContains(t, err, "indexer host/2 beat at")
+	require.NoError(t, store.Index().SaveHeartbeat(indexer.HeartbeatName("host/2"), "host/2", 0))
+
+	// an indexer is running
+	require.NoError(t, db.Create(&model.LeaderLease{Name: leader.LeaseName, Holder: "replica-0", ExpiresAt: time.Now().Add(time.Minute)}).Error)
+	_, err = a.SetCursor(110, 0, 200, change)
+	require.ErrorIs(t, err, admin.ErrUnsafeCursor)
+	_, err = a.SetCursor(110, 0, 200, admin.Change{Operator: "ops", Reason: "INC-1", Force: true})
+	require.NoError(t, err)
+
+	audits, err := a.Audits(admin.AuditFilter{Target: "btc_index:1"})
+	require.NoError(t, err)
+	require.Len(t, audits, 3)
+	require.True(t, audits[0].Forced)
+	require.False(t, audits[1].Forced)
+	var before model.BtcIndex
+	require.NoError(t, json.Unmarshal([]byte(audits[2].Before), &before))
+	require.Equal(t, int64(150), before.BtcIndexBlock)
+}
+
+func TestWithdraw(t *testing.T) {
+	db := openSqlite(t)
+	a := admin.NewAdmin(db, log.NewNopLogger())
+	withdraw := model.Withdraw{B2TxHash: "0x01", BtcTo: "abe1", BtcValue: 10}
+	require.NoError(t, db.Create(&withdraw).Error)
+	require.NoError(t, db.Create(&model.Withdraw{B2TxHash: "0x02"}).Error)
+	tx := model.WithdrawTx{BtcTxID: "t1", B2TxHashes: `["0x01","0x02"]`}
+	require.NoError(t, db.Create(&tx).Error)
+	rbf := model.WithdrawTx{BtcTxID: "t2", B2TxHashes: `["0x01","0x02"]`, ReplacesID: tx.ID, BumpType: model.WithdrawTxBumpRBF}
+	require.NoError(t, db.Create(&rbf).Error)
+	cpfp := model.WithdrawTx{BtcTxID: "t3", B2TxHashes: "[]", ReplacesID: rbf.ID, BumpType: model.WithdrawTxBumpCPFP}
+	require.NoError(t, db.Create(&cpfp).Error)
+	require.NoError(t, db.Create(&model.WithdrawTx{BtcTxID: "t4", B2TxHashes: `["0x03"]`}).Error)
+	require.NoError(t, db.Create(&model.WithdrawSign{WithdrawTxID: cpfp.ID, Signer: "02aa"}).Error)
+
+	for _, key := range []string{"0x01", "1"} {
+		detail, err := a.Withdraw(key)
+		require.NoError(t, err)
+		require.Equal(t, withdraw.ID, detail.Withdraw.ID)
+		require.Len(t, detail.Txs, 3)
+		require.Equal(t, "t3", detail.Txs[2].BtcTxID)
+		require.Len(t, detail.Signs, 1)
+	}
+	_, err := a.Withdraw("0x09")
+	require.ErrorIs(t, err, admin.ErrWithdrawNotFound)
+}
+
+func TestRefundWithdraw(t *testing.T) {
+	db := openSqlite(t)
+	a := admin.NewAdmin(db, log.NewNopLogger())
+	rejected := model.Withdraw{B2TxHash: "0x01", BtcValue: 10, Status: model.BtcTxWithdrawRejected}
+	require.NoError(t, db.Create(&rejected).Error)
+	require.NoError(t, db.Create(&model.Withdraw{B2TxHash: "0x02", BtcValue: 10, Status: model.BtcTxWithdrawSuccess}).Error)
+	require.NoError(t, db.Create(&model.RollupDeposit{B2TxHash: "0x11", BtcValue: 10}).Error)
+	require.NoError(t, db.Create(&model.RollupDeposit{B2TxHash: "0x12", BtcValue: 7}).Error)
+	require.NoError(t, db.Create(&model.RollupDeposit{BtcTxHash: "a", B2TxHash: "0x13", BtcValue: 10}).Error)
+
+	_, err := a.RefundWithdraw("0x01", "0x11", admin.Change{Operator: "ops"})
+	require.ErrorIs(t, err, admin.ErrReasonRequired)
+	_, err = a.RefundWithdraw("0x01", "", change)
+	require.ErrorIs(t, err, admin.ErrRefundTxHashRequired)
+	_, err = a.RefundWithdraw("0x02", "0x11", change)
+	require.ErrorIs(t, err, admin.ErrNotRefundable)
+	// a deposit mint is never a refund, an unindexed tx or another value needs force
+	_, err = a.RefundWithdraw("0x01", "0x13", admin.Change{Operator: "ops", Reason: "INC-1", Force: true})
+	require.ErrorIs(t, err, admin.ErrNotRefundable)
+	_, err = a.RefundWithdraw("0x01", "0x19", change)
+	require.ErrorIs(t, err, admin.ErrNotRefundable)
+	_, err = a.RefundWithdraw("0x01", "0x12", change)
+	require.ErrorIs(t, err, admin.ErrNotRefundable)
+
+	withdraw, err := a.RefundWithdraw("1", "0x11", change)
+	require.NoError(t, err)
+	require.Equal(t, model.BtcTxWithdrawRefunded, withdraw.Status)
+	require.Equal(t, "0x11", withdraw.RefundTxHash)
+	_, err = a.RefundWithdraw("0x01", "0x11", change)
+	require.ErrorIs(t, err, admin.ErrNotRefundable)
+
+	var audits []model.AdminAudit
+	require.NoError(t, db.Where("target = ?", "withdraw_history:1").Find(&audits).Error)
+	require.Len(t, audits, 1)
+	require.Equal(t, model.AdminActionWithdrawRefund, audits[0].Action)
+	require.False(t, audits[0].Forced)
+}
+
+type walletClient struct{}
+
+func (walletClient) BalanceAt(context.Context, common.Address, *big.Int) (*big.Int, error) {
+	return big.NewInt(1e18), nil
+}
+
+func (walletClient) NonceAt(context.Context, common.Address, *big.Int) (uint64, error) {
+	return 7, nil
+}
+
+func (walletClient) PendingNonceAt(context.Context, common.Address) (uint64, error) {
+	return 9, nil
+}
+
+func TestWalletStatus(t *testing.T) {
+	db := openSqlite(t)
+	a := admin.NewAdmin(db, log.NewNopLogger())
+	createDeposit(t, db, model.Deposit{BtcTxHash: "a", B2TxStatus: model.DepositB2TxStatusWaitMined, B2TxNonce: 8})
+	createDeposit(t, db, model.Deposit{BtcTxHash: "b", B2TxStatus: model.DepositB2TxStatusSuccess, B2TxNonce: 6})
+	address := common.HexToAddress("0x01")
+	status, err := a.WalletStatus(context.Background(), walletClient{}, address)
+	require.NoError(t, err)
+	require.Equal(t, address.Hex(), status.Address)
+	require.Equal(t, "1000000000000000000", status.Balance)
+	require.Equal(t, uint64(2), status.PendingTxs)
+	require.Len(t, status.InFlight, 1)
+	require.Equal(t, "a", status.InFlight[0].BtcTxHash)
+}
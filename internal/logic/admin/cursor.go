@@ -0,0 +1,133 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/b2network/b2-indexer/internal/leader"
+	"github.com/b2network/b2-indexer/internal/logic/indexer"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/storage"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid index cursor")
+	ErrUnsafeCursor  = errors.New("unsafe index cursor")
+	ErrNoCursor      = errors.New("index cursor not seeded")
+)
+
+// before reports whether position a is before position b, tx 0 is the start of the block
+func before(a, b [2]int64) bool {
+	return a[0] < b[0] || (a[0] == b[0] && a[1] < b[1])
+}
+
+// position returns the next block and tx indexed by an indexer going on with tx txIndex of block height
+func position(height int64, txIndex int64) [2]int64 {
+	block, tx := indexer.CursorAt(height, txIndex)
+	return indexer.NextPosition(model.BtcIndex{BtcIndexBlock: block, BtcIndexTx: tx})
+}
+
+// SetCursor moves the abelian index cursor for the indexer to go on with tx txIndex of
+// block height, tx 0 and 1 are the start of the block. Moving back reindexes blocks, the
+// deposits are upserted by output. Heights beyond the block after tip are refused, moving
+// forward past unindexed blocks, before the seeded start, while an indexer holds the
+// leader lease or beats, or without an indexer heartbeat to check needs change.Force.
+func (a *Admin) SetCursor(height int64, txIndex int64, tip int64, change Change) (*model.BtcIndex, error) {
+	if err := change.validate(); err != nil {
+		return nil, err
+	}
+	if height <= 0 || txIndex < 0 {
+		return nil, fmt.Errorf("%w: height %d tx index %d", ErrInvalidCursor, height, txIndex)
+	}
+	if height > tip+1 {
+		return nil, fmt.Errorf("%w: height %d beyond the block after the tip %d", ErrUnsafeCursor, height, tip)
+	}
+	lease, err := a.heldLease()
+	if err != nil {
+		return nil, err
+	}
+	running, err := a.runningIndexer()
+	if err != nil {
+		return nil, err
+	}
+	var btcIndex model.BtcIndex
+	err = a.store.Transaction(func(store storage.Store) error {
+		current, err := store.Index().LockBtcIndex()
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNoCursor
+			}
+			return err
+		}
+		next := position(height, txIndex)
+		var unsafe []string
+		if current.StartHeight > 0 && before(next, position(current.StartHeight, current.StartTxIndex)) {
+			unsafe = append(unsafe, fmt.Sprintf("before the start height %d tx %d", current.StartHeight, current.StartTxIndex))
+		}
+		if before(indexer.NextPosition(current), next) {
+			unsafe = append(unsafe, fmt.Sprintf("skips the unindexed blocks from %d", indexer.NextPosition(current)[0]))
+		}
+		if lease != nil {
+			unsafe = append(unsafe, fmt.Sprintf("indexer %s holds the leader lease until %s", lease.Holder, lease.ExpiresAt.Format(time.RFC3339)))
+		}
+		if running != "" {
+			unsafe = append(unsafe, running)
+		}
+		if len(unsafe) > 0 && !change.Force {
+			return fmt.Errorf("%w: %s, use force", ErrUnsafeCursor, strings.Join(unsafe, ", "))
+		}
+		btcIndex = current
+		btcIndex.BtcIndexBlock, btcIndex.BtcIndexTx = indexer.CursorAt(height, txIndex)
+		if err = store.Index().SaveBtcIndex(&btcIndex); err != nil {
+			return err
+		}
+		return audit(store, model.AdminActionIndexSetCursor, target(model.BtcIndex{}.TableName(), current.ID),
+			change, len(unsafe) > 0, current, btcIndex)
+	})
+	if err != nil {
+		return nil, err
+	}
+	a.log.Infow("admin index cursor set", "block", btcIndex.BtcIndexBlock, "tx", btcIndex.BtcIndexTx,
+		"operator", change.Operator, "forced", change.Force)
+	return &btcIndex, nil
+}
+
+// heldLease returns the unexpired leader lease of the indexers by the db clock, nil if no
+// indexer holds it
+func (a *Admin) heldLease() (*model.LeaderLease, error) {
+	lease, err := a.store.Index().Lease(leader.LeaseName)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &lease, nil
+}
+
+// runningIndexer returns why an indexer may be running by the heartbeats, empty if they all
+// expired by the db clock. An indexer without heartbeat may be running too, it cannot be told.
+func (a *Admin) runningIndexer() (string, error) {
+	live, err := a.store.Index().Heartbeats(indexer.HeartbeatPrefix, true)
+	if err != nil {
+		return "", err
+	}
+	if len(live) > 0 {
+		running := make([]string, 0, len(live))
+		for _, heartbeat := range live {
+			running = append(running, fmt.Sprintf("indexer %s beat at %s", heartbeat.Holder, heartbeat.UpdatedAt.Format(time.RFC3339)))
+		}
+		return strings.Join(running, ", "), nil
+	}
+	heartbeats, err := a.store.Index().Heartbeats(indexer.HeartbeatPrefix, false)
+	if err != nil {
+		return "", err
+	}
+	if len(heartbeats) == 0 {
+		return "no indexer heartbeat to check that no indexer is running", nil
+	}
+	return "", nil
+}
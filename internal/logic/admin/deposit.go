@@ -0,0 +1,293 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/b2network/b2-indexer/internal/logic/indexer"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/storage"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrDepositNotFound = errors.New("deposit not found")
+	ErrMintNotFound    = errors.New("rollup deposit of the b2 tx not found")
+	ErrNotRetryable    = errors.New("deposit is not retryable")
+	ErrNotResolvable   = errors.New("deposit is not resolvable")
+	ErrUnknownStatus   = errors.New("unknown deposit status")
+)
+
+// inFlightStatus are the b2 tx statuses of a deposit whose mint may still be mined
+var inFlightStatus = map[int]bool{
+	model.DepositB2TxStatusWaitMinedFailed:         true,
+	model.DepositB2TxStatusContextDeadlineExceeded: true,
+	model.DepositB2TxStatusWaitMined:               true,
+	model.DepositB2TxStatusIsPending:               true,
+	model.DepositB2TxStatusNonceToLow:              true,
+}
+
+// retriedStatus are the b2 tx statuses the deposit service retries up to indexer.DepositMaxRetry times
+var retriedStatus = map[int]bool{
+	model.DepositB2TxStatusPending:                    true,
+	model.DepositB2TxStatusInsufficientBalance:        true,
+	model.DepositB2TxStatusFromAccountGasInsufficient: true,
+}
+
+func minted(status int) bool {
+	return status == model.DepositB2TxStatusSuccess || status == model.DepositB2TxStatusTxHashExist
+}
+
+// ParseDepositStatus returns the b2 tx status of a name of model.DepositB2TxStatusNames or a number
+func ParseDepositStatus(s string) (int, error) {
+	if status, ok := model.DepositB2TxStatusNames[strings.ToLower(s)]; ok {
+		return status, nil
+	}
+	status, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownStatus, s)
+	}
+	for _, v := range model.DepositB2TxStatusNames {
+		if v == status {
+			return status, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", ErrUnknownStatus, s)
+}
+
+// DepositDetail is a deposit tx with its outputs, l2 mints and audited repairs
+type DepositDetail struct {
+	Deposits []model.Deposit       `json:"deposits"`
+	Mints    []model.RollupDeposit `json:"mints"`
+	Audits   []model.AdminAudit    `json:"audits"`
+}
+
+// Deposit returns the deposits of the abelian tx txHash
+func (a *Admin) Deposit(txHash string) (*DepositDetail, error) {
+	detail := &DepositDetail{}
+	err := a.db.
+		Where(fmt.Sprintf("%s = ?", model.Deposit{}.Column().BtcTxHash), txHash).
+		Order(model.Deposit{}.Column().BtcTxOutput).
+		Find(&detail.Deposits).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(detail.Deposits) == 0 {
+		return nil, ErrDepositNotFound
+	}
+	err = a.db.
+		Where(fmt.Sprintf("%s = ?", model.RollupDeposit{}.Column().BtcTxHash), txHash).
+		Order("id").
+		Find(&detail.Mints).Error
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]string, 0, len(detail.Deposits))
+	for _, d := range detail.Deposits {
+		targets = append(targets, target(model.Deposit{}.TableName(), d.ID))
+	}
+	err = a.db.
+		Where(fmt.Sprintf("%s IN (?)", model.AdminAudit{}.Column().Target), targets).
+		Order("id").
+		Find(&detail.Audits).Error
+	if err != nil {
+		return nil, err
+	}
+	return detail, nil
+}
+
+// DepositFilter selects the deposits listed, a nil status matches all deposits
+type DepositFilter struct {
+	Status *int
+	Limit  int
+}
+
+// Deposits returns the latest deposits of filter
+func (a *Admin) Deposits(filter DepositFilter) ([]model.Deposit, error) {
+	query := a.db.Model(&model.Deposit{})
+	if filter.Status != nil {
+		query = query.Where(fmt.Sprintf("%s = ?", model.Deposit{}.Column().B2TxStatus), *filter.Status)
+	}
+	var deposits []model.Deposit
+	err := query.Order("id DESC").Limit(limit(filter.Limit)).Find(&deposits).Error
+	return deposits, err
+}
+
+// MintClient is the l2 client checking the recorded mint tx of a deposit before a retry
+type MintClient interface {
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*ethtypes.Receipt, error)
+	TransactionByHash(ctx context.Context, hash common.Hash) (*ethtypes.Transaction, bool, error)
+}
+
+// mintDead checks the recorded mint tx of a deposit on l2. It fails while the tx is pending
+// or minted, and reports whether the tx can no longer be mined: it reverted, or its nonce
+// was taken by another tx.
+func mintDead(ctx context.Context, client MintClient, d model.Deposit) (bool, error) {
+	hash := common.HexToHash(d.B2TxHash)
+	// the nonce is read first, a tx of the nonce mined before has its receipt then
+	var nonce uint64
+	if d.B2TxFrom != "" {
+		var err error
+		if nonce, err = client.NonceAt(ctx, common.HexToAddress(d.B2TxFrom), nil); err != nil {
+			return false, err
+		}
+	}
+	receipt, err := client.TransactionReceipt(ctx, hash)
+	if err == nil {
+		if receipt.Status == ethtypes.ReceiptStatusSuccessful {
+			return false, fmt.Errorf("%w: b2 tx %s minted in block %s, mark it resolved with its b2 tx hash",
+				ErrNotRetryable, d.B2TxHash, receipt.BlockNumber)
+		}
+		return true, nil
+	}
+	if !errors.Is(err, ethereum.NotFound) {
+		return false, err
+	}
+	_, isPending, err := client.TransactionByHash(ctx, hash)
+	if err != nil && !errors.Is(err, ethereum.NotFound) {
+		return false, err
+	}
+	if err == nil && isPending {
+		return false, fmt.Errorf("%w: b2 tx %s is pending", ErrNotRetryable, d.B2TxHash)
+	}
+	return d.B2TxFrom != "" && nonce > d.B2TxNonce, nil
+}
+
+// RetryDeposit puts a deposit back to pending for the deposit service to mint it again.
+// A recorded mint tx pending or minted on l2 is never retried, one that reverted or whose
+// nonce another tx took is. Failed deposits and deposits out of retries are retried, other
+// deposits need change.Force, deposits already minted are never retried.
+func (a *Admin) RetryDeposit(ctx context.Context, client MintClient, txHash string, output int64, change Change) (*model.Deposit, error) {
+	if err := change.validate(); err != nil {
+		return nil, err
+	}
+	deposit, err := a.store.Deposits().ByOutput(txHash, output)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDepositNotFound
+		}
+		return nil, err
+	}
+	// the recorded mint tx is checked on l2 before the deposit is locked
+	dead := false
+	if deposit.B2TxHash != "" && !minted(deposit.B2TxStatus) {
+		if dead, err = mintDead(ctx, client, deposit); err != nil {
+			return nil, err
+		}
+	}
+	check := func(d model.Deposit) (bool, error) {
+		if minted(d.B2TxStatus) {
+			return false, fmt.Errorf("%w: already minted with status %d", ErrNotRetryable, d.B2TxStatus)
+		}
+		if d.ListenerStatus != model.ListenerStatusSuccess {
+			return false, fmt.Errorf("%w: not confirmed by the listener", ErrNotRetryable)
+		}
+		if d.B2TxHash != deposit.B2TxHash {
+			return false, fmt.Errorf("%w: b2 tx changed to %s while checked, run again", ErrNotRetryable, d.B2TxHash)
+		}
+		switch {
+		case dead,
+			d.B2TxStatus == model.DepositB2TxStatusFailed,
+			d.B2TxStatus == model.DepositB2TxStatusWaitMinedStatusFailed,
+			retriedStatus[d.B2TxStatus] && d.B2TxRetry > indexer.DepositMaxRetry:
+			return false, nil
+		case change.Force:
+			return true, nil
+		case inFlightStatus[d.B2TxStatus]:
+			return false, fmt.Errorf("%w: mint with status %d may still be mined, use force", ErrNotRetryable, d.B2TxStatus)
+		default:
+			return false, fmt.Errorf("%w: status %d retry %d, use force", ErrNotRetryable, d.B2TxStatus, d.B2TxRetry)
+		}
+	}
+	return a.updateDeposit(txHash, output, model.AdminActionDepositRetry, change, check, map[string]interface{}{
+		model.Deposit{}.Column().B2TxStatus: model.DepositB2TxStatusPending,
+		model.Deposit{}.Column().B2TxRetry:  0,
+	})
+}
+
+// ResolveDeposit marks a deposit the indexer will not mint as resolved. With b2TxHash the
+// deposit is marked minted by that l2 tx instead, and checked against its rollup deposit
+// by the deposit service. Deposits whose mint may still be mined need change.Force.
+func (a *Admin) ResolveDeposit(txHash string, output int64, b2TxHash string, change Change) (*model.Deposit, error) {
+	if err := change.validate(); err != nil {
+		return nil, err
+	}
+	updateFields := map[string]interface{}{
+		model.Deposit{}.Column().B2TxStatus: model.DepositB2TxStatusResolved,
+	}
+	if b2TxHash != "" {
+		var mint model.RollupDeposit
+		err := a.db.
+			Where(fmt.Sprintf("%s = ? AND %s = ?", model.RollupDeposit{}.Column().B2TxHash, model.RollupDeposit{}.Column().BtcTxHash),
+				b2TxHash, txHash).
+			First(&mint).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrMintNotFound
+			}
+			return nil, err
+		}
+		updateFields = map[string]interface{}{
+			model.Deposit{}.Column().B2TxStatus: model.DepositB2TxStatusSuccess,
+			model.Deposit{}.Column().B2TxHash:   mint.B2TxHash,
+			model.Deposit{}.Column().B2TxFrom:   mint.B2TxFrom,
+			model.Deposit{}.Column().B2TxCheck:  model.B2CheckStatusPending,
+		}
+	}
+	check := func(d model.Deposit) (bool, error) {
+		if minted(d.B2TxStatus) || d.B2TxStatus == model.DepositB2TxStatusResolved {
+			return false, fmt.Errorf("%w: already settled with status %d", ErrNotResolvable, d.B2TxStatus)
+		}
+		if inFlightStatus[d.B2TxStatus] {
+			if !change.Force {
+				return false, fmt.Errorf("%w: mint with status %d may still be mined, use force", ErrNotResolvable, d.B2TxStatus)
+			}
+			return true, nil
+		}
+		return false, nil
+	}
+	return a.updateDeposit(txHash, output, model.AdminActionDepositResolve, change, check, updateFields)
+}
+
+// updateDeposit locks a deposit, updates it if check passes and audits the change,
+// check reports whether change.Force overrode a safety check
+func (a *Admin) updateDeposit(txHash string, output int64, action string, change Change,
+	check func(model.Deposit) (bool, error), updateFields map[string]interface{},
+) (*model.Deposit, error) {
+	var deposit model.Deposit
+	err := a.store.Transaction(func(store storage.Store) error {
+		before, err := store.Deposits().LockByOutput(txHash, output)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrDepositNotFound
+			}
+			return err
+		}
+		forced, err := check(before)
+		if err != nil {
+			return err
+		}
+		if err = store.Deposits().Update(before.ID, updateFields); err != nil {
+			return err
+		}
+		deposit, err = store.Deposits().ByOutput(txHash, output)
+		if err != nil {
+			return err
+		}
+		return audit(store, action, target(model.Deposit{}.TableName(), deposit.ID), change, forced, before, deposit)
+	})
+	if err != nil {
+		return nil, err
+	}
+	a.log.Infow("admin deposit changed", "action", action, "btcTxHash", txHash, "output", output,
+		"operator", change.Operator, "status", deposit.B2TxStatus)
+	return &deposit, nil
+}
@@ -0,0 +1,68 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// WalletClient is the l2 client of the wallet minting the deposits
+type WalletClient interface {
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+}
+
+// WalletStatus is the l2 state of the wallet minting the deposits
+type WalletStatus struct {
+	Address string `json:"address"`
+	// Balance is in wei
+	Balance      string `json:"balance"`
+	Nonce        uint64 `json:"nonce"`
+	PendingNonce uint64 `json:"pending_nonce"`
+	// PendingTxs are the txs of the wallet in the l2 mempool
+	PendingTxs uint64 `json:"pending_txs"`
+	// InFlight are the deposits whose mint may still be mined
+	InFlight []model.Deposit `json:"in_flight"`
+}
+
+// WalletStatus returns the l2 state of the wallet address and the deposits it is minting
+func (a *Admin) WalletStatus(ctx context.Context, client WalletClient, address common.Address) (*WalletStatus, error) {
+	balance, err := client.BalanceAt(ctx, address, nil)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := client.NonceAt(ctx, address, nil)
+	if err != nil {
+		return nil, err
+	}
+	pendingNonce, err := client.PendingNonceAt(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	status := &WalletStatus{
+		Address:      address.Hex(),
+		Balance:      balance.String(),
+		Nonce:        nonce,
+		PendingNonce: pendingNonce,
+	}
+	if pendingNonce > nonce {
+		status.PendingTxs = pendingNonce - nonce
+	}
+	statuses := make([]int, 0, len(inFlightStatus))
+	for s := range inFlightStatus {
+		statuses = append(statuses, s)
+	}
+	err = a.db.
+		Where(fmt.Sprintf("%s IN (?)", model.Deposit{}.Column().B2TxStatus), statuses).
+		Order(model.Deposit{}.Column().B2TxNonce).
+		Limit(DefaultLimit).
+		Find(&status.InFlight).Error
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
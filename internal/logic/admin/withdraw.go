@@ -0,0 +1,142 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/storage"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrWithdrawNotFound     = errors.New("withdraw not found")
+	ErrNotRefundable        = errors.New("withdraw is not refundable")
+	ErrRefundTxHashRequired = errors.New("refund b2 tx hash is required")
+)
+
+// WithdrawDetail is a withdraw with the abelian txs paying it, fee bumps included, and their signatures
+type WithdrawDetail struct {
+	Withdraw model.Withdraw       `json:"withdraw"`
+	Txs      []model.WithdrawTx   `json:"txs"`
+	Signs    []model.WithdrawSign `json:"signs"`
+}
+
+// Withdraw returns the withdraw of an id or of its b2 tx hash
+func (a *Admin) Withdraw(idOrB2TxHash string) (*WithdrawDetail, error) {
+	detail := &WithdrawDetail{}
+	query := a.db.Where(fmt.Sprintf("%s = ?", model.Withdraw{}.Column().B2TxHash), idOrB2TxHash)
+	if id, err := strconv.ParseInt(idOrB2TxHash, 10, 64); err == nil {
+		query = a.db.Where("id = ?", id)
+	}
+	if err := query.First(&detail.Withdraw).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWithdrawNotFound
+		}
+		return nil, err
+	}
+	// the txs listing the b2 tx hash, RBF bumps copy the list, then the CPFP bumps of them
+	err := a.db.
+		Where(fmt.Sprintf("%s LIKE ?", model.WithdrawTx{}.Column().B2TxHashes), fmt.Sprintf("%%%q%%", detail.Withdraw.B2TxHash)).
+		Order("id").
+		Find(&detail.Txs).Error
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(detail.Txs))
+	for _, tx := range detail.Txs {
+		ids = append(ids, tx.ID)
+	}
+	for replaced := ids; len(replaced) > 0; {
+		var bumps []model.WithdrawTx
+		err = a.db.
+			Where(fmt.Sprintf("%s IN (?) AND %s = ?", model.WithdrawTx{}.Column().ReplacesID, model.WithdrawTx{}.Column().BumpType),
+				replaced, model.WithdrawTxBumpCPFP).
+			Order("id").
+			Find(&bumps).Error
+		if err != nil {
+			return nil, err
+		}
+		replaced = nil
+		for _, bump := range bumps {
+			detail.Txs = append(detail.Txs, bump)
+			ids = append(ids, bump.ID)
+			replaced = append(replaced, bump.ID)
+		}
+	}
+	if len(ids) > 0 {
+		err = a.db.
+			Where(fmt.Sprintf("%s IN (?)", model.WithdrawSign{}.Column().WithdrawTxID), ids).
+			Order("id").
+			Find(&detail.Signs).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return detail, nil
+}
+
+// RefundWithdraw marks a withdraw rejected by the risk engine as refunded by the l2 tx
+// refundTxHash, the operators minted its burned value back to the sender. The refund is
+// checked against the rollup deposit of the tx: a tx not indexed yet or minting another
+// value needs change.Force, a tx minting an abelian deposit is never a refund.
+func (a *Admin) RefundWithdraw(idOrB2TxHash string, refundTxHash string, change Change) (*model.Withdraw, error) {
+	if err := change.validate(); err != nil {
+		return nil, err
+	}
+	if refundTxHash == "" {
+		return nil, ErrRefundTxHashRequired
+	}
+	detail, err := a.Withdraw(idOrB2TxHash)
+	if err != nil {
+		return nil, err
+	}
+	forced := false
+	var mint model.RollupDeposit
+	err = a.db.Where(fmt.Sprintf("%s = ?", model.RollupDeposit{}.Column().B2TxHash), refundTxHash).First(&mint).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if !change.Force {
+			return nil, fmt.Errorf("%w: b2 tx %s is not indexed as a rollup deposit, use force", ErrNotRefundable, refundTxHash)
+		}
+		forced = true
+	case err != nil:
+		return nil, err
+	case mint.BtcTxHash != "":
+		return nil, fmt.Errorf("%w: b2 tx %s mints the abelian deposit %s", ErrNotRefundable, refundTxHash, mint.BtcTxHash)
+	case mint.BtcValue != detail.Withdraw.BtcValue:
+		if !change.Force {
+			return nil, fmt.Errorf("%w: b2 tx %s mints %d, the withdraw burned %d, use force",
+				ErrNotRefundable, refundTxHash, mint.BtcValue, detail.Withdraw.BtcValue)
+		}
+		forced = true
+	}
+	var withdraw model.Withdraw
+	err = a.store.Transaction(func(store storage.Store) error {
+		before, err := store.Withdraws().LockByID(detail.Withdraw.ID)
+		if err != nil {
+			return err
+		}
+		if before.Status != model.BtcTxWithdrawRejected {
+			return fmt.Errorf("%w: status %d is not rejected", ErrNotRefundable, before.Status)
+		}
+		err = store.Withdraws().Update(before.ID, map[string]interface{}{
+			model.Withdraw{}.Column().Status:       model.BtcTxWithdrawRefunded,
+			model.Withdraw{}.Column().RefundTxHash: refundTxHash,
+		})
+		if err != nil {
+			return err
+		}
+		if withdraw, err = store.Withdraws().ByID(before.ID); err != nil {
+			return err
+		}
+		return audit(store, model.AdminActionWithdrawRefund, target(model.Withdraw{}.TableName(), withdraw.ID), change, forced, before, withdraw)
+	})
+	if err != nil {
+		return nil, err
+	}
+	a.log.Infow("admin withdraw refunded", "id", withdraw.ID, "b2TxHash", withdraw.B2TxHash,
+		"refundTxHash", refundTxHash, "operator", change.Operator)
+	return &withdraw, nil
+}
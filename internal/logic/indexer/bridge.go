@@ -14,6 +14,7 @@ import (
 	"sync"
 
 	config2 "github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/metrics"
 	b2types "github.com/b2network/b2-indexer/internal/types"
 	"github.com/b2network/b2-indexer/pkg/aa"
 	"github.com/b2network/b2-indexer/pkg/log"
@@ -25,6 +26,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/tidwall/gjson"
 )
 
@@ -37,9 +39,25 @@ var (
 	ErrOldNonceToHeight                         = errors.New("old nonce params to height")
 )
 
+// EthClient is the rollup rpc used by the bridge, *ethclient.Client and the
+// go-ethereum simulated backend client implement it
+type EthClient interface {
+	bind.DeployBackend
+	ChainID(ctx context.Context) (*big.Int, error)
+	BlockNumber(ctx context.Context) (uint64, error)
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+	SuggestGasPrice(ctx context.Context) (*big.Int, error)
+	EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64, error)
+	SendTransaction(ctx context.Context, tx *types.Transaction) error
+	TransactionByHash(ctx context.Context, hash common.Hash) (tx *types.Transaction, isPending bool, err error)
+}
+
 // Bridge bridge
 // TODO: only L1 -> L2, More calls may be supported later
 type Bridge struct {
+	client               EthClient
 	EthRPCURL            string
 	EthPrivKey           *ecdsa.PrivateKey
 	ContractAddress      common.Address
@@ -69,7 +87,16 @@ func NewBridge(bridgeCfg config2.BridgeConfig, abiFileDir string, log log.Logger
 	if err != nil {
 		return nil, err
 	}
+	bridgeCfg.EthRPCURL = rpcURL.String()
+	client, err := dial(bridgeCfg.EthRPCURL)
+	if err != nil {
+		return nil, err
+	}
+	return NewBridgeWithClient(client, bridgeCfg, abiFileDir, log, network)
+}
 
+// NewBridgeWithClient returns a bridge sending the rollup txs through client
+func NewBridgeWithClient(client EthClient, bridgeCfg config2.BridgeConfig, abiFileDir string, log log.Logger, network string) (*Bridge, error) {
 	var ABI string
 
 	abiFile, err := os.ReadFile(path.Join(abiFileDir, bridgeCfg.ABI))
@@ -102,7 +129,8 @@ func NewBridge(bridgeCfg config2.BridgeConfig, abiFileDir string, log log.Logger
 	}
 	log.Infof("load eth address: %s", crypto.PubkeyToAddress(privateKey.PublicKey))
 	return &Bridge{
-		EthRPCURL:       rpcURL.String(),
+		client:          client,
+		EthRPCURL:       bridgeCfg.EthRPCURL,
 		ContractAddress: common.HexToAddress(bridgeCfg.ContractAddress),
 		EthPrivKey:      privateKey,
 		ABI:             ABI,
@@ -231,10 +259,7 @@ func (b *Bridge) sendTransaction(ctx context.Context, fromPriv *ecdsa.PrivateKey
 ) (*types.Transaction, error) {
 	txLock.Lock()
 	defer txLock.Unlock()
-	client, err := ethclient.Dial(b.EthRPCURL)
-	if err != nil {
-		return nil, err
-	}
+	client := b.client
 	fromAddress := crypto.PubkeyToAddress(fromPriv.PublicKey)
 
 	nonce, err := client.PendingNonceAt(ctx, fromAddress)
@@ -246,12 +271,11 @@ func (b *Bridge) sendTransaction(ctx context.Context, fromPriv *ecdsa.PrivateKey
 		// If db sets a nonce that is too high, the pending nonce will be too large
 		// There is virtually no transaction in between
 		// Manual handling may be required at this time
-		var latestTxCount hexutil.Uint64
-		err := client.Client().CallContext(ctx, &latestTxCount, "eth_getTransactionCount", fromAddress, "latest")
+		latestTxCount, err := client.NonceAt(ctx, fromAddress, nil)
 		if err != nil {
 			return nil, err
 		}
-		if oldNonce > uint64(latestTxCount) {
+		if oldNonce > latestTxCount {
 			return nil, ErrOldNonceToHeight
 		}
 		nonce = oldNonce
@@ -343,21 +367,17 @@ func (b *Bridge) retrySendTransaction(
 ) (*types.Transaction, error) {
 	txLock.Lock()
 	defer txLock.Unlock()
-	client, err := ethclient.Dial(b.EthRPCURL)
-	if err != nil {
-		return nil, err
-	}
+	client := b.client
 	fromAddress := crypto.PubkeyToAddress(fromPriv.PublicKey)
 	nonce := oldTx.Nonce()
-	var latestTxCount hexutil.Uint64
-	err = client.Client().CallContext(ctx, &latestTxCount, "eth_getTransactionCount", fromAddress, "latest")
+	latestTxCount, err := client.NonceAt(ctx, fromAddress, nil)
 	if err != nil {
 		return nil, err
 	}
 	if resetNonce {
-		nonce = uint64(latestTxCount)
+		nonce = latestTxCount
 	}
-	if nonce > uint64(latestTxCount) {
+	if nonce > latestTxCount {
 		return nil, ErrOldNonceToHeight
 	}
 
@@ -476,12 +496,7 @@ func (b *Bridge) BitcoinAddressToEthAddress(hash string, bitcoinAddress b2types.
 
 // WaitMined wait tx mined
 func (b *Bridge) WaitMined(ctx context.Context, tx *types.Transaction, _ []byte) (*types.Receipt, error) {
-	client, err := ethclient.Dial(b.EthRPCURL)
-	if err != nil {
-		return nil, err
-	}
-
-	receipt, err := bind.WaitMined(ctx, client, tx)
+	receipt, err := bind.WaitMined(ctx, b.client, tx)
 	if err != nil {
 		return nil, err
 	}
@@ -493,12 +508,7 @@ func (b *Bridge) WaitMined(ctx context.Context, tx *types.Transaction, _ []byte)
 }
 
 func (b *Bridge) TransactionReceipt(hash string) (*types.Receipt, error) {
-	client, err := ethclient.Dial(b.EthRPCURL)
-	if err != nil {
-		return nil, err
-	}
-
-	receipt, err := client.TransactionReceipt(context.Background(), common.HexToHash(hash))
+	receipt, err := b.client.TransactionReceipt(context.Background(), common.HexToHash(hash))
 	if err != nil {
 		return nil, err
 	}
@@ -506,12 +516,7 @@ func (b *Bridge) TransactionReceipt(hash string) (*types.Receipt, error) {
 }
 
 func (b *Bridge) TransactionByHash(hash string) (*types.Transaction, bool, error) {
-	client, err := ethclient.Dial(b.EthRPCURL)
-	if err != nil {
-		return nil, false, err
-	}
-
-	tx, isPending, err := client.TransactionByHash(context.Background(), common.HexToHash(hash))
+	tx, isPending, err := b.client.TransactionByHash(context.Background(), common.HexToHash(hash))
 	if err != nil {
 		return nil, false, err
 	}
@@ -523,6 +528,31 @@ func (b *Bridge) FromAddress() string {
 	return fromAddress.String()
 }
 
+// FromBalance returns the balance of the from address in wei
+func (b *Bridge) FromBalance() (*big.Int, error) {
+	return b.client.BalanceAt(context.Background(), crypto.PubkeyToAddress(b.EthPrivKey.PublicKey), nil)
+}
+
+// Ping checks the rollup rpc is reachable
+func (b *Bridge) Ping(ctx context.Context) error {
+	_, err := b.client.BlockNumber(ctx)
+	return err
+}
+
+// dial connects to the rollup rpc, http calls are observed by the rpc metrics
+// DialEthClient dials the l2 rpc with the rpc metrics of the bridge
+func DialEthClient(rawURL string) (*ethclient.Client, error) {
+	return dial(rawURL)
+}
+
+func dial(rawURL string) (*ethclient.Client, error) {
+	client, err := rpc.DialOptions(context.Background(), rawURL, rpc.WithHTTPClient(metrics.NewRPCHTTPClient(metrics.RPCChainEVM)))
+	if err != nil {
+		return nil, err
+	}
+	return ethclient.NewClient(client), nil
+}
+
 func has0xPrefix(input string) bool {
 	return len(input) >= 2 && input[0] == '0' && (input[1] == 'x' || input[1] == 'X')
 }
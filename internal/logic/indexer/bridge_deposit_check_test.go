@@ -0,0 +1,31 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindMint(t *testing.T) {
+	db := openSqlite(t)
+	require.NoError(t, db.Create(&model.RollupDeposit{BtcTxHash: "single", BtcValue: 10, B2TxHash: "0x01"}).Error)
+	require.NoError(t, db.Create(&model.RollupDeposit{BtcTxHash: "single", BtcValue: 20, B2TxHash: "0x02"}).Error)
+	require.NoError(t, db.Create(&model.RollupDeposit{BtcTxHash: "several", BtcValue: 10, B2TxHash: "0x03"}).Error)
+	single := model.Deposit{BtcTxHash: "single", BtcValue: 20, B2TxStatus: model.DepositB2TxStatusTxHashExist}
+	require.NoError(t, db.Create(&single).Error)
+	for output := int64(0); output < 2; output++ {
+		require.NoError(t, db.Create(&model.Deposit{BtcTxHash: "several", BtcTxOutput: output, BtcValue: 10}).Error)
+	}
+
+	// matched by tx and value
+	mint, err := findMint(db, single)
+	require.NoError(t, err)
+	require.Equal(t, "0x02", mint.B2TxHash)
+	// a sent deposit by its b2 tx
+	mint, err = findMint(db, model.Deposit{BtcTxHash: "several", B2TxHash: "0x03", B2TxStatus: model.DepositB2TxStatusSuccess})
+	require.NoError(t, err)
+	require.Equal(t, "0x03", mint.B2TxHash)
+	_, err = findMint(db, model.Deposit{BtcTxHash: "several", BtcValue: 10, B2TxStatus: model.DepositB2TxStatusTxHashExist})
+	require.ErrorIs(t, err, ErrAmbiguousMint)
+}
@@ -8,7 +8,10 @@ import (
 	"time"
 
 	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/health"
+	"github.com/b2network/b2-indexer/internal/leader"
 	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/supervisor"
 	"github.com/b2network/b2-indexer/internal/types"
 	"github.com/b2network/b2-indexer/pkg/log"
 	"github.com/cometbft/cometbft/libs/service"
@@ -19,15 +22,26 @@ import (
 
 const (
 	BridgeDepositServiceName = "BitcoinBridgeDepositService"
-	BatchDepositWaitTimeout  = 10 * time.Second
 	DepositErrTimeout        = 20 * time.Second
 	BatchDepositLimit        = 100
-	WaitMinedTimeout         = 20 * time.Second
-	HandleDepositTimeout     = 1 * time.Second
 	DepositRetry             = 10 // temp fix, Increase retry times
+	// DepositMaxRetry is the b2_tx_retry after which a pending deposit is no longer sent
+	DepositMaxRetry = 300
 )
 
-var ErrServerStop = errors.New("server stop")
+// the deposit loop intervals, the e2e tests shorten them
+var (
+	BatchDepositWaitTimeout = 10 * time.Second
+	WaitMinedTimeout        = 20 * time.Second
+	HandleDepositTimeout    = 1 * time.Second
+	CheckDepositTimeout     = 2 * time.Second
+)
+
+var (
+	ErrServerStop = errors.New("server stop")
+	// ErrAmbiguousMint is a deposit whose mint event cannot be told from the other deposits of its tx
+	ErrAmbiguousMint = errors.New("mint of the deposit is ambiguous")
+)
 
 // BridgeDepositService l1->l2
 type BridgeDepositService struct {
@@ -37,8 +51,8 @@ type BridgeDepositService struct {
 	btcIndexer types.BitcoinTxIndexer
 	db         *gorm.DB
 	log        log.Logger
-	//wg         sync.WaitGroup
-	stopChan chan struct{}
+	loops      *supervisor.Loops
+	stopChan   <-chan struct{}
 }
 
 // NewBridgeDepositService returns a new service instance.
@@ -60,20 +74,37 @@ func NewBridgeDepositService(
 	return is
 }
 
-// OnStart
+// OnStart starts the deposit loops
 func (bis *BridgeDepositService) OnStart() error {
-	go bis.Deposit()
+	bis.loops = supervisor.NewLoops()
+	bis.stopChan = bis.loops.Quit()
+	bis.loops.Go(func() error {
+		bis.Deposit()
+		return nil
+	})
 	if bis.bridgeCfg.EnableRollupListener {
-		go bis.CheckDeposit()
+		bis.loops.Go(func() error {
+			bis.CheckDeposit()
+			return nil
+		})
 	}
-	bis.stopChan = make(chan struct{})
 	return nil
 }
 
+// OnStop waits for the deposit being sent to finish
 func (bis *BridgeDepositService) OnStop() {
 	bis.log.Warnf("bridge deposit service stoping...")
-	close(bis.stopChan)
-	//bis.wg.Wait()
+	bis.loops.Stop()
+}
+
+// Crashed implements supervisor.Service
+func (bis *BridgeDepositService) Crashed() <-chan struct{} {
+	return bis.loops.Crashed()
+}
+
+// Err implements supervisor.Service
+func (bis *BridgeDepositService) Err() error {
+	return bis.loops.Err()
 }
 
 func (bis *BridgeDepositService) Deposit() {
@@ -85,6 +116,8 @@ func (bis *BridgeDepositService) Deposit() {
 			bis.log.Warnf("deposit stopping...")
 			return
 		case <-time.After(BatchDepositWaitTimeout):
+			health.Beat(health.ComponentBridgeDeposit)
+			bis.updateMetrics()
 			// Priority processing UnconfirmedDeposit
 			err := bis.UnconfirmedDeposit()
 			if err != nil {
@@ -118,6 +151,7 @@ func (bis *BridgeDepositService) Deposit() {
 					return
 				case <-time.After(HandleDepositTimeout):
 				}
+				health.Beat(health.ComponentBridgeDeposit)
 			}
 
 			// handle aa not found err
@@ -183,8 +217,8 @@ func (bis *BridgeDepositService) GetTxToDeposit() ([]*model.Deposit, error) {
 	// 1. tx status is pending
 	// 2. contract insufficient balance
 	// 3. invoke contract from account insufficient balance
-	// 4. callback status is success
-	// 5. listener status is success
+	// 4. listener status is success
+	// the callback status is the webhook delivery, it does not hold the mint
 	var deposits []*model.Deposit
 	err := bis.db.
 		Where(
@@ -195,17 +229,13 @@ func (bis *BridgeDepositService) GetTxToDeposit() ([]*model.Deposit, error) {
 				model.DepositB2TxStatusFromAccountGasInsufficient,
 			},
 		).
-		Where(
-			fmt.Sprintf("%s.%s = ?", model.Deposit{}.TableName(), model.Deposit{}.Column().CallbackStatus),
-			model.CallbackStatusSuccess,
-		).
 		Where(
 			fmt.Sprintf("%s.%s = ?", model.Deposit{}.TableName(), model.Deposit{}.Column().ListenerStatus),
 			model.ListenerStatusSuccess,
 		).
 		Where(
 			fmt.Sprintf("%s.%s <= ?", model.Deposit{}.TableName(), model.Deposit{}.Column().B2TxRetry),
-			300,
+			DepositMaxRetry,
 		).
 		Limit(BatchDepositLimit).
 		Order(fmt.Sprintf("%s.%s ASC", model.Deposit{}.TableName(), model.Deposit{}.Column().BtcBlockNumber)).
@@ -273,10 +303,16 @@ func (bis *BridgeDepositService) HandleDeposit(deposit *model.Deposit, oldTx *et
 		return err
 	}
 
+	// a replica which lost the leader lease must not mint
+	if err := leader.Verify(bis.db); err != nil {
+		bis.log.Errorw("leader verify before deposit err", "btcTxHash", deposit.BtcTxHash, "error", err)
+		return err
+	}
+
 	// send deposit tx
 	b2Tx, _, aaAddress, fromAddress, err := bis.bridge.Deposit(deposit.BtcTxHash, types.BitcoinFrom{
 		Address: deposit.BtcFrom,
-	}, deposit.BtcTos, deposit.BtcValue, oldTx, nonce, resetNonce)
+	}, string(deposit.BtcTos), deposit.BtcValue, oldTx, nonce, resetNonce)
 	if err != nil {
 		switch {
 		case errors.Is(err, ErrBridgeDepositTxHashExist):
@@ -338,12 +374,12 @@ func (bis *BridgeDepositService) HandleDeposit(deposit *model.Deposit, oldTx *et
 				"btcTxHash", deposit.BtcTxHash,
 				"data", deposit)
 			// The call may not succeed due to network reasons. sleep wait for a while
-			err = bis.db.Model(&model.Deposit{}).Where("id = ?", deposit.ID).Updates(map[string]interface{}{
+			dbErr := bis.db.Model(&model.Deposit{}).Where("id = ?", deposit.ID).Updates(map[string]interface{}{
 				model.Deposit{}.Column().B2TxStatus: deposit.B2TxStatus,
 				model.Deposit{}.Column().B2TxRetry:  deposit.B2TxRetry,
 			}).Error
-			if err != nil {
-				return err
+			if dbErr != nil {
+				return dbErr
 			}
 			//tryTicker := time.NewTicker(DepositErrTimeout)
 			//select {
@@ -384,14 +420,10 @@ func (bis *BridgeDepositService) HandleDeposit(deposit *model.Deposit, oldTx *et
 	// wait tx mined, may be wait long time so set timeout ctx
 	ctx1, cancel1 := context.WithTimeout(context.Background(), WaitMinedTimeout)
 	defer cancel1()
-	errCh := make(chan error)
+	// buffered, the result of a wait outliving the select is dropped
+	errCh := make(chan error, 1)
 	go func(ctx1 context.Context, b2Tx *ethTypes.Transaction, deposit *model.Deposit) {
-		err := bis.WaitMined(ctx1, b2Tx, deposit)
-		if err != nil {
-			errCh <- err
-			return
-		}
-		//errCh <- nil
+		errCh <- bis.WaitMined(ctx1, b2Tx, deposit)
 	}(ctx1, b2Tx, deposit)
 	waitMinedTicker := time.NewTimer(WaitMinedTimeout + (10 * time.Second))
 	bis.log.Warn("wait mined")
@@ -429,6 +461,7 @@ func (bis *BridgeDepositService) HandleUnconfirmedDeposit(deposit *model.Deposit
 	txReceipt, err := bis.bridge.TransactionReceipt(deposit.B2TxHash)
 	if err == nil {
 		// case 1
+		observeDepositReceipt(deposit, txReceipt)
 		updateFields := map[string]interface{}{}
 		if txReceipt.Status == 1 {
 			updateFields[model.Deposit{}.Column().B2TxStatus] = model.DepositB2TxStatusSuccess
@@ -466,6 +499,7 @@ func (bis *BridgeDepositService) HandleUnconfirmedDeposit(deposit *model.Deposit
 
 func (bis *BridgeDepositService) WaitMined(ctx1 context.Context, b2Tx *ethTypes.Transaction, deposit *model.Deposit) error {
 	b2txReceipt, err := bis.bridge.WaitMined(ctx1, b2Tx, nil)
+	observeDepositReceipt(deposit, b2txReceipt)
 	if err != nil {
 		switch {
 		case errors.Is(err, ErrBridgeWaitMinedStatus):
@@ -539,13 +573,7 @@ func (bis *BridgeDepositService) CheckDeposit() {
 
 			for _, deposit := range deposits {
 
-				var rollupDeposit model.RollupDeposit
-				err = bis.db.
-					Where(
-						fmt.Sprintf("%s.%s = ?", model.RollupDeposit{}.TableName(), model.Deposit{}.Column().BtcTxHash),
-						deposit.BtcTxHash,
-					).
-					First(&rollupDeposit).Error
+				rollupDeposit, err := findMint(bis.db, deposit)
 				if err != nil {
 					bis.log.Errorw("find rollup deposit error", "err", err, "deposit", deposit)
 					continue
@@ -584,8 +612,41 @@ func (bis *BridgeDepositService) CheckDeposit() {
 					}
 				}
 
-				<-time.After(2 * time.Second)
+				select {
+				case <-bis.stopChan:
+					bis.log.Warnf("check deposit stopping...")
+					return
+				case <-time.After(CheckDepositTimeout):
+				}
 			}
 		}
 	}
 }
+
+// findMint returns the mint event of a deposit checked. A sent deposit is matched by its
+// own b2 tx, the others by their tx and value, unless the tx holds several deposits whose
+// mints cannot be told apart.
+func findMint(db *gorm.DB, deposit model.Deposit) (model.RollupDeposit, error) {
+	var rollupDeposit model.RollupDeposit
+	if deposit.B2TxStatus == model.DepositB2TxStatusSuccess {
+		err := db.
+			Where(fmt.Sprintf("%s = ?", model.RollupDeposit{}.Column().B2TxHash), deposit.B2TxHash).
+			First(&rollupDeposit).Error
+		return rollupDeposit, err
+	}
+	var outputs int64
+	err := db.Model(&model.Deposit{}).
+		Where(fmt.Sprintf("%s = ?", model.Deposit{}.Column().BtcTxHash), deposit.BtcTxHash).
+		Count(&outputs).Error
+	if err != nil {
+		return rollupDeposit, err
+	}
+	if outputs > 1 {
+		return rollupDeposit, fmt.Errorf("%w: tx %s holds %d deposits", ErrAmbiguousMint, deposit.BtcTxHash, outputs)
+	}
+	err = db.
+		Where(fmt.Sprintf("%s = ?", model.RollupDeposit{}.Column().BtcTxHash), deposit.BtcTxHash).
+		Where(fmt.Sprintf("%s = ?", model.RollupDeposit{}.Column().BtcValue), deposit.BtcValue).
+		First(&rollupDeposit).Error
+	return rollupDeposit, err
+}
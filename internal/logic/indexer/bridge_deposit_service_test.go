@@ -0,0 +1,207 @@
+package indexer_test
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/logic/indexer"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/testutil/abecmock"
+	"github.com/b2network/b2-indexer/internal/testutil/evmsim"
+	b2types "github.com/b2network/b2-indexer/internal/types"
+	logger "github.com/b2network/b2-indexer/pkg/log"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+const (
+	simNetwork       = "Abelian Testnetwork"
+	simListenAddress = "0xE37e799D5077682FA0a244D46E5649F71457BD09"
+	simBtcFrom       = "abe36f503e14f9fe13950e009d89de269031aab054223858cc4241224b95c9fd"
+)
+
+// simRecipient is the aa address of every deposit
+var simRecipient = common.HexToAddress("0xdac17f958d2ee523a2206206994597c13d831ec7")
+
+type depositHarness struct {
+	sim     *evmsim.Backend
+	node    *abecmock.Node
+	aaAPI   string
+	bridge  *indexer.Bridge
+	service *indexer.BridgeDepositService
+}
+
+// newDepositHarness wires a deposit service to a simulated rollup, a mock abec node,
+// a mock aa api and a dry run db, the db updates are not executed
+func newDepositHarness(t *testing.T) *depositHarness {
+	h := &depositHarness{
+		sim:  evmsim.New(t),
+		node: abecmock.New(t),
+	}
+	aaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"code": 0,
+			"data": map[string]string{
+				"to_address":   simRecipient.Hex(),
+				"from_network": simNetwork,
+				"from_address": simBtcFrom,
+			},
+		})
+	}))
+	t.Cleanup(aaServer.Close)
+	h.aaAPI = aaServer.URL
+	h.bridge = h.newBridge(t, h.sim.PrivKeyHex())
+
+	btcIndexer, err := indexer.NewAbelianIndexer(logger.NewNopLogger(),
+		&config.BitcoinConfig{RPCHost: h.node.URL()}, simListenAddress, 1)
+	require.NoError(t, err)
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1 user=postgres dbname=b2-indexer"}), &gorm.Config{
+		DryRun:                 true,
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+		Logger:                 gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	require.NoError(t, err)
+	h.service = indexer.NewBridgeDepositService(h.bridge, btcIndexer, db, logger.NewNopLogger(), config.BridgeConfig{})
+	return h
+}
+
+func (h *depositHarness) newBridge(t *testing.T, privKey string) *indexer.Bridge {
+	bridge, err := indexer.NewBridgeWithClient(h.sim, config.BridgeConfig{
+		EthRPCURL:       "simulated://",
+		EthPrivKey:      privKey,
+		ContractAddress: h.sim.Contract.Hex(),
+		AAB2PI:          h.aaAPI,
+	}, t.TempDir(), logger.NewNopLogger(), simNetwork)
+	require.NoError(t, err)
+	return bridge
+}
+
+// deposit returns a confirmed abelian deposit of value
+func (h *depositHarness) deposit(t *testing.T, value int64) *model.Deposit {
+	txID := make([]byte, 32)
+	_, err := rand.Read(txID)
+	require.NoError(t, err)
+	tos, err := json.Marshal([]b2types.BitcoinTo{{
+		Address: simRecipient.Hex(),
+		Value:   value,
+		Memo:    indexer.Memo{Action: "deposit", Protocol: "Mable", LockupPeriod: 180},
+	}})
+	require.NoError(t, err)
+	h.node.AddBlock(abecmock.Tx{TxID: hex.EncodeToString(txID)})
+	return &model.Deposit{
+		BtcTxHash: hex.EncodeToString(txID),
+		BtcFrom:   simBtcFrom,
+		BtcTos:    model.JSON(tos),
+		BtcValue:  value,
+	}
+}
+
+// minted is the wei of value abelian satoshi
+func minted(value int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(value), big.NewInt(1e11))
+}
+
+func TestHandleDepositMint(t *testing.T) {
+	h := newDepositHarness(t)
+	h.sim.AutoCommit(50 * time.Millisecond)
+
+	deposit := h.deposit(t, 1000)
+	require.NoError(t, h.service.HandleDeposit(deposit, nil, 0, false))
+	require.Equal(t, model.DepositB2TxStatusSuccess, deposit.B2TxStatus)
+	require.Equal(t, simRecipient.Hex(), deposit.BtcFromAAAddress)
+	require.Equal(t, minted(1000), h.sim.Balance(t, simRecipient))
+
+	receipt, err := h.bridge.TransactionReceipt(deposit.B2TxHash)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), receipt.Status)
+}
+
+func TestHandleDepositRevert(t *testing.T) {
+	h := newDepositHarness(t)
+	h.sim.AutoCommit(50 * time.Millisecond)
+
+	// more than the contract holds, the estimate failure does not stop the send
+	deposit := h.deposit(t, new(big.Int).Div(evmsim.ContractFunds, minted(1)).Int64()+1)
+	err := h.service.HandleDeposit(deposit, nil, 0, false)
+	require.Error(t, err)
+	require.Equal(t, model.DepositB2TxStatusWaitMinedStatusFailed, deposit.B2TxStatus)
+
+	receipt, err := h.bridge.TransactionReceipt(deposit.B2TxHash)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), receipt.Status)
+	require.Equal(t, 0, h.sim.Balance(t, simRecipient).Sign())
+}
+
+func TestHandleDepositInsufficientBalance(t *testing.T) {
+	h := newDepositHarness(t)
+
+	// the retry of a pending mint checks the contract balance by the gas estimate
+	deposit := h.deposit(t, new(big.Int).Div(evmsim.ContractFunds, minted(1)).Int64()+1)
+	oldTx, _, _, _, err := h.bridge.Deposit(deposit.BtcTxHash, b2types.BitcoinFrom{Address: deposit.BtcFrom},
+		string(deposit.BtcTos), deposit.BtcValue, nil, 0, false)
+	require.NoError(t, err)
+	err = h.service.HandleDeposit(deposit, oldTx, 0, false)
+	require.ErrorIs(t, err, indexer.ErrBridgeDepositContractInsufficientBalance)
+	require.Equal(t, model.DepositB2TxStatusInsufficientBalance, deposit.B2TxStatus)
+
+	// a bridge key without gas funds is retried
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	unfunded := h.newBridge(t, hex.EncodeToString(crypto.FromECDSA(key)))
+	_, _, _, _, err = unfunded.Deposit(deposit.BtcTxHash, b2types.BitcoinFrom{Address: deposit.BtcFrom},
+		string(deposit.BtcTos), 1000, nil, 0, false)
+	require.ErrorContains(t, err, "insufficient funds")
+}
+
+func TestHandleDepositNonceTooLow(t *testing.T) {
+	h := newDepositHarness(t)
+	h.sim.AutoCommit(50 * time.Millisecond)
+
+	first := h.deposit(t, 1000)
+	require.NoError(t, h.service.HandleDeposit(first, nil, 0, false))
+
+	// the nonce of the first mint, which is mined
+	deposit := h.deposit(t, 1000)
+	err := h.service.HandleDeposit(deposit, nil, first.B2TxNonce, false)
+	require.ErrorContains(t, err, "nonce too low")
+	require.Equal(t, model.DepositB2TxStatusNonceToLow, deposit.B2TxStatus)
+
+	// a nonce above the mined ones is refused before sending
+	err = h.service.HandleDeposit(deposit, nil, first.B2TxNonce+5, false)
+	require.ErrorIs(t, err, indexer.ErrOldNonceToHeight)
+}
+
+func TestHandleDepositReplacementUnderpriced(t *testing.T) {
+	h := newDepositHarness(t)
+
+	first := h.deposit(t, 1000)
+	pending, _, _, _, err := h.bridge.Deposit(first.BtcTxHash, b2types.BitcoinFrom{Address: first.BtcFrom},
+		string(first.BtcTos), first.BtcValue, nil, 0, false)
+	require.NoError(t, err)
+
+	// another mint with the nonce and gas price of the pending one
+	deposit := h.deposit(t, 2000)
+	err = h.service.HandleDeposit(deposit, nil, pending.Nonce(), false)
+	require.ErrorContains(t, err, "replacement transaction underpriced")
+	require.Equal(t, model.DepositB2TxStatusPending, deposit.B2TxStatus)
+	require.Equal(t, 1, deposit.B2TxRetry)
+
+	// the retry of the pending mint doubles the gas price and replaces it
+	h.sim.AutoCommit(50 * time.Millisecond)
+	require.NoError(t, h.service.HandleDeposit(first, pending, 0, false))
+	require.Equal(t, model.DepositB2TxStatusSuccess, first.B2TxStatus)
+	require.NotEqual(t, pending.Hash().String(), first.B2TxHash)
+	require.Equal(t, minted(1000), h.sim.Balance(t, simRecipient))
+}
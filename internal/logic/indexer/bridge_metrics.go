@@ -0,0 +1,83 @@
+package indexer
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/b2network/b2-indexer/internal/metrics"
+	"github.com/b2network/b2-indexer/internal/model"
+	ethTypes "github.com/ethereum/go-ethereum/core/types"
+	"gorm.io/gorm"
+)
+
+// statusCounts counts the rows of the table of value by the status column
+func statusCounts(db *gorm.DB, value interface{}, column string) (map[int]int64, error) {
+	var rows []struct {
+		Status int
+		Count  int64
+	}
+	err := db.Model(value).
+		Select(fmt.Sprintf("%s AS status, COUNT(*) AS count", column)).
+		Group(column).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[int]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+// updateMetrics refreshes the deposit status and hot wallet balance gauges
+func (bis *BridgeDepositService) updateMetrics() {
+	counts, err := statusCounts(bis.db, &model.Deposit{}, model.Deposit{}.Column().B2TxStatus)
+	if err != nil {
+		bis.log.Warnw("bridge deposit metrics count deposits err", "error", err)
+	} else {
+		metrics.SetStatusCounts(metrics.Deposits, counts)
+	}
+	balance, err := bis.bridge.FromBalance()
+	if err != nil {
+		bis.log.Warnw("bridge deposit metrics get balance err", "error", err)
+		return
+	}
+	metrics.HotWalletBalance.Set(weiFloat(balance))
+}
+
+// observeDepositReceipt records the gas paid by a deposit tx and the mint latency of a successful one
+func observeDepositReceipt(deposit *model.Deposit, receipt *ethTypes.Receipt) {
+	if receipt == nil {
+		return
+	}
+	if receipt.EffectiveGasPrice != nil {
+		gas := new(big.Int).Mul(new(big.Int).SetUint64(receipt.GasUsed), receipt.EffectiveGasPrice)
+		metrics.GasSpent.Add(weiFloat(gas))
+	}
+	if receipt.Status == ethTypes.ReceiptStatusSuccessful && !deposit.BtcBlockTime.IsZero() {
+		metrics.MintLatency.Observe(time.Since(deposit.BtcBlockTime).Seconds())
+	}
+}
+
+// updateMetrics refreshes the withdraw and withdraw tx status gauges
+func (bis *BridgeWithdrawService) updateMetrics() {
+	counts, err := statusCounts(bis.db, &model.Withdraw{}, model.Withdraw{}.Column().Status)
+	if err != nil {
+		bis.log.Warnw("BridgeWithdrawService metrics count withdraws err", "error", err)
+	} else {
+		metrics.SetStatusCounts(metrics.Withdraws, counts)
+	}
+	counts, err = statusCounts(bis.db, &model.WithdrawTx{}, model.WithdrawTx{}.Column().Status)
+	if err != nil {
+		bis.log.Warnw("BridgeWithdrawService metrics count withdraw txs err", "error", err)
+		return
+	}
+	metrics.SetStatusCounts(metrics.WithdrawTxs, counts)
+}
+
+func weiFloat(wei *big.Int) float64 {
+	f, _ := new(big.Float).SetInt(wei).Float64()
+	return f
+}
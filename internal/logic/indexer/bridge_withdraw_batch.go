@@ -0,0 +1,118 @@
+package indexer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// DefaultBatchMaxOutputs keeps a withdraw tx far below the standard tx weight limit
+const DefaultBatchMaxOutputs = 100
+
+// WithdrawBatchPolicy bounds the withdraws paid by one withdraw tx
+type WithdrawBatchPolicy struct {
+	// MaxOutputs is the max destination outputs of a tx, after merging duplicated addresses
+	MaxOutputs int
+	// MaxValue is the max total value of a tx in satoshi, 0 means no limit
+	MaxValue int64
+	// MinAge is how long the oldest withdraw waits for more withdraws to batch with
+	MinAge time.Duration
+	// SoloValue is the value in satoshi at or above which a withdraw gets its own tx, 0 disables
+	SoloValue int64
+}
+
+// NewWithdrawBatchPolicy returns the batch policy configured by bridgeCfg
+func NewWithdrawBatchPolicy(bridgeCfg config.BridgeConfig) WithdrawBatchPolicy {
+	maxOutputs := bridgeCfg.BatchMaxOutputs
+	if maxOutputs <= 0 {
+		maxOutputs = DefaultBatchMaxOutputs
+	}
+	return WithdrawBatchPolicy{
+		MaxOutputs: maxOutputs,
+		MaxValue:   bridgeCfg.BatchMaxValue,
+		MinAge:     time.Duration(bridgeCfg.BatchMinAge) * time.Second,
+		SoloValue:  bridgeCfg.SoloWithdrawValue,
+	}
+}
+
+// NextWithdrawBatch picks the withdraws of the next withdraw tx from the pending withdraws.
+// Withdraws are taken oldest first. A withdraw at or above the solo value is paid alone,
+// one above the max value is paid alone once it is the oldest. An empty batch means wait:
+// a batch that is not full waits until its oldest withdraw reaches the min age.
+func NextWithdrawBatch(pending []model.Withdraw, policy WithdrawBatchPolicy, now time.Time) []model.Withdraw {
+	sorted := append([]model.Withdraw{}, pending...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	if policy.SoloValue > 0 {
+		for _, v := range sorted {
+			if v.BtcValue >= policy.SoloValue {
+				return []model.Withdraw{v}
+			}
+		}
+	}
+
+	batch := make([]model.Withdraw, 0)
+	addresses := make(map[string]bool)
+	var total int64
+	var full bool
+	for _, v := range sorted {
+		if len(batch) == 0 && policy.MaxValue > 0 && v.BtcValue > policy.MaxValue {
+			return []model.Withdraw{v}
+		}
+		newOutput := !addresses[v.BtcTo]
+		if newOutput && len(addresses) >= policy.MaxOutputs {
+			full = true
+			continue
+		}
+		if policy.MaxValue > 0 && total+v.BtcValue > policy.MaxValue {
+			full = true
+			continue
+		}
+		batch = append(batch, v)
+		addresses[v.BtcTo] = true
+		total += v.BtcValue
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	if !full && len(addresses) < policy.MaxOutputs && now.Sub(batch[0].CreatedAt) < policy.MinAge {
+		return nil
+	}
+	return batch
+}
+
+// reservedOutpoints returns the utxos spent by withdraw txs that are not broadcast or not confirmed yet,
+// they are not available to a new withdraw tx
+func (bis *BridgeWithdrawService) reservedOutpoints() (map[wire.OutPoint]bool, error) {
+	var withdrawTxList []model.WithdrawTx
+	err := bis.db.Model(&model.WithdrawTx{}).
+		Where(fmt.Sprintf("%s IN (?)", model.WithdrawTx{}.Column().Status), []int{
+			model.BtcTxWithdrawPending,
+			model.BtcTxWithdrawSignatureCompleted,
+			model.BtcTxWithdrawBroadcastSuccess,
+		}).
+		Find(&withdrawTxList).Error
+	if err != nil {
+		return nil, err
+	}
+	reserved := make(map[wire.OutPoint]bool)
+	for _, v := range withdrawTxList {
+		pack, err := psbt.NewFromRawBytes(strings.NewReader(v.BtcTx), true)
+		if err != nil {
+			bis.log.Errorw("BridgeWithdrawService reserved outpoints parse psbt err", "error", err, "id", v.ID)
+			return nil, err
+		}
+		for _, in := range pack.UnsignedTx.TxIn {
+			reserved[in.PreviousOutPoint] = true
+		}
+	}
+	return reserved, nil
+}
@@ -0,0 +1,96 @@
+package indexer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func testWithdraw(id int64, to string, value int64, createdAt time.Time) model.Withdraw {
+	w := model.Withdraw{BtcTo: to, BtcValue: value}
+	w.ID = id
+	w.CreatedAt = createdAt
+	return w
+}
+
+func withdrawIDs(withdraws []model.Withdraw) []int64 {
+	ids := make([]int64, 0, len(withdraws))
+	for _, w := range withdraws {
+		ids = append(ids, w.ID)
+	}
+	return ids
+}
+
+func TestNextWithdrawBatchLimits(t *testing.T) {
+	now := time.Now()
+	pending := []model.Withdraw{
+		testWithdraw(4, "d", 100, now),
+		testWithdraw(1, "a", 100, now),
+		testWithdraw(2, "b", 300, now),
+		testWithdraw(3, "a", 100, now),
+		testWithdraw(5, "e", 100, now),
+	}
+
+	// duplicated addresses share one output
+	batch := NextWithdrawBatch(pending, WithdrawBatchPolicy{MaxOutputs: 2}, now)
+	require.Equal(t, []int64{1, 2, 3}, withdrawIDs(batch))
+
+	// withdraws over the max value wait for the next tx
+	batch = NextWithdrawBatch(pending, WithdrawBatchPolicy{MaxOutputs: 10, MaxValue: 350}, now)
+	require.Equal(t, []int64{1, 3, 4}, withdrawIDs(batch))
+
+	// the oldest withdraw above the max value is paid alone
+	batch = NextWithdrawBatch(pending, WithdrawBatchPolicy{MaxOutputs: 10, MaxValue: 50}, now)
+	require.Equal(t, []int64{1}, withdrawIDs(batch))
+}
+
+func TestNextWithdrawBatchSolo(t *testing.T) {
+	now := time.Now()
+	pending := []model.Withdraw{
+		testWithdraw(1, "a", 100, now),
+		testWithdraw(2, "b", 5000, now),
+		testWithdraw(3, "c", 6000, now),
+	}
+	policy := WithdrawBatchPolicy{MaxOutputs: 10, SoloValue: 5000, MinAge: time.Hour}
+
+	batch := NextWithdrawBatch(pending, policy, now)
+	require.Equal(t, []int64{2}, withdrawIDs(batch))
+
+	// the remaining small withdraw waits for the min age
+	batch = NextWithdrawBatch(pending[:1], policy, now)
+	require.Empty(t, batch)
+}
+
+func TestNextWithdrawBatchMinAge(t *testing.T) {
+	now := time.Now()
+	pending := []model.Withdraw{
+		testWithdraw(1, "a", 100, now.Add(-time.Minute)),
+		testWithdraw(2, "b", 100, now),
+	}
+	policy := WithdrawBatchPolicy{MaxOutputs: 10, MinAge: 5 * time.Minute}
+
+	require.Empty(t, NextWithdrawBatch(pending, policy, now))
+	require.Equal(t, []int64{1, 2}, withdrawIDs(NextWithdrawBatch(pending, policy, now.Add(4*time.Minute))))
+
+	// a full batch does not wait
+	policy.MaxOutputs = 2
+	require.Equal(t, []int64{1, 2}, withdrawIDs(NextWithdrawBatch(pending, policy, now)))
+}
+
+func TestNewWithdrawBatchPolicy(t *testing.T) {
+	policy := NewWithdrawBatchPolicy(config.BridgeConfig{BatchMinAge: 60})
+	require.Equal(t, DefaultBatchMaxOutputs, policy.MaxOutputs)
+	require.Equal(t, time.Minute, policy.MinAge)
+}
+
+func TestMergeDuplicateAddresses(t *testing.T) {
+	addresses, amounts := mergeDuplicateAddresses(
+		[]string{"c", "a", "c", "b", "a"},
+		[]int64{1, 2, 3, 4, 5},
+	)
+	require.Equal(t, []string{"c", "a", "b"}, addresses)
+	require.Equal(t, []int64{4, 7, 4}, amounts)
+}
@@ -0,0 +1,312 @@
+package indexer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/metrics"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	FeeBumpRBF  = "rbf"
+	FeeBumpCPFP = "cpfp"
+
+	// IncrementalRelayFeeRate is the bitcoin core default incremental relay fee rate in sat/vB,
+	// a replacement pays at least this rate for its own size on top of the replaced fee
+	IncrementalRelayFeeRate = 1
+	// RBFSequence signals opt-in replace by fee, BIP 125
+	RBFSequence = wire.MaxTxInSequenceNum - 2
+)
+
+var ErrFeeBumpUnavailable = errors.New("fee bump unavailable")
+
+// FeeBumpParams defines the inputs of a fee bump
+type FeeBumpParams struct {
+	// ChangeScript locks the change output the bump is paid from
+	ChangeScript []byte
+	// MultiSigScript is the witness script of the multisig inputs
+	MultiSigScript []byte
+	SigNum         int
+	// FeeRate is the target fee rate in sat/vB
+	FeeRate int64
+	Dust    int64
+}
+
+// CheckFeeBumpStrategy checks the configured fee bump strategy
+func CheckFeeBumpStrategy(bridgeCfg config.BridgeConfig) error {
+	switch bridgeCfg.FeeBumpStrategy {
+	case "", FeeBumpRBF, FeeBumpCPFP:
+		return nil
+	default:
+		return fmt.Errorf("unknown fee bump strategy: %s", bridgeCfg.FeeBumpStrategy)
+	}
+}
+
+// BuildRBFReplacement returns a replacement of pack spending the same inputs at params.FeeRate,
+// the fee increase is taken from the change output. It returns the replacement and its fee.
+func BuildRBFReplacement(pack *psbt.Packet, params FeeBumpParams) (*psbt.Packet, int64, error) {
+	oldFee, err := psbtFee(pack)
+	if err != nil {
+		return nil, 0, err
+	}
+	changeIndex := findChangeOutput(pack.UnsignedTx, params.ChangeScript)
+	if changeIndex < 0 {
+		return nil, 0, fmt.Errorf("%w: no change output to pay the replacement fee", ErrFeeBumpUnavailable)
+	}
+
+	tx := wire.NewMsgTx(pack.UnsignedTx.Version)
+	tx.LockTime = pack.UnsignedTx.LockTime
+	for _, in := range pack.UnsignedTx.TxIn {
+		tx.AddTxIn(wire.NewTxIn(&in.PreviousOutPoint, nil, nil))
+	}
+	for i, out := range pack.UnsignedTx.TxOut {
+		if i != changeIndex {
+			tx.AddTxOut(wire.NewTxOut(out.Value, out.PkScript))
+		}
+	}
+	sizer := NewWithdrawTxSizer(tx.TxOut, params.ChangeScript, params.MultiSigScript, params.SigNum)
+
+	change := pack.UnsignedTx.TxOut[changeIndex].Value
+	vsize := sizer.VSize(len(tx.TxIn), true)
+	fee := replacementFee(oldFee, params.FeeRate, vsize)
+	if newChange := change - (fee - oldFee); newChange >= params.Dust && newChange > 0 {
+		tx.AddTxOut(wire.NewTxOut(newChange, params.ChangeScript))
+	} else {
+		// fold the whole change into the fee
+		vsize = sizer.VSize(len(tx.TxIn), false)
+		if oldFee+change < replacementFee(oldFee, params.FeeRate, vsize) {
+			return nil, 0, fmt.Errorf("%w: change %d can not pay fee rate %d", ErrFeeBumpUnavailable, change, params.FeeRate)
+		}
+		fee = oldFee + change
+	}
+	setRBFSequence(tx)
+
+	replacement, err := psbt.NewFromUnsignedTx(tx)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i, in := range pack.Inputs {
+		replacement.Inputs[i].WitnessUtxo = in.WitnessUtxo
+		replacement.Inputs[i].WitnessScript = in.WitnessScript
+	}
+	replacement.Unknowns = pack.Unknowns
+	return replacement, fee, nil
+}
+
+// BuildCPFPChild returns a child of pack spending its change output, paying a fee that brings
+// the parent and child package to params.FeeRate. It returns the child and its fee.
+func BuildCPFPChild(pack *psbt.Packet, params FeeBumpParams) (*psbt.Packet, int64, error) {
+	parentFee, err := psbtFee(pack)
+	if err != nil {
+		return nil, 0, err
+	}
+	changeIndex := findChangeOutput(pack.UnsignedTx, params.ChangeScript)
+	if changeIndex < 0 {
+		return nil, 0, fmt.Errorf("%w: no change output for the child to spend", ErrFeeBumpUnavailable)
+	}
+	parentVSize := packetVSize(pack, params, changeIndex)
+	childVSize := NewWithdrawTxSizer(nil, params.ChangeScript, params.MultiSigScript, params.SigNum).VSize(1, true)
+
+	fee := params.FeeRate*(parentVSize+childVSize) - parentFee
+	if minFee := params.FeeRate * childVSize; fee < minFee {
+		fee = minFee
+	}
+	change := pack.UnsignedTx.TxOut[changeIndex].Value
+	if change-fee < params.Dust || change-fee <= 0 {
+		return nil, 0, fmt.Errorf("%w: change %d can not pay child fee %d", ErrFeeBumpUnavailable, change, fee)
+	}
+
+	parentHash := pack.UnsignedTx.TxHash()
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&parentHash, uint32(changeIndex)), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(change-fee, params.ChangeScript))
+	setRBFSequence(tx)
+
+	child, err := psbt.NewFromUnsignedTx(tx)
+	if err != nil {
+		return nil, 0, err
+	}
+	child.Inputs[0].WitnessUtxo = wire.NewTxOut(change, params.ChangeScript)
+	child.Inputs[0].WitnessScript = params.MultiSigScript
+	child.Unknowns = []*psbt.Unknown{{Key: []byte("b2TxHashes"), Value: []byte("[]")}}
+	return child, fee, nil
+}
+
+// PacketFeeRate returns the fee rate in sat/vB paid by pack
+func PacketFeeRate(pack *psbt.Packet, params FeeBumpParams) (int64, error) {
+	fee, err := psbtFee(pack)
+	if err != nil {
+		return 0, err
+	}
+	vsize := packetVSize(pack, params, findChangeOutput(pack.UnsignedTx, params.ChangeScript))
+	return fee / vsize, nil
+}
+
+// replacementFee returns the fee a replacement of vsize pays at feeRate, BIP 125 rules 3 and 4
+func replacementFee(oldFee int64, feeRate int64, vsize int64) int64 {
+	fee := feeRate * vsize
+	if minFee := oldFee + IncrementalRelayFeeRate*vsize; fee < minFee {
+		fee = minFee
+	}
+	return fee
+}
+
+// packetVSize estimates the signed vsize of pack, changeIndex is -1 without change output
+func packetVSize(pack *psbt.Packet, params FeeBumpParams, changeIndex int) int64 {
+	outputs := make([]*wire.TxOut, 0, len(pack.UnsignedTx.TxOut))
+	for i, out := range pack.UnsignedTx.TxOut {
+		if i != changeIndex {
+			outputs = append(outputs, out)
+		}
+	}
+	sizer := NewWithdrawTxSizer(outputs, params.ChangeScript, params.MultiSigScript, params.SigNum)
+	return sizer.VSize(len(pack.UnsignedTx.TxIn), changeIndex >= 0)
+}
+
+// psbtFee returns the fee paid by pack, from the witness utxos of its inputs
+func psbtFee(pack *psbt.Packet) (int64, error) {
+	var fee int64
+	for i, in := range pack.Inputs {
+		if in.WitnessUtxo == nil {
+			return 0, fmt.Errorf("input %d has no witness utxo", i)
+		}
+		fee += in.WitnessUtxo.Value
+	}
+	for _, out := range pack.UnsignedTx.TxOut {
+		fee -= out.Value
+	}
+	return fee, nil
+}
+
+func findChangeOutput(tx *wire.MsgTx, changeScript []byte) int {
+	for i, out := range tx.TxOut {
+		if bytes.Equal(out.PkScript, changeScript) {
+			return i
+		}
+	}
+	return -1
+}
+
+func setRBFSequence(tx *wire.MsgTx) {
+	for _, in := range tx.TxIn {
+		in.Sequence = RBFSequence
+	}
+}
+
+// BumpStuckTx creates a fee bump tx for the broadcast withdraw tx v once it stays unconfirmed
+// longer than the stuck tx age. The bump tx is stored pending and needs the multisig signatures.
+func (bis *BridgeWithdrawService) BumpStuckTx(v model.WithdrawTx) error {
+	bridgeCfg := bis.config.Bridge
+	if bridgeCfg.FeeBumpStrategy == "" {
+		return nil
+	}
+	broadcastAt := v.BroadcastAt
+	if broadcastAt.IsZero() {
+		broadcastAt = v.UpdatedAt
+	}
+	if time.Since(broadcastAt) < time.Duration(bridgeCfg.StuckTxAge)*time.Second {
+		return nil
+	}
+	if v.BumpCount >= bridgeCfg.FeeBumpMaxTimes {
+		bis.log.Warnw("BridgeWithdrawService stuck tx reached max fee bumps", "id", v.ID, "txID", v.BtcTxID, "bumpCount", v.BumpCount)
+		return nil
+	}
+	var bumping int64
+	err := bis.db.Model(&model.WithdrawTx{}).
+		Where(fmt.Sprintf("%s = ? AND %s NOT IN (?)", model.WithdrawTx{}.Column().ReplacesID, model.WithdrawTx{}.Column().Status),
+			v.ID, []int{model.BtcTxWithdrawBroadcastFailed, model.BtcTxWithdrawFailed}).
+		Count(&bumping).Error
+	if err != nil {
+		return err
+	}
+	if bumping > 0 {
+		return nil
+	}
+
+	pack, err := psbt.NewFromRawBytes(strings.NewReader(v.BtcTx), true)
+	if err != nil {
+		return err
+	}
+	params, err := bis.feeBumpParams()
+	if err != nil {
+		return err
+	}
+	oldFeeRate, err := PacketFeeRate(pack, params)
+	if err != nil {
+		return err
+	}
+	feeRate, err := bis.feeEstimator.FeeRate()
+	if err != nil {
+		return err
+	}
+	if feeRate <= oldFeeRate {
+		feeRate = oldFeeRate + IncrementalRelayFeeRate
+	}
+	params.FeeRate = feeRate
+
+	bumpTx := model.WithdrawTx{
+		ReplacesID: v.ID,
+		BumpCount:  v.BumpCount + 1,
+	}
+	var bump *psbt.Packet
+	var fee int64
+	switch bridgeCfg.FeeBumpStrategy {
+	case FeeBumpRBF:
+		bump, fee, err = BuildRBFReplacement(pack, params)
+		bumpTx.BumpType = model.WithdrawTxBumpRBF
+		bumpTx.B2TxHashes = v.B2TxHashes
+	case FeeBumpCPFP:
+		bump, fee, err = BuildCPFPChild(pack, params)
+		bumpTx.BumpType = model.WithdrawTxBumpCPFP
+		bumpTx.B2TxHashes = "[]"
+	default:
+		return fmt.Errorf("unknown fee bump strategy: %s", bridgeCfg.FeeBumpStrategy)
+	}
+	if err != nil {
+		return err
+	}
+	bumpTx.BtcTxID = bump.UnsignedTx.TxHash().String()
+	bumpTx.BtcTx, err = bump.B64Encode()
+	if err != nil {
+		return err
+	}
+	if err = bis.db.Create(&bumpTx).Error; err != nil {
+		return err
+	}
+	metrics.WithdrawFeeBumps.WithLabelValues(bridgeCfg.FeeBumpStrategy).Inc()
+	bis.log.Infow("BridgeWithdrawService bump stuck tx", "id", v.ID, "txID", v.BtcTxID,
+		"bumpTxID", bumpTx.BtcTxID, "strategy", bridgeCfg.FeeBumpStrategy,
+		"oldFeeRate", oldFeeRate, "feeRate", feeRate, "fee", fee)
+	return nil
+}
+
+func (bis *BridgeWithdrawService) feeBumpParams() (FeeBumpParams, error) {
+	sourceAddr, err := btcutil.DecodeAddress(bis.config.IndexerListenAddress, config.ChainParams(bis.config.NetworkName))
+	if err != nil {
+		return FeeBumpParams{}, err
+	}
+	changeScript, err := txscript.PayToAddrScript(sourceAddr)
+	if err != nil {
+		return FeeBumpParams{}, err
+	}
+	multiSigScript, err := bis.GetMultiSigScript(bis.config.Bridge.PublicKeys, bis.config.Bridge.MultisigNum)
+	if err != nil {
+		return FeeBumpParams{}, err
+	}
+	return FeeBumpParams{
+		ChangeScript:   changeScript,
+		MultiSigScript: multiSigScript,
+		SigNum:         bis.config.Bridge.MultisigNum,
+		Dust:           mempool.GetDustThreshold(wire.NewTxOut(0, changeScript)),
+	}, nil
+}
@@ -0,0 +1,125 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+)
+
+func testFeeBumpParams(feeRate int64) FeeBumpParams {
+	return FeeBumpParams{
+		ChangeScript:   append([]byte{0x00, 0x20}, make([]byte, 32)...),
+		MultiSigScript: make([]byte, MultiSigSize),
+		SigNum:         2,
+		FeeRate:        feeRate,
+		Dust:           330,
+	}
+}
+
+// testWithdrawPacket spends inputs to one destination output and a change output
+func testWithdrawPacket(t *testing.T, params FeeBumpParams, inputs []int64, dest int64, change int64) *psbt.Packet {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	for i := range inputs {
+		hash := chainhash.HashH([]byte{byte(i)})
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&hash, 0), nil, nil))
+	}
+	tx.AddTxOut(wire.NewTxOut(dest, []byte{0x00, 0x14, 0x01}))
+	if change > 0 {
+		tx.AddTxOut(wire.NewTxOut(change, params.ChangeScript))
+	}
+	setRBFSequence(tx)
+	pack, err := psbt.NewFromUnsignedTx(tx)
+	require.NoError(t, err)
+	for i, v := range inputs {
+		pack.Inputs[i].WitnessUtxo = wire.NewTxOut(v, params.MultiSigScript)
+		pack.Inputs[i].WitnessScript = params.MultiSigScript
+	}
+	pack.Unknowns = []*psbt.Unknown{{Key: []byte("b2TxHashes"), Value: []byte(`["0x01"]`)}}
+	return pack
+}
+
+func TestBuildRBFReplacement(t *testing.T) {
+	params := testFeeBumpParams(10)
+	pack := testWithdrawPacket(t, params, []int64{100000}, 50000, 49000)
+	oldFee, err := psbtFee(pack)
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), oldFee)
+
+	replacement, fee, err := BuildRBFReplacement(pack, params)
+	require.NoError(t, err)
+	vsize := packetVSize(replacement, params, 1)
+	require.Equal(t, params.FeeRate*vsize, fee)
+	newFee, err := psbtFee(replacement)
+	require.NoError(t, err)
+	require.Equal(t, fee, newFee)
+
+	// same inputs and destination, only the change pays the bump
+	require.Equal(t, pack.UnsignedTx.TxIn[0].PreviousOutPoint, replacement.UnsignedTx.TxIn[0].PreviousOutPoint)
+	require.Equal(t, uint32(RBFSequence), replacement.UnsignedTx.TxIn[0].Sequence)
+	require.Equal(t, int64(50000), replacement.UnsignedTx.TxOut[0].Value)
+	require.Equal(t, int64(49000)-(fee-oldFee), replacement.UnsignedTx.TxOut[1].Value)
+	require.Equal(t, pack.Unknowns, replacement.Unknowns)
+	require.Equal(t, pack.Inputs[0].WitnessUtxo, replacement.Inputs[0].WitnessUtxo)
+}
+
+func TestBuildRBFReplacementMinIncrement(t *testing.T) {
+	// the target rate is below the paid rate, BIP 125 still needs the incremental relay fee
+	params := testFeeBumpParams(1)
+	pack := testWithdrawPacket(t, params, []int64{100000}, 50000, 40000)
+
+	_, fee, err := BuildRBFReplacement(pack, params)
+	require.NoError(t, err)
+	require.Equal(t, int64(10000)+IncrementalRelayFeeRate*packetVSize(pack, params, 1), fee)
+}
+
+func TestBuildRBFReplacementFoldsChange(t *testing.T) {
+	params := testFeeBumpParams(10)
+	vsize := packetVSize(testWithdrawPacket(t, params, []int64{100000}, 50000, 0), params, -1)
+	// the remaining change after the bump is below dust
+	change := params.FeeRate*vsize - 1000 + 100
+	pack := testWithdrawPacket(t, params, []int64{100000}, 50000, change)
+	pack.Inputs[0].WitnessUtxo.Value = 50000 + change + 1000
+
+	replacement, fee, err := BuildRBFReplacement(pack, params)
+	require.NoError(t, err)
+	require.Len(t, replacement.UnsignedTx.TxOut, 1)
+	require.Equal(t, change+1000, fee)
+
+	_, _, err = BuildRBFReplacement(pack, testFeeBumpParams(100))
+	require.ErrorIs(t, err, ErrFeeBumpUnavailable)
+
+	noChange := testWithdrawPacket(t, params, []int64{100000}, 99000, 0)
+	_, _, err = BuildRBFReplacement(noChange, params)
+	require.ErrorIs(t, err, ErrFeeBumpUnavailable)
+}
+
+func TestBuildCPFPChild(t *testing.T) {
+	params := testFeeBumpParams(20)
+	pack := testWithdrawPacket(t, params, []int64{100000}, 50000, 49000)
+
+	child, fee, err := BuildCPFPChild(pack, params)
+	require.NoError(t, err)
+	parentVSize := packetVSize(pack, params, 1)
+	childVSize := packetVSize(child, params, 0)
+	// parent and child pay the target rate as a package
+	require.Equal(t, params.FeeRate*(parentVSize+childVSize)-1000, fee)
+
+	parentHash := pack.UnsignedTx.TxHash()
+	require.Equal(t, *wire.NewOutPoint(&parentHash, 1), child.UnsignedTx.TxIn[0].PreviousOutPoint)
+	require.Equal(t, int64(49000)-fee, child.UnsignedTx.TxOut[0].Value)
+	require.Equal(t, params.ChangeScript, child.UnsignedTx.TxOut[0].PkScript)
+	require.Equal(t, int64(49000), child.Inputs[0].WitnessUtxo.Value)
+
+	_, _, err = BuildCPFPChild(testWithdrawPacket(t, params, []int64{100000}, 50000, 1000), params)
+	require.ErrorIs(t, err, ErrFeeBumpUnavailable)
+}
+
+func TestCheckFeeBumpStrategy(t *testing.T) {
+	require.NoError(t, CheckFeeBumpStrategy(config.BridgeConfig{}))
+	require.NoError(t, CheckFeeBumpStrategy(config.BridgeConfig{FeeBumpStrategy: FeeBumpCPFP}))
+	require.Error(t, CheckFeeBumpStrategy(config.BridgeConfig{FeeBumpStrategy: "cancel"}))
+}
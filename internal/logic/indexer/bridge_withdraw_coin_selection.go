@@ -0,0 +1,273 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	CoinSelectionLargestFirst   = "largest-first"
+	CoinSelectionBranchAndBound = "branch-and-bound"
+
+	// TxOverheadVSize 11 vbytes
+	//	- Version: 4 bytes
+	//	- LockTime: 4 bytes
+	//	- TxIn count: 1 byte
+	//	- TxOut count: 1 byte
+	//	- Segwit marker and flag: 2 weight units, rounded up
+	TxOverheadVSize = 4 + 4 + 1 + 1 + 1
+	// SignatureSize 74 bytes, 1 byte length + 73 bytes DER signature with sighash type
+	SignatureSize = 1 + 73
+
+	bnbMaxTries = 100000
+)
+
+var ErrInsufficientUtxo = errors.New("insufficient utxo")
+
+// WithdrawTxSizer estimates the virtual size of a withdraw tx spending multisig inputs
+type WithdrawTxSizer struct {
+	// OutputsVSize is the size of all destination outputs
+	OutputsVSize int64
+	// ChangeVSize is the size of the change output
+	ChangeVSize int64
+	// InputVSize is the size of one multisig input, including the discounted witness
+	InputVSize int64
+}
+
+// NewWithdrawTxSizer returns a sizer for txs paying outputs, with change to changeScript,
+// spending inputs locked by multiSigScript that needs sigNum signatures.
+func NewWithdrawTxSizer(outputs []*wire.TxOut, changeScript []byte, multiSigScript []byte, sigNum int) WithdrawTxSizer {
+	var outputsSize int
+	for _, out := range outputs {
+		outputsSize += out.SerializeSize()
+	}
+	// witness: item count + empty item for CHECKMULTISIG bug + signatures + witness script
+	witnessSize := 1 + 1 + sigNum*SignatureSize + wire.VarIntSerializeSize(uint64(len(multiSigScript))) + len(multiSigScript)
+	return WithdrawTxSizer{
+		OutputsVSize: int64(outputsSize),
+		ChangeVSize:  int64(wire.NewTxOut(0, changeScript).SerializeSize()),
+		InputVSize:   int64(InputSize + (witnessSize+3)/4),
+	}
+}
+
+// VSize returns the estimated virtual size of a tx with the given input count
+func (s WithdrawTxSizer) VSize(inputs int, withChange bool) int64 {
+	size := TxOverheadVSize + s.OutputsVSize + int64(inputs)*s.InputVSize
+	if withChange {
+		size += s.ChangeVSize
+	}
+	return size
+}
+
+// CoinSelectionParams defines the inputs of a coin selection
+type CoinSelectionParams struct {
+	// Target is the total amount paid to destination outputs
+	Target int64
+	// FeeRate in sat/vB
+	FeeRate int64
+	// Dust is the smallest change worth creating an output for
+	Dust  int64
+	Sizer WithdrawTxSizer
+}
+
+// CoinSelectionResult is the outcome of a coin selection
+type CoinSelectionResult struct {
+	Inputs []*model.UnspentOutput
+	Fee    int64
+	// Change is 0 when there is no change output, the remainder is folded into the fee
+	Change int64
+}
+
+// CoinSelector chooses the utxos funding a withdraw tx
+type CoinSelector interface {
+	Select(utxos []*model.UnspentOutput, params CoinSelectionParams) (*CoinSelectionResult, error)
+}
+
+// NewCoinSelector builds the coin selector configured by bridgeCfg
+func NewCoinSelector(bridgeCfg config.BridgeConfig) (CoinSelector, error) {
+	var selector CoinSelector
+	switch bridgeCfg.CoinSelection {
+	case CoinSelectionLargestFirst, "":
+		selector = LargestFirstSelector{}
+	case CoinSelectionBranchAndBound:
+		selector = BranchAndBoundSelector{}
+	default:
+		return nil, fmt.Errorf("unknown coin selection: %s", bridgeCfg.CoinSelection)
+	}
+	if bridgeCfg.ConsolidateFeeRate > 0 {
+		selector = ConsolidatingSelector{
+			Selector:   selector,
+			MaxFeeRate: bridgeCfg.ConsolidateFeeRate,
+			MaxInputs:  bridgeCfg.ConsolidateMaxInputs,
+		}
+	}
+	return selector, nil
+}
+
+// completeSelection computes fee and change for inputs, folding dust change into the fee
+func completeSelection(inputs []*model.UnspentOutput, params CoinSelectionParams) (*CoinSelectionResult, bool) {
+	total := sumUtxo(inputs)
+	feeWithChange := params.FeeRate * params.Sizer.VSize(len(inputs), true)
+	change := total - params.Target - feeWithChange
+	if change >= params.Dust && change > 0 {
+		return &CoinSelectionResult{Inputs: inputs, Fee: feeWithChange, Change: change}, true
+	}
+	feeNoChange := params.FeeRate * params.Sizer.VSize(len(inputs), false)
+	if total-params.Target >= feeNoChange {
+		return &CoinSelectionResult{Inputs: inputs, Fee: total - params.Target, Change: 0}, true
+	}
+	return nil, false
+}
+
+// LargestFirstSelector adds the largest utxos until the target and fee are covered
+type LargestFirstSelector struct{}
+
+func (LargestFirstSelector) Select(utxos []*model.UnspentOutput, params CoinSelectionParams) (*CoinSelectionResult, error) {
+	sorted := sortUtxoDesc(utxos)
+	selected := make([]*model.UnspentOutput, 0)
+	for _, utxo := range sorted {
+		selected = append(selected, utxo)
+		if result, ok := completeSelection(selected, params); ok {
+			return result, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: available %d, target %d", ErrInsufficientUtxo, sumUtxo(utxos), params.Target)
+}
+
+// BranchAndBoundSelector searches for an input set that needs no change output,
+// falling back to largest-first when no such set exists.
+type BranchAndBoundSelector struct{}
+
+func (BranchAndBoundSelector) Select(utxos []*model.UnspentOutput, params CoinSelectionParams) (*CoinSelectionResult, error) {
+	inputFee := params.FeeRate * params.Sizer.InputVSize
+	candidates := make([]*model.UnspentOutput, 0, len(utxos))
+	for _, utxo := range sortUtxoDesc(utxos) {
+		// skip utxos costing more to spend than they are worth
+		if utxo.Output.Value > inputFee {
+			candidates = append(candidates, utxo)
+		}
+	}
+	effective := make([]int64, len(candidates))
+	var available int64
+	for i, utxo := range candidates {
+		effective[i] = utxo.Output.Value - inputFee
+		available += effective[i]
+	}
+
+	target := params.Target + params.FeeRate*params.Sizer.VSize(0, false)
+	costOfChange := params.FeeRate*params.Sizer.ChangeVSize + params.Dust
+
+	var (
+		best      []int
+		bestWaste int64 = -1
+		tries     int
+		current   []int
+	)
+	var search func(index int, value int64, remaining int64)
+	search = func(index int, value int64, remaining int64) {
+		tries++
+		if tries > bnbMaxTries {
+			return
+		}
+		if value > target+costOfChange || value+remaining < target {
+			return
+		}
+		if value >= target {
+			waste := value - target
+			if bestWaste < 0 || waste < bestWaste {
+				bestWaste = waste
+				best = append(best[:0], current...)
+			}
+			return
+		}
+		if index >= len(candidates) {
+			return
+		}
+		// include
+		current = append(current, index)
+		search(index+1, value+effective[index], remaining-effective[index])
+		current = current[:len(current)-1]
+		// exclude
+		search(index+1, value, remaining-effective[index])
+	}
+	search(0, 0, available)
+
+	if bestWaste >= 0 {
+		selected := make([]*model.UnspentOutput, 0, len(best))
+		for _, i := range best {
+			selected = append(selected, candidates[i])
+		}
+		total := sumUtxo(selected)
+		return &CoinSelectionResult{Inputs: selected, Fee: total - params.Target, Change: 0}, nil
+	}
+	return LargestFirstSelector{}.Select(utxos, params)
+}
+
+// ConsolidatingSelector adds the smallest remaining utxos to the selection while fees are low,
+// skipping utxos costing more to spend than they are worth
+type ConsolidatingSelector struct {
+	Selector CoinSelector
+	// MaxFeeRate is the fee rate at or below which consolidation happens
+	MaxFeeRate int64
+	// MaxInputs bounds the total inputs of the tx
+	MaxInputs int
+}
+
+func (c ConsolidatingSelector) Select(utxos []*model.UnspentOutput, params CoinSelectionParams) (*CoinSelectionResult, error) {
+	result, err := c.Selector.Select(utxos, params)
+	if err != nil {
+		return nil, err
+	}
+	if params.FeeRate > c.MaxFeeRate || len(result.Inputs) >= c.MaxInputs {
+		return result, nil
+	}
+
+	selected := make(map[wire.OutPoint]bool, len(result.Inputs))
+	for _, utxo := range result.Inputs {
+		selected[*utxo.Outpoint] = true
+	}
+	rest := append([]*model.UnspentOutput{}, utxos...)
+	sort.SliceStable(rest, func(i, j int) bool {
+		return rest[i].Output.Value < rest[j].Output.Value
+	})
+	inputFee := params.FeeRate * params.Sizer.InputVSize
+	inputs := append([]*model.UnspentOutput{}, result.Inputs...)
+	for _, utxo := range rest {
+		if len(inputs) >= c.MaxInputs {
+			break
+		}
+		if selected[*utxo.Outpoint] || utxo.Output.Value <= inputFee {
+			continue
+		}
+		inputs = append(inputs, utxo)
+	}
+	if len(inputs) == len(result.Inputs) {
+		return result, nil
+	}
+	consolidated, ok := completeSelection(inputs, params)
+	if !ok {
+		return result, nil
+	}
+	return consolidated, nil
+}
+
+func sortUtxoDesc(utxos []*model.UnspentOutput) []*model.UnspentOutput {
+	sorted := append([]*model.UnspentOutput{}, utxos...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Output.Value > sorted[j].Output.Value
+	})
+	return sorted
+}
+
+func sumUtxo(utxos []*model.UnspentOutput) int64 {
+	var total int64
+	for _, utxo := range utxos {
+		total += utxo.Output.Value
+	}
+	return total
+}
@@ -0,0 +1,129 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+)
+
+func testUtxos(values ...int64) []*model.UnspentOutput {
+	utxos := make([]*model.UnspentOutput, 0, len(values))
+	for i, v := range values {
+		hash := chainhash.HashH([]byte{byte(i)})
+		utxos = append(utxos, &model.UnspentOutput{
+			Outpoint: wire.NewOutPoint(&hash, uint32(i)),
+			Output:   wire.NewTxOut(v, nil),
+		})
+	}
+	return utxos
+}
+
+func testSelectionParams(target int64, feeRate int64) CoinSelectionParams {
+	return CoinSelectionParams{
+		Target:  target,
+		FeeRate: feeRate,
+		Dust:    330,
+		Sizer: WithdrawTxSizer{
+			OutputsVSize: 43,
+			ChangeVSize:  43,
+			InputVSize:   104,
+		},
+	}
+}
+
+func TestLargestFirstSelector(t *testing.T) {
+	utxos := testUtxos(1000, 50000, 20000, 300000)
+
+	result, err := LargestFirstSelector{}.Select(utxos, testSelectionParams(100000, 2))
+	require.NoError(t, err)
+	require.Len(t, result.Inputs, 1)
+	require.Equal(t, int64(300000), result.Inputs[0].Output.Value)
+	require.Equal(t, int64(2*(TxOverheadVSize+43+43+104)), result.Fee)
+	require.Equal(t, int64(300000-100000)-result.Fee, result.Change)
+
+	_, err = LargestFirstSelector{}.Select(utxos, testSelectionParams(1000000, 2))
+	require.ErrorIs(t, err, ErrInsufficientUtxo)
+}
+
+func TestSelectionFoldsDustChange(t *testing.T) {
+	params := testSelectionParams(100000, 1)
+	noChangeFee := params.FeeRate * params.Sizer.VSize(1, false)
+	// leaves 100 sat over the no change fee, below dust
+	utxos := testUtxos(100000 + noChangeFee + 100)
+
+	result, err := LargestFirstSelector{}.Select(utxos, params)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), result.Change)
+	require.Equal(t, noChangeFee+100, result.Fee)
+}
+
+func TestBranchAndBoundSelector(t *testing.T) {
+	params := testSelectionParams(50000, 1)
+	inputFee := params.FeeRate * params.Sizer.InputVSize
+	exact := 50000 + params.FeeRate*params.Sizer.VSize(0, false)
+	// 30000 + 20000 effective values sum to exactly the target
+	utxos := testUtxos(400000, 30000+inputFee, 1000, 20000+inputFee+exact-50000)
+
+	result, err := BranchAndBoundSelector{}.Select(utxos, params)
+	require.NoError(t, err)
+	require.Len(t, result.Inputs, 2)
+	require.Equal(t, int64(0), result.Change)
+	require.Equal(t, sumUtxo(result.Inputs)-50000, result.Fee)
+
+	// no exact match falls back to largest first
+	result, err = BranchAndBoundSelector{}.Select(testUtxos(400000), params)
+	require.NoError(t, err)
+	require.Len(t, result.Inputs, 1)
+	require.Greater(t, result.Change, int64(0))
+}
+
+func TestConsolidatingSelector(t *testing.T) {
+	utxos := testUtxos(500000, 5000, 6000, 50)
+	selector := ConsolidatingSelector{
+		Selector:   LargestFirstSelector{},
+		MaxFeeRate: 2,
+		MaxInputs:  3,
+	}
+
+	// low fee: consolidates the smallest spendable utxos up to max inputs
+	result, err := selector.Select(utxos, testSelectionParams(100000, 1))
+	require.NoError(t, err)
+	require.Len(t, result.Inputs, 3)
+	require.Equal(t, int64(500000), result.Inputs[0].Output.Value)
+	require.Equal(t, int64(5000), result.Inputs[1].Output.Value)
+	require.Equal(t, int64(6000), result.Inputs[2].Output.Value)
+
+	// high fee: keeps the minimal selection
+	result, err = selector.Select(utxos, testSelectionParams(100000, 10))
+	require.NoError(t, err)
+	require.Len(t, result.Inputs, 1)
+}
+
+func TestNewCoinSelector(t *testing.T) {
+	selector, err := NewCoinSelector(config.BridgeConfig{})
+	require.NoError(t, err)
+	require.IsType(t, LargestFirstSelector{}, selector)
+
+	selector, err = NewCoinSelector(config.BridgeConfig{CoinSelection: CoinSelectionBranchAndBound, ConsolidateFeeRate: 3})
+	require.NoError(t, err)
+	require.IsType(t, ConsolidatingSelector{}, selector)
+
+	_, err = NewCoinSelector(config.BridgeConfig{CoinSelection: "random"})
+	require.Error(t, err)
+}
+
+func TestBoundedFeeEstimator(t *testing.T) {
+	estimator := &boundedFeeEstimator{source: staticFeeEstimator(200), floor: 2, ceiling: 50}
+	feeRate, err := estimator.FeeRate()
+	require.NoError(t, err)
+	require.Equal(t, int64(50), feeRate)
+
+	estimator = &boundedFeeEstimator{source: staticFeeEstimator(0)}
+	feeRate, err = estimator.FeeRate()
+	require.NoError(t, err)
+	require.Equal(t, int64(1), feeRate)
+}
@@ -0,0 +1,63 @@
+package indexer
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/migration"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/storage"
+	"github.com/b2network/b2-indexer/pkg/log"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func openSqlite(t *testing.T) *gorm.DB {
+	db, err := storage.Open(&config.Config{
+		DatabaseSource: "sqlite://" + filepath.Join(t.TempDir(), "indexer.db"),
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	migrator, err := migration.New(db, log.NewNopLogger())
+	require.NoError(t, err)
+	_, err = migrator.Up(0)
+	require.NoError(t, err)
+	return db
+}
+
+func TestDropConflicts(t *testing.T) {
+	db := openSqlite(t)
+	create := func(tx model.WithdrawTx) model.WithdrawTx {
+		require.NoError(t, db.Create(&tx).Error)
+		return tx
+	}
+	original := create(model.WithdrawTx{BtcTxID: "original", Status: model.BtcTxWithdrawReplaced})
+	child := create(model.WithdrawTx{BtcTxID: "child", Status: model.BtcTxWithdrawBroadcastSuccess, ReplacesID: original.ID, BumpType: model.WithdrawTxBumpCPFP})
+	grandchild := create(model.WithdrawTx{BtcTxID: "grandchild", Status: model.BtcTxWithdrawBroadcastSuccess, ReplacesID: child.ID, BumpType: model.WithdrawTxBumpCPFP})
+	rbf := create(model.WithdrawTx{BtcTxID: "rbf", Status: model.BtcTxWithdrawBroadcastSuccess, ReplacesID: original.ID, BumpType: model.WithdrawTxBumpRBF})
+	rbfChild := create(model.WithdrawTx{BtcTxID: "rbf-child", Status: model.BtcTxWithdrawBroadcastSuccess, ReplacesID: rbf.ID, BumpType: model.WithdrawTxBumpCPFP})
+	rbf2 := create(model.WithdrawTx{BtcTxID: "rbf2", Status: model.BtcTxWithdrawBroadcastSuccess, ReplacesID: rbf.ID, BumpType: model.WithdrawTxBumpRBF})
+	failed := create(model.WithdrawTx{BtcTxID: "failed", Status: model.BtcTxWithdrawBroadcastFailed, ReplacesID: rbf.ID, BumpType: model.WithdrawTxBumpRBF})
+	other := create(model.WithdrawTx{BtcTxID: "other", Status: model.BtcTxWithdrawReplaced})
+
+	// the first replacement is mined
+	require.NoError(t, dropConflicts(db, rbf))
+	want := map[int64]int{
+		original.ID:   model.BtcTxWithdrawDropped,
+		child.ID:      model.BtcTxWithdrawDropped,
+		grandchild.ID: model.BtcTxWithdrawDropped,
+		rbf.ID:        model.BtcTxWithdrawBroadcastSuccess,
+		rbfChild.ID:   model.BtcTxWithdrawBroadcastSuccess,
+		rbf2.ID:       model.BtcTxWithdrawDropped,
+		failed.ID:     model.BtcTxWithdrawBroadcastFailed,
+		other.ID:      model.BtcTxWithdrawReplaced,
+	}
+	for id, status := range want {
+		var tx model.WithdrawTx
+		require.NoError(t, db.First(&tx, id).Error)
+		require.Equal(t, status, tx.Status, tx.BtcTxID)
+	}
+}
@@ -0,0 +1,116 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/rpcclient"
+)
+
+const (
+	FeeSourceMempool = "mempool"
+	FeeSourceNode    = "node"
+	FeeSourceStatic  = "static"
+)
+
+var ErrFeeEstimateUnavailable = errors.New("fee estimate unavailable")
+
+// FeeEstimator returns the fee rate in sat/vB used to build withdraw transactions
+type FeeEstimator interface {
+	FeeRate() (int64, error)
+}
+
+// NewFeeEstimator builds the fee estimator configured by bridgeCfg.FeeSource,
+// bounded by the configured floor and ceiling.
+func NewFeeEstimator(bis *BridgeWithdrawService, bridgeCfg config.BridgeConfig) (FeeEstimator, error) {
+	var source FeeEstimator
+	switch bridgeCfg.FeeSource {
+	case FeeSourceMempool, "":
+		source = &mempoolFeeEstimator{bis: bis}
+	case FeeSourceNode:
+		source = &nodeFeeEstimator{client: bis.btcCli, confTarget: bridgeCfg.FeeConfTarget}
+	case FeeSourceStatic:
+		if bridgeCfg.StaticFeeRate <= 0 {
+			return nil, fmt.Errorf("static fee source requires a positive static-fee-rate")
+		}
+		source = staticFeeEstimator(bridgeCfg.StaticFeeRate)
+	default:
+		return nil, fmt.Errorf("unknown fee source: %s", bridgeCfg.FeeSource)
+	}
+	return &boundedFeeEstimator{
+		source:  source,
+		floor:   bridgeCfg.MinFeeRate,
+		ceiling: bridgeCfg.MaxFeeRate,
+	}, nil
+}
+
+// mempoolFeeEstimator uses the mempool.space recommended fastest fee
+type mempoolFeeEstimator struct {
+	bis *BridgeWithdrawService
+}
+
+func (m *mempoolFeeEstimator) FeeRate() (int64, error) {
+	feeRates, err := m.bis.GetFeeRate()
+	if err != nil {
+		return 0, err
+	}
+	return int64(feeRates.FastestFee), nil
+}
+
+// nodeFeeEstimator uses the bitcoin node estimatesmartfee rpc
+type nodeFeeEstimator struct {
+	client     *rpcclient.Client
+	confTarget int64
+}
+
+func (n *nodeFeeEstimator) FeeRate() (int64, error) {
+	confTarget := n.confTarget
+	if confTarget <= 0 {
+		confTarget = 3
+	}
+	mode := btcjson.EstimateModeConservative
+	result, err := n.client.EstimateSmartFee(confTarget, &mode)
+	if err != nil {
+		return 0, err
+	}
+	if result.FeeRate == nil {
+		return 0, fmt.Errorf("%w: %v", ErrFeeEstimateUnavailable, result.Errors)
+	}
+	// BTC/kvB -> sat/vB
+	return int64(math.Ceil(*result.FeeRate * 1e8 / 1000)), nil
+}
+
+// staticFeeEstimator always returns the configured fee rate
+type staticFeeEstimator int64
+
+func (s staticFeeEstimator) FeeRate() (int64, error) {
+	return int64(s), nil
+}
+
+// boundedFeeEstimator clamps the source fee rate to [floor, ceiling]
+type boundedFeeEstimator struct {
+	source  FeeEstimator
+	floor   int64
+	ceiling int64
+}
+
+func (b *boundedFeeEstimator) FeeRate() (int64, error) {
+	feeRate, err := b.source.FeeRate()
+	if err != nil {
+		return 0, err
+	}
+	floor := b.floor
+	if floor <= 0 {
+		floor = 1
+	}
+	if feeRate < floor {
+		feeRate = floor
+	}
+	if b.ceiling > 0 && feeRate > b.ceiling {
+		feeRate = b.ceiling
+	}
+	return feeRate, nil
+}
@@ -14,10 +14,15 @@ import (
 	"github.com/b2network/b2-indexer/config"
 	"github.com/go-resty/resty/v2"
 
+	"github.com/b2network/b2-indexer/internal/health"
+	"github.com/b2network/b2-indexer/internal/leader"
+	"github.com/b2network/b2-indexer/internal/logic/risk"
 	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/supervisor"
 	"github.com/b2network/b2-indexer/pkg/log"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mempool"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/cometbft/cometbft/libs/service"
@@ -33,6 +38,9 @@ const (
 	BridgeWithdrawServiceName = "BitcoinBridgeWithdrawService"
 	WithdrawHandleTime        = 10
 	WithdrawTXConfirmTime     = 60 * 5
+	// ReplacedTxDropAge is how long a replaced withdraw tx unknown to the node is polled
+	// before it is dropped, it may be broadcast again by another node meanwhile
+	ReplacedTxDropAge = 24 * time.Hour
 
 	// P2SHSize 23 bytes.
 	P2SHSize = 23
@@ -65,15 +73,22 @@ const (
 	MultiSigSize = 1 + 1 + 33 + 1 + 33 + 1 + 1
 )
 
+var ErrNoUnspentTx = errors.New("no unspent tx")
+
 // BridgeWithdrawService indexes transactions for json-rpc service.
 type BridgeWithdrawService struct {
 	service.BaseService
 
-	btcCli *rpcclient.Client
-	ethCli *ethclient.Client
-	config *config.BitcoinConfig
-	db     *gorm.DB
-	log    log.Logger
+	btcCli       *rpcclient.Client
+	ethCli       *ethclient.Client
+	config       *config.BitcoinConfig
+	db           *gorm.DB
+	log          log.Logger
+	feeEstimator FeeEstimator
+	coinSelector CoinSelector
+	batchPolicy  WithdrawBatchPolicy
+	riskEngine   *risk.Engine
+	loops        *supervisor.Loops
 }
 
 // NewBridgeWithdrawService returns a new service instance.
@@ -83,39 +98,38 @@ func NewBridgeWithdrawService(
 	config *config.BitcoinConfig,
 	db *gorm.DB,
 	log log.Logger,
-) *BridgeWithdrawService {
+) (*BridgeWithdrawService, error) {
 	is := &BridgeWithdrawService{btcCli: btcCli, ethCli: ethCli, config: config, db: db, log: log}
+	feeEstimator, err := NewFeeEstimator(is, config.Bridge)
+	if err != nil {
+		return nil, err
+	}
+	coinSelector, err := NewCoinSelector(config.Bridge)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckFeeBumpStrategy(config.Bridge); err != nil {
+		return nil, err
+	}
+	is.feeEstimator = feeEstimator
+	is.coinSelector = coinSelector
+	is.batchPolicy = NewWithdrawBatchPolicy(config.Bridge)
+	is.riskEngine = risk.NewEngine(config.Bridge.Risk, is.chainParams(), db, log)
 	is.BaseService = *service.NewBaseService(nil, BridgeWithdrawServiceName, is)
-	return is
+	return is, nil
 }
 
-// OnStart implements service.Service by subscribing for new blocks
-// and indexing them by events.
+// OnStart implements service.Service by starting the withdraw tx submit,
+// broadcast, confirm and complete loops.
 func (bis *BridgeWithdrawService) OnStart() error {
-	if !bis.db.Migrator().HasTable(&model.Withdraw{}) {
-		err := bis.db.AutoMigrate(&model.Withdraw{})
-		if err != nil {
-			bis.log.Errorw("BridgeWithdrawService create withdraw table", "error", err.Error())
-			return err
-		}
-	}
-	if !bis.db.Migrator().HasTable(&model.WithdrawTx{}) {
-		err := bis.db.AutoMigrate(&model.WithdrawTx{})
-		if err != nil {
-			bis.log.Errorw("BridgeWithdrawService create withdrawTx table", "error", err.Error())
-			return err
-		}
-	}
+	bis.loops = supervisor.NewLoops()
 
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				bis.log.Errorw("BridgeWithdrawService panic", "error", r)
-			}
-		}()
+	bis.loops.Go(func() error {
 		for {
 			// broadcast transaction
-			time.Sleep(time.Duration(WithdrawHandleTime) * time.Second)
+			if !bis.loops.Sleep(time.Duration(WithdrawHandleTime) * time.Second) {
+				return nil
+			}
 			var withdrawTxList []model.WithdrawTx
 			err := bis.db.Model(&model.WithdrawTx{}).Where(fmt.Sprintf("%s = ?", model.Withdraw{}.Column().Status), model.BtcTxWithdrawSignatureCompleted).Find(&withdrawTxList).Error
 			if err != nil {
@@ -131,33 +145,16 @@ func (bis *BridgeWithdrawService) OnStart() error {
 					bis.log.Errorw("BridgeWithdrawService get psbt tx err", "error", err)
 					continue
 				}
-				tx := pack.UnsignedTx
-				preTx := pack.Inputs
-
-				var signes [][]model.Sign
-				var signatures []string
-				for _, signHex := range signatures {
-					signByte, err := hex.DecodeString(signHex)
-					if err != nil {
-						bis.log.Errorw("BridgeWithdrawService DecodeString sign err", "error", err)
-						continue
-					}
-					var sign []model.Sign
-					err = json.Unmarshal(signByte, &sign)
-					if err != nil {
-						bis.log.Errorw("BridgeWithdrawService Unmarshal sign err", "error", err)
-						continue
-					}
-					signes = append(signes, sign)
+				// witnesses are finalized by the WithdrawSigner
+				tx, err := psbt.Extract(pack)
+				if err != nil {
+					bis.log.Errorw("BridgeWithdrawService extract psbt tx err", "id", v.ID, "error", err)
+					continue
 				}
-				for index, in := range tx.TxIn {
-					witness := wire.TxWitness{nil}
-					for i := 0; i < bis.config.Bridge.MultisigNum; i++ {
-						sign := signes[i][index].Sign
-						witness = append(witness, sign)
-					}
-					witness = append(witness, preTx[index].WitnessUtxo.PkScript)
-					in.Witness = witness
+				// a replica which lost the leader lease must not broadcast
+				if err := leader.Verify(bis.db); err != nil {
+					bis.log.Errorw("BridgeWithdrawService leader verify err", "id", v.ID, "error", err)
+					break
 				}
 				var status int
 				var reason string
@@ -170,11 +167,24 @@ func (bis *BridgeWithdrawService) OnStart() error {
 					status = model.BtcTxWithdrawBroadcastSuccess
 				}
 				updateFields := map[string]interface{}{
-					model.WithdrawTx{}.Column().BtcTxHash: txHash,
-					model.WithdrawTx{}.Column().Status:    status,
-					model.WithdrawTx{}.Column().Reason:    reason,
+					model.WithdrawTx{}.Column().BtcTxHash:   txHash,
+					model.WithdrawTx{}.Column().Status:      status,
+					model.WithdrawTx{}.Column().Reason:      reason,
+					model.WithdrawTx{}.Column().BroadcastAt: time.Now(),
 				}
-				err = bis.db.Model(&model.WithdrawTx{}).Where("id = ?", v.ID).Updates(updateFields).Error
+				err = bis.db.Transaction(func(tx *gorm.DB) error {
+					err := tx.Model(&model.WithdrawTx{}).Where("id = ?", v.ID).Updates(updateFields).Error
+					if err != nil {
+						return err
+					}
+					// the broadcast replacement evicts the replaced tx from the mempool
+					if status == model.BtcTxWithdrawBroadcastSuccess && v.BumpType == model.WithdrawTxBumpRBF {
+						return tx.Model(&model.WithdrawTx{}).
+							Where(fmt.Sprintf("id = ? AND %s = ?", model.WithdrawTx{}.Column().Status), v.ReplacesID, model.BtcTxWithdrawBroadcastSuccess).
+							Update(model.WithdrawTx{}.Column().Status, model.BtcTxWithdrawReplaced).Error
+					}
+					return nil
+				})
 				if err != nil {
 					bis.log.Errorw("BridgeWithdrawService broadcast tx update db err", "error", err, "id", v.ID)
 					continue
@@ -182,19 +192,18 @@ func (bis *BridgeWithdrawService) OnStart() error {
 				bis.log.Infow("BridgeWithdrawService broadcast tx success", "id", v.ID, "btcTxID", v.BtcTxID)
 			}
 		}
-	}()
+	})
 
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				bis.log.Errorw("BridgeWithdrawService panic", "error", r)
-			}
-		}()
+	bis.loops.Go(func() error {
 		for {
-			time.Sleep(time.Duration(WithdrawTXConfirmTime) * time.Second)
-			// confirm tx
+			if !bis.loops.Sleep(time.Duration(WithdrawTXConfirmTime) * time.Second) {
+				return nil
+			}
+			// confirm tx, a replaced tx may still be mined before its replacement
 			var withdrawTxList []model.WithdrawTx
-			err := bis.db.Model(&model.WithdrawTx{}).Where(fmt.Sprintf("%s = ?", model.WithdrawTx{}.Column().Status), model.BtcTxWithdrawBroadcastSuccess).Find(&withdrawTxList).Error
+			err := bis.db.Model(&model.WithdrawTx{}).
+				Where(fmt.Sprintf("%s IN (?)", model.WithdrawTx{}.Column().Status), []int{model.BtcTxWithdrawBroadcastSuccess, model.BtcTxWithdrawReplaced}).
+				Find(&withdrawTxList).Error
 			if err != nil {
 				bis.log.Errorw("BridgeWithdrawService get broadcast tx failed", "error", err)
 				continue
@@ -210,28 +219,53 @@ func (bis *BridgeWithdrawService) OnStart() error {
 				}
 				txRawResult, err := bis.btcCli.GetRawTransactionVerbose(txHash)
 				if err != nil {
-					bis.log.Errorw("BridgeWithdrawService GetRawTransactionVerbose err", "error", err, "txID", v.BtcTxID)
+					if v.Status != model.BtcTxWithdrawReplaced {
+						bis.log.Errorw("BridgeWithdrawService GetRawTransactionVerbose err", "error", err, "txID", v.BtcTxID)
+						continue
+					}
+					// the replacement evicted the replaced tx from the mempool
+					bis.log.Warnw("BridgeWithdrawService replaced tx unknown to the node", "error", err, "id", v.ID, "txID", v.BtcTxID)
+					if time.Since(v.UpdatedAt) < ReplacedTxDropAge {
+						continue
+					}
+					err = bis.db.Model(&model.WithdrawTx{}).
+						Where(fmt.Sprintf("id = ? AND %s = ?", model.WithdrawTx{}.Column().Status), v.ID, model.BtcTxWithdrawReplaced).
+						Update(model.WithdrawTx{}.Column().Status, model.BtcTxWithdrawDropped).Error
+					if err != nil {
+						bis.log.Errorw("BridgeWithdrawService drop replaced tx err", "error", err, "txID", v.BtcTxID)
+						continue
+					}
+					bis.log.Warnw("BridgeWithdrawService replaced tx dropped", "id", v.ID, "txID", v.BtcTxID)
 					continue
 				}
 				if txRawResult.Confirmations >= 6 {
-					err = bis.db.Model(&model.WithdrawTx{}).Where("id = ?", v.ID).Update(model.WithdrawTx{}.Column().Status, model.BtcTxWithdrawConfirmed).Error
+					err = bis.db.Transaction(func(tx *gorm.DB) error {
+						err := tx.Model(&model.WithdrawTx{}).Where("id = ?", v.ID).Update(model.WithdrawTx{}.Column().Status, model.BtcTxWithdrawConfirmed).Error
+						if err != nil {
+							return err
+						}
+						return dropConflicts(tx, v)
+					})
 					if err != nil {
 						bis.log.Errorw("BridgeWithdrawService Update WithdrawTx status err", "error", err, "txID", v.BtcTxID)
 						continue
 					}
+				} else if txRawResult.Confirmations == 0 && v.Status == model.BtcTxWithdrawBroadcastSuccess {
+					err = bis.BumpStuckTx(v)
+					if err != nil {
+						bis.log.Errorw("BridgeWithdrawService bump stuck tx err", "error", err, "txID", v.BtcTxID)
+						continue
+					}
 				}
 			}
 		}
-	}()
+	})
 
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				bis.log.Errorw("BridgeWithdrawService panic", "error", r)
-			}
-		}()
+	bis.loops.Go(func() error {
 		for {
-			time.Sleep(time.Duration(WithdrawHandleTime) * time.Second)
+			if !bis.loops.Sleep(time.Duration(WithdrawHandleTime) * time.Second) {
+				return nil
+			}
 			// complete tx
 			var withdrawTxList []model.WithdrawTx
 			err := bis.db.Model(&model.WithdrawTx{}).
@@ -260,6 +294,10 @@ func (bis *BridgeWithdrawService) OnStart() error {
 						bis.log.Errorw("BridgeWithdrawService Update WithdrawTx status err", "error", err, "txID", v.BtcTxID)
 						return err
 					}
+					// a failed fee bump leaves the bumped tx in charge of the withdraws
+					if v.ReplacesID != 0 && withdrawTxStatus == model.BtcTxWithdrawFailed {
+						return nil
+					}
 					var b2TxHashList []string
 					err = json.Unmarshal([]byte(v.B2TxHashes), &b2TxHashList)
 					if err != nil {
@@ -277,17 +315,102 @@ func (bis *BridgeWithdrawService) OnStart() error {
 				}
 			}
 		}
-	}()
+	})
+
+	bis.loops.Go(bis.submitWithdraws)
+	return nil
+}
 
+// dropConflicts drops the withdraw txs which never confirm once confirmed did: the txs
+// of its RBF replacement chain, which spend the same inputs, and their CPFP children
+func dropConflicts(tx *gorm.DB, confirmed model.WithdrawTx) error {
+	root := confirmed
+	for root.BumpType == model.WithdrawTxBumpRBF && root.ReplacesID != 0 {
+		var replaced model.WithdrawTx
+		if err := tx.First(&replaced, root.ReplacesID).Error; err != nil {
+			return err
+		}
+		root = replaced
+	}
+	var conflicts []int64
+	if root.ID != confirmed.ID {
+		conflicts = append(conflicts, root.ID)
+	}
+	// the replacements of the chain, then the children paying for them
+	for _, bumpType := range []int{model.WithdrawTxBumpRBF, model.WithdrawTxBumpCPFP} {
+		parents := []int64{root.ID}
+		if bumpType == model.WithdrawTxBumpCPFP {
+			parents = conflicts
+		}
+		for len(parents) > 0 {
+			var children []model.WithdrawTx
+			err := tx.Model(&model.WithdrawTx{}).
+				Where(fmt.Sprintf("%s IN (?) AND %s = ?", model.WithdrawTx{}.Column().ReplacesID, model.WithdrawTx{}.Column().BumpType), parents, bumpType).
+				Find(&children).Error
+			if err != nil {
+				return err
+			}
+			parents = nil
+			for _, child := range children {
+				if child.ID == confirmed.ID {
+					parents = append(parents, child.ID)
+					continue
+				}
+				conflicts = append(conflicts, child.ID)
+				parents = append(parents, child.ID)
+			}
+		}
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	return tx.Model(&model.WithdrawTx{}).
+		Where(fmt.Sprintf("id IN (?) AND %s IN (?)", model.WithdrawTx{}.Column().Status), conflicts,
+			[]int{model.BtcTxWithdrawBroadcastSuccess, model.BtcTxWithdrawReplaced}).
+		Update(model.WithdrawTx{}.Column().Status, model.BtcTxWithdrawDropped).Error
+}
+
+// OnStop waits for the withdraw txs being saved or broadcast
+func (bis *BridgeWithdrawService) OnStop() {
+	bis.log.Warnf("BridgeWithdrawService stopping...")
+	bis.loops.Stop()
+}
+
+// Crashed implements supervisor.Service
+func (bis *BridgeWithdrawService) Crashed() <-chan struct{} {
+	return bis.loops.Crashed()
+}
+
+// Err implements supervisor.Service
+func (bis *BridgeWithdrawService) Err() error {
+	return bis.loops.Err()
+}
+
+// submitWithdraws builds the withdraw txs of the pending withdraws until the service stops
+func (bis *BridgeWithdrawService) submitWithdraws() error {
 	for {
 		timeInterval := bis.config.Bridge.TimeInterval
-		time.Sleep(time.Duration(timeInterval) * time.Second)
-		var withdrawList []model.Withdraw
-		err := bis.db.Model(&model.Withdraw{}).Where(fmt.Sprintf("%s = ?", model.Withdraw{}.Column().Status), model.BtcTxWithdrawPending).Find(&withdrawList).Error
+		if !bis.loops.Sleep(time.Duration(timeInterval) * time.Second) {
+			return nil
+		}
+		health.Beat(health.ComponentBridgeWithdraw)
+		bis.updateMetrics()
+		err := bis.riskEngine.CheckPending()
+		if err != nil {
+			bis.log.Errorw("BridgeWithdrawService risk check failed", "error", err)
+			continue
+		}
+		var pendingList []model.Withdraw
+		err = bis.db.Model(&model.Withdraw{}).
+			Where(fmt.Sprintf("%s = ? AND %s IN (?)", model.Withdraw{}.Column().Status, model.Withdraw{}.Column().RiskStatus),
+				model.BtcTxWithdrawPending, []int{model.WithdrawRiskPassed, model.WithdrawRiskApproved}).
+			Order("id").
+			Find(&pendingList).Error
 		if err != nil {
 			bis.log.Errorw("BridgeWithdrawService get blockNumber failed", "error", err)
 			continue
 		}
+		withdrawList := NextWithdrawBatch(pendingList, bis.batchPolicy, time.Now())
 		if len(withdrawList) == 0 {
 			continue
 		}
@@ -311,7 +434,7 @@ func (bis *BridgeWithdrawService) OnStart() error {
 		}
 		txID, btcTx, err := bis.ConstructTx(destAddressList, amounts, b2TxHashesByte)
 		if err != nil {
-			if errors.Is(err, errors.New("no unspent tx")) {
+			if errors.Is(err, ErrNoUnspentTx) {
 				continue
 			}
 			bis.log.Errorw("BridgeWithdrawService transferToBtc failed: ", "error", err)
@@ -429,15 +552,23 @@ func (bis *BridgeWithdrawService) GetUnspentList(address string, cursor int64) (
 		if err != nil {
 			return total, satoshiTotal, nil, err
 		}
+		scriptPk, err := hex.DecodeString(v.ScriptPk)
+		if err != nil {
+			return total, satoshiTotal, nil, err
+		}
 		unspentOutputs = append(unspentOutputs, &model.UnspentOutput{
 			Outpoint: wire.NewOutPoint(txHash, uint32(v.Vout)),
-			Output:   wire.NewTxOut(v.Satoshi, []byte(v.ScriptPk)),
+			Output:   wire.NewTxOut(v.Satoshi, scriptPk),
 		})
 		satoshiTotal += v.Satoshi
 	}
 	return total, satoshiTotal, unspentOutputs, nil
 }
 
+func (bis *BridgeWithdrawService) chainParams() *chaincfg.Params {
+	return config.ChainParams(bis.config.NetworkName)
+}
+
 func (bis *BridgeWithdrawService) GetUisatURL() string {
 	networkName := bis.config.NetworkName
 	switch networkName {
@@ -477,31 +608,28 @@ func (bis *BridgeWithdrawService) ConstructTx(destAddressList []string, amounts
 		return "", "", err
 	}
 
-	total, satoshiTotal, unspentTxs, err := bis.GetUnspentList(sourceAddrStr, 0)
+	allUnspentTxs, err := bis.GetAllUnspentList(sourceAddrStr)
+	if err != nil {
+		bis.log.Errorw("BridgeWithdrawService GetAllUnspentList err: ", "error", err)
+		return "", "", err
+	}
+	reserved, err := bis.reservedOutpoints()
 	if err != nil {
-		bis.log.Errorw("BridgeWithdrawService GetUnspentList err: ", "error", err)
 		return "", "", err
 	}
+	unspentTxs := make([]*model.UnspentOutput, 0, len(allUnspentTxs))
+	for _, unspentTx := range allUnspentTxs {
+		if !reserved[*unspentTx.Outpoint] {
+			unspentTxs = append(unspentTxs, unspentTx)
+		}
+	}
 	if len(unspentTxs) == 0 {
-		return "", "", errors.New("no unspent tx")
+		return "", "", ErrNoUnspentTx
 	}
 	var totalTransferAmount int64
 	for _, v := range amounts {
 		totalTransferAmount += v
 	}
-	if satoshiTotal <= totalTransferAmount {
-		for i := 0; int64(i) < total/16; i++ {
-			_, satoshiTotalTemp, unspentTxsTemp, err := bis.GetUnspentList(sourceAddrStr, int64(i))
-			if err != nil {
-				bis.log.Errorw("BridgeWithdrawService GetUnspentList err: ", "error", err)
-				return "", "", err
-			}
-			if (satoshiTotal + satoshiTotalTemp) > totalTransferAmount {
-				break
-			}
-			unspentTxs = append(unspentTxs, unspentTxsTemp...)
-		}
-	}
 
 	tx := wire.NewMsgTx(wire.TxVersion)
 	changeScript, err := txscript.PayToAddrScript(sourceAddr)
@@ -509,9 +637,6 @@ func (bis *BridgeWithdrawService) ConstructTx(destAddressList []string, amounts
 		bis.log.Errorw("BridgeWithdrawService transferToBtc PayToAddrScript sourceAddr failed: ", "error", err)
 		return "", "", err
 	}
-	var txSize int
-	var outputSize int
-	var fee int
 	for index, destAddress := range destAddressList {
 		destAddr, err := btcutil.DecodeAddress(destAddress, defaultNet)
 		if err != nil {
@@ -524,48 +649,47 @@ func (bis *BridgeWithdrawService) ConstructTx(destAddressList []string, amounts
 			return "", "", err
 		}
 		tx.AddTxOut(wire.NewTxOut(amounts[index], destinationScript))
-		outputSize += wire.NewTxOut(amounts[index], destinationScript).SerializeSize()
 	}
-	outputSize += wire.NewTxOut(0, changeScript).SerializeSize()
-	var pInput psbt.PInput
-	feeRate, err := bis.GetFeeRate()
+	multiSigScript, err := bis.GetMultiSigScript(bis.config.Bridge.PublicKeys, bis.config.Bridge.MultisigNum)
 	if err != nil {
-		bis.log.Errorw("BridgeWithdrawService GetFeeRate err: ", "error", err)
+		bis.log.Errorw("BridgeWithdrawService ConstructTx GenerateMultiSigScript err", "error", err)
 		return "", "", err
 	}
-	txSize += outputSize
-	pInputArry := make([]psbt.PInput, 0)
-	totalInputAmount := btcutil.Amount(0)
-	for _, unspentTx := range unspentTxs {
-		var inputSize int
+	feeRate, err := bis.feeEstimator.FeeRate()
+	if err != nil {
+		bis.log.Errorw("BridgeWithdrawService FeeRate err: ", "error", err)
+		return "", "", err
+	}
+	selection, err := bis.coinSelector.Select(unspentTxs, CoinSelectionParams{
+		Target:  totalTransferAmount,
+		FeeRate: feeRate,
+		Dust:    mempool.GetDustThreshold(wire.NewTxOut(0, changeScript)),
+		Sizer:   NewWithdrawTxSizer(tx.TxOut, changeScript, multiSigScript, bis.config.Bridge.MultisigNum),
+	})
+	if err != nil {
+		bis.log.Errorw("BridgeWithdrawService ConstructTx select utxo err",
+			"error", err, "totalTransferAmount", totalTransferAmount, "feeRate", feeRate)
+		return "", "", err
+	}
+
+	pInputArry := make([]psbt.PInput, 0, len(selection.Inputs))
+	for _, unspentTx := range selection.Inputs {
+		var pInput psbt.PInput
 		outpoint := wire.NewOutPoint(&unspentTx.Outpoint.Hash, unspentTx.Outpoint.Index)
 		txIn := wire.NewTxIn(outpoint, nil, nil)
+		txIn.Sequence = RBFSequence
 		tx.AddTxIn(txIn)
-		multiSigScript, err := bis.GetMultiSigScript(bis.config.Bridge.PublicKeys, bis.config.Bridge.MultisigNum)
-		if err != nil {
-			bis.log.Errorw("BridgeWithdrawService ConstructTx GenerateMultiSigScript err", "error", err)
-			return "", "", err
-		}
-		unspentTx.Output.PkScript = multiSigScript
+		// the utxos are locked by the multisig source address
+		unspentTx.Output.PkScript = changeScript
 		pInput.WitnessUtxo = unspentTx.Output
 		pInput.WitnessScript = multiSigScript
 		pInputArry = append(pInputArry, pInput)
-		totalInputAmount += btcutil.Amount(unspentTx.Output.Value)
-		inputSize = InputSize + bis.GetMultiSigWitnessSize()
-		txSize += inputSize
-		fee = txSize * feeRate.FastestFee
-		if int64(totalInputAmount) > (totalTransferAmount + int64(fee)) {
-			break
-		}
 	}
-	changeAmount := int64(totalInputAmount) - int64(fee) - totalTransferAmount
-	if changeAmount < 0 {
-		bis.log.Errorw("BridgeWithdrawService ConstructTx insufficient balance err",
-			"totalInputAmount", totalInputAmount, "fee", fee, "totalTransferAmount", totalTransferAmount)
-		return "", "", errors.New("insufficient balance")
+	if selection.Change > 0 {
+		tx.AddTxOut(wire.NewTxOut(selection.Change, changeScript))
 	}
-	tx.AddTxOut(wire.NewTxOut(changeAmount, changeScript))
-	bis.log.Infow("BridgeWithdrawService ConstructTx fee", "tx_id", tx.TxHash().String(), "fee", fee, "feeRate", feeRate)
+	bis.log.Infow("BridgeWithdrawService ConstructTx fee", "tx_id", tx.TxHash().String(),
+		"fee", selection.Fee, "feeRate", feeRate, "inputs", len(selection.Inputs), "change", selection.Change)
 
 	txCopy := tx.Copy()
 	unsignedPsbt, err := psbt.NewFromUnsignedTx(txCopy)
@@ -587,6 +711,23 @@ func (bis *BridgeWithdrawService) ConstructTx(destAddressList []string, amounts
 	return tx.TxHash().String(), psbtData, nil
 }
 
+// GetAllUnspentList pages through all utxos of address
+func (bis *BridgeWithdrawService) GetAllUnspentList(address string) ([]*model.UnspentOutput, error) {
+	unspentOutputs := make([]*model.UnspentOutput, 0)
+	var cursor int64
+	for {
+		total, _, page, err := bis.GetUnspentList(address, cursor)
+		if err != nil {
+			return nil, err
+		}
+		unspentOutputs = append(unspentOutputs, page...)
+		cursor += int64(len(page))
+		if len(page) == 0 || cursor >= total {
+			return unspentOutputs, nil
+		}
+	}
+}
+
 func (bis *BridgeWithdrawService) GetMultiSigScript(pubs []string, minSignNum int) ([]byte, error) {
 	var defaultNet *chaincfg.Params
 	networkName := bis.config.NetworkName
@@ -653,19 +794,22 @@ func (bis *BridgeWithdrawService) GetMultiSigWitnessSize() int {
 	return 1 + 1 + 1 + MultiSigSize + bis.config.Bridge.MultisigNum*74
 }
 
+// mergeDuplicateAddresses sums the amounts of duplicated addresses,
+// outputs keep the order of the first appearance of their address
 func mergeDuplicateAddresses(destAddressList []string, amounts []int64) ([]string, []int64) {
-	mergedAddresses := make(map[string]int64)
-
-	for i, address := range destAddressList {
-		mergedAddresses[address] += amounts[i]
-	}
+	indexes := make(map[string]int)
 
 	uniqueAddresses := make([]string, 0)
 	mergedAmounts := make([]int64, 0)
 
-	for address, amount := range mergedAddresses {
+	for i, address := range destAddressList {
+		if index, ok := indexes[address]; ok {
+			mergedAmounts[index] += amounts[i]
+			continue
+		}
+		indexes[address] = len(uniqueAddresses)
 		uniqueAddresses = append(uniqueAddresses, address)
-		mergedAmounts = append(mergedAmounts, amount)
+		mergedAmounts = append(mergedAmounts, amounts[i])
 	}
 
 	return uniqueAddresses, mergedAmounts
@@ -0,0 +1,294 @@
+package indexer
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/storage"
+	"github.com/b2network/b2-indexer/pkg/log"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrWithdrawTxNotFound   = errors.New("withdraw tx not found")
+	ErrWithdrawTxNotPending = errors.New("withdraw tx is not waiting for signatures")
+	ErrUnknownSigner        = errors.New("unknown signer")
+	ErrInvalidSign          = errors.New("invalid signature")
+)
+
+// PendingWithdrawTx is a withdraw tx waiting for signatures
+type PendingWithdrawTx struct {
+	model.WithdrawTx
+	// Signers are the public keys that already signed
+	Signers []string `json:"signers"`
+}
+
+// WithdrawSigner collects the multisig signatures of pending withdraw txs,
+// the tx is finalized once the multisig number of signers signed
+type WithdrawSigner struct {
+	db      *gorm.DB
+	store   storage.Store
+	config  *config.BitcoinConfig
+	log     log.Logger
+	pubKeys [][]byte
+}
+
+// NewWithdrawSigner returns a signer collector for the bridge public keys
+func NewWithdrawSigner(config *config.BitcoinConfig, db *gorm.DB, log log.Logger) (*WithdrawSigner, error) {
+	pubKeys := make([][]byte, 0, len(config.Bridge.PublicKeys))
+	for _, pubKey := range config.Bridge.PublicKeys {
+		pubKeyByte, err := hex.DecodeString(pubKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bridge public key %s: %w", pubKey, err)
+		}
+		if _, err := btcec.ParsePubKey(pubKeyByte); err != nil {
+			return nil, fmt.Errorf("invalid bridge public key %s: %w", pubKey, err)
+		}
+		pubKeys = append(pubKeys, pubKeyByte)
+	}
+	if config.Bridge.MultisigNum <= 0 || config.Bridge.MultisigNum > len(pubKeys) {
+		return nil, fmt.Errorf("invalid multisig number %d of %d public keys", config.Bridge.MultisigNum, len(pubKeys))
+	}
+	return &WithdrawSigner{db: db, store: storage.New(db), config: config, log: log, pubKeys: pubKeys}, nil
+}
+
+// SignerIndex returns the index of signer in the bridge public keys, -1 if unknown
+func (ws *WithdrawSigner) SignerIndex(signer string) int {
+	for i, pubKey := range ws.config.Bridge.PublicKeys {
+		if strings.EqualFold(pubKey, signer) {
+			return i
+		}
+	}
+	return -1
+}
+
+// PendingWithdrawTxs returns the withdraw txs waiting for signatures
+func (ws *WithdrawSigner) PendingWithdrawTxs() ([]PendingWithdrawTx, error) {
+	var withdrawTxList []model.WithdrawTx
+	err := ws.db.Model(&model.WithdrawTx{}).
+		Where(fmt.Sprintf("%s = ?", model.WithdrawTx{}.Column().Status), model.BtcTxWithdrawPending).
+		Order("id").
+		Find(&withdrawTxList).Error
+	if err != nil {
+		return nil, err
+	}
+	pendingList := make([]PendingWithdrawTx, 0, len(withdrawTxList))
+	for _, v := range withdrawTxList {
+		var signers []string
+		err = ws.db.Model(&model.WithdrawSign{}).
+			Where(fmt.Sprintf("%s = ?", model.WithdrawSign{}.Column().WithdrawTxID), v.ID).
+			Pluck(model.WithdrawSign{}.Column().Signer, &signers).Error
+		if err != nil {
+			return nil, err
+		}
+		pendingList = append(pendingList, PendingWithdrawTx{WithdrawTx: v, Signers: signers})
+	}
+	return pendingList, nil
+}
+
+// SubmitPsbt takes the partial signatures of signer from a signed copy of the withdraw tx psbt
+func (ws *WithdrawSigner) SubmitPsbt(signer string, btcTxID string, psbtData string) (*model.WithdrawTx, error) {
+	index := ws.SignerIndex(signer)
+	if index < 0 {
+		return nil, ErrUnknownSigner
+	}
+	pack, err := psbt.NewFromRawBytes(strings.NewReader(psbtData), true)
+	if err != nil {
+		return nil, err
+	}
+	if pack.UnsignedTx.TxHash().String() != btcTxID {
+		return nil, fmt.Errorf("%w: psbt tx id %s mismatch", ErrInvalidSign, pack.UnsignedTx.TxHash())
+	}
+	signs, err := SignsFromPsbt(pack, ws.pubKeys[index])
+	if err != nil {
+		return nil, err
+	}
+	return ws.SubmitSigns(signer, btcTxID, signs)
+}
+
+// SubmitSigns validates the signatures of signer for every input of the withdraw tx and stores them,
+// the tx is finalized and waits for broadcast once enough signers signed
+func (ws *WithdrawSigner) SubmitSigns(signer string, btcTxID string, signs []model.Sign) (*model.WithdrawTx, error) {
+	index := ws.SignerIndex(signer)
+	if index < 0 {
+		return nil, ErrUnknownSigner
+	}
+	pubKey, err := btcec.ParsePubKey(ws.pubKeys[index])
+	if err != nil {
+		return nil, err
+	}
+	var withdrawTx model.WithdrawTx
+	err = ws.store.Transaction(func(store storage.Store) error {
+		var err error
+		withdrawTx, err = store.Withdraws().LockTxByBtcTxID(btcTxID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrWithdrawTxNotFound
+			}
+			return err
+		}
+		if withdrawTx.Status != model.BtcTxWithdrawPending {
+			return ErrWithdrawTxNotPending
+		}
+		pack, err := psbt.NewFromRawBytes(strings.NewReader(withdrawTx.BtcTx), true)
+		if err != nil {
+			return err
+		}
+		if err = VerifyWithdrawSigns(pack, pubKey, signs); err != nil {
+			return err
+		}
+		AddWithdrawSigns(pack, ws.pubKeys[index], signs)
+
+		signsByte, err := json.Marshal(signs)
+		if err != nil {
+			return err
+		}
+		withdrawSign := model.WithdrawSign{
+			WithdrawTxID: withdrawTx.ID,
+			BtcTxID:      withdrawTx.BtcTxID,
+			Signer:       ws.config.Bridge.PublicKeys[index],
+			Signs:        string(signsByte),
+		}
+		if err = store.Withdraws().SaveSign(&withdrawSign); err != nil {
+			return err
+		}
+
+		if len(pack.Inputs) > 0 && len(pack.Inputs[0].PartialSigs) >= ws.config.Bridge.MultisigNum {
+			if err = FinalizeWithdrawPsbt(pack, ws.pubKeys, ws.config.Bridge.MultisigNum); err != nil {
+				return err
+			}
+			withdrawTx.Status = model.BtcTxWithdrawSignatureCompleted
+		}
+		withdrawTx.BtcTx, err = pack.B64Encode()
+		if err != nil {
+			return err
+		}
+		updateFields := map[string]interface{}{
+			model.WithdrawTx{}.Column().BtcTx:  withdrawTx.BtcTx,
+			model.WithdrawTx{}.Column().Status: withdrawTx.Status,
+		}
+		return store.Withdraws().UpdateTx(withdrawTx.ID, updateFields)
+	})
+	if err != nil {
+		return nil, err
+	}
+	ws.log.Infow("WithdrawSigner submit signs", "signer", signer, "btcTxID", btcTxID, "status", withdrawTx.Status)
+	return &withdrawTx, nil
+}
+
+// VerifyWithdrawSigns checks signs holds one valid SIGHASH_ALL signature of pubKey for every input of pack
+func VerifyWithdrawSigns(pack *psbt.Packet, pubKey *btcec.PublicKey, signs []model.Sign) error {
+	tx := pack.UnsignedTx
+	if len(signs) != len(tx.TxIn) {
+		return fmt.Errorf("%w: %d signatures for %d inputs", ErrInvalidSign, len(signs), len(tx.TxIn))
+	}
+	prevOutFetcher := txscript.NewMultiPrevOutFetcher(nil)
+	for i, in := range pack.Inputs {
+		if in.WitnessUtxo == nil || in.WitnessScript == nil {
+			return fmt.Errorf("input %d has no witness utxo or script", i)
+		}
+		prevOutFetcher.AddPrevOut(tx.TxIn[i].PreviousOutPoint, in.WitnessUtxo)
+	}
+	sigHashes := txscript.NewTxSigHashes(tx, prevOutFetcher)
+
+	signed := make(map[int]bool, len(signs))
+	for _, sign := range signs {
+		index := sign.TxInIndex
+		if index < 0 || index >= len(tx.TxIn) || signed[index] {
+			return fmt.Errorf("%w: unexpected input index %d", ErrInvalidSign, index)
+		}
+		signed[index] = true
+		if len(sign.Sign) == 0 || txscript.SigHashType(sign.Sign[len(sign.Sign)-1]) != txscript.SigHashAll {
+			return fmt.Errorf("%w: input %d signature is not SIGHASH_ALL", ErrInvalidSign, index)
+		}
+		signature, err := ecdsa.ParseDERSignature(sign.Sign[:len(sign.Sign)-1])
+		if err != nil {
+			return fmt.Errorf("%w: input %d: %s", ErrInvalidSign, index, err)
+		}
+		in := pack.Inputs[index]
+		hash, err := txscript.CalcWitnessSigHash(in.WitnessScript, sigHashes, txscript.SigHashAll, tx, index, in.WitnessUtxo.Value)
+		if err != nil {
+			return err
+		}
+		if !signature.Verify(hash, pubKey) {
+			return fmt.Errorf("%w: input %d signature verify failed", ErrInvalidSign, index)
+		}
+	}
+	return nil
+}
+
+// AddWithdrawSigns stores signs of pubKey as partial signatures of pack, replacing earlier ones
+func AddWithdrawSigns(pack *psbt.Packet, pubKey []byte, signs []model.Sign) {
+	for _, sign := range signs {
+		in := &pack.Inputs[sign.TxInIndex]
+		partialSigs := make([]*psbt.PartialSig, 0, len(in.PartialSigs)+1)
+		for _, partialSig := range in.PartialSigs {
+			if !bytes.Equal(partialSig.PubKey, pubKey) {
+				partialSigs = append(partialSigs, partialSig)
+			}
+		}
+		in.PartialSigs = append(partialSigs, &psbt.PartialSig{PubKey: pubKey, Signature: sign.Sign})
+	}
+}
+
+// SignsFromPsbt returns the partial signatures of pubKey for every input of pack
+func SignsFromPsbt(pack *psbt.Packet, pubKey []byte) ([]model.Sign, error) {
+	signs := make([]model.Sign, 0, len(pack.Inputs))
+	for i, in := range pack.Inputs {
+		var found bool
+		for _, partialSig := range in.PartialSigs {
+			if bytes.Equal(partialSig.PubKey, pubKey) {
+				signs = append(signs, model.Sign{TxInIndex: i, Sign: partialSig.Signature})
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: input %d has no signature of the signer", ErrInvalidSign, i)
+		}
+	}
+	return signs, nil
+}
+
+// FinalizeWithdrawPsbt builds the multisig witness of every input from the partial signatures,
+// taking sigNum signatures in the order of pubKeys as CHECKMULTISIG requires
+func FinalizeWithdrawPsbt(pack *psbt.Packet, pubKeys [][]byte, sigNum int) error {
+	for i := range pack.Inputs {
+		in := &pack.Inputs[i]
+		witness := wire.TxWitness{nil}
+		for _, pubKey := range pubKeys {
+			if len(witness)-1 >= sigNum {
+				break
+			}
+			for _, partialSig := range in.PartialSigs {
+				if bytes.Equal(partialSig.PubKey, pubKey) {
+					witness = append(witness, partialSig.Signature)
+					break
+				}
+			}
+		}
+		if len(witness)-1 < sigNum {
+			return fmt.Errorf("input %d has %d of %d signatures", i, len(witness)-1, sigNum)
+		}
+		witness = append(witness, in.WitnessScript)
+
+		var buf bytes.Buffer
+		if err := psbt.WriteTxWitness(&buf, witness); err != nil {
+			return err
+		}
+		in.FinalScriptWitness = buf.Bytes()
+		in.PartialSigs = nil
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+)
+
+type testMultisig struct {
+	privKeys       []*btcec.PrivateKey
+	pubKeys        [][]byte
+	multiSigScript []byte
+	pkScript       []byte
+}
+
+func newTestMultisig(t *testing.T, n int, sigNum int) testMultisig {
+	var m testMultisig
+	addressPubKeys := make([]*btcutil.AddressPubKey, 0, n)
+	for i := 0; i < n; i++ {
+		privKey, err := btcec.NewPrivateKey()
+		require.NoError(t, err)
+		pubKey := privKey.PubKey().SerializeCompressed()
+		addressPubKey, err := btcutil.NewAddressPubKey(pubKey, &chaincfg.TestNet3Params)
+		require.NoError(t, err)
+		m.privKeys = append(m.privKeys, privKey)
+		m.pubKeys = append(m.pubKeys, pubKey)
+		addressPubKeys = append(addressPubKeys, addressPubKey)
+	}
+	var err error
+	m.multiSigScript, err = txscript.MultiSigScript(addressPubKeys, sigNum)
+	require.NoError(t, err)
+	scriptHash := chainhash.HashB(m.multiSigScript)
+	address, err := btcutil.NewAddressWitnessScriptHash(scriptHash, &chaincfg.TestNet3Params)
+	require.NoError(t, err)
+	m.pkScript, err = txscript.PayToAddrScript(address)
+	require.NoError(t, err)
+	return m
+}
+
+func (m testMultisig) packet(t *testing.T, inputs ...int64) *psbt.Packet {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	var total int64
+	for i, v := range inputs {
+		hash := chainhash.HashH([]byte{byte(i)})
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&hash, 1), nil, nil))
+		total += v
+	}
+	tx.AddTxOut(wire.NewTxOut(total-1000, m.pkScript))
+	setRBFSequence(tx)
+	pack, err := psbt.NewFromUnsignedTx(tx)
+	require.NoError(t, err)
+	for i, v := range inputs {
+		pack.Inputs[i].WitnessUtxo = wire.NewTxOut(v, m.pkScript)
+		pack.Inputs[i].WitnessScript = m.multiSigScript
+	}
+	return pack
+}
+
+func (m testMultisig) sign(t *testing.T, pack *psbt.Packet, signer int) []model.Sign {
+	prevOutFetcher := txscript.NewMultiPrevOutFetcher(nil)
+	for i, in := range pack.Inputs {
+		prevOutFetcher.AddPrevOut(pack.UnsignedTx.TxIn[i].PreviousOutPoint, in.WitnessUtxo)
+	}
+	sigHashes := txscript.NewTxSigHashes(pack.UnsignedTx, prevOutFetcher)
+	signs := make([]model.Sign, 0, len(pack.Inputs))
+	for i, in := range pack.Inputs {
+		sign, err := txscript.RawTxInWitnessSignature(pack.UnsignedTx, sigHashes, i, in.WitnessUtxo.Value,
+			m.multiSigScript, txscript.SigHashAll, m.privKeys[signer])
+		require.NoError(t, err)
+		signs = append(signs, model.Sign{TxInIndex: i, Sign: sign})
+	}
+	return signs
+}
+
+func TestVerifyWithdrawSigns(t *testing.T) {
+	m := newTestMultisig(t, 3, 2)
+	pack := m.packet(t, 60000, 40000)
+	signs := m.sign(t, pack, 0)
+
+	require.NoError(t, VerifyWithdrawSigns(pack, m.privKeys[0].PubKey(), signs))
+	// signed by another key
+	require.ErrorIs(t, VerifyWithdrawSigns(pack, m.privKeys[1].PubKey(), signs), ErrInvalidSign)
+	// missing input
+	require.ErrorIs(t, VerifyWithdrawSigns(pack, m.privKeys[0].PubKey(), signs[:1]), ErrInvalidSign)
+	// duplicated input
+	require.ErrorIs(t, VerifyWithdrawSigns(pack, m.privKeys[0].PubKey(), []model.Sign{signs[0], signs[0]}), ErrInvalidSign)
+	// signed for another tx
+	other := m.sign(t, m.packet(t, 60000, 40001), 0)
+	require.ErrorIs(t, VerifyWithdrawSigns(pack, m.privKeys[0].PubKey(), other), ErrInvalidSign)
+}
+
+func TestFinalizeWithdrawPsbt(t *testing.T) {
+	m := newTestMultisig(t, 3, 2)
+	pack := m.packet(t, 60000, 40000)
+
+	// signers submit out of the public key order
+	AddWithdrawSigns(pack, m.pubKeys[2], m.sign(t, pack, 2))
+	require.Error(t, FinalizeWithdrawPsbt(pack, m.pubKeys, 2))
+	AddWithdrawSigns(pack, m.pubKeys[0], m.sign(t, pack, 0))
+
+	// a signed psbt returned by a signer holds its signatures
+	signs, err := SignsFromPsbt(pack, m.pubKeys[2])
+	require.NoError(t, err)
+	require.Len(t, signs, 2)
+	_, err = SignsFromPsbt(pack, m.pubKeys[1])
+	require.ErrorIs(t, err, ErrInvalidSign)
+
+	require.NoError(t, FinalizeWithdrawPsbt(pack, m.pubKeys, 2))
+	tx, err := psbt.Extract(pack)
+	require.NoError(t, err)
+
+	prevOutFetcher := txscript.NewMultiPrevOutFetcher(nil)
+	for i, in := range pack.Inputs {
+		prevOutFetcher.AddPrevOut(tx.TxIn[i].PreviousOutPoint, in.WitnessUtxo)
+	}
+	sigHashes := txscript.NewTxSigHashes(tx, prevOutFetcher)
+	for i, in := range pack.Inputs {
+		vm, err := txscript.NewEngine(in.WitnessUtxo.PkScript, tx, i, txscript.StandardVerifyFlags,
+			nil, sigHashes, in.WitnessUtxo.Value, prevOutFetcher)
+		require.NoError(t, err)
+		require.NoError(t, vm.Execute())
+	}
+}
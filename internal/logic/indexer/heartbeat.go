@@ -0,0 +1,68 @@
+package indexer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+)
+
+// HeartbeatPrefix names the leader_lease rows renewed by the running indexers, one per
+// process with or without leader election, for the admin commands to tell whether an
+// indexer is running
+const HeartbeatPrefix = "indexer-heartbeat:"
+
+// the heartbeat is renewed every HeartbeatInterval and shows the indexer running for
+// HeartbeatTTL, longer than a block waits for its confirmations. The heartbeats of the
+// stopped indexers are deleted HeartbeatRetention after they expired.
+var (
+	HeartbeatInterval  = 30 * time.Second
+	HeartbeatTTL       = 5 * time.Minute
+	HeartbeatRetention = 7 * 24 * time.Hour
+)
+
+// heartbeatHolder returns the host and process of the indexer
+func heartbeatHolder() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s/%d", hostname, os.Getpid())
+}
+
+// HeartbeatName returns the heartbeat row of holder, the hash fits any host name in the row name
+func HeartbeatName(holder string) string {
+	sum := sha256.Sum256([]byte(holder))
+	return HeartbeatPrefix + hex.EncodeToString(sum[:8])
+}
+
+// beat renews the heartbeat once HeartbeatInterval passed since the last one
+func (bis *IndexerService) beat() {
+	if time.Since(bis.beatAt) < HeartbeatInterval {
+		return
+	}
+	if err := bis.store.Index().SaveHeartbeat(HeartbeatName(bis.holder), bis.holder, HeartbeatTTL); err != nil {
+		bis.log.Errorw("failed to save indexer heartbeat", "error", err)
+		return
+	}
+	bis.beatAt = time.Now()
+}
+
+// startBeat saves the heartbeat of the starting indexer and deletes the ones of the
+// indexers stopped long ago, every process start adds a row
+func (bis *IndexerService) startBeat() {
+	bis.beatAt = time.Time{}
+	bis.beat()
+	if err := bis.store.Index().DeleteHeartbeats(HeartbeatPrefix, HeartbeatRetention); err != nil {
+		bis.log.Errorw("failed to delete expired indexer heartbeats", "error", err)
+	}
+}
+
+// stopBeat expires the heartbeat of the stopped indexer, the heartbeats of the other
+// indexers are left as they are
+func (bis *IndexerService) stopBeat() {
+	if err := bis.store.Index().SaveHeartbeat(HeartbeatName(bis.holder), bis.holder, 0); err != nil {
+		bis.log.Errorw("failed to expire indexer heartbeat", "error", err)
+	}
+}
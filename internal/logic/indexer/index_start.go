@@ -0,0 +1,105 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/model"
+)
+
+const (
+	IndexStartLatest     = "latest"
+	IndexStartDeployment = "deployment"
+)
+
+var ErrIndexStart = errors.New("invalid indexer start")
+
+// IndexStart is the first block and tx indexed on a new db
+type IndexStart struct {
+	// Height is 0 for the block after the latest block at the first start
+	Height  int64
+	TxIndex int64
+}
+
+// ParseIndexStart resolves the indexer-start and indexer-start-tx-index config
+func ParseIndexStart(cfg *config.BitcoinConfig) (IndexStart, error) {
+	start := IndexStart{TxIndex: cfg.IndexerStartTxIndex}
+	switch cfg.IndexerStart {
+	case "", IndexStartLatest:
+		if start.TxIndex != 0 {
+			return IndexStart{}, fmt.Errorf("%w: tx index %d needs a start height", ErrIndexStart, start.TxIndex)
+		}
+		return start, nil
+	case IndexStartDeployment:
+		start.Height = cfg.Bridge.DeploymentHeight
+		if start.Height <= 0 {
+			return IndexStart{}, fmt.Errorf("%w: bridge deployment-height not set", ErrIndexStart)
+		}
+	default:
+		height, err := strconv.ParseInt(cfg.IndexerStart, 10, 64)
+		if err != nil || height <= 0 {
+			return IndexStart{}, fmt.Errorf("%w: %s", ErrIndexStart, cfg.IndexerStart)
+		}
+		start.Height = height
+	}
+	if start.TxIndex < 0 {
+		return IndexStart{}, fmt.Errorf("%w: tx index %d", ErrIndexStart, start.TxIndex)
+	}
+	return start, nil
+}
+
+// seed returns the cursor of a new db. The cursor is the last indexed block and tx,
+// tx 0 means the whole block, the indexer goes on with the next block.
+func (s IndexStart) seed(latestBlock int64) model.BtcIndex {
+	btcIndex := model.BtcIndex{
+		Base: model.Base{
+			ID: 1,
+		},
+	}
+	if s.Height == 0 {
+		btcIndex.BtcIndexBlock = latestBlock
+		btcIndex.StartHeight = latestBlock + 1
+		return btcIndex
+	}
+	btcIndex.StartHeight = s.Height
+	btcIndex.StartTxIndex = s.TxIndex
+	btcIndex.BtcIndexBlock, btcIndex.BtcIndexTx = CursorAt(s.Height, s.TxIndex)
+	return btcIndex
+}
+
+// CursorAt returns the cursor block and tx of an indexer going on with tx txIndex of
+// block height
+func CursorAt(height int64, txIndex int64) (int64, int64) {
+	// tx 0 is the coinbase, starting at tx 1 is starting at the block
+	if txIndex <= 1 {
+		return height - 1, 0
+	}
+	return height, txIndex - 1
+}
+
+// diverges returns why the stored cursor does not match the start, empty if it matches
+func (s IndexStart) diverges(btcIndex model.BtcIndex) string {
+	// the latest block start is not reproducible, nothing to compare
+	if s.Height == 0 {
+		return ""
+	}
+	if btcIndex.StartHeight != 0 && (btcIndex.StartHeight != s.Height || btcIndex.StartTxIndex != s.TxIndex) {
+		return "the cursor was seeded from another start"
+	}
+	next := NextPosition(btcIndex)
+	first := NextPosition(s.seed(0))
+	if next[0] < first[0] || (next[0] == first[0] && next[1] < first[1]) {
+		return "the cursor is before the start"
+	}
+	return ""
+}
+
+// NextPosition returns the block and tx the cursor goes on with
+func NextPosition(btcIndex model.BtcIndex) [2]int64 {
+	if btcIndex.BtcIndexTx == 0 {
+		return [2]int64{btcIndex.BtcIndexBlock + 1, 0}
+	}
+	return [2]int64{btcIndex.BtcIndexBlock, btcIndex.BtcIndexTx + 1}
+}
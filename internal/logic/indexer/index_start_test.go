@@ -0,0 +1,65 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIndexStart(t *testing.T) {
+	cfg := &config.BitcoinConfig{IndexerStart: IndexStartLatest}
+	start, err := ParseIndexStart(cfg)
+	require.NoError(t, err)
+	require.Equal(t, IndexStart{}, start)
+
+	cfg = &config.BitcoinConfig{IndexerStart: "120000", IndexerStartTxIndex: 5}
+	start, err = ParseIndexStart(cfg)
+	require.NoError(t, err)
+	require.Equal(t, IndexStart{Height: 120000, TxIndex: 5}, start)
+
+	cfg = &config.BitcoinConfig{IndexerStart: IndexStartDeployment, Bridge: config.BridgeConfig{DeploymentHeight: 9000}}
+	start, err = ParseIndexStart(cfg)
+	require.NoError(t, err)
+	require.Equal(t, IndexStart{Height: 9000}, start)
+
+	for _, cfg := range []*config.BitcoinConfig{
+		{IndexerStart: IndexStartDeployment},
+		{IndexerStart: "0"},
+		{IndexerStart: "genesis"},
+		{IndexerStart: "100", IndexerStartTxIndex: -1},
+		{IndexerStart: IndexStartLatest, IndexerStartTxIndex: 2},
+	} {
+		_, err := ParseIndexStart(cfg)
+		require.ErrorIs(t, err, ErrIndexStart)
+	}
+}
+
+func TestIndexStartSeed(t *testing.T) {
+	btcIndex := IndexStart{}.seed(500)
+	require.Equal(t, int64(500), btcIndex.BtcIndexBlock)
+	require.Equal(t, int64(501), btcIndex.StartHeight)
+	require.Equal(t, [2]int64{501, 0}, NextPosition(btcIndex))
+
+	btcIndex = IndexStart{Height: 100}.seed(500)
+	require.Equal(t, [2]int64{100, 0}, NextPosition(btcIndex))
+
+	btcIndex = IndexStart{Height: 100, TxIndex: 4}.seed(500)
+	require.Equal(t, [2]int64{100, 4}, NextPosition(btcIndex))
+	require.Equal(t, int64(4), btcIndex.StartTxIndex)
+}
+
+func TestIndexStartDiverges(t *testing.T) {
+	start := IndexStart{Height: 100, TxIndex: 4}
+	require.Empty(t, start.diverges(start.seed(0)))
+	require.Empty(t, start.diverges(model.BtcIndex{BtcIndexBlock: 150, StartHeight: 100, StartTxIndex: 4}))
+	// cursors seeded before the start columns existed
+	require.Empty(t, start.diverges(model.BtcIndex{BtcIndexBlock: 150}))
+
+	require.NotEmpty(t, start.diverges(model.BtcIndex{BtcIndexBlock: 150, StartHeight: 90}))
+	require.NotEmpty(t, start.diverges(model.BtcIndex{BtcIndexBlock: 100, BtcIndexTx: 2}))
+	require.NotEmpty(t, start.diverges(model.BtcIndex{BtcIndexBlock: 80}))
+
+	require.Empty(t, IndexStart{}.diverges(model.BtcIndex{BtcIndexBlock: 80, StartHeight: 50}))
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/metrics"
 	"github.com/b2network/b2-indexer/internal/types"
 	"github.com/b2network/b2-indexer/pkg/log"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -66,9 +67,9 @@ func (b *AbelianIndexer) newRequest(id string, method string, params []interface
 	if !strings.HasPrefix(url, "http") && !strings.HasPrefix(url, "https") {
 
 		if b.bitcoinCfg.DisableTLS {
-			url = fmt.Sprintf("https://%s", url)
-		} else {
 			url = fmt.Sprintf("http://%s", url)
+		} else {
+			url = fmt.Sprintf("https://%s", url)
 		}
 	}
 
@@ -82,7 +83,11 @@ func (b *AbelianIndexer) newRequest(id string, method string, params []interface
 	return httpReq, nil
 }
 
-func (b *AbelianIndexer) getResponseFromChan(method string, params []interface{}) ([]byte, error) {
+func (b *AbelianIndexer) getResponseFromChan(method string, params []interface{}) (result []byte, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.ObserveRPC(metrics.RPCChainAbec, method, start, err)
+	}()
 	id := fmt.Sprintf("%d", time.Now().UnixNano())
 	req, err := b.newRequest(id, method, params)
 	if err != nil {
@@ -112,6 +117,10 @@ func (b *AbelianIndexer) getResponseFromChan(method string, params []interface{}
 	if len(errorStr) > 0 && errorStr != "null" {
 		return nil, fmt.Errorf("abec.%s: %s", method, respObj.Error)
 	}
+	// a proxy or auth failure has no json-rpc error, its empty result is no value
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("abec.%s: http status %s", method, resp.Status)
+	}
 
 	return respObj.Result, nil
 }
@@ -146,9 +155,7 @@ func (b *AbelianIndexer) ParseBlock(height int64, txIndex int64) ([]*types.Bitco
 		}
 		b.logger.Infof("parse block:height=%v,txIndex=%v", height, k)
 
-		if parseTxs != nil {
-			blockParsedResult = append(blockParsedResult, parseTxs)
-		}
+		blockParsedResult = append(blockParsedResult, parseTxs...)
 	}
 
 	return blockParsedResult, blockResult, nil
@@ -167,8 +174,8 @@ func (b *AbelianIndexer) CheckConfirmations(hash string) error {
 	return nil
 }
 
-// parseTx parse transaction data
-func (b *AbelianIndexer) parseTx(txResult *AbecTx, index int) (*types.BitcoinTxParseResult, error) {
+// parseTx parse transaction data, the memo is a deposit or an array holding at most one deposit
+func (b *AbelianIndexer) parseTx(txResult *AbecTx, index int) ([]*types.BitcoinTxParseResult, error) {
 
 	if len(txResult.Memo) < 9 {
 		b.logger.Warnf("memo format error, txId:%v,memo:%v", txResult.TxID, txResult.Memo)
@@ -212,6 +219,32 @@ func (b *AbelianIndexer) parseTx(txResult *AbecTx, index int) (*types.BitcoinTxP
 		return nil, nil
 	}
 
+	// the output of a deposit is its position in the memo, whatever the other entries are
+	payloads := []gjson.Result{gjson.ParseBytes(memo)}
+	if payloads[0].IsArray() {
+		payloads = payloads[0].Array()
+	}
+	results := make([]*types.BitcoinTxParseResult, 0, len(payloads))
+	for output, payload := range payloads {
+		result, err := b.parseDeposit(txResult, index, int64(output), []byte(payload.Raw))
+		if err != nil {
+			return nil, err
+		}
+		if result != nil {
+			results = append(results, result)
+		}
+	}
+	// the aa address is looked up by tx and the value sent to the listen address is not
+	// known, the deposits of a tx could not get their own receipt nor be bounded by it
+	if len(results) > 1 {
+		b.logger.Warnw("memo with several deposits rejected", "txId", txResult.TxID, "deposits", len(results))
+		return nil, nil
+	}
+	return results, nil
+}
+
+// parseDeposit parses a deposit of the memo of a tx, nil if it is not one to the listen address
+func (b *AbelianIndexer) parseDeposit(txResult *AbecTx, index int, output int64, memo []byte) (*types.BitcoinTxParseResult, error) {
 	action := gjson.ParseBytes(memo).Get("action").String()
 	protocol := gjson.ParseBytes(memo).Get("protocol").String()
 
@@ -220,7 +253,7 @@ func (b *AbelianIndexer) parseTx(txResult *AbecTx, index int) (*types.BitcoinTxP
 	}
 
 	var m Memo
-	err = json.Unmarshal(memo, &m)
+	err := json.Unmarshal(memo, &m)
 	if err != nil {
 		b.logger.Errorf("unmarshal memo error:%v,txId:%v,memo:%v", err, txResult.TxID, string(memo))
 		return nil, err
@@ -279,6 +312,7 @@ func (b *AbelianIndexer) parseTx(txResult *AbecTx, index int) (*types.BitcoinTxP
 			TxID:   txResult.TxID,
 			TxType: TxTypeTransfer,
 			Index:  int64(index),
+			Output: output,
 			Value:  totalValue,
 			From: []types.BitcoinFrom{types.BitcoinFrom{
 				Address: m.From,
@@ -344,6 +378,25 @@ func (b *AbelianIndexer) BlockChainInfo() (*types.BlockChainInfo, error) {
 	return blockchainInfo, nil
 }
 
+// BestBlock returns the height and the hash of the tip of the longest block chain,
+// both from one getinfo so they are of the same block
+func (b *AbelianIndexer) BestBlock() (int64, string, error) {
+	resp, err := b.getResponseFromChan("getinfo", nil)
+	if err != nil {
+		return 0, "", err
+	}
+	var abe AbelianChainInfo
+	if err = json.Unmarshal(resp, &abe); err != nil {
+		return 0, "", err
+	}
+	return abe.Blocks, abe.Bestblockhash, nil
+}
+
+// Call sends a json-rpc request of method to rpc-host and returns its raw result
+func (b *AbelianIndexer) Call(method string, params []interface{}) ([]byte, error) {
+	return b.getResponseFromChan(method, params)
+}
+
 func (b *AbelianIndexer) GetRawTransactionVerbose(hash string) (*types.TxInfo, error) {
 	if has0xPrefix(hash) {
 		hash = strings.Replace(hash, "0x", "", 1)
@@ -1,38 +1,133 @@
 package indexer
 
 import (
-	"encoding/json"
+	"net/http"
 	"testing"
 
 	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/testutil/abecmock"
 	logger "github.com/b2network/b2-indexer/pkg/log"
+	"github.com/stretchr/testify/require"
 )
 
-func init2() *AbelianIndexer {
-	bitcoinCfg, err := config.LoadBitcoinConfig("../../../cmd/")
-	if err != nil {
-		panic(err)
-	}
+const (
+	testListenAddress = "0xE37e799D5077682FA0a244D46E5649F71457BD09"
+	testDepositFrom   = "0xCB369d06BD0aaA813E1d6bad09421D53bB96D175"
+	testDepositTo     = "0x1111111254fb6c44bAC0beD2854e76F90643097d"
+)
 
+func newMockIndexer(t *testing.T, targetConfirmations uint64) (*AbelianIndexer, *abecmock.Node) {
+	node := abecmock.New(t)
+	node.SetAuth("user", "pass")
+	bitcoinCfg := &config.BitcoinConfig{
+		RPCHost: node.URL(),
+		RPCUser: "user",
+		RPCPass: "pass",
+	}
 	return &AbelianIndexer{
-		listenAddress:       bitcoinCfg.IndexerListenAddress,
-		targetConfirmations: bitcoinCfg.IndexerListenTargetConfirmations,
+		listenAddress:       testListenAddress,
+		targetConfirmations: targetConfirmations,
 		logger:              logger.NewNopLogger(),
 		bitcoinCfg:          bitcoinCfg,
-	}
+	}, node
 }
 
 func TestAbelianIndexer_ParseBlock(t *testing.T) {
-	b := init2()
+	b, node := newMockIndexer(t, 1)
+	node.AddBlock(
+		abecmock.Tx{TxID: "no-memo"},
+		abecmock.Tx{TxID: "deposit", Memo: abecmock.DepositMemo(testDepositFrom, testListenAddress, testDepositTo, 0x10)},
+		abecmock.Tx{TxID: "other-address", Memo: abecmock.DepositMemo(testDepositFrom, testDepositTo, testDepositTo, 0x10)},
+		abecmock.Tx{TxID: "inscribe", Memo: abecmock.Memo([]byte(`{"action":"inscribe","protocol":"Mable"}`))},
+	)
+
+	txs, block, err := b.ParseBlock(1, 0)
+	require.NoError(t, err)
+	require.Equal(t, node.Block(1).Hash, block.BlockHash)
+	require.Len(t, txs, 1)
+	require.Equal(t, "deposit", txs[0].TxID)
+	require.Equal(t, int64(1), txs[0].Index)
+	require.Equal(t, int64(0x10), txs[0].Value)
+	require.Equal(t, testDepositFrom, txs[0].From[0].Address)
+	require.Equal(t, testDepositTo, txs[0].Tos[0].Address)
 
-	txs, block, err := b.ParseBlock(304092, 0)
-	if err != nil {
-		t.Fatal(err)
-		return
+	// the txs before txIndex are skipped
+	txs, _, err = b.ParseBlock(1, 2)
+	require.NoError(t, err)
+	require.Empty(t, txs)
+
+	_, _, err = b.ParseBlock(2, 0)
+	require.ErrorContains(t, err, "out of range")
+}
+
+func TestAbelianIndexer_ParseDepositArray(t *testing.T) {
+	b, node := newMockIndexer(t, 1)
+	deposit := func(value string) string {
+		return `{"action":"deposit","protocol":"Mable","from":"` + testDepositFrom + `","to":"` + testListenAddress +
+			`","receipt":"` + testDepositTo + `","value":"` + value + `"}`
 	}
+	memo := `[{"action":"inscribe","protocol":"Mable"},` + deposit("0x10") + `]`
+	// a memo of several deposits is rejected, they would mint to the aa address of the tx
+	memos := `[` + deposit("0x10") + `,{"action":"inscribe","protocol":"Mable"},` + deposit("0x20") + `]`
+	node.AddBlock(
+		abecmock.Tx{TxID: "deposit", Memo: abecmock.Memo([]byte(memo))},
+		abecmock.Tx{TxID: "deposits", Memo: abecmock.Memo([]byte(memos))},
+	)
+
+	txs, _, err := b.ParseBlock(1, 0)
+	require.NoError(t, err)
+	require.Len(t, txs, 1)
+	// the output is the position of the deposit in the memo
+	require.Equal(t, "deposit", txs[0].TxID)
+	require.Equal(t, int64(1), txs[0].Output)
+	require.Equal(t, int64(0x10), txs[0].Value)
+}
+
+func TestAbelianIndexerChain(t *testing.T) {
+	b, node := newMockIndexer(t, 3)
+	node.AddBlock(abecmock.Tx{TxID: "tx"})
+	node.AddBlocks(1)
+
+	latest, err := b.LatestBlock()
+	require.NoError(t, err)
+	require.Equal(t, int64(2), latest)
+
+	info, err := b.BlockChainInfo()
+	require.NoError(t, err)
+	require.Equal(t, int64(2), info.Blocks)
+
+	err = b.CheckConfirmations("tx")
+	require.ErrorIs(t, err, ErrTargetConfirmations)
+	node.AddBlocks(1)
+	require.NoError(t, b.CheckConfirmations("tx"))
+
+	// a reorg replaces the block hashes and drops the txs of the dropped blocks
+	hash := node.Block(1).Hash
+	node.Reorg(1)
+	node.AddBlocks(2)
+	block, err := b.GetBlockByHeight(1)
+	require.NoError(t, err)
+	require.NotEqual(t, hash, block.BlockHash)
+	_, err = b.GetRawTransactionVerbose("tx")
+	require.ErrorContains(t, err, "No information available")
+}
+
+func TestAbelianIndexerErrors(t *testing.T) {
+	b, node := newMockIndexer(t, 1)
+
+	node.Fail("getblockcount", 1, &abecmock.Error{Code: abecmock.ErrCodeMisc, Message: "warming up"})
+	_, err := b.LatestBlock()
+	require.ErrorContains(t, err, "warming up")
+	_, err = b.LatestBlock()
+	require.NoError(t, err)
 
-	t.Logf("txs: %v block: %v", txs[0], block)
+	node.FailHTTP("", 1, http.StatusBadGateway)
+	_, err = b.GetBlockByHeight(0)
+	require.Error(t, err)
+	require.Equal(t, 1, node.Calls("getblockhash"))
+	require.Equal(t, 0, node.Calls("getblockabe"))
 
-	bs, _ := json.Marshal(txs[0].Tos)
-	t.Log(string(bs))
+	b.bitcoinCfg.RPCPass = "wrong"
+	_, err = b.LatestBlock()
+	require.Error(t, err)
 }
@@ -1,22 +1,26 @@
 package indexer
 
 import (
-	"encoding/json"
 	"errors"
-	"fmt"
 	"time"
 
+	"github.com/b2network/b2-indexer/internal/health"
+	"github.com/b2network/b2-indexer/internal/metrics"
 	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/storage"
+	"github.com/b2network/b2-indexer/internal/supervisor"
 	"github.com/b2network/b2-indexer/internal/types"
 	"github.com/b2network/b2-indexer/pkg/log"
 	"github.com/cometbft/cometbft/libs/service"
-	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
 )
 
 const (
 	ServiceName = "BitcoinIndexerService"
+)
 
+// the index loop intervals, the e2e tests shorten them
+var (
 	NewBlockWaitTimeout = 60 * time.Second
 
 	IndexTxTimeout    = 100 * time.Millisecond
@@ -41,46 +45,24 @@ const (
 type IndexerService struct {
 	service.BaseService
 	txIdxr types.BitcoinTxIndexer
-	db     *gorm.DB
+	store  storage.Store
 	log    log.Logger
+	loops  *supervisor.Loops
+	// start seeds the cursor of a new db
+	start IndexStart
+	// holder and beatAt are the host of the heartbeat and its last renewal
+	holder string
+	beatAt time.Time
 }
 
 // NewIndexerService returns a new service instance.
-func NewIndexerService(txIdxr types.BitcoinTxIndexer, db *gorm.DB, logger log.Logger) *IndexerService {
-	is := &IndexerService{txIdxr: txIdxr, db: db, log: logger}
+func NewIndexerService(txIdxr types.BitcoinTxIndexer, db *gorm.DB, logger log.Logger, start IndexStart) *IndexerService {
+	is := &IndexerService{txIdxr: txIdxr, store: storage.New(db), log: logger, start: start, holder: heartbeatHolder()}
 	is.BaseService = *service.NewBaseService(nil, ServiceName, is)
 	return is
 }
 
-func (bis *IndexerService) CheckDb() error {
-	if !bis.db.Migrator().HasTable(&model.Deposit{}) {
-		err := bis.db.AutoMigrate(&model.Deposit{})
-		if err != nil {
-			bis.log.Errorw("bitcoin indexer create table", "error", err.Error())
-			return err
-		}
-	}
-
-	if !bis.db.Migrator().HasTable(&model.BtcIndex{}) {
-		err := bis.db.AutoMigrate(&model.BtcIndex{})
-		if err != nil {
-			bis.log.Errorw("bitcoin indexer create table", "error", err.Error())
-			return err
-		}
-	}
-
-	if !bis.db.Migrator().HasTable(&model.RollupDeposit{}) {
-		err := bis.db.AutoMigrate(&model.RollupDeposit{})
-		if err != nil {
-			bis.log.Errorw("bitcoin indexer create table", "error", err.Error())
-			return err
-		}
-	}
-
-	return nil
-}
-
-// OnStart
+// OnStart loads the index cursor and starts indexing blocks
 func (bis *IndexerService) OnStart() error {
 	latestBlock, err := bis.txIdxr.LatestBlock()
 	if err != nil {
@@ -92,43 +74,95 @@ func (bis *IndexerService) OnStart() error {
 		currentBlock   int64 // index current block number
 		currentTxIndex int64 // index current block tx index
 	)
-	var btcIndex model.BtcIndex
-	if err := bis.db.First(&btcIndex, 1).Error; err != nil {
+	btcIndex, err := bis.store.Index().BtcIndex()
+	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			btcIndex = model.BtcIndex{
-				Base: model.Base{
-					ID: 1,
-				},
-				BtcIndexBlock: latestBlock,
-				BtcIndexTx:    0,
-			}
-			if err := bis.db.Create(&btcIndex).Error; err != nil {
+			btcIndex = bis.start.seed(latestBlock)
+			if err := bis.store.Index().SaveBtcIndex(&btcIndex); err != nil {
 				return err
 			}
+			if bis.start.Height == 0 {
+				bis.log.Warnw("bitcoin indexer seeded from the latest block, set indexer-start for a reproducible index",
+					"startHeight", btcIndex.StartHeight)
+			} else {
+				bis.log.Infow("bitcoin indexer seeded", "startHeight", btcIndex.StartHeight, "startTxIndex", btcIndex.StartTxIndex)
+			}
 		} else {
 			return err
 		}
 	}
+	if reason := bis.start.diverges(btcIndex); reason != "" {
+		bis.log.Errorw("bitcoin indexer cursor diverges from indexer-start, blocks may be missing from the index, "+
+			"check the config or backfill them with `abe-indexer reindex`",
+			"reason", reason,
+			"configStartHeight", bis.start.Height, "configStartTxIndex", bis.start.TxIndex,
+			"dbStartHeight", btcIndex.StartHeight, "dbStartTxIndex", btcIndex.StartTxIndex,
+			"dbIndexBlock", btcIndex.BtcIndexBlock, "dbIndexTx", btcIndex.BtcIndexTx)
+	}
 
 	bis.log.Infow("bitcoin indexer load db", "data", btcIndex)
 
 	// set default value
 	currentBlock = btcIndex.BtcIndexBlock
 	currentTxIndex = btcIndex.BtcIndexTx
+	health.IndexProgress(currentBlock, latestBlock)
+	bis.startBeat()
+
+	bis.loops = supervisor.NewLoops()
+	bis.loops.Go(func() error {
+		return bis.index(btcIndex, currentBlock, currentTxIndex, latestBlock)
+	})
+	return nil
+}
+
+// OnStop waits for the block being indexed to be saved
+func (bis *IndexerService) OnStop() {
+	bis.log.Warnf("bitcoin indexer service stopping...")
+	bis.loops.Stop()
+	bis.stopBeat()
+}
+
+// Crashed implements supervisor.Service
+func (bis *IndexerService) Crashed() <-chan struct{} {
+	return bis.loops.Crashed()
+}
+
+// Err implements supervisor.Service
+func (bis *IndexerService) Err() error {
+	return bis.loops.Err()
+}
 
+// index indexes the blocks after currentBlock until the service stops
+func (bis *IndexerService) index(btcIndex model.BtcIndex, currentBlock int64, currentTxIndex int64, latestBlock int64) error {
+	var err error
 	//ticker := time.NewTicker(NewBlockWaitTimeout)
 	for {
+		select {
+		case <-bis.loops.Quit():
+			return nil
+		default:
+		}
+		bis.beat()
+		metrics.SetIndexHeight(currentBlock, latestBlock)
 		bis.log.Infow("bitcoin indexer", "latestBlock",
 			latestBlock, "currentBlock", currentBlock, "currentTxIndex", currentTxIndex)
 
 		if latestBlock <= currentBlock {
 			//<-ticker.C
-			<-time.After(NewBlockWaitTimeout)
+			if !bis.loops.Sleep(NewBlockWaitTimeout) {
+				return nil
+			}
 
 			// update latest block
 			latestBlock, err = bis.txIdxr.LatestBlock()
 			if err != nil {
 				bis.log.Errorw("bitcoin indexer latestBlock", "error", err.Error())
+				continue
+			}
+			health.IndexProgress(currentBlock, latestBlock)
+			// caught up with the node
+			if latestBlock <= currentBlock {
+				health.Beat(health.ComponentIndexer)
 			}
 			continue
 		}
@@ -145,138 +179,84 @@ func (bis *IndexerService) OnStart() error {
 			txResults, blockHeader, err := bis.txIdxr.ParseBlock(i, currentTxIndex)
 			if err != nil {
 				if errors.Is(err, ErrTargetConfirmations) {
+					metrics.ParseErrors.WithLabelValues(metrics.ParseErrConfirmations).Inc()
 					bis.log.Warnw("parse block confirmations", "error", err.Error(), "currentBlock", i, "currentTxIndex", currentTxIndex)
-					time.Sleep(NewBlockWaitTimeout)
+					if !bis.loops.Sleep(NewBlockWaitTimeout) {
+						return nil
+					}
 				} else {
+					metrics.ParseErrors.WithLabelValues(metrics.ParseErrBlock).Inc()
 					bis.log.Errorw("parse block unknown err", "error", err.Error(), "currentBlock", i, "currentTxIndex", currentTxIndex)
 				}
-				if currentTxIndex == 0 {
-					currentBlock = i - 1
-				} else {
-					currentBlock = i
-					currentTxIndex--
-				}
-
+				// rollback index to just before the tx parsed from
+				currentBlock, currentTxIndex = CursorAt(i, currentTxIndex)
 				break
 			}
 			if len(txResults) > 0 {
 				currentBlock, currentTxIndex, err = bis.HandleResults(txResults, btcIndex, time.Unix(blockHeader.Time, 0), i)
 				if err != nil {
+					metrics.ParseErrors.WithLabelValues(metrics.ParseErrHandleResults).Inc()
 					bis.log.Errorw("failed to handle results", "error", err,
 						"currentBlock", currentBlock, "currentTxIndex", currentTxIndex, "latestBlock", latestBlock)
-					rollback := true
-					// not duplicated key, rollback index
-					if pgErr, ok := err.(*pgconn.PgError); ok {
-						// 23505 duplicate key value violates unique constraint , continue
-						if pgErr.Code == "23505" {
-							rollback = false
-						}
-					}
-
-					if rollback {
-						if currentTxIndex == 0 {
-							currentBlock = i - 1
-						} else {
-							currentBlock = i
-							currentTxIndex--
-						}
-						break
-					}
+					// rollback index to just before the failed tx, it is saved again from its first deposit
+					currentBlock, currentTxIndex = CursorAt(i, currentTxIndex)
+					break
 				}
 			}
 			currentBlock = i
 			currentTxIndex = 0
 			btcIndex.BtcIndexBlock = currentBlock
 			btcIndex.BtcIndexTx = currentTxIndex
-			if err := bis.db.Save(&btcIndex).Error; err != nil {
+			if err := bis.store.Index().SaveBtcIndex(&btcIndex); err != nil {
+				metrics.ParseErrors.WithLabelValues(metrics.ParseErrSaveIndex).Inc()
 				bis.log.Errorw("failed to save bitcoin index block", "error", err, "currentBlock", i,
 					"currentTxIndex", currentTxIndex, "latestBlock", latestBlock)
 				// rollback
 				currentBlock = i - 1
 				break
 			}
+			bis.beat()
+			metrics.BlocksIndexed.Inc()
+			metrics.SetIndexHeight(i, latestBlock)
+			health.BlockCommitted(i, latestBlock)
 			bis.log.Infow("bitcoin indexer parsed", "currentBlock", i,
 				"currentTxIndex", currentTxIndex, "latestBlock", latestBlock)
-			time.Sleep(IndexBlockTimeout)
+			if !bis.loops.Sleep(IndexBlockTimeout) {
+				return nil
+			}
 		}
 	}
 }
 
-// save index tx to db
-func (bis *IndexerService) SaveParsedResult(
-	parseResult *types.BitcoinTxParseResult,
+// SaveParsedResults saves the deposits of a tx and the index cursor past it in one
+// transaction. A deposit is inserted unless its tx output is known, a deposit created
+// by the callback and waiting for its listener gets the parsed fields, the others are
+// kept, so a tx indexed again changes nothing.
+func (bis *IndexerService) SaveParsedResults(
+	parseResults []*types.BitcoinTxParseResult,
 	btcBlockNumber int64,
 	b2TxStatus int,
 	btcBlockTime time.Time,
 	btcIndex model.BtcIndex,
 ) error {
 	// write db
-	err := bis.db.Transaction(func(tx *gorm.DB) error {
-		if len(parseResult.From) == 0 {
-			return fmt.Errorf("parse result from empty")
-		}
-
-		if len(parseResult.To) == 0 {
-			return fmt.Errorf("parse result to empty")
-		}
-
-		froms, err := json.Marshal(parseResult.From)
-		if err != nil {
-			return err
-		}
-		tos, err := json.Marshal(parseResult.Tos)
-		if err != nil {
-			return err
-		}
-
-		// if existed, update deposit record
-		var deposit model.Deposit
-		err = tx.First(&deposit,
-			fmt.Sprintf("%s = ?", model.Deposit{}.Column().BtcTxHash),
-			parseResult.TxID).Error
-		if err != nil {
-			if !errors.Is(err, gorm.ErrRecordNotFound) {
+	err := bis.store.Transaction(func(store storage.Store) error {
+		for _, parseResult := range parseResults {
+			parsed, err := newDeposit(parseResult, btcBlockNumber, b2TxStatus, btcBlockTime)
+			if err != nil {
 				return err
 			}
-			deposit := model.Deposit{
-				BtcBlockNumber: btcBlockNumber,
-				BtcTxIndex:     parseResult.Index,
-				BtcTxHash:      parseResult.TxID,
-				BtcFrom:        parseResult.From[0].Address,
-				BtcTos:         string(tos),
-				BtcTo:          parseResult.To,
-				BtcValue:       parseResult.Value,
-				BtcFroms:       string(froms),
-				B2TxStatus:     b2TxStatus,
-				BtcBlockTime:   btcBlockTime,
-				B2TxRetry:      0,
-				ListenerStatus: model.ListenerStatusSuccess,
-				CallbackStatus: model.CallbackStatusSuccess,
-			}
-			err = tx.Create(&deposit).Error
+			saved, err := store.Deposits().Upsert(&parsed)
 			if err != nil {
 				bis.log.Errorw("failed to save tx parsed result", "error", err)
 				return err
 			}
-		} else if deposit.CallbackStatus == model.CallbackStatusSuccess &&
-			deposit.ListenerStatus == model.ListenerStatusPending {
-			// if existed, update deposit record
-			updateFields := map[string]interface{}{
-				model.Deposit{}.Column().BtcBlockNumber: btcBlockNumber,
-				model.Deposit{}.Column().BtcTxIndex:     parseResult.Index,
-				model.Deposit{}.Column().BtcFroms:       string(froms),
-				model.Deposit{}.Column().BtcTos:         string(tos),
-				model.Deposit{}.Column().BtcBlockTime:   btcBlockTime,
-				model.Deposit{}.Column().ListenerStatus: model.ListenerStatusSuccess,
-			}
-			err = tx.Model(&model.Deposit{}).Where("id = ?", deposit.ID).Updates(updateFields).Error
-			if err != nil {
-				bis.log.Errorw("failed to update tx parsed result", "error", err)
-				return err
+			if !saved {
+				bis.log.Infow("tx parsed result already saved", "btcTxHash", parseResult.TxID, "output", parseResult.Output)
 			}
 		}
 
-		if err := tx.Save(&btcIndex).Error; err != nil {
+		if err := store.Index().SaveBtcIndex(&btcIndex); err != nil {
 			bis.log.Errorw("failed to save bitcoin tx index", "error", err)
 			return err
 		}
@@ -291,18 +271,28 @@ func (bis *IndexerService) HandleResults(
 	btcBlockTime time.Time,
 	currentBlock int64,
 ) (int64, int64, error) {
-	for _, v := range txResults {
-		// if from is listen address, skip
-		if bis.ToInFroms(v.From, v.To) {
-			bis.log.Infow("current transaction from is listen address", "currentBlock", currentBlock, "currentTxIndex", v.Index, "data", v)
+	for start := 0; start < len(txResults); {
+		// the deposits of a tx are consecutive, they are saved together
+		txIndex := txResults[start].Index
+		deposits := make([]*types.BitcoinTxParseResult, 0, 1)
+		for ; start < len(txResults) && txResults[start].Index == txIndex; start++ {
+			v := txResults[start]
+			// if from is listen address, skip
+			if bis.ToInFroms(v.From, v.To) {
+				bis.log.Infow("current transaction from is listen address", "currentBlock", currentBlock, "currentTxIndex", v.Index, "data", v)
+				continue
+			}
+			deposits = append(deposits, v)
+		}
+		if len(deposits) == 0 {
 			continue
 		}
 
 		btcIndex.BtcIndexBlock = currentBlock
-		btcIndex.BtcIndexTx = v.Index
+		btcIndex.BtcIndexTx = txIndex
 		// write db
-		err := bis.SaveParsedResult(
-			v,
+		err := bis.SaveParsedResults(
+			deposits,
 			currentBlock,
 			model.DepositB2TxStatusPending,
 			btcBlockTime,
@@ -310,16 +300,21 @@ func (bis *IndexerService) HandleResults(
 		)
 		if err != nil {
 			bis.log.Errorw("failed to save bitcoin index tx", "error", err,
-				"data", v)
-			return currentBlock, v.Index, err
+				"data", deposits)
+			return currentBlock, txIndex, err
 		}
-		bis.log.Infow("save bitcoin index tx success", "currentBlock", currentBlock, "currentTxIndex", v.Index, "data", v)
+		bis.log.Infow("save bitcoin index tx success", "currentBlock", currentBlock, "currentTxIndex", txIndex, "data", deposits)
 		time.Sleep(IndexTxTimeout)
 	}
 	return currentBlock, 0, nil
 }
 
 func (bis *IndexerService) ToInFroms(a []types.BitcoinFrom, s string) bool {
+	return toInFroms(a, s)
+}
+
+// toInFroms reports whether the listen address s is a sender, i.e. the tx is not a deposit
+func toInFroms(a []types.BitcoinFrom, s string) bool {
 	for _, i := range a {
 		if i.Address == s {
 			return true
@@ -0,0 +1,109 @@
+package indexer
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/types"
+	"github.com/b2network/b2-indexer/pkg/log"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// blockIndexer serves a single block with a deposit in its tx 1
+type blockIndexer struct {
+	types.BitcoinTxIndexer
+	height int64
+}
+
+func (b *blockIndexer) LatestBlock() (int64, error) {
+	return b.height, nil
+}
+
+func (b *blockIndexer) ParseBlock(height int64, txIndex int64) ([]*types.BitcoinTxParseResult, *types.BlockInfo, error) {
+	blockInfo := &types.BlockInfo{Height: height, Time: time.Now().Unix()}
+	if height != b.height || txIndex > 1 {
+		return nil, blockInfo, nil
+	}
+	return []*types.BitcoinTxParseResult{{
+		From:  []types.BitcoinFrom{{Address: "from"}},
+		To:    "to",
+		Value: 1000,
+		TxID:  "txid",
+		Index: 1,
+	}}, blockInfo, nil
+}
+
+func TestIndexRetriesFailedFirstTx(t *testing.T) {
+	for v, d := range map[*time.Duration]time.Duration{
+		&NewBlockWaitTimeout: 10 * time.Millisecond,
+		&IndexBlockTimeout:   10 * time.Millisecond,
+		&IndexTxTimeout:      0,
+	} {
+		v, old := v, *v
+		*v = d
+		t.Cleanup(func() { *v = old })
+	}
+	db := openSqlite(t)
+	// the first save of the deposit fails
+	var failed atomic.Bool
+	require.NoError(t, db.Callback().Create().Before("gorm:create").Register("test:fail_once", func(tx *gorm.DB) {
+		if tx.Statement.Table == (model.Deposit{}).TableName() && failed.CompareAndSwap(false, true) {
+			_ = tx.AddError(errors.New("save failed"))
+		}
+	}))
+
+	is := NewIndexerService(&blockIndexer{height: 10}, db, log.NewNopLogger(), IndexStart{Height: 10})
+	require.NoError(t, is.Start())
+	t.Cleanup(func() { _ = is.Stop() })
+
+	require.Eventually(t, func() bool {
+		var btcIndex model.BtcIndex
+		if err := db.First(&btcIndex).Error; err != nil {
+			return false
+		}
+		return btcIndex.BtcIndexBlock == 10 && btcIndex.BtcIndexTx == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.True(t, failed.Load())
+	var deposits []model.Deposit
+	require.NoError(t, db.Find(&deposits).Error)
+	require.Len(t, deposits, 1)
+	require.Equal(t, "txid", deposits[0].BtcTxHash)
+	require.Equal(t, int64(10), deposits[0].BtcBlockNumber)
+}
+
+func TestIndexerHeartbeat(t *testing.T) {
+	db := openSqlite(t)
+	is := NewIndexerService(&blockIndexer{height: 10}, db, log.NewNopLogger(), IndexStart{Height: 11})
+	// an indexer stopped long ago and one running on another host
+	require.NoError(t, is.store.Index().SaveHeartbeat(HeartbeatName("old/1"), "old/1", -HeartbeatRetention-time.Hour))
+	require.NoError(t, is.store.Index().SaveHeartbeat(HeartbeatName("other/1"), "other/1", time.Minute))
+
+	require.NoError(t, is.Start())
+	live, err := is.store.Index().Heartbeats(HeartbeatPrefix, true)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{heartbeatHolder(), "other/1"}, holders(live))
+	for _, heartbeat := range live {
+		require.True(t, heartbeat.ExpiresAt.After(time.Now()))
+	}
+
+	// a stopped indexer expires its own heartbeat
+	require.NoError(t, is.Stop())
+	live, err = is.store.Index().Heartbeats(HeartbeatPrefix, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"other/1"}, holders(live))
+	heartbeats, err := is.store.Index().Heartbeats(HeartbeatPrefix, false)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{heartbeatHolder(), "other/1"}, holders(heartbeats))
+}
+
+func holders(leases []model.LeaderLease) []string {
+	holders := make([]string, 0, len(leases))
+	for _, lease := range leases {
+		holders = append(holders, lease.Holder)
+	}
+	return holders
+}
@@ -0,0 +1,181 @@
+package indexer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/types"
+	"github.com/b2network/b2-indexer/pkg/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrReindexRange = errors.New("invalid reindex range")
+
+// ReindexDiff is a deposit of the reindexed range missing from or differing with deposit_history
+type ReindexDiff struct {
+	BtcTxHash      string `json:"btc_tx_hash"`
+	BtcTxOutput    int64  `json:"btc_tx_output"`
+	BtcBlockNumber int64  `json:"btc_block_number"`
+	BtcTxIndex     int64  `json:"btc_tx_index"`
+	// Fields are the differing fields as db value -> parsed value, empty for a missing deposit
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// ReindexReport is the result of a reindex
+type ReindexReport struct {
+	From   int64 `json:"from"`
+	To     int64 `json:"to"`
+	DryRun bool  `json:"dry_run"`
+	// Deposits is the number of deposits parsed in the range
+	Deposits int `json:"deposits"`
+	// Inserted is the number of missing deposits inserted, 0 on dry run
+	Inserted int           `json:"inserted"`
+	Missing  []ReindexDiff `json:"missing"`
+	// Differing deposits are reported only, the db rows are kept
+	Differing []ReindexDiff `json:"differing"`
+}
+
+// Reindexer parses a block range again without moving the index cursor and
+// inserts the deposits missing from deposit_history, e.g. after an outage
+type Reindexer struct {
+	txIdxr types.BitcoinTxIndexer
+	db     *gorm.DB
+	log    log.Logger
+}
+
+// NewReindexer returns a new reindexer instance.
+func NewReindexer(txIdxr types.BitcoinTxIndexer, db *gorm.DB, logger log.Logger) *Reindexer {
+	return &Reindexer{txIdxr: txIdxr, db: db, log: logger}
+}
+
+// Reindex parses the blocks from..to, with dryRun the missing deposits are only reported
+func (r *Reindexer) Reindex(from, to int64, dryRun bool) (*ReindexReport, error) {
+	latestBlock, err := r.txIdxr.LatestBlock()
+	if err != nil {
+		return nil, err
+	}
+	if from <= 0 || to < from || to > latestBlock {
+		return nil, fmt.Errorf("%w: %d..%d, latest block %d", ErrReindexRange, from, to, latestBlock)
+	}
+	report := &ReindexReport{
+		From:      from,
+		To:        to,
+		DryRun:    dryRun,
+		Missing:   []ReindexDiff{},
+		Differing: []ReindexDiff{},
+	}
+	for height := from; height <= to; height++ {
+		txResults, blockHeader, err := r.txIdxr.ParseBlock(height, 0)
+		if err != nil {
+			return report, fmt.Errorf("parse block %d: %w", height, err)
+		}
+		for _, parseResult := range txResults {
+			if toInFroms(parseResult.From, parseResult.To) {
+				continue
+			}
+			report.Deposits++
+			if err := r.reindexDeposit(report, parseResult, height, time.Unix(blockHeader.Time, 0)); err != nil {
+				return report, fmt.Errorf("reindex tx %s: %w", parseResult.TxID, err)
+			}
+		}
+		r.log.Infow("reindex block", "height", height, "deposits", len(txResults))
+	}
+	return report, nil
+}
+
+func (r *Reindexer) reindexDeposit(report *ReindexReport, parseResult *types.BitcoinTxParseResult, height int64, blockTime time.Time) error {
+	parsed, err := newDeposit(parseResult, height, model.DepositB2TxStatusPending, blockTime)
+	if err != nil {
+		return err
+	}
+	diff := ReindexDiff{
+		BtcTxHash:      parsed.BtcTxHash,
+		BtcTxOutput:    parsed.BtcTxOutput,
+		BtcBlockNumber: parsed.BtcBlockNumber,
+		BtcTxIndex:     parsed.BtcTxIndex,
+	}
+
+	var deposit model.Deposit
+	err = r.db.Where(fmt.Sprintf("%s = ?", model.Deposit{}.Column().BtcTxHash), parsed.BtcTxHash).
+		Where(fmt.Sprintf("%s = ?", model.Deposit{}.Column().BtcTxOutput), parsed.BtcTxOutput).
+		First(&deposit).Error
+	if err == nil {
+		diff.Fields = depositDiff(&deposit, &parsed)
+		if len(diff.Fields) > 0 {
+			report.Differing = append(report.Differing, diff)
+		}
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	report.Missing = append(report.Missing, diff)
+	if report.DryRun {
+		return nil
+	}
+	// the live indexer may insert it meanwhile
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&parsed)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 1 {
+		report.Inserted++
+		r.log.Infow("reindex inserted missing deposit", "btcTxHash", parsed.BtcTxHash, "output", parsed.BtcTxOutput, "height", height)
+	}
+	return nil
+}
+
+// depositDiff returns the fields of the parsed deposit differing from the db deposit as db value -> parsed value
+func depositDiff(deposit *model.Deposit, parsed *model.Deposit) map[string]string {
+	fields := make(map[string]string)
+	compare := func(column string, db interface{}, parsed interface{}) {
+		if db != parsed {
+			fields[column] = fmt.Sprintf("%v -> %v", db, parsed)
+		}
+	}
+	compare(model.Deposit{}.Column().BtcBlockNumber, deposit.BtcBlockNumber, parsed.BtcBlockNumber)
+	compare(model.Deposit{}.Column().BtcTxIndex, deposit.BtcTxIndex, parsed.BtcTxIndex)
+	compare(model.Deposit{}.Column().BtcFrom, deposit.BtcFrom, parsed.BtcFrom)
+	compare(model.Deposit{}.Column().BtcTo, deposit.BtcTo, parsed.BtcTo)
+	compare(model.Deposit{}.Column().BtcValue, deposit.BtcValue, parsed.BtcValue)
+	return fields
+}
+
+// newDeposit returns the deposit record of a parsed tx
+func newDeposit(parseResult *types.BitcoinTxParseResult, btcBlockNumber int64, b2TxStatus int, btcBlockTime time.Time) (model.Deposit, error) {
+	if len(parseResult.From) == 0 {
+		return model.Deposit{}, fmt.Errorf("parse result from empty")
+	}
+	if len(parseResult.To) == 0 {
+		return model.Deposit{}, fmt.Errorf("parse result to empty")
+	}
+	froms, err := json.Marshal(parseResult.From)
+	if err != nil {
+		return model.Deposit{}, err
+	}
+	tos, err := json.Marshal(parseResult.Tos)
+	if err != nil {
+		return model.Deposit{}, err
+	}
+	return model.Deposit{
+		BtcBlockNumber: btcBlockNumber,
+		BtcTxIndex:     parseResult.Index,
+		BtcTxHash:      parseResult.TxID,
+		BtcTxOutput:    parseResult.Output,
+		BtcFrom:        parseResult.From[0].Address,
+		BtcTos:         model.JSON(tos),
+		BtcTo:          parseResult.To,
+		BtcValue:       parseResult.Value,
+		BtcFroms:       model.JSON(froms),
+		B2TxStatus:     b2TxStatus,
+		BtcBlockTime:   btcBlockTime,
+		B2TxRetry:      0,
+		ListenerStatus: model.ListenerStatusSuccess,
+		CallbackStatus: model.CallbackStatusSuccess,
+	}, nil
+}
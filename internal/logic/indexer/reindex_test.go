@@ -0,0 +1,55 @@
+package indexer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/types"
+	"github.com/b2network/b2-indexer/pkg/log"
+	"github.com/stretchr/testify/require"
+)
+
+type latestBlockIndexer struct {
+	types.BitcoinTxIndexer
+	latest int64
+}
+
+func (l *latestBlockIndexer) LatestBlock() (int64, error) {
+	return l.latest, nil
+}
+
+func TestReindexRange(t *testing.T) {
+	r := NewReindexer(&latestBlockIndexer{latest: 100}, nil, log.NewNopLogger())
+	for _, tt := range []struct{ from, to int64 }{{0, 10}, {20, 10}, {90, 101}} {
+		_, err := r.Reindex(tt.from, tt.to, true)
+		require.ErrorIs(t, err, ErrReindexRange)
+	}
+}
+
+func TestReindexDepositDiff(t *testing.T) {
+	parseResult := &types.BitcoinTxParseResult{
+		From:  []types.BitcoinFrom{{Address: "from"}},
+		To:    "to",
+		Value: 1000,
+		TxID:  "txid",
+		Index: 3,
+	}
+	parsed, err := newDeposit(parseResult, 10, model.DepositB2TxStatusPending, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, "from", parsed.BtcFrom)
+	require.Equal(t, model.DepositB2TxStatusPending, parsed.B2TxStatus)
+
+	deposit := parsed
+	require.Empty(t, depositDiff(&deposit, &parsed))
+
+	deposit.BtcValue = 900
+	deposit.BtcBlockNumber = 11
+	require.Equal(t, map[string]string{
+		model.Deposit{}.Column().BtcValue:       "900 -> 1000",
+		model.Deposit{}.Column().BtcBlockNumber: "11 -> 10",
+	}, depositDiff(&deposit, &parsed))
+
+	_, err = newDeposit(&types.BitcoinTxParseResult{To: "to"}, 10, model.DepositB2TxStatusPending, time.Now())
+	require.Error(t, err)
+}
@@ -0,0 +1,499 @@
+// Package reconcile reconciles the abelian deposits with the l2 mint and burn events
+// recorded by the rollup listener, and reports the discrepancies.
+package reconcile
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/metrics"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/pkg/log"
+	"gorm.io/gorm"
+)
+
+const (
+	// alertTimeout is the time the post of an alert may take
+	alertTimeout = 10 * time.Second
+	// maxAlertItems is the max discrepancies posted with an alert, the report holds all
+	maxAlertItems = 100
+	// maxDetailLen is the size of reconciliation_discrepancy.detail
+	maxDetailLen = 256
+)
+
+// the b2 tx status of a deposit whose mint was sent, TxHashExist until CheckDeposit
+// takes its b2 tx from the mint event
+var mintedStatus = []int{model.DepositB2TxStatusSuccess, model.DepositB2TxStatusTxHashExist}
+
+// the status of a withdraw paid out, failed or rejected, the burns of the others are being paid
+var settledStatus = []int{
+	model.BtcTxWithdrawSuccess, model.BtcTxWithdrawFailed, model.BtcTxWithdrawRejected, model.BtcTxWithdrawRefunded,
+}
+
+// Report is a reconciliation run and its discrepancies
+type Report struct {
+	model.ReconciliationReport
+	Items []model.ReconciliationDiscrepancy `json:"items"`
+}
+
+// Reconciler checks that every deposit has exactly one mint event, that every mint event
+// has its deposit, and that the minted supply less the burns is the confirmed deposits less
+// the paid withdraws. A deposit may wait grace period for its mint event.
+type Reconciler struct {
+	db          *gorm.DB
+	gracePeriod time.Duration
+	alertURL    string
+	client      *http.Client
+	log         log.Logger
+}
+
+// NewReconciler returns a reconciler of the deposits and the events of db
+func NewReconciler(cfg config.ReconcileConfig, db *gorm.DB, log log.Logger) *Reconciler {
+	return &Reconciler{
+		db:          db,
+		gracePeriod: time.Duration(cfg.GracePeriod) * time.Second,
+		alertURL:    cfg.AlertURL,
+		client:      &http.Client{Timeout: alertTimeout},
+		log:         log,
+	}
+}
+
+// totals is the count and the summed value of rows
+type totals struct {
+	Count int64
+	Value int64
+}
+
+// txGroup is the deposits and the mint events of an abelian tx not matched by b2 tx hash
+type txGroup struct {
+	deposits []model.Deposit
+	mints    []model.RollupDeposit
+}
+
+// Run reconciles, saves the report and its discrepancies, updates the metrics and posts
+// an alert with discrepancies. A failed alert is returned with the saved report.
+func (r *Reconciler) Run(ctx context.Context) (*Report, error) {
+	db := r.db.WithContext(ctx)
+	report := &Report{}
+	report.StartedAt = time.Now()
+	cutoff := report.StartedAt.Add(-r.gracePeriod)
+
+	// the totals and the discrepancies are read from one snapshot while the indexer writes
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return r.read(tx, cutoff, report)
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	report.Discrepancies = int64(len(report.Items))
+	report.Status = model.ReconciliationStatusOK
+	if report.Discrepancies > 0 {
+		report.Status = model.ReconciliationStatusDiscrepancy
+	}
+	report.FinishedAt = time.Now()
+	if err = r.save(db, report); err != nil {
+		return nil, err
+	}
+	r.observe(report)
+	if report.Discrepancies == 0 {
+		r.log.Infow("reconciliation ok", "report", report.ID, "deposits", report.Deposits, "mints", report.Mints, "burns", report.Burns)
+		return report, nil
+	}
+	r.log.Errorw("reconciliation found discrepancies", "report", report.ID, "discrepancies", report.Discrepancies, "supplyDiff", report.SupplyDiff)
+	if err = r.alert(ctx, report); err != nil {
+		return report, fmt.Errorf("post reconciliation alert: %w", err)
+	}
+	return report, nil
+}
+
+// read counts the deposits, the mint and burn events and the paid withdraws, and adds the
+// discrepancies of the deposits and the mint events and of the supply to report
+func (r *Reconciler) read(db *gorm.DB, cutoff time.Time, report *Report) error {
+	const sum = "COUNT(*) AS count, COALESCE(SUM(btc_value), 0) AS value"
+	var deposits, confirmed, mints, burns, paid, paying totals
+	if err := db.Model(&model.Deposit{}).Select(sum).Scan(&deposits).Error; err != nil {
+		return err
+	}
+	err := db.Model(&model.Deposit{}).
+		Select(sum).
+		Where(fmt.Sprintf("%s IN ?", model.Deposit{}.Column().B2TxStatus), mintedStatus).
+		Scan(&confirmed).Error
+	if err != nil {
+		return err
+	}
+	if err = db.Model(&model.RollupDeposit{}).Select(sum).Scan(&mints).Error; err != nil {
+		return err
+	}
+	if err = db.Model(&model.Withdraw{}).Select(sum).Scan(&burns).Error; err != nil {
+		return err
+	}
+	err = db.Model(&model.Withdraw{}).
+		Select(sum).
+		Where(fmt.Sprintf("%s = ?", model.Withdraw{}.Column().Status), model.BtcTxWithdrawSuccess).
+		Scan(&paid).Error
+	if err != nil {
+		return err
+	}
+	err = db.Model(&model.Withdraw{}).
+		Select(sum).
+		Where(fmt.Sprintf("%s NOT IN ?", model.Withdraw{}.Column().Status), settledStatus).
+		Scan(&paying).Error
+	if err != nil {
+		return err
+	}
+	report.Deposits, report.Mints, report.Burns = deposits.Count, mints.Count, burns.Count
+	report.ConfirmedValue, report.MintedValue, report.BurnedValue = confirmed.Value, mints.Value, burns.Value
+	report.PaidValue, report.PayingValue = paid.Value, paying.Value
+
+	if report.Items, err = r.mismatchedByB2Tx(db); err != nil {
+		return err
+	}
+	groups, err := r.unmatched(db)
+	if err != nil {
+		return err
+	}
+	if err = r.reconcileGroups(db, groups, cutoff, report); err != nil {
+		return err
+	}
+
+	// the supply in circulation and the custody backing it are counted on their own, a
+	// confirmed deposit without its mint event yet or a burn being paid is no discrepancy
+	circulating := report.MintedValue - report.BurnedValue
+	backed := report.ConfirmedValue - report.PaidValue - report.InFlightValue - report.PayingValue
+	report.SupplyDiff = circulating - backed
+	if report.SupplyDiff != 0 {
+		report.Items = append(report.Items, model.ReconciliationDiscrepancy{
+			Kind:     model.DiscrepancySupplyMismatch,
+			Expected: backed,
+			Actual:   circulating,
+			Detail: fmt.Sprintf("minted %d less burned %d differs from confirmed deposits %d less paid %d, in flight %d and paying %d by %d",
+				report.MintedValue, report.BurnedValue, report.ConfirmedValue, report.PaidValue, report.InFlightValue, report.PayingValue, report.SupplyDiff),
+		})
+	}
+	return nil
+}
+
+// mismatchedByB2Tx returns the mint events differing from the deposit of their b2 tx
+func (r *Reconciler) mismatchedByB2Tx(db *gorm.DB) ([]model.ReconciliationDiscrepancy, error) {
+	var pairs []struct {
+		DepositID              int64
+		RollupDepositID        int64
+		BtcTxHash              string
+		RollupBtcTxHash        string
+		B2TxHash               string
+		BtcValue               int64
+		RollupBtcValue         int64
+		BtcFromAAAddress       string
+		RollupBtcFromAAAddress string
+	}
+	err := db.Table(model.Deposit{}.TableName() + " d").
+		Select("d.id AS deposit_id, r.id AS rollup_deposit_id, d.btc_tx_hash, r.btc_tx_hash AS rollup_btc_tx_hash, d.b2_tx_hash, " +
+			"d.btc_value, r.btc_value AS rollup_btc_value, d.btc_from_aa_address, r.btc_from_aa_address AS rollup_btc_from_aa_address").
+		Joins(fmt.Sprintf("JOIN %s r ON r.b2_tx_hash = d.b2_tx_hash AND r.deleted_at IS NULL", model.RollupDeposit{}.TableName())).
+		Where("d.deleted_at IS NULL AND d.b2_tx_hash <> ''").
+		Where("d.btc_value <> r.btc_value OR LOWER(d.btc_from_aa_address) <> LOWER(r.btc_from_aa_address) OR d.btc_tx_hash <> r.btc_tx_hash").
+		Order("d.id").
+		Scan(&pairs).Error
+	if err != nil {
+		return nil, err
+	}
+	items := make([]model.ReconciliationDiscrepancy, 0, len(pairs))
+	for _, p := range pairs {
+		items = append(items, model.ReconciliationDiscrepancy{
+			Kind:            model.DiscrepancyMintMismatch,
+			DepositID:       p.DepositID,
+			RollupDepositID: p.RollupDepositID,
+			BtcTxHash:       p.BtcTxHash,
+			B2TxHash:        p.B2TxHash,
+			Expected:        p.BtcValue,
+			Actual:          p.RollupBtcValue,
+			Detail: mismatch(p.BtcValue, p.RollupBtcValue, p.BtcFromAAAddress, p.RollupBtcFromAAAddress) +
+				txMismatch(p.BtcTxHash, p.RollupBtcTxHash),
+		})
+	}
+	return items, nil
+}
+
+// unmatched returns the deposits and the mint events without a counterpart of the same
+// b2 tx, by abelian tx
+func (r *Reconciler) unmatched(db *gorm.DB) (map[string]*txGroup, error) {
+	var deposits []model.Deposit
+	err := db.
+		Where(fmt.Sprintf("NOT EXISTS (SELECT 1 FROM %[1]s r WHERE r.b2_tx_hash = %[2]s.b2_tx_hash AND %[2]s.b2_tx_hash <> '' AND r.deleted_at IS NULL)",
+			model.RollupDeposit{}.TableName(), model.Deposit{}.TableName())).
+		Order("id").
+		Find(&deposits).Error
+	if err != nil {
+		return nil, err
+	}
+	var mints []model.RollupDeposit
+	err = db.
+		Where(fmt.Sprintf("NOT EXISTS (SELECT 1 FROM %[1]s d WHERE d.b2_tx_hash = %[2]s.b2_tx_hash AND %[2]s.b2_tx_hash <> '' AND d.deleted_at IS NULL)",
+			model.Deposit{}.TableName(), model.RollupDeposit{}.TableName())).
+		Order("id").
+		Find(&mints).Error
+	if err != nil {
+		return nil, err
+	}
+	groups := make(map[string]*txGroup)
+	group := func(txHash string) *txGroup {
+		g, ok := groups[txHash]
+		if !ok {
+			g = &txGroup{}
+			groups[txHash] = g
+		}
+		return g
+	}
+	for _, d := range deposits {
+		group(d.BtcTxHash).deposits = append(group(d.BtcTxHash).deposits, d)
+	}
+	for _, m := range mints {
+		group(m.BtcTxHash).mints = append(group(m.BtcTxHash).mints, m)
+	}
+	return groups, nil
+}
+
+// reconcileGroups pairs the deposits and the mint events of every abelian tx, the same
+// value and aa address first, and adds the missing, orphan, duplicate and mismatched ones
+func (r *Reconciler) reconcileGroups(db *gorm.DB, groups map[string]*txGroup, cutoff time.Time, report *Report) error {
+	// the abelian txs of the unpaired mint events having a deposit matched by b2 tx
+	var mintTxs []string
+	for txHash, g := range groups {
+		if txHash != "" && len(g.mints) > len(g.deposits) {
+			mintTxs = append(mintTxs, txHash)
+		}
+	}
+	var depositTxs []string
+	if len(mintTxs) > 0 {
+		err := db.Model(&model.Deposit{}).
+			Where(fmt.Sprintf("%s IN ?", model.Deposit{}.Column().BtcTxHash), mintTxs).
+			Distinct().
+			Pluck(model.Deposit{}.Column().BtcTxHash, &depositTxs).Error
+		if err != nil {
+			return err
+		}
+	}
+	hasDeposit := make(map[string]bool, len(depositTxs))
+	for _, txHash := range depositTxs {
+		hasDeposit[txHash] = true
+	}
+	// the mint events not sent by a deposit refunding a rejected withdraw
+	var b2TxHashes, refundTxs []string
+	if g, ok := groups[""]; ok {
+		for _, m := range g.mints {
+			b2TxHashes = append(b2TxHashes, m.B2TxHash)
+		}
+	}
+	if len(b2TxHashes) > 0 {
+		err := db.Model(&model.Withdraw{}).
+			Where(fmt.Sprintf("%s IN ?", model.Withdraw{}.Column().RefundTxHash), b2TxHashes).
+			Pluck(model.Withdraw{}.Column().RefundTxHash, &refundTxs).Error
+		if err != nil {
+			return err
+		}
+	}
+	refund := make(map[string]bool, len(refundTxs))
+	for _, b2TxHash := range refundTxs {
+		refund[b2TxHash] = true
+	}
+
+	txHashes := make([]string, 0, len(groups))
+	for txHash := range groups {
+		txHashes = append(txHashes, txHash)
+	}
+	sort.Strings(txHashes)
+	for _, txHash := range txHashes {
+		g := groups[txHash]
+		sort.Slice(g.deposits, func(i, j int) bool { return g.deposits[i].BtcTxOutput < g.deposits[j].BtcTxOutput })
+		used := make([]bool, len(g.mints))
+		paired := make(map[int]int, len(g.deposits))
+		for i, d := range g.deposits {
+			for j, m := range g.mints {
+				if !used[j] && d.BtcValue == m.BtcValue && strings.EqualFold(d.BtcFromAAAddress, m.BtcFromAAAddress) {
+					used[j], paired[i] = true, j
+					break
+				}
+			}
+		}
+		for i := range g.deposits {
+			if _, ok := paired[i]; ok {
+				continue
+			}
+			for j := range g.mints {
+				if !used[j] {
+					used[j], paired[i] = true, j
+					break
+				}
+			}
+		}
+
+		for i, d := range g.deposits {
+			j, ok := paired[i]
+			if ok {
+				if item, ok := checkPair(d, g.mints[j], cutoff); ok {
+					report.Items = append(report.Items, item)
+				}
+				continue
+			}
+			minted := d.B2TxStatus == model.DepositB2TxStatusSuccess || d.B2TxStatus == model.DepositB2TxStatusTxHashExist
+			switch {
+			case minted && d.UpdatedAt.After(cutoff):
+				report.InFlightValue += d.BtcValue
+			case d.CreatedAt.After(cutoff):
+			// an operator resolved it without a mint, see admin_audit
+			case d.B2TxStatus == model.DepositB2TxStatusResolved:
+			default:
+				report.Items = append(report.Items, model.ReconciliationDiscrepancy{
+					Kind:      model.DiscrepancyMissingMint,
+					DepositID: d.ID,
+					BtcTxHash: d.BtcTxHash,
+					B2TxHash:  d.B2TxHash,
+					Expected:  d.BtcValue,
+					Detail:    fmt.Sprintf("output %d without mint event, b2 tx status %d", d.BtcTxOutput, d.B2TxStatus),
+				})
+			}
+		}
+		for j, m := range g.mints {
+			// an operator refunded a rejected withdraw by it, see withdraw mark-refunded
+			if used[j] || (m.BtcTxHash == "" && refund[m.B2TxHash]) {
+				continue
+			}
+			item := model.ReconciliationDiscrepancy{
+				Kind:            model.DiscrepancyOrphanMint,
+				RollupDepositID: m.ID,
+				BtcTxHash:       m.BtcTxHash,
+				B2TxHash:        m.B2TxHash,
+				Actual:          m.BtcValue,
+				Detail:          fmt.Sprintf("mint of %s at b2 block %d without deposit", m.BtcFromAAAddress, m.B2BlockNumber),
+			}
+			switch {
+			case m.BtcTxHash == "":
+				// the listener found no deposit sent by the mint tx
+				item.Detail = fmt.Sprintf("mint of %s at b2 block %d not sent by a deposit", m.BtcFromAAAddress, m.B2BlockNumber)
+			case len(g.deposits) > 0 || hasDeposit[txHash]:
+				item.Kind = model.DiscrepancyDuplicateMint
+				item.Detail = fmt.Sprintf("mint of %s at b2 block %d beyond the deposits of the tx", m.BtcFromAAAddress, m.B2BlockNumber)
+			}
+			report.Items = append(report.Items, item)
+		}
+	}
+	return nil
+}
+
+// checkPair returns the discrepancy of a deposit and the mint event of its abelian tx
+func checkPair(d model.Deposit, m model.RollupDeposit, cutoff time.Time) (model.ReconciliationDiscrepancy, bool) {
+	detail := mismatch(d.BtcValue, m.BtcValue, d.BtcFromAAAddress, m.BtcFromAAAddress)
+	switch {
+	case d.B2TxStatus == model.DepositB2TxStatusSuccess && d.B2TxHash != m.B2TxHash:
+		detail += fmt.Sprintf("sent by b2 tx %s, minted by %s; ", d.B2TxHash, m.B2TxHash)
+	case d.B2TxStatus != model.DepositB2TxStatusSuccess && d.B2TxStatus != model.DepositB2TxStatusTxHashExist && m.CreatedAt.Before(cutoff):
+		// the deposit may be sent again
+		detail += fmt.Sprintf("minted while b2 tx status %d; ", d.B2TxStatus)
+	}
+	if detail == "" {
+		return model.ReconciliationDiscrepancy{}, false
+	}
+	return model.ReconciliationDiscrepancy{
+		Kind:            model.DiscrepancyMintMismatch,
+		DepositID:       d.ID,
+		RollupDepositID: m.ID,
+		BtcTxHash:       d.BtcTxHash,
+		B2TxHash:        m.B2TxHash,
+		Expected:        d.BtcValue,
+		Actual:          m.BtcValue,
+		Detail:          detail,
+	}, true
+}
+
+func mismatch(value, mintValue int64, aaAddress, mintAAAddress string) string {
+	var detail string
+	if value != mintValue {
+		detail += fmt.Sprintf("value %d, minted %d; ", value, mintValue)
+	}
+	if !strings.EqualFold(aaAddress, mintAAAddress) {
+		detail += fmt.Sprintf("aa address %s, minted to %s; ", aaAddress, mintAAAddress)
+	}
+	return detail
+}
+
+func txMismatch(txHash, mintTxHash string) string {
+	if txHash == mintTxHash {
+		return ""
+	}
+	return fmt.Sprintf("abelian tx %s, minted for %s; ", txHash, mintTxHash)
+}
+
+// save writes the report and its discrepancies
+func (r *Reconciler) save(db *gorm.DB, report *Report) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&report.ReconciliationReport).Error; err != nil {
+			return err
+		}
+		if len(report.Items) == 0 {
+			return nil
+		}
+		for i := range report.Items {
+			report.Items[i].ReportID = report.ID
+			report.Items[i].Detail = strings.TrimSuffix(report.Items[i].Detail, "; ")
+			if len(report.Items[i].Detail) > maxDetailLen {
+				report.Items[i].Detail = report.Items[i].Detail[:maxDetailLen]
+			}
+		}
+		return tx.CreateInBatches(&report.Items, 100).Error
+	})
+}
+
+func (r *Reconciler) observe(report *Report) {
+	metrics.ReconcileDiscrepancies.Reset()
+	for _, kind := range []string{
+		model.DiscrepancyMissingMint, model.DiscrepancyOrphanMint, model.DiscrepancyDuplicateMint,
+		model.DiscrepancyMintMismatch, model.DiscrepancySupplyMismatch,
+	} {
+		metrics.ReconcileDiscrepancies.WithLabelValues(kind).Set(0)
+	}
+	for _, item := range report.Items {
+		metrics.ReconcileDiscrepancies.WithLabelValues(item.Kind).Inc()
+	}
+	metrics.ReconcileSupplyDiff.Set(float64(report.SupplyDiff))
+	metrics.ReconcileLastRun.Set(float64(report.FinishedAt.Unix()))
+}
+
+// alert posts the report with its first discrepancies to the alert url
+func (r *Reconciler) alert(ctx context.Context, report *Report) error {
+	if r.alertURL == "" {
+		return nil
+	}
+	alert := *report
+	if len(alert.Items) > maxAlertItems {
+		alert.Items = alert.Items[:maxAlertItems]
+	}
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.alertURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("alert response status %s", resp.Status)
+	}
+	return nil
+}
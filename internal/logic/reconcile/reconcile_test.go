@@ -0,0 +1,205 @@
+package reconcile_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/logic/reconcile"
+	"github.com/b2network/b2-indexer/internal/migration"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/storage"
+	"github.com/b2network/b2-indexer/pkg/log"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func openSqlite(t *testing.T) *gorm.DB {
+	db, err := storage.Open(&config.Config{
+		DatabaseSource: "sqlite://" + filepath.Join(t.TempDir(), "indexer.db"),
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	migrator, err := migration.New(db, log.NewNopLogger())
+	require.NoError(t, err)
+	_, err = migrator.Up(0)
+	require.NoError(t, err)
+	return db
+}
+
+func createDeposit(t *testing.T, db *gorm.DB, deposit model.Deposit, age time.Duration) model.Deposit {
+	// the zero success status is not inserted over the column default
+	status := deposit.B2TxStatus
+	require.NoError(t, db.Create(&deposit).Error)
+	deposit.B2TxStatus = status
+	at := time.Now().Add(-age)
+	require.NoError(t, db.Model(&model.Deposit{}).Where("id = ?", deposit.ID).UpdateColumns(map[string]interface{}{
+		model.Deposit{}.Column().B2TxStatus: status,
+		"created_at":                        at,
+		"updated_at":                        at,
+	}).Error)
+	return deposit
+}
+
+func createMint(t *testing.T, db *gorm.DB, btcTxHash, b2TxHash, aaAddress string, value int64) model.RollupDeposit {
+	mint := model.RollupDeposit{BtcTxHash: btcTxHash, B2TxHash: b2TxHash, BtcFromAAAddress: aaAddress, BtcValue: value}
+	require.NoError(t, db.Create(&mint).Error)
+	return mint
+}
+
+func kinds(report *reconcile.Report) map[string][]model.ReconciliationDiscrepancy {
+	items := make(map[string][]model.ReconciliationDiscrepancy)
+	for _, item := range report.Items {
+		items[item.Kind] = append(items[item.Kind], item)
+	}
+	return items
+}
+
+func TestReconcile(t *testing.T) {
+	db := openSqlite(t)
+	hour := time.Hour
+	minted := createDeposit(t, db, model.Deposit{BtcTxHash: "a", BtcValue: 10, BtcFromAAAddress: "0xAA", B2TxHash: "0x01", B2TxStatus: model.DepositB2TxStatusSuccess}, hour)
+	createMint(t, db, "a", "0x01", "0xaa", 10)
+	wrongValue := createDeposit(t, db, model.Deposit{BtcTxHash: "b", BtcValue: 20, BtcFromAAAddress: "0xaa", B2TxHash: "0x02", B2TxStatus: model.DepositB2TxStatusSuccess}, hour)
+	createMint(t, db, "b", "0x02", "0xaa", 25)
+	unminted := createDeposit(t, db, model.Deposit{BtcTxHash: "c", BtcValue: 30, B2TxStatus: model.DepositB2TxStatusInsufficientBalance}, hour)
+	// a mint found by CheckDeposit later, matched by abelian tx
+	createDeposit(t, db, model.Deposit{BtcTxHash: "d", BtcValue: 40, BtcFromAAAddress: "0xaa", B2TxStatus: model.DepositB2TxStatusTxHashExist}, hour)
+	createMint(t, db, "d", "0x04", "0xaa", 40)
+	// waiting for its confirmations or its mint event
+	createDeposit(t, db, model.Deposit{BtcTxHash: "e", BtcValue: 50, B2TxStatus: model.DepositB2TxStatusPending}, 0)
+	createDeposit(t, db, model.Deposit{BtcTxHash: "f", BtcValue: 60, BtcFromAAAddress: "0xaa", B2TxHash: "0x06", B2TxStatus: model.DepositB2TxStatusSuccess}, 0)
+	orphan := createMint(t, db, "z", "0x07", "0xaa", 70)
+	duplicate := createMint(t, db, "a", "0x08", "0xaa", 10)
+	require.NoError(t, db.Create(&model.Withdraw{B2TxHash: "0x09", BtcValue: 15}).Error)
+
+	var alerts []reconcile.Report
+	alertServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert reconcile.Report
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&alert))
+		alerts = append(alerts, alert)
+	}))
+	defer alertServer.Close()
+
+	reconciler := reconcile.NewReconciler(config.ReconcileConfig{GracePeriod: 600, AlertURL: alertServer.URL}, db, log.NewNopLogger())
+	report, err := reconciler.Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, model.ReconciliationStatusDiscrepancy, report.Status)
+	require.Equal(t, int64(6), report.Deposits)
+	require.Equal(t, int64(5), report.Mints)
+	require.Equal(t, int64(1), report.Burns)
+	require.Equal(t, int64(10+20+40+60), report.ConfirmedValue)
+	require.Equal(t, int64(10+25+40+70+10), report.MintedValue)
+	require.Equal(t, int64(15), report.BurnedValue)
+	require.Equal(t, int64(60), report.InFlightValue)
+	require.Equal(t, int64(5+70+10), report.SupplyDiff)
+
+	items := kinds(report)
+	require.Len(t, items[model.DiscrepancyMintMismatch], 1)
+	require.Equal(t, wrongValue.ID, items[model.DiscrepancyMintMismatch][0].DepositID)
+	require.Equal(t, "value 20, minted 25", items[model.DiscrepancyMintMismatch][0].Detail)
+	require.Len(t, items[model.DiscrepancyMissingMint], 1)
+	require.Equal(t, unminted.ID, items[model.DiscrepancyMissingMint][0].DepositID)
+	require.Len(t, items[model.DiscrepancyOrphanMint], 1)
+	require.Equal(t, orphan.ID, items[model.DiscrepancyOrphanMint][0].RollupDepositID)
+	require.Len(t, items[model.DiscrepancyDuplicateMint], 1)
+	require.Equal(t, duplicate.ID, items[model.DiscrepancyDuplicateMint][0].RollupDepositID)
+	require.Equal(t, "a", items[model.DiscrepancyDuplicateMint][0].BtcTxHash)
+	require.Len(t, items[model.DiscrepancySupplyMismatch], 1)
+	require.Equal(t, int64(5), report.Discrepancies)
+	require.NotEqual(t, minted.ID, items[model.DiscrepancyMintMismatch][0].DepositID)
+
+	var saved []model.ReconciliationDiscrepancy
+	require.NoError(t, db.Where("report_id = ?", report.ID).Find(&saved).Error)
+	require.Len(t, saved, 5)
+	require.Len(t, alerts, 1)
+	require.Equal(t, report.ID, alerts[0].ID)
+	require.Len(t, alerts[0].Items, 5)
+}
+
+func TestReconcileOK(t *testing.T) {
+	db := openSqlite(t)
+	// two deposits of a tx, one mint event not yet matched by its b2 tx
+	createDeposit(t, db, model.Deposit{BtcTxHash: "a", BtcValue: 10, BtcFromAAAddress: "0xaa", B2TxHash: "0x01", B2TxStatus: model.DepositB2TxStatusSuccess}, time.Hour)
+	createDeposit(t, db, model.Deposit{BtcTxHash: "a", BtcTxOutput: 1, BtcValue: 20, BtcFromAAAddress: "0xbb", B2TxStatus: model.DepositB2TxStatusTxHashExist}, time.Hour)
+	createMint(t, db, "a", "0x02", "0xbb", 20)
+	createMint(t, db, "a", "0x01", "0xaa", 10)
+	require.NoError(t, db.Create(&model.Withdraw{B2TxHash: "0x03", BtcValue: 5}).Error)
+
+	report, err := reconcile.NewReconciler(config.ReconcileConfig{GracePeriod: 600}, db, log.NewNopLogger()).Run(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, report.Items)
+	require.Equal(t, model.ReconciliationStatusOK, report.Status)
+	require.Zero(t, report.SupplyDiff)
+
+	var saved model.ReconciliationReport
+	require.NoError(t, db.First(&saved, report.ID).Error)
+	require.Equal(t, int64(30), saved.MintedValue)
+	require.Equal(t, int64(5), saved.BurnedValue)
+}
+
+func TestReconcileSupply(t *testing.T) {
+	db := openSqlite(t)
+	createDeposit(t, db, model.Deposit{BtcTxHash: "a", BtcValue: 100, BtcFromAAAddress: "0xaa", B2TxHash: "0x01", B2TxStatus: model.DepositB2TxStatusSuccess}, time.Hour)
+	createMint(t, db, "a", "0x01", "0xaa", 100)
+	// a paid withdraw leaves the custody, a withdraw being paid not yet
+	require.NoError(t, db.Create(&model.Withdraw{B2TxHash: "0x02", BtcValue: 30, Status: model.BtcTxWithdrawSuccess}).Error)
+	require.NoError(t, db.Create(&model.Withdraw{B2TxHash: "0x03", BtcValue: 20, Status: model.BtcTxWithdrawBroadcastSuccess}).Error)
+
+	reconciler := reconcile.NewReconciler(config.ReconcileConfig{GracePeriod: 600}, db, log.NewNopLogger())
+	report, err := reconciler.Run(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, report.Items)
+	require.Equal(t, int64(30), report.PaidValue)
+	require.Equal(t, int64(20), report.PayingValue)
+
+	// a burn never paid out is still held by the custody
+	require.NoError(t, db.Create(&model.Withdraw{B2TxHash: "0x04", BtcValue: 10, Status: model.BtcTxWithdrawFailed}).Error)
+	report, err = reconciler.Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(-10), report.SupplyDiff)
+	items := kinds(report)
+	require.Len(t, items[model.DiscrepancySupplyMismatch], 1)
+	require.Equal(t, int64(100-30-20), items[model.DiscrepancySupplyMismatch][0].Expected)
+	require.Equal(t, int64(100-60), items[model.DiscrepancySupplyMismatch][0].Actual)
+}
+
+func TestReconcileRefund(t *testing.T) {
+	db := openSqlite(t)
+	createDeposit(t, db, model.Deposit{BtcTxHash: "a", BtcValue: 100, BtcFromAAAddress: "0xaa", B2TxHash: "0x01", B2TxStatus: model.DepositB2TxStatusSuccess}, time.Hour)
+	createMint(t, db, "a", "0x01", "0xaa", 100)
+	// a rejected burn is not paid out, the custody holds it until the operators refund it
+	rejected := model.Withdraw{B2TxHash: "0x02", BtcValue: 40, Status: model.BtcTxWithdrawRejected}
+	require.NoError(t, db.Create(&rejected).Error)
+
+	reconciler := reconcile.NewReconciler(config.ReconcileConfig{GracePeriod: 600}, db, log.NewNopLogger())
+	report, err := reconciler.Run(context.Background())
+	require.NoError(t, err)
+	require.Zero(t, report.PayingValue)
+	require.Equal(t, int64(-40), report.SupplyDiff)
+
+	// the refund mint is sent by no deposit and is no orphan
+	createMint(t, db, "", "0x03", "0xaa", 40)
+	require.NoError(t, db.Model(&rejected).Updates(map[string]interface{}{
+		model.Withdraw{}.Column().Status:       model.BtcTxWithdrawRefunded,
+		model.Withdraw{}.Column().RefundTxHash: "0x03",
+	}).Error)
+	report, err = reconciler.Run(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, report.Items)
+
+	// another mint sent by no deposit still is
+	createMint(t, db, "", "0x04", "0xaa", 40)
+	report, err = reconciler.Run(context.Background())
+	require.NoError(t, err)
+	items := kinds(report)
+	require.Len(t, items[model.DiscrepancyOrphanMint], 1)
+	require.Equal(t, "0x04", items[model.DiscrepancyOrphanMint][0].B2TxHash)
+}
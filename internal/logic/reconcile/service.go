@@ -0,0 +1,70 @@
+package reconcile
+
+import (
+	"context"
+	"time"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/supervisor"
+	"github.com/b2network/b2-indexer/pkg/log"
+	"github.com/cometbft/cometbft/libs/service"
+	"gorm.io/gorm"
+)
+
+const ServiceName = "ReconcileService"
+
+// Service reconciles every interval, with leader election the leader runs it
+type Service struct {
+	service.BaseService
+
+	reconciler *Reconciler
+	interval   time.Duration
+	log        log.Logger
+	loops      *supervisor.Loops
+}
+
+// NewService returns a service reconciling the deposits of db every interval
+func NewService(cfg config.ReconcileConfig, db *gorm.DB, log log.Logger) *Service {
+	s := &Service{
+		reconciler: NewReconciler(cfg, db, log),
+		interval:   time.Duration(cfg.Interval) * time.Second,
+		log:        log,
+	}
+	s.BaseService = *service.NewBaseService(nil, ServiceName, s)
+	return s
+}
+
+// OnStart implements service.Service
+func (s *Service) OnStart() error {
+	s.loops = supervisor.NewLoops()
+	s.loops.Go(s.reconcile)
+	return nil
+}
+
+// OnStop waits for the run in progress
+func (s *Service) OnStop() {
+	s.log.Warnf("Reconcile stopping...")
+	s.loops.Stop()
+}
+
+// Crashed implements supervisor.Service
+func (s *Service) Crashed() <-chan struct{} {
+	return s.loops.Crashed()
+}
+
+// Err implements supervisor.Service
+func (s *Service) Err() error {
+	return s.loops.Err()
+}
+
+// reconcile runs at start and every interval until the service stops, a failed run waits for the next
+func (s *Service) reconcile() error {
+	for {
+		if _, err := s.reconciler.Run(context.Background()); err != nil {
+			s.log.Errorw("reconciliation failed", "error", err)
+		}
+		if !s.loops.Sleep(s.interval) {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,390 @@
+// Package reserves builds the signed proof-of-reserves report: the wABEL supply on l2
+// against the ABEL the bridge holds at its abelian custody address, with the deposit and
+// withdraw ledger of the indexer db.
+package reserves
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/pkg/log"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tidwall/gjson"
+	"gorm.io/gorm"
+)
+
+// abelDecimals is the decimals of ABE, the deposits and the withdraws are in its base unit
+const abelDecimals = 7
+
+var (
+	ErrNoSignerKey      = errors.New("reserves: no signer-key configured")
+	ErrInvalidSignature = errors.New("reserves: invalid signature")
+	ErrInvalidBalance   = errors.New("reserves: invalid custody balance")
+)
+
+// weiPerUnit is the wABEL wei minted for a base unit of ABE, see Bridge.Deposit
+var weiPerUnit = big.NewInt(1e11)
+
+// erc20ABI is the part of the wABEL abi the report reads
+const erc20ABI = `[
+	{"inputs":[],"name":"totalSupply","outputs":[{"internalType":"uint256","name":"","type":"uint256"}],"stateMutability":"view","type":"function"},
+	{"inputs":[{"internalType":"address","name":"account","type":"address"}],"name":"balanceOf","outputs":[{"internalType":"uint256","name":"","type":"uint256"}],"stateMutability":"view","type":"function"}
+]`
+
+// L2Client is the part of an ethclient the report reads, the contract calls are made at
+// one block so the supply and the balances are of the same state
+type L2Client interface {
+	ChainID(ctx context.Context) (*big.Int, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*ethtypes.Header, error)
+	CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+}
+
+// AbelianNode is the part of the abelian indexer the report reads
+type AbelianNode interface {
+	BestBlock() (int64, string, error)
+	Call(method string, params []interface{}) ([]byte, error)
+}
+
+// Report is the state of both chains and of the ledger at the heights it names. The
+// values are in the base unit of ABE, the raw wABEL amounts in wei.
+type Report struct {
+	GeneratedAt time.Time       `json:"generated_at"`
+	L2          L2Reserves      `json:"l2"`
+	Abelian     AbelianReserves `json:"abelian"`
+	Ledger      Ledger          `json:"ledger"`
+	// Surplus is the custody balance less the outstanding wABEL, negative when under-collateralized
+	Surplus int64 `json:"surplus"`
+	// LedgerDiff is the outstanding wABEL less the outstanding ledger, 0 when the l2 and the db agree
+	LedgerDiff int64 `json:"ledger_diff"`
+	// Backed reports whether the custody balance covers the outstanding wABEL
+	Backed bool `json:"backed"`
+}
+
+// L2Reserves is the wABEL supply at an l2 block
+type L2Reserves struct {
+	ChainID     string `json:"chain_id"`
+	BlockNumber uint64 `json:"block_number"`
+	BlockHash   string `json:"block_hash"`
+	Bridge      string `json:"bridge"`
+	WAbel       string `json:"wabel"`
+	TotalSupply string `json:"total_supply"`
+	// BridgeBalance is the wABEL the bridge contract holds, no claim on the reserves
+	BridgeBalance string `json:"bridge_balance"`
+	// Outstanding is the supply less the bridge balance, rounded up to a base unit
+	Outstanding int64 `json:"outstanding"`
+}
+
+// AbelianReserves is the custody balance at an abelian block
+type AbelianReserves struct {
+	Height         int64  `json:"height"`
+	BlockHash      string `json:"block_hash"`
+	CustodyAddress string `json:"custody_address"`
+	Balance        int64  `json:"balance"`
+}
+
+// Ledger is the deposits and the withdraws indexed in the db
+type Ledger struct {
+	ConfirmedDeposits  int64 `json:"confirmed_deposits"`
+	CompletedWithdraws int64 `json:"completed_withdraws"`
+	Outstanding        int64 `json:"outstanding"`
+}
+
+// SignedReport is a report and the eip-191 personal_sign signature of its compact json
+type SignedReport struct {
+	Report    json.RawMessage `json:"report"`
+	Signer    string          `json:"signer"`
+	Signature string          `json:"signature"`
+}
+
+// Reporter builds and signs the reports, and caches the latest for the http api
+type Reporter struct {
+	db            *gorm.DB
+	l2            L2Client
+	node          AbelianNode
+	erc20         abi.ABI
+	bridgeABI     abi.ABI
+	bridge        common.Address
+	wAbel         common.Address
+	custody       string
+	balanceMethod string
+	key           *ecdsa.PrivateKey
+	cacheTTL      time.Duration
+	log           log.Logger
+
+	mu       sync.Mutex
+	cached   *SignedReport
+	cachedAt time.Time
+}
+
+// NewReporter returns a reporter of the bridge of bitcoinCfg signing with its reserves signer-key
+func NewReporter(bitcoinCfg *config.BitcoinConfig, db *gorm.DB, l2 L2Client, node AbelianNode, log log.Logger) (*Reporter, error) {
+	cfg := bitcoinCfg.Bridge.Reserves
+	if cfg.SignerKey == "" {
+		return nil, ErrNoSignerKey
+	}
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(cfg.SignerKey, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("reserves: signer-key: %w", err)
+	}
+	erc20, err := abi.JSON(strings.NewReader(erc20ABI))
+	if err != nil {
+		return nil, err
+	}
+	bridgeABI, err := abi.JSON(strings.NewReader(config.DefaultDepositAbi))
+	if err != nil {
+		return nil, err
+	}
+	custody := cfg.CustodyAddress
+	if custody == "" {
+		custody = bitcoinCfg.IndexerListenAddress
+	}
+	r := &Reporter{
+		db:            db,
+		l2:            l2,
+		node:          node,
+		erc20:         erc20,
+		bridgeABI:     bridgeABI,
+		bridge:        common.HexToAddress(bitcoinCfg.Bridge.ContractAddress),
+		custody:       custody,
+		balanceMethod: cfg.BalanceMethod,
+		key:           key,
+		cacheTTL:      time.Duration(cfg.CacheTTL) * time.Second,
+		log:           log,
+	}
+	if cfg.WAbelAddress != "" {
+		r.wAbel = common.HexToAddress(cfg.WAbelAddress)
+	}
+	return r, nil
+}
+
+// Signer returns the address of the signer-key
+func (r *Reporter) Signer() common.Address {
+	return crypto.PubkeyToAddress(r.key.PublicKey)
+}
+
+// Latest returns the cached report while it is younger than cache-ttl, else a new one
+func (r *Reporter) Latest(ctx context.Context) (*SignedReport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cached != nil && time.Since(r.cachedAt) < r.cacheTTL {
+		return r.cached, nil
+	}
+	signed, err := r.Build(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.cached, r.cachedAt = signed, time.Now()
+	return signed, nil
+}
+
+// Build reads both chains and the ledger and signs the report. The l2 state is pinned to
+// one block, the abelian tip and the balance are read right after it.
+func (r *Reporter) Build(ctx context.Context) (*SignedReport, error) {
+	report := &Report{GeneratedAt: time.Now().UTC().Truncate(time.Second)}
+	if err := r.readL2(ctx, &report.L2); err != nil {
+		return nil, err
+	}
+	if err := r.readAbelian(&report.Abelian); err != nil {
+		return nil, err
+	}
+	if err := r.readLedger(ctx, &report.Ledger); err != nil {
+		return nil, err
+	}
+	report.Surplus = report.Abelian.Balance - report.L2.Outstanding
+	report.LedgerDiff = report.L2.Outstanding - report.Ledger.Outstanding
+	report.Backed = report.Surplus >= 0
+	if !report.Backed {
+		r.log.Warnw("reserves do not cover the wABEL supply",
+			"outstanding", report.L2.Outstanding, "balance", report.Abelian.Balance, "surplus", report.Surplus)
+	}
+	return Sign(report, r.key)
+}
+
+func (r *Reporter) readL2(ctx context.Context, l2 *L2Reserves) error {
+	chainID, err := r.l2.ChainID(ctx)
+	if err != nil {
+		return fmt.Errorf("reserves: l2 chain id: %w", err)
+	}
+	header, err := r.l2.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("reserves: l2 head: %w", err)
+	}
+	block := header.Number
+	l2.ChainID = chainID.String()
+	l2.BlockNumber = block.Uint64()
+	l2.BlockHash = header.Hash().Hex()
+	l2.Bridge = r.bridge.Hex()
+
+	wAbel := r.wAbel
+	if wAbel == (common.Address{}) {
+		out, err := r.call(ctx, r.bridgeABI, r.bridge, block, "wAbel")
+		if err != nil {
+			return err
+		}
+		wAbel = out[0].(common.Address)
+	}
+	l2.WAbel = wAbel.Hex()
+
+	out, err := r.call(ctx, r.erc20, wAbel, block, "totalSupply")
+	if err != nil {
+		return err
+	}
+	supply := out[0].(*big.Int)
+	if out, err = r.call(ctx, r.erc20, wAbel, block, "balanceOf", r.bridge); err != nil {
+		return err
+	}
+	bridgeBalance := out[0].(*big.Int)
+	l2.TotalSupply = supply.String()
+	l2.BridgeBalance = bridgeBalance.String()
+
+	outstanding := new(big.Int).Sub(supply, bridgeBalance)
+	units, rem := new(big.Int).QuoRem(outstanding, weiPerUnit, new(big.Int))
+	if rem.Sign() > 0 {
+		units.Add(units, big.NewInt(1))
+	}
+	if !units.IsInt64() {
+		return fmt.Errorf("reserves: outstanding wABEL %s out of range", outstanding)
+	}
+	l2.Outstanding = units.Int64()
+	return nil
+}
+
+func (r *Reporter) call(ctx context.Context, contract abi.ABI, to common.Address, block *big.Int, method string, args ...interface{}) ([]interface{}, error) {
+	data, err := contract.Pack(method, args...)
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.l2.CallContract(ctx, ethereum.CallMsg{To: &to, Data: data}, block)
+	if err != nil {
+		return nil, fmt.Errorf("reserves: l2 %s: %w", method, err)
+	}
+	out, err := contract.Unpack(method, res)
+	if err != nil {
+		return nil, fmt.Errorf("reserves: l2 %s: %w", method, err)
+	}
+	return out, nil
+}
+
+func (r *Reporter) readAbelian(abelian *AbelianReserves) error {
+	height, hash, err := r.node.BestBlock()
+	if err != nil {
+		return fmt.Errorf("reserves: abelian tip: %w", err)
+	}
+	res, err := r.node.Call(r.balanceMethod, nil)
+	if err != nil {
+		return fmt.Errorf("reserves: abelian balance: %w", err)
+	}
+	balance, err := parseBalance(res)
+	if err != nil {
+		return err
+	}
+	abelian.Height, abelian.BlockHash = height, hash
+	abelian.CustodyAddress = r.custody
+	abelian.Balance = balance
+	return nil
+}
+
+// parseBalance reads a balance in ABE, a number or an array whose first element is the
+// total, into base units without going through a float
+func parseBalance(res []byte) (int64, error) {
+	value := gjson.ParseBytes(res)
+	if value.IsArray() {
+		value = value.Get("0")
+	}
+	if value.Type != gjson.Number {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidBalance, res)
+	}
+	whole, frac, _ := strings.Cut(value.Raw, ".")
+	if len(frac) > abelDecimals || strings.ContainsAny(value.Raw, "eE-") {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidBalance, value.Raw)
+	}
+	units, ok := new(big.Int).SetString(whole+frac+strings.Repeat("0", abelDecimals-len(frac)), 10)
+	if !ok || !units.IsInt64() {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidBalance, value.Raw)
+	}
+	return units.Int64(), nil
+}
+
+func (r *Reporter) readLedger(ctx context.Context, ledger *Ledger) error {
+	db := r.db.WithContext(ctx)
+	err := db.Model(&model.Deposit{}).
+		Select("COALESCE(SUM(btc_value), 0)").
+		Where(fmt.Sprintf("%s IN ?", model.Deposit{}.Column().B2TxStatus),
+			[]int{model.DepositB2TxStatusSuccess, model.DepositB2TxStatusTxHashExist}).
+		Scan(&ledger.ConfirmedDeposits).Error
+	if err != nil {
+		return err
+	}
+	err = db.Model(&model.Withdraw{}).
+		Select("COALESCE(SUM(btc_value), 0)").
+		Where(fmt.Sprintf("%s = ?", model.Withdraw{}.Column().Status), model.BtcTxWithdrawSuccess).
+		Scan(&ledger.CompletedWithdraws).Error
+	if err != nil {
+		return err
+	}
+	ledger.Outstanding = ledger.ConfirmedDeposits - ledger.CompletedWithdraws
+	return nil
+}
+
+// Sign signs the json of report with key
+func Sign(report *Report, key *ecdsa.PrivateKey) (*SignedReport, error) {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := crypto.Sign(accounts.TextHash(body), key)
+	if err != nil {
+		return nil, err
+	}
+	// personal_sign v
+	sig[crypto.RecoveryIDOffset] += 27
+	return &SignedReport{
+		Report:    body,
+		Signer:    crypto.PubkeyToAddress(key.PublicKey).Hex(),
+		Signature: hexutil.Encode(sig),
+	}, nil
+}
+
+// Verify checks the signature of signed is by its signer and returns the report
+func Verify(signed *SignedReport) (*Report, error) {
+	sig, err := hexutil.Decode(signed.Signature)
+	if err != nil || len(sig) != crypto.SignatureLength {
+		return nil, ErrInvalidSignature
+	}
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+	// an indented copy of the report verifies as well
+	body := &bytes.Buffer{}
+	if err = json.Compact(body, signed.Report); err != nil {
+		return nil, err
+	}
+	pub, err := crypto.SigToPub(accounts.TextHash(body.Bytes()), sig)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	if !common.IsHexAddress(signed.Signer) || crypto.PubkeyToAddress(*pub) != common.HexToAddress(signed.Signer) {
+		return nil, ErrInvalidSignature
+	}
+	report := &Report{}
+	if err = json.Unmarshal(body.Bytes(), report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
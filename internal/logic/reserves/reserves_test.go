@@ -0,0 +1,268 @@
+package reserves_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/logic/indexer"
+	"github.com/b2network/b2-indexer/internal/logic/reserves"
+	"github.com/b2network/b2-indexer/internal/migration"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/storage"
+	"github.com/b2network/b2-indexer/internal/testutil/abecmock"
+	"github.com/b2network/b2-indexer/pkg/log"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+const (
+	signerKey = "4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318"
+	bridge    = "0x0000000000000000000000000000000000000b21"
+	wAbel     = "0x000000000000000000000000000000000000a8e1"
+)
+
+// wei is units of ABE as wABEL wei
+func wei(units int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(units), big.NewInt(1e11))
+}
+
+// fakeL2 answers the wAbel, totalSupply and balanceOf calls, and records their blocks
+type fakeL2 struct {
+	t             *testing.T
+	head          *ethtypes.Header
+	supply        *big.Int
+	bridgeBalance *big.Int
+	bridgeABI     abi.ABI
+	erc20ABI      abi.ABI
+	blocks        []uint64
+}
+
+func newFakeL2(t *testing.T, supply, bridgeBalance *big.Int) *fakeL2 {
+	bridgeABI, err := abi.JSON(strings.NewReader(config.DefaultDepositAbi))
+	require.NoError(t, err)
+	erc20ABI, err := abi.JSON(strings.NewReader(`[
+		{"inputs":[],"name":"totalSupply","outputs":[{"type":"uint256"}],"stateMutability":"view","type":"function"},
+		{"inputs":[{"name":"account","type":"address"}],"name":"balanceOf","outputs":[{"type":"uint256"}],"stateMutability":"view","type":"function"}
+	]`))
+	require.NoError(t, err)
+	return &fakeL2{
+		t:             t,
+		head:          &ethtypes.Header{Number: big.NewInt(4242), Difficulty: big.NewInt(0)},
+		supply:        supply,
+		bridgeBalance: bridgeBalance,
+		bridgeABI:     bridgeABI,
+		erc20ABI:      erc20ABI,
+	}
+}
+
+func (f *fakeL2) ChainID(context.Context) (*big.Int, error) {
+	return big.NewInt(1123), nil
+}
+
+func (f *fakeL2) HeaderByNumber(_ context.Context, number *big.Int) (*ethtypes.Header, error) {
+	require.Nil(f.t, number)
+	return f.head, nil
+}
+
+func (f *fakeL2) CallContract(_ context.Context, msg ethereum.CallMsg, block *big.Int) ([]byte, error) {
+	f.blocks = append(f.blocks, block.Uint64())
+	switch {
+	case bytes.Equal(msg.Data, f.bridgeABI.Methods["wAbel"].ID):
+		require.Equal(f.t, common.HexToAddress(bridge), *msg.To)
+		return f.bridgeABI.Methods["wAbel"].Outputs.Pack(common.HexToAddress(wAbel))
+	case bytes.Equal(msg.Data, f.erc20ABI.Methods["totalSupply"].ID):
+		require.Equal(f.t, common.HexToAddress(wAbel), *msg.To)
+		return f.erc20ABI.Methods["totalSupply"].Outputs.Pack(f.supply)
+	case bytes.HasPrefix(msg.Data, f.erc20ABI.Methods["balanceOf"].ID):
+		args, err := f.erc20ABI.Methods["balanceOf"].Inputs.Unpack(msg.Data[4:])
+		require.NoError(f.t, err)
+		require.Equal(f.t, common.HexToAddress(bridge), args[0])
+		return f.erc20ABI.Methods["balanceOf"].Outputs.Pack(f.bridgeBalance)
+	}
+	return nil, ethereum.NotFound
+}
+
+func openSqlite(t *testing.T) *gorm.DB {
+	db, err := storage.Open(&config.Config{
+		DatabaseSource: "sqlite://" + filepath.Join(t.TempDir(), "indexer.db"),
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	migrator, err := migration.New(db, log.NewNopLogger())
+	require.NoError(t, err)
+	_, err = migrator.Up(0)
+	require.NoError(t, err)
+	return db
+}
+
+func createDeposit(t *testing.T, db *gorm.DB, btcTxHash string, value int64, status int) {
+	deposit := model.Deposit{BtcTxHash: btcTxHash, BtcValue: value}
+	require.NoError(t, db.Create(&deposit).Error)
+	// the zero success status is not inserted over the column default
+	require.NoError(t, db.Model(&model.Deposit{}).Where("id = ?", deposit.ID).
+		UpdateColumn(model.Deposit{}.Column().B2TxStatus, status).Error)
+}
+
+func createWithdraw(t *testing.T, db *gorm.DB, b2TxHash string, value int64, status int) {
+	require.NoError(t, db.Create(&model.Withdraw{B2TxHash: b2TxHash, BtcValue: value, Status: status}).Error)
+}
+
+type fixture struct {
+	db       *gorm.DB
+	node     *abecmock.Node
+	l2       *fakeL2
+	reporter *reserves.Reporter
+}
+
+func newFixture(t *testing.T, supply, bridgeBalance *big.Int, edit func(*config.BitcoinConfig)) *fixture {
+	f := &fixture{db: openSqlite(t), node: abecmock.New(t), l2: newFakeL2(t, supply, bridgeBalance)}
+	f.node.AddBlocks(9)
+	bitcoinCfg := &config.BitcoinConfig{
+		RPCHost:              f.node.URL(),
+		IndexerListenAddress: "abe-custody",
+		Bridge: config.BridgeConfig{
+			ContractAddress: bridge,
+			Reserves: config.ReservesConfig{
+				SignerKey:     "0x" + signerKey,
+				BalanceMethod: "getbalancesabe",
+				CacheTTL:      60,
+			},
+		},
+	}
+	if edit != nil {
+		edit(bitcoinCfg)
+	}
+	node, err := indexer.NewAbelianIndexer(log.NewNopLogger(), bitcoinCfg, bitcoinCfg.IndexerListenAddress, 1)
+	require.NoError(t, err)
+	f.reporter, err = reserves.NewReporter(bitcoinCfg, f.db, f.l2, node.(*indexer.AbelianIndexer), log.NewNopLogger())
+	require.NoError(t, err)
+	return f
+}
+
+func TestReportBacked(t *testing.T) {
+	f := newFixture(t, wei(1200_0000000), wei(100_0000000), nil)
+	f.node.SetBalance("1100.0000001")
+	createDeposit(t, f.db, "btc-1", 700_0000000, model.DepositB2TxStatusSuccess)
+	createDeposit(t, f.db, "btc-2", 500_0000000, model.DepositB2TxStatusTxHashExist)
+	createDeposit(t, f.db, "btc-3", 900_0000000, model.DepositB2TxStatusFailed)
+	createWithdraw(t, f.db, "b2-1", 100_0000000, model.BtcTxWithdrawSuccess)
+	createWithdraw(t, f.db, "b2-2", 50_0000000, model.BtcTxWithdrawPending)
+
+	signed, err := f.reporter.Build(context.Background())
+	require.NoError(t, err)
+	key, err := crypto.HexToECDSA(signerKey)
+	require.NoError(t, err)
+	require.Equal(t, crypto.PubkeyToAddress(key.PublicKey).Hex(), signed.Signer)
+
+	report, err := reserves.Verify(signed)
+	require.NoError(t, err)
+	require.Equal(t, "1123", report.L2.ChainID)
+	require.Equal(t, uint64(4242), report.L2.BlockNumber)
+	require.Equal(t, f.l2.head.Hash().Hex(), report.L2.BlockHash)
+	require.Equal(t, common.HexToAddress(wAbel).Hex(), report.L2.WAbel)
+	require.Equal(t, wei(1200_0000000).String(), report.L2.TotalSupply)
+	require.Equal(t, int64(1100_0000000), report.L2.Outstanding)
+	// every call is at the pinned block
+	require.Equal(t, []uint64{4242, 4242, 4242}, f.l2.blocks)
+
+	require.Equal(t, int64(9), report.Abelian.Height)
+	require.NotEmpty(t, report.Abelian.BlockHash)
+	require.Equal(t, "abe-custody", report.Abelian.CustodyAddress)
+	require.Equal(t, int64(1100_0000001), report.Abelian.Balance)
+
+	require.Equal(t, reserves.Ledger{
+		ConfirmedDeposits:  1200_0000000,
+		CompletedWithdraws: 100_0000000,
+		Outstanding:        1100_0000000,
+	}, report.Ledger)
+	require.Equal(t, int64(1), report.Surplus)
+	require.Zero(t, report.LedgerDiff)
+	require.True(t, report.Backed)
+}
+
+func TestReportUnderCollateralized(t *testing.T) {
+	// a wei of dust counts as a whole unit against the reserves
+	supply := new(big.Int).Add(wei(500_0000000), big.NewInt(1))
+	f := newFixture(t, supply, big.NewInt(0), func(cfg *config.BitcoinConfig) {
+		cfg.Bridge.Reserves.WAbelAddress = wAbel
+		cfg.Bridge.Reserves.CustodyAddress = "abe-cold"
+	})
+	f.node.SetBalance("500")
+	createDeposit(t, f.db, "btc-1", 400_0000000, model.DepositB2TxStatusSuccess)
+
+	signed, err := f.reporter.Build(context.Background())
+	require.NoError(t, err)
+	report, err := reserves.Verify(signed)
+	require.NoError(t, err)
+	// the configured wabel-address is not read from the bridge
+	require.Equal(t, []uint64{4242, 4242}, f.l2.blocks)
+	require.Equal(t, "abe-cold", report.Abelian.CustodyAddress)
+	require.Equal(t, int64(500_0000001), report.L2.Outstanding)
+	require.Equal(t, int64(-1), report.Surplus)
+	require.Equal(t, int64(100_0000001), report.LedgerDiff)
+	require.False(t, report.Backed)
+}
+
+func TestReportInvalidBalance(t *testing.T) {
+	f := newFixture(t, wei(1), big.NewInt(0), nil)
+	for _, balance := range []string{`"1"`, "1.00000001", "-1", "1e3"} {
+		f.node.SetBalance(balance)
+		_, err := f.reporter.Build(context.Background())
+		require.ErrorIs(t, err, reserves.ErrInvalidBalance, balance)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	f := newFixture(t, wei(10), big.NewInt(0), nil)
+	f.node.SetBalance("10")
+	signed, err := f.reporter.Build(context.Background())
+	require.NoError(t, err)
+
+	// the signature survives the indented output of the command
+	out, err := json.MarshalIndent(signed, "", "  ")
+	require.NoError(t, err)
+	printed := &reserves.SignedReport{}
+	require.NoError(t, json.Unmarshal(out, printed))
+	_, err = reserves.Verify(printed)
+	require.NoError(t, err)
+
+	tampered := *signed
+	tampered.Report = bytes.Replace(signed.Report, []byte(`"backed":true`), []byte(`"backed":false`), 1)
+	require.NotEqual(t, signed.Report, tampered.Report)
+	_, err = reserves.Verify(&tampered)
+	require.ErrorIs(t, err, reserves.ErrInvalidSignature)
+
+	otherSigner := *signed
+	otherSigner.Signer = bridge
+	_, err = reserves.Verify(&otherSigner)
+	require.ErrorIs(t, err, reserves.ErrInvalidSignature)
+}
+
+func TestLatestCached(t *testing.T) {
+	f := newFixture(t, wei(10), big.NewInt(0), nil)
+	f.node.SetBalance("10")
+	first, err := f.reporter.Latest(context.Background())
+	require.NoError(t, err)
+	second, err := f.reporter.Latest(context.Background())
+	require.NoError(t, err)
+	require.Same(t, first, second)
+	require.Len(t, f.l2.blocks, 3)
+}
+
+func TestNewReporterWithoutKey(t *testing.T) {
+	_, err := reserves.NewReporter(&config.BitcoinConfig{}, nil, nil, nil, log.NewNopLogger())
+	require.ErrorIs(t, err, reserves.ErrNoSignerKey)
+}
@@ -0,0 +1,112 @@
+package risk
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/migration"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/storage"
+	"github.com/b2network/b2-indexer/pkg/log"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func openSqlite(t *testing.T) *gorm.DB {
+	db, err := storage.Open(&config.Config{
+		DatabaseSource: "sqlite://" + filepath.Join(t.TempDir(), "indexer.db"),
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	migrator, err := migration.New(db, log.NewNopLogger())
+	require.NoError(t, err)
+	_, err = migrator.Up(0)
+	require.NoError(t, err)
+	return db
+}
+
+func createWithdraw(t *testing.T, db *gorm.DB, withdraw model.Withdraw) model.Withdraw {
+	var n int64
+	require.NoError(t, db.Model(&model.Withdraw{}).Count(&n).Error)
+	withdraw.B2TxHash = fmt.Sprintf("0x%02x", n+1)
+	require.NoError(t, db.Create(&withdraw).Error)
+	return withdraw
+}
+
+func riskStatus(t *testing.T, db *gorm.DB, withdraw model.Withdraw) int {
+	require.NoError(t, db.First(&withdraw, withdraw.ID).Error)
+	return withdraw.RiskStatus
+}
+
+func TestEngineLists(t *testing.T) {
+	db := openSqlite(t)
+	engine := NewEngine(config.RiskConfig{
+		DenyList:          []string{"abeDenied"},
+		AllowList:         []string{"abeAllowed"},
+		ApprovalThreshold: 100,
+	}, &chaincfg.MainNetParams, db, log.NewNopLogger())
+	denied := createWithdraw(t, db, model.Withdraw{BtcTo: "abeDenied", BtcValue: 10})
+	// abelian addresses differing by case are distinct addresses
+	otherCase := createWithdraw(t, db, model.Withdraw{BtcTo: "abedenied", BtcValue: 10})
+	allowed := createWithdraw(t, db, model.Withdraw{BtcTo: "abeAllowed", BtcValue: 200})
+	notAllowed := createWithdraw(t, db, model.Withdraw{BtcTo: "abeallowed", BtcValue: 200})
+
+	require.NoError(t, engine.CheckPending())
+	require.Equal(t, model.WithdrawRiskRejected, riskStatus(t, db, denied))
+	require.Equal(t, model.WithdrawRiskPassed, riskStatus(t, db, otherCase))
+	require.Equal(t, model.WithdrawRiskPassed, riskStatus(t, db, allowed))
+	require.Equal(t, model.WithdrawRiskAwaitingApproval, riskStatus(t, db, notAllowed))
+
+	var rejected model.Withdraw
+	require.NoError(t, db.First(&rejected, denied.ID).Error)
+	require.Equal(t, model.BtcTxWithdrawRejected, rejected.Status)
+	require.Equal(t, "destination address denied", rejected.RiskReason)
+	require.Equal(t, EngineReviewer, rejected.RiskReviewer)
+}
+
+func TestEngineVelocity(t *testing.T) {
+	db := openSqlite(t)
+	engine := NewEngine(config.RiskConfig{AddressHourLimit: 100}, &chaincfg.MainNetParams, db, log.NewNopLogger())
+	// paid within the hour and before it
+	createWithdraw(t, db, model.Withdraw{BtcTo: "abeRecent", BtcValue: 80, RiskStatus: model.WithdrawRiskPassed, RiskCheckedAt: time.Now().Add(-30 * time.Minute)})
+	createWithdraw(t, db, model.Withdraw{BtcTo: "abeOld", BtcValue: 80, RiskStatus: model.WithdrawRiskApproved, RiskCheckedAt: time.Now().Add(-2 * time.Hour)})
+	overLimit := createWithdraw(t, db, model.Withdraw{BtcTo: "abeRecent", BtcValue: 30})
+	otherCase := createWithdraw(t, db, model.Withdraw{BtcTo: "aberecent", BtcValue: 30})
+	outOfWindow := createWithdraw(t, db, model.Withdraw{BtcTo: "abeOld", BtcValue: 30})
+
+	require.NoError(t, engine.CheckPending())
+	require.Equal(t, model.WithdrawRiskAwaitingApproval, riskStatus(t, db, overLimit))
+	require.Equal(t, model.WithdrawRiskPassed, riskStatus(t, db, otherCase))
+	require.Equal(t, model.WithdrawRiskPassed, riskStatus(t, db, outOfWindow))
+
+	// the passed withdraw counts for the next one
+	next := createWithdraw(t, db, model.Withdraw{BtcTo: "abeOld", BtcValue: 80})
+	require.NoError(t, engine.CheckPending())
+	require.Equal(t, model.WithdrawRiskAwaitingApproval, riskStatus(t, db, next))
+}
+
+func TestEngineReject(t *testing.T) {
+	db := openSqlite(t)
+	engine := NewEngine(config.RiskConfig{}, &chaincfg.MainNetParams, db, log.NewNopLogger())
+	held := createWithdraw(t, db, model.Withdraw{BtcTo: "abeHeld", BtcValue: 10, RiskStatus: model.WithdrawRiskAwaitingApproval})
+
+	_, err := engine.Reject(held.ID, "alice", " ")
+	require.ErrorIs(t, err, ErrReasonRequired)
+	require.Equal(t, model.WithdrawRiskAwaitingApproval, riskStatus(t, db, held))
+
+	rejected, err := engine.Reject(held.ID, "alice", "sanctioned counterparty")
+	require.NoError(t, err)
+	require.Equal(t, model.WithdrawRiskRejected, rejected.RiskStatus)
+	require.Equal(t, model.BtcTxWithdrawRejected, rejected.Status)
+	require.Equal(t, "sanctioned counterparty", rejected.RiskReason)
+	require.Equal(t, "alice", rejected.RiskReviewer)
+
+	_, err = engine.Reject(held.ID, "alice", "again")
+	require.ErrorIs(t, err, ErrNotAwaitingApproval)
+}
@@ -0,0 +1,280 @@
+package risk
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/storage"
+	"github.com/b2network/b2-indexer/pkg/log"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrWithdrawNotFound    = errors.New("withdraw not found")
+	ErrNotAwaitingApproval = errors.New("withdraw is not awaiting approval")
+	ErrReviewerRequired    = errors.New("reviewer is required")
+	ErrReasonRequired      = errors.New("rejection reason is required")
+)
+
+// EngineReviewer is the reviewer of the withdraws rejected by the rules
+const EngineReviewer = "risk-engine"
+
+// Rules are the withdraw risk rules, values in satoshi, 0 disables a limit
+type Rules struct {
+	DenyList          map[string]bool
+	AllowList         map[string]bool
+	MaxWithdrawValue  int64
+	ApprovalThreshold int64
+	AddressHourLimit  int64
+	AddressDayLimit   int64
+	GlobalHourLimit   int64
+	GlobalDayLimit    int64
+}
+
+// Usage is the withdraw value already passed or approved in the velocity windows
+type Usage struct {
+	AddressHour int64
+	AddressDay  int64
+	GlobalHour  int64
+	GlobalDay   int64
+}
+
+// Decision is the outcome of a risk check
+type Decision struct {
+	// Status is model.WithdrawRiskPassed, model.WithdrawRiskAwaitingApproval or model.WithdrawRiskRejected
+	Status int
+	Reason string
+}
+
+// Evaluate checks a withdraw to address against the rules.
+// Denied addresses and oversized withdraws are rejected, allow listed addresses pass,
+// withdraws over the approval threshold or a velocity limit await manual approval.
+func Evaluate(address string, value int64, rules Rules, usage Usage) Decision {
+	if rules.DenyList[address] {
+		return Decision{Status: model.WithdrawRiskRejected, Reason: "destination address denied"}
+	}
+	if rules.MaxWithdrawValue > 0 && value > rules.MaxWithdrawValue {
+		return Decision{
+			Status: model.WithdrawRiskRejected,
+			Reason: fmt.Sprintf("value %d over max withdraw value %d", value, rules.MaxWithdrawValue),
+		}
+	}
+	if rules.AllowList[address] {
+		return Decision{Status: model.WithdrawRiskPassed}
+	}
+	if rules.ApprovalThreshold > 0 && value >= rules.ApprovalThreshold {
+		return Decision{
+			Status: model.WithdrawRiskAwaitingApproval,
+			Reason: fmt.Sprintf("value %d over approval threshold %d", value, rules.ApprovalThreshold),
+		}
+	}
+	limits := []struct {
+		name  string
+		used  int64
+		limit int64
+	}{
+		{"address hourly", usage.AddressHour, rules.AddressHourLimit},
+		{"address daily", usage.AddressDay, rules.AddressDayLimit},
+		{"global hourly", usage.GlobalHour, rules.GlobalHourLimit},
+		{"global daily", usage.GlobalDay, rules.GlobalDayLimit},
+	}
+	for _, l := range limits {
+		if l.limit > 0 && l.used+value > l.limit {
+			return Decision{
+				Status: model.WithdrawRiskAwaitingApproval,
+				Reason: fmt.Sprintf("%s velocity limit exceeded: %d + %d > %d", l.name, l.used, value, l.limit),
+			}
+		}
+	}
+	return Decision{Status: model.WithdrawRiskPassed}
+}
+
+// Engine checks pending withdraws before they are paid and handles manual approvals
+type Engine struct {
+	db     *gorm.DB
+	store  storage.Store
+	rules  Rules
+	params *chaincfg.Params
+	log    log.Logger
+}
+
+// NewEngine returns a risk engine with the rules of riskCfg
+func NewEngine(riskCfg config.RiskConfig, params *chaincfg.Params, db *gorm.DB, log log.Logger) *Engine {
+	e := &Engine{db: db, store: storage.New(db), params: params, log: log}
+	e.rules = Rules{
+		DenyList:          e.addressSet(riskCfg.DenyList),
+		AllowList:         e.addressSet(riskCfg.AllowList),
+		MaxWithdrawValue:  riskCfg.MaxWithdrawValue,
+		ApprovalThreshold: riskCfg.ApprovalThreshold,
+		AddressHourLimit:  riskCfg.AddressHourLimit,
+		AddressDayLimit:   riskCfg.AddressDayLimit,
+		GlobalHourLimit:   riskCfg.GlobalHourLimit,
+		GlobalDayLimit:    riskCfg.GlobalDayLimit,
+	}
+	return e
+}
+
+// normalizeAddress returns the canonical encoding of a bitcoin address, bech32 addresses are
+// case insensitive; other addresses, abelian addresses included, are compared as they are
+func (e *Engine) normalizeAddress(address string) string {
+	address = strings.TrimSpace(address)
+	decoded, err := btcutil.DecodeAddress(address, e.params)
+	if err != nil {
+		return address
+	}
+	return decoded.EncodeAddress()
+}
+
+func (e *Engine) addressSet(addresses []string) map[string]bool {
+	set := make(map[string]bool, len(addresses))
+	for _, address := range addresses {
+		set[e.normalizeAddress(address)] = true
+	}
+	return set
+}
+
+// CheckPending checks the unchecked pending withdraws in creation order
+func (e *Engine) CheckPending() error {
+	var withdrawList []model.Withdraw
+	err := e.db.Model(&model.Withdraw{}).
+		Where(fmt.Sprintf("%s = ? AND %s = ?", model.Withdraw{}.Column().Status, model.Withdraw{}.Column().RiskStatus),
+			model.BtcTxWithdrawPending, model.WithdrawRiskUnchecked).
+		Order("id").
+		Find(&withdrawList).Error
+	if err != nil {
+		return err
+	}
+	for _, v := range withdrawList {
+		if err = e.check(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Engine) check(v model.Withdraw) error {
+	address := e.normalizeAddress(v.BtcTo)
+	now := time.Now()
+	usage := Usage{}
+	var err error
+	// abelian addresses are case sensitive, the velocity is of the address as withdrawn
+	if usage.AddressHour, err = e.usage(v.BtcTo, now.Add(-time.Hour)); err != nil {
+		return err
+	}
+	if usage.AddressDay, err = e.usage(v.BtcTo, now.Add(-24*time.Hour)); err != nil {
+		return err
+	}
+	if usage.GlobalHour, err = e.usage("", now.Add(-time.Hour)); err != nil {
+		return err
+	}
+	if usage.GlobalDay, err = e.usage("", now.Add(-24*time.Hour)); err != nil {
+		return err
+	}
+	decision := Evaluate(address, v.BtcValue, e.rules, usage)
+
+	updateFields := map[string]interface{}{
+		model.Withdraw{}.Column().RiskStatus: decision.Status,
+		model.Withdraw{}.Column().RiskReason: decision.Reason,
+	}
+	switch decision.Status {
+	case model.WithdrawRiskPassed:
+		updateFields[model.Withdraw{}.Column().RiskCheckedAt] = now
+	case model.WithdrawRiskRejected:
+		// the burn is not paid out, see withdraw mark-refunded
+		updateFields[model.Withdraw{}.Column().Status] = model.BtcTxWithdrawRejected
+		updateFields[model.Withdraw{}.Column().RiskReviewer] = EngineReviewer
+	}
+	err = e.db.Model(&model.Withdraw{}).
+		Where(fmt.Sprintf("id = ? AND %s = ?", model.Withdraw{}.Column().RiskStatus), v.ID, model.WithdrawRiskUnchecked).
+		Updates(updateFields).Error
+	if err != nil {
+		return err
+	}
+	if decision.Status != model.WithdrawRiskPassed {
+		e.log.Warnw("risk engine withdraw held", "id", v.ID, "b2TxHash", v.B2TxHash,
+			"btcTo", v.BtcTo, "value", v.BtcValue, "riskStatus", decision.Status, "reason", decision.Reason)
+	}
+	return nil
+}
+
+// usage sums the passed and approved withdraw value since from, to address or to all addresses if empty
+func (e *Engine) usage(address string, from time.Time) (int64, error) {
+	var total int64
+	query := e.db.Model(&model.Withdraw{}).
+		Select(fmt.Sprintf("COALESCE(SUM(%s), 0)", model.Withdraw{}.Column().BtcValue)).
+		Where(fmt.Sprintf("%s IN (?) AND %s >= ?", model.Withdraw{}.Column().RiskStatus, model.Withdraw{}.Column().RiskCheckedAt),
+			[]int{model.WithdrawRiskPassed, model.WithdrawRiskApproved}, from)
+	if address != "" {
+		query = query.Where(fmt.Sprintf("%s = ?", model.Withdraw{}.Column().BtcTo), address)
+	}
+	err := query.Scan(&total).Error
+	return total, err
+}
+
+// AwaitingApproval returns the withdraws awaiting manual approval
+func (e *Engine) AwaitingApproval() ([]model.Withdraw, error) {
+	var withdrawList []model.Withdraw
+	err := e.db.Model(&model.Withdraw{}).
+		Where(fmt.Sprintf("%s = ?", model.Withdraw{}.Column().RiskStatus), model.WithdrawRiskAwaitingApproval).
+		Order("id").
+		Find(&withdrawList).Error
+	return withdrawList, err
+}
+
+// Approve releases a withdraw awaiting approval for payment
+func (e *Engine) Approve(id int64, reviewer string) (*model.Withdraw, error) {
+	return e.review(id, reviewer, map[string]interface{}{
+		model.Withdraw{}.Column().RiskStatus:    model.WithdrawRiskApproved,
+		model.Withdraw{}.Column().RiskCheckedAt: time.Now(),
+	})
+}
+
+// Reject rejects a withdraw awaiting approval with reason, its burn is not paid out
+// and is refunded by the operators, see withdraw mark-refunded
+func (e *Engine) Reject(id int64, reviewer string, reason string) (*model.Withdraw, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, ErrReasonRequired
+	}
+	return e.review(id, reviewer, map[string]interface{}{
+		model.Withdraw{}.Column().RiskStatus: model.WithdrawRiskRejected,
+		model.Withdraw{}.Column().RiskReason: reason,
+		model.Withdraw{}.Column().Status:     model.BtcTxWithdrawRejected,
+	})
+}
+
+func (e *Engine) review(id int64, reviewer string, updateFields map[string]interface{}) (*model.Withdraw, error) {
+	if reviewer == "" {
+		return nil, ErrReviewerRequired
+	}
+	updateFields[model.Withdraw{}.Column().RiskReviewer] = reviewer
+	var withdraw model.Withdraw
+	err := e.store.Transaction(func(store storage.Store) error {
+		var err error
+		withdraw, err = store.Withdraws().LockByID(id)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrWithdrawNotFound
+			}
+			return err
+		}
+		if withdraw.RiskStatus != model.WithdrawRiskAwaitingApproval {
+			return ErrNotAwaitingApproval
+		}
+		if err = store.Withdraws().Update(id, updateFields); err != nil {
+			return err
+		}
+		withdraw, err = store.Withdraws().ByID(id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	e.log.Infow("risk engine withdraw reviewed", "id", id, "reviewer", reviewer, "riskStatus", withdraw.RiskStatus)
+	return &withdraw, nil
+}
@@ -0,0 +1,50 @@
+package risk
+
+import (
+	"testing"
+
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluateLists(t *testing.T) {
+	rules := Rules{
+		DenyList:          map[string]bool{"denied": true},
+		AllowList:         map[string]bool{"allowed": true},
+		MaxWithdrawValue:  1000,
+		ApprovalThreshold: 500,
+		GlobalDayLimit:    100,
+	}
+
+	require.Equal(t, model.WithdrawRiskRejected, Evaluate("denied", 1, rules, Usage{}).Status)
+	// the max value applies to allow listed addresses
+	require.Equal(t, model.WithdrawRiskRejected, Evaluate("allowed", 1001, rules, Usage{}).Status)
+	// allow listed addresses bypass the threshold and velocity limits
+	require.Equal(t, model.WithdrawRiskPassed, Evaluate("allowed", 900, rules, Usage{GlobalDay: 100}).Status)
+	require.Equal(t, model.WithdrawRiskAwaitingApproval, Evaluate("other", 500, rules, Usage{}).Status)
+}
+
+func TestEvaluateVelocity(t *testing.T) {
+	rules := Rules{
+		AddressHourLimit: 100,
+		AddressDayLimit:  200,
+		GlobalHourLimit:  300,
+		GlobalDayLimit:   400,
+	}
+
+	require.Equal(t, model.WithdrawRiskPassed, Evaluate("a", 50, rules, Usage{AddressHour: 50}).Status)
+
+	for _, usage := range []Usage{
+		{AddressHour: 51},
+		{AddressDay: 151},
+		{GlobalHour: 251},
+		{GlobalDay: 351},
+	} {
+		decision := Evaluate("a", 50, rules, usage)
+		require.Equal(t, model.WithdrawRiskAwaitingApproval, decision.Status, "usage %+v", usage)
+		require.NotEmpty(t, decision.Reason)
+	}
+
+	// zero limits are disabled
+	require.Equal(t, model.WithdrawRiskPassed, Evaluate("a", 1<<40, Rules{}, Usage{GlobalDay: 1 << 40}).Status)
+}
@@ -3,48 +3,60 @@ package rollup
 import (
 	"context"
 	"errors"
+	"fmt"
 	"math/big"
 	"time"
 
 	"github.com/b2network/b2-indexer/config"
 	"github.com/b2network/b2-indexer/pkg/event"
+	"github.com/b2network/b2-indexer/pkg/event/bridge"
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/shopspring/decimal"
 
 	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/storage"
+	"github.com/b2network/b2-indexer/internal/supervisor"
 	"github.com/b2network/b2-indexer/pkg/log"
 	"github.com/cometbft/cometbft/libs/service"
 	"gorm.io/gorm"
 
 	ethtypes "github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/ethclient"
 )
 
 const (
 	IndexerServiceName = "RollupIndexerService"
-
-	WaitHandleTime = 10
 )
 
+// WaitHandleTime is the interval of the rollup scans, the e2e tests shorten it
+var WaitHandleTime = 10 * time.Second
+
+// EthClient is the rollup rpc of the listener, *ethclient.Client implements it
+type EthClient interface {
+	BlockNumber(ctx context.Context) (uint64, error)
+	FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]ethtypes.Log, error)
+}
+
 // IndexerService indexes transactions for json-rpc service.
 type IndexerService struct {
 	service.BaseService
 
-	ethCli *ethclient.Client
+	ethCli EthClient
 	config *config.BitcoinConfig
 	db     *gorm.DB
+	store  storage.Store
 	log    log.Logger
+	loops  *supervisor.Loops
 }
 
 // NewRollupService returns a new service instance.
 func NewRollupService(
-	ethCli *ethclient.Client,
+	ethCli EthClient,
 	config *config.BitcoinConfig,
 	db *gorm.DB,
 	log log.Logger,
 ) *IndexerService {
-	is := &IndexerService{ethCli: ethCli, config: config, db: db, log: log}
+	is := &IndexerService{ethCli: ethCli, config: config, db: db, store: storage.New(db), log: log}
 	is.BaseService = *service.NewBaseService(nil, IndexerServiceName, is)
 	return is
 }
@@ -52,26 +64,39 @@ func NewRollupService(
 // OnStart implements service.Service by subscribing for new blocks
 // and indexing them by events.
 func (bis *IndexerService) OnStart() error {
-	defer func() {
-		if r := recover(); r != nil {
-			bis.log.Errorw("BridgeWithdrawService panic", "error", r)
-		}
-	}()
-	if !bis.db.Migrator().HasTable(&model.RollupIndex{}) {
-		err := bis.db.AutoMigrate(&model.RollupIndex{})
-		if err != nil {
-			bis.log.Errorw("IndexerService create WithdrawIndex table", "error", err.Error())
-			return err
-		}
-	}
+	bis.loops = supervisor.NewLoops()
+	bis.loops.Go(bis.index)
+	return nil
+}
+
+// OnStop waits for the block being indexed to be saved
+func (bis *IndexerService) OnStop() {
+	bis.log.Warnf("IndexerService stopping...")
+	bis.loops.Stop()
+}
+
+// Crashed implements supervisor.Service
+func (bis *IndexerService) Crashed() <-chan struct{} {
+	return bis.loops.Crashed()
+}
+
+// Err implements supervisor.Service
+func (bis *IndexerService) Err() error {
+	return bis.loops.Err()
+}
+
+// index indexes the rollup deposit events until the service stops
+func (bis *IndexerService) index() error {
 	for {
 		// listen server scan blocks
-		time.Sleep(time.Duration(WaitHandleTime) * time.Second)
+		if !bis.loops.Sleep(WaitHandleTime) {
+			return nil
+		}
 		var currentBlock uint64 // index current block number
 		var currentTxIndex uint // index current block tx index
 		var currentLogIndex uint
-		var rollupIndex model.RollupIndex
-		if err := bis.db.First(&rollupIndex, 1).Error; err != nil {
+		rollupIndex, err := bis.store.Index().RollupIndex()
+		if err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				latestBlock, err := bis.ethCli.BlockNumber(context.Background())
 				if err != nil {
@@ -86,7 +111,7 @@ func (bis *IndexerService) OnStart() error {
 					B2IndexTx:    0,
 					B2LogIndex:   0,
 				}
-				if err := bis.db.Create(&rollupIndex).Error; err != nil {
+				if err := bis.store.Index().SaveRollupIndex(&rollupIndex); err != nil {
 					bis.log.Errorw("IndexerService create rollupIndex is failed:", "error", err)
 					continue
 				}
@@ -145,7 +170,11 @@ func (bis *IndexerService) OnStart() error {
 				// }
 				if eventHash == common.HexToHash(bis.config.Bridge.Deposit) {
 					bis.log.Warnw("vlog", "vlog", vlog)
-					err = handelDepositEvent(vlog, bis.db)
+					if eventHash == common.BytesToHash(bridge.MintWAbelHash) {
+						err = handleMintWAbelEvent(vlog, bis.db)
+					} else {
+						err = handelDepositEvent(vlog, bis.db)
+					}
 					if err != nil {
 						bis.log.Errorw("IndexerService handelDepositEvent err: ", "error", err)
 						continue
@@ -158,7 +187,7 @@ func (bis *IndexerService) OnStart() error {
 			rollupIndex.B2IndexBlock = currentBlock
 			rollupIndex.B2IndexTx = currentTxIndex
 			rollupIndex.B2LogIndex = currentLogIndex
-			if err := bis.db.Save(&rollupIndex).Error; err != nil {
+			if err := bis.store.Index().SaveRollupIndex(&rollupIndex); err != nil {
 				bis.log.Errorw("failed to save b2 index block", "error", err, "currentBlock", i,
 					"currentTxIndex", currentTxIndex, "latestBlock", latestBlock)
 				continue
@@ -214,6 +243,34 @@ func handelDepositEvent(vlog ethtypes.Log, db *gorm.DB) error {
 	return nil
 }
 
+// handleMintWAbelEvent saves the MintWAbel event of a wABEL mint, the event has no
+// abelian tx hash, it is taken from the deposit sent by the mint tx. A mint no deposit
+// sent is saved without abelian tx hash for the reconciliation to report it.
+func handleMintWAbelEvent(vlog ethtypes.Log, db *gorm.DB) error {
+	var deposit model.Deposit
+	err := db.Where(fmt.Sprintf("%s = ?", model.Deposit{}.Column().B2TxHash), vlog.TxHash.String()).
+		First(&deposit).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("find deposit of mint tx %s: %w", vlog.TxHash, err)
+		}
+		log.Warnw("mint event without deposit", "b2TxHash", vlog.TxHash.String(), "b2BlockNumber", vlog.BlockNumber)
+	}
+	depositData := model.RollupDeposit{
+		BtcTxHash:        deposit.BtcTxHash,
+		BtcFromAAAddress: event.TopicToAddress(vlog, 1).Hex(),
+		// the bridge mints value * 1e11
+		BtcValue:      event.DataToDecimal(vlog, 0, 0).Div(decimal.NewFromInt(1e11)).BigInt().Int64(),
+		B2TxFrom:      deposit.B2TxFrom,
+		B2BlockNumber: vlog.BlockNumber,
+		B2BlockHash:   vlog.BlockHash.String(),
+		B2TxHash:      vlog.TxHash.String(),
+		B2TxIndex:     vlog.TxIndex,
+		B2LogIndex:    vlog.Index,
+	}
+	return db.Create(&depositData).Error
+}
+
 func remove0xPrefix(input string) string {
 	if len(input) > 2 && input[:2] == "0x" {
 		return input[2:]
@@ -0,0 +1,105 @@
+package rollup_test
+
+import (
+	"context"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/logic/reconcile"
+	"github.com/b2network/b2-indexer/internal/logic/rollup"
+	"github.com/b2network/b2-indexer/internal/migration"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/storage"
+	"github.com/b2network/b2-indexer/pkg/event/bridge"
+	"github.com/b2network/b2-indexer/pkg/log"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+var contract = common.HexToAddress("0x0000000000000000000000000000000000000b2b")
+
+func openSqlite(t *testing.T) *gorm.DB {
+	db, err := storage.Open(&config.Config{
+		DatabaseSource: "sqlite://" + filepath.Join(t.TempDir(), "indexer.db"),
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	migrator, err := migration.New(db, log.NewNopLogger())
+	require.NoError(t, err)
+	_, err = migrator.Up(0)
+	require.NoError(t, err)
+	return db
+}
+
+// logClient is a rollup whose latest block holds the logs
+type logClient struct {
+	block uint64
+	logs  []ethtypes.Log
+}
+
+func (c *logClient) BlockNumber(context.Context) (uint64, error) {
+	return c.block, nil
+}
+
+func (c *logClient) FilterLogs(_ context.Context, q ethereum.FilterQuery) ([]ethtypes.Log, error) {
+	if q.FromBlock.Uint64() != c.block {
+		return nil, nil
+	}
+	return c.logs, nil
+}
+
+func TestMintWithoutDeposit(t *testing.T) {
+	old := rollup.WaitHandleTime
+	rollup.WaitHandleTime = 10 * time.Millisecond
+	t.Cleanup(func() { rollup.WaitHandleTime = old })
+
+	db := openSqlite(t)
+	require.NoError(t, db.Create(&model.RollupIndex{Base: model.Base{ID: 1}, B2IndexBlock: 9}).Error)
+	aa := common.HexToAddress("0x5A0b54D5dc17e0AadC383d2db43B0a0D3E029c4c")
+	mintTx := common.HexToHash("0x01")
+	client := &logClient{block: 10, logs: []ethtypes.Log{{
+		Address:     contract,
+		Topics:      []common.Hash{common.BytesToHash(bridge.MintWAbelHash), common.BytesToHash(aa.Bytes())},
+		Data:        append(common.BigToHash(new(big.Int).Mul(big.NewInt(1000), big.NewInt(1e11))).Bytes(), make([]byte, 32)...),
+		BlockNumber: 10,
+		TxHash:      mintTx,
+		TxIndex:     1,
+		Index:       1,
+	}}}
+	cfg := &config.BitcoinConfig{Bridge: config.BridgeConfig{
+		ContractAddress: contract.Hex(),
+		Deposit:         common.BytesToHash(bridge.MintWAbelHash).Hex(),
+	}}
+
+	listener := rollup.NewRollupService(client, cfg, db, log.NewNopLogger())
+	require.NoError(t, listener.Start())
+	t.Cleanup(func() { _ = listener.Stop() })
+	var mint model.RollupDeposit
+	require.Eventually(t, func() bool {
+		return db.Where("b2_tx_hash = ?", mintTx.String()).First(&mint).Error == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Empty(t, mint.BtcTxHash)
+	require.Equal(t, int64(1000), mint.BtcValue)
+	require.Equal(t, aa.Hex(), mint.BtcFromAAAddress)
+
+	report, err := reconcile.NewReconciler(config.ReconcileConfig{}, db, log.NewNopLogger()).Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, model.ReconciliationStatusDiscrepancy, report.Status)
+	var orphans []model.ReconciliationDiscrepancy
+	for _, item := range report.Items {
+		if item.Kind == model.DiscrepancyOrphanMint {
+			orphans = append(orphans, item)
+		}
+	}
+	require.Len(t, orphans, 1)
+	require.Equal(t, mint.ID, orphans[0].RollupDepositID)
+	require.Equal(t, mintTx.String(), orphans[0].B2TxHash)
+}
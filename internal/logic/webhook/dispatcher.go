@@ -0,0 +1,305 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/supervisor"
+	"github.com/b2network/b2-indexer/pkg/log"
+	"github.com/cometbft/cometbft/libs/service"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	DispatcherServiceName = "WebhookDispatcherService"
+
+	// batchSize is the max outbox events or due deliveries handled per poll
+	batchSize = 100
+	// maxErrorLen is the size of webhook_delivery.last_error
+	maxErrorLen = 512
+)
+
+// Dispatcher creates the deliveries of the milestones of the outbox events and
+// delivers them. A delivery is retried with an exponential backoff until max
+// attempts, the callback status of a deposit follows its deliveries. With leader
+// election the leader runs it.
+type Dispatcher struct {
+	service.BaseService
+
+	db           *gorm.DB
+	client       *http.Client
+	maxAttempts  int
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	pollInterval time.Duration
+	log          log.Logger
+	loops        *supervisor.Loops
+}
+
+// NewDispatcher returns a dispatcher of the webhooks of db
+func NewDispatcher(cfg config.WebhookConfig, db *gorm.DB, log log.Logger) *Dispatcher {
+	d := &Dispatcher{
+		db:           db,
+		client:       &http.Client{Timeout: time.Duration(cfg.Timeout) * time.Second},
+		maxAttempts:  cfg.MaxAttempts,
+		minBackoff:   time.Duration(cfg.MinBackoff) * time.Second,
+		maxBackoff:   time.Duration(cfg.MaxBackoff) * time.Second,
+		pollInterval: time.Duration(cfg.PollInterval) * time.Second,
+		log:          log,
+	}
+	d.BaseService = *service.NewBaseService(nil, DispatcherServiceName, d)
+	return d
+}
+
+// OnStart implements service.Service
+func (d *Dispatcher) OnStart() error {
+	d.loops = supervisor.NewLoops()
+	d.loops.Go(d.dispatch)
+	return nil
+}
+
+// OnStop waits for the delivery being sent
+func (d *Dispatcher) OnStop() {
+	d.log.Warnf("Dispatcher stopping...")
+	d.loops.Stop()
+}
+
+// Crashed implements supervisor.Service
+func (d *Dispatcher) Crashed() <-chan struct{} {
+	return d.loops.Crashed()
+}
+
+// Err implements supervisor.Service
+func (d *Dispatcher) Err() error {
+	return d.loops.Err()
+}
+
+// dispatch creates and sends the deliveries until the service stops, a full
+// batch is followed by the next one right away
+func (d *Dispatcher) dispatch() error {
+	for {
+		notified, err := d.Notify()
+		if err != nil {
+			d.log.Errorw("webhook dispatcher failed to create deliveries", "error", err)
+		}
+		delivered, deliverErr := d.Deliver()
+		if deliverErr != nil {
+			d.log.Errorw("webhook dispatcher failed to load deliveries", "error", deliverErr)
+		}
+		wait := d.pollInterval
+		if err == nil && deliverErr == nil && (notified == batchSize || delivered == batchSize) {
+			wait = 0
+		}
+		if !d.loops.Sleep(wait) {
+			return nil
+		}
+	}
+}
+
+// Notify creates the deliveries of a batch of outbox events not yet notified, for the
+// enabled subscriptions of their milestones, and returns the number of events. A milestone
+// is delivered once per subscription and row, the later changes of the row do not repeat it.
+func (d *Dispatcher) Notify() (int, error) {
+	var events []model.OutboxEvent
+	err := d.db.
+		Where(fmt.Sprintf("%s IS NULL", model.OutboxEvent{}.Column().NotifiedAt)).
+		Order("id").
+		Limit(batchSize).
+		Find(&events).Error
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+	var subs []model.WebhookSubscription
+	err = d.db.Where(fmt.Sprintf("%s = ?", model.WebhookSubscription{}.Column().Enabled), true).Find(&subs).Error
+	if err != nil {
+		return 0, err
+	}
+	ids := make([]int64, 0, len(events))
+	var deliveries []model.WebhookDelivery
+	deposits := make(map[int64]bool)
+	now := time.Now()
+	for _, e := range events {
+		ids = append(ids, e.ID)
+		for _, event := range Milestones(e.Aggregate, e.EventType, []byte(e.Payload)) {
+			for _, sub := range subs {
+				if !Matches(sub.Events, event) {
+					continue
+				}
+				deliveries = append(deliveries, model.WebhookDelivery{
+					SubscriptionID: sub.ID,
+					Event:          event,
+					Aggregate:      e.Aggregate,
+					AggregateID:    e.AggregateID,
+					Payload:        e.Payload,
+					Status:         model.WebhookDeliveryPending,
+					NextAttemptAt:  now,
+				})
+				if e.Aggregate == (model.Deposit{}).TableName() {
+					deposits[e.AggregateID] = true
+				}
+			}
+		}
+	}
+	err = d.db.Transaction(func(tx *gorm.DB) error {
+		if len(deliveries) > 0 {
+			err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&deliveries).Error
+			if err != nil {
+				return err
+			}
+		}
+		err := tx.Model(&model.OutboxEvent{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			model.OutboxEvent{}.Column().NotifiedAt: now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return syncCallbackStatus(tx, sortedIDs(deposits))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(events), nil
+}
+
+// Deliver sends a batch of due deliveries of the enabled subscriptions and returns the number sent
+func (d *Dispatcher) Deliver() (int, error) {
+	columns := model.WebhookDelivery{}.Column()
+	var deliveries []model.WebhookDelivery
+	err := d.db.
+		Joins(fmt.Sprintf("JOIN %[1]s ON %[1]s.id = %[2]s.%[3]s AND %[1]s.%[4]s = ?",
+			model.WebhookSubscription{}.TableName(), model.WebhookDelivery{}.TableName(),
+			columns.SubscriptionID, model.WebhookSubscription{}.Column().Enabled), true).
+		Where(fmt.Sprintf("%[1]s.%[2]s = ? AND %[1]s.%[3]s <= ?", model.WebhookDelivery{}.TableName(), columns.Status, columns.NextAttemptAt),
+			model.WebhookDeliveryPending, time.Now()).
+		Order(fmt.Sprintf("%s.id", model.WebhookDelivery{}.TableName())).
+		Limit(batchSize).
+		Find(&deliveries).Error
+	if err != nil || len(deliveries) == 0 {
+		return 0, err
+	}
+	subs := make(map[int64]model.WebhookSubscription)
+	for _, delivery := range deliveries {
+		sub, ok := subs[delivery.SubscriptionID]
+		if !ok {
+			if err = d.db.First(&sub, delivery.SubscriptionID).Error; err != nil {
+				return 0, err
+			}
+			subs[sub.ID] = sub
+		}
+		code, sendErr := d.send(sub, delivery)
+		if err = d.record(delivery, code, sendErr); err != nil {
+			return 0, err
+		}
+	}
+	return len(deliveries), nil
+}
+
+// send posts the notification of delivery, a response out of 2xx is an error
+func (d *Dispatcher) send(sub model.WebhookSubscription, delivery model.WebhookDelivery) (int, error) {
+	body, err := json.Marshal(Notification{
+		ID:          delivery.ID,
+		Event:       delivery.Event,
+		Aggregate:   delivery.Aggregate,
+		AggregateID: delivery.AggregateID,
+		CreatedAt:   delivery.CreatedAt,
+		Data:        json.RawMessage(delivery.Payload),
+	})
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), d.client.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, time.Now().Unix(), body))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook response status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// record saves the outcome of an attempt of delivery, a redelivery requested
+// during the attempt is kept
+func (d *Dispatcher) record(delivery model.WebhookDelivery, code int, sendErr error) error {
+	columns := model.WebhookDelivery{}.Column()
+	now := time.Now()
+	attempts := delivery.Attempts + 1
+	fields := map[string]interface{}{
+		columns.Attempts:     attempts,
+		columns.ResponseCode: code,
+	}
+	switch {
+	case sendErr == nil:
+		fields[columns.Status] = model.WebhookDeliverySuccess
+		fields[columns.DeliveredAt] = now
+		fields[columns.LastError] = ""
+	default:
+		reason := sendErr.Error()
+		if len(reason) > maxErrorLen {
+			reason = reason[:maxErrorLen]
+		}
+		fields[columns.LastError] = reason
+		if attempts >= d.maxAttempts {
+			fields[columns.Status] = model.WebhookDeliveryFailed
+		} else {
+			fields[columns.NextAttemptAt] = now.Add(d.backoff(attempts))
+		}
+		d.log.Warnw("webhook delivery failed", "id", delivery.ID, "subscription", delivery.SubscriptionID,
+			"event", delivery.Event, "attempts", attempts, "error", sendErr)
+	}
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&model.WebhookDelivery{}).
+			Where(fmt.Sprintf("id = ? AND %s = ? AND %s = ?", columns.Status, columns.Attempts), delivery.ID, model.WebhookDeliveryPending, delivery.Attempts).
+			Updates(fields).Error
+		if err != nil {
+			return err
+		}
+		if delivery.Aggregate != (model.Deposit{}).TableName() {
+			return nil
+		}
+		return syncCallbackStatus(tx, []int64{delivery.AggregateID})
+	})
+}
+
+// backoff returns the wait after the failed attempt, min backoff doubled by every
+// earlier attempt up to max backoff
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.minBackoff
+	for i := 1; i < attempts && wait < d.maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > d.maxBackoff {
+		wait = d.maxBackoff
+	}
+	return wait
+}
+
+func sortedIDs(ids map[int64]bool) []int64 {
+	sorted := make([]int64, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
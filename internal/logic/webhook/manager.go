@@ -0,0 +1,240 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/b2network/b2-indexer/internal/model"
+	"gorm.io/gorm"
+)
+
+const (
+	// secretSize is the bytes of a generated subscription secret
+	secretSize = 32
+	// maxDeliveries is the max deliveries listed at once
+	maxDeliveries = 500
+)
+
+// Subscription is the requested state of a subscription
+type Subscription struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Secret is generated when empty for a new subscription, kept for a known one
+	Secret  string `json:"secret"`
+	Events  string `json:"events"`
+	Enabled *bool  `json:"enabled"`
+}
+
+// DeliveryFilter selects the listed deliveries, zero fields select all
+type DeliveryFilter struct {
+	SubscriptionID int64
+	Event          string
+	Aggregate      string
+	AggregateID    int64
+	Status         int
+	Limit          int
+}
+
+// Manager manages the subscriptions and the deliveries of the api
+type Manager struct {
+	db *gorm.DB
+}
+
+func NewManager(db *gorm.DB) *Manager {
+	return &Manager{db: db}
+}
+
+// SaveSubscription creates the subscription or updates the subscription of the name,
+// the secret is returned when it was created or changed, empty otherwise
+func (m *Manager) SaveSubscription(req Subscription) (model.WebhookSubscription, string, error) {
+	var sub model.WebhookSubscription
+	if req.Name == "" || len(req.Name) > 64 {
+		return sub, "", fmt.Errorf("%w: name must have 1 to 64 characters", ErrInvalidSubscription)
+	}
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" || len(req.URL) > 512 {
+		return sub, "", fmt.Errorf("%w: url must be an http or https url", ErrInvalidSubscription)
+	}
+	events, err := ParseEvents(req.Events)
+	if err != nil {
+		return sub, "", fmt.Errorf("%w: %w", ErrInvalidSubscription, err)
+	}
+	if len(events) > 512 || len(req.Secret) > 128 {
+		return sub, "", fmt.Errorf("%w: events or secret too long", ErrInvalidSubscription)
+	}
+	secret := req.Secret
+	err = m.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where(fmt.Sprintf("%s = ?", model.WebhookSubscription{}.Column().Name), req.Name).
+			First(&sub).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if secret == "" {
+				if secret, err = newSecret(); err != nil {
+					return err
+				}
+			}
+			sub = model.WebhookSubscription{
+				Name:    req.Name,
+				URL:     req.URL,
+				Secret:  secret,
+				Events:  events,
+				Enabled: req.Enabled == nil || *req.Enabled,
+			}
+			// gorm skips the false zero value of a field with a default
+			return tx.Select("*").Omit("id").Create(&sub).Error
+		}
+		if err != nil {
+			return err
+		}
+		enabled := sub.Enabled
+		if req.Enabled != nil {
+			enabled = *req.Enabled
+		}
+		fields := map[string]interface{}{
+			model.WebhookSubscription{}.Column().URL:     req.URL,
+			model.WebhookSubscription{}.Column().Events:  events,
+			model.WebhookSubscription{}.Column().Enabled: enabled,
+		}
+		if secret != "" {
+			fields["secret"] = secret
+		}
+		if err = tx.Model(&sub).Updates(fields).Error; err != nil {
+			return err
+		}
+		if enabled == sub.Enabled {
+			return tx.First(&sub, sub.ID).Error
+		}
+		// the pending deliveries of a disabled subscription do not hold the callback status
+		var ids []int64
+		err = tx.Model(&model.WebhookDelivery{}).
+			Where(fmt.Sprintf("%s = ? AND %s = ?", model.WebhookDelivery{}.Column().SubscriptionID, model.WebhookDelivery{}.Column().Aggregate),
+				sub.ID, model.Deposit{}.TableName()).
+			Distinct().
+			Pluck(model.WebhookDelivery{}.Column().AggregateID, &ids).Error
+		if err != nil {
+			return err
+		}
+		if err = tx.First(&sub, sub.ID).Error; err != nil {
+			return err
+		}
+		return syncCallbackStatus(tx, ids)
+	})
+	if err != nil {
+		return model.WebhookSubscription{}, "", err
+	}
+	return sub, secret, nil
+}
+
+// Subscriptions returns the subscriptions by id
+func (m *Manager) Subscriptions() ([]model.WebhookSubscription, error) {
+	var subs []model.WebhookSubscription
+	err := m.db.Order("id").Find(&subs).Error
+	return subs, err
+}
+
+// Deliveries returns the deliveries of filter, the latest first
+func (m *Manager) Deliveries(filter DeliveryFilter) ([]model.WebhookDelivery, error) {
+	columns := model.WebhookDelivery{}.Column()
+	query := m.db.Model(&model.WebhookDelivery{})
+	if filter.SubscriptionID != 0 {
+		query = query.Where(fmt.Sprintf("%s = ?", columns.SubscriptionID), filter.SubscriptionID)
+	}
+	if filter.Event != "" {
+		query = query.Where(fmt.Sprintf("%s = ?", columns.Event), filter.Event)
+	}
+	if filter.Aggregate != "" {
+		query = query.Where(fmt.Sprintf("%s = ?", columns.Aggregate), filter.Aggregate)
+	}
+	if filter.AggregateID != 0 {
+		query = query.Where(fmt.Sprintf("%s = ?", columns.AggregateID), filter.AggregateID)
+	}
+	if filter.Status != 0 {
+		query = query.Where(fmt.Sprintf("%s = ?", columns.Status), filter.Status)
+	}
+	limit := filter.Limit
+	if limit <= 0 || limit > maxDeliveries {
+		limit = maxDeliveries
+	}
+	var deliveries []model.WebhookDelivery
+	err := query.Order("id DESC").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+// Redeliver schedules the delivery of id now with a fresh attempt budget, whatever its status
+func (m *Manager) Redeliver(id int64) (model.WebhookDelivery, error) {
+	var delivery model.WebhookDelivery
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.First(&delivery, id).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrDeliveryNotFound
+		}
+		if err != nil {
+			return err
+		}
+		columns := model.WebhookDelivery{}.Column()
+		err = tx.Model(&delivery).Updates(map[string]interface{}{
+			columns.Status:        model.WebhookDeliveryPending,
+			columns.Attempts:      0,
+			columns.NextAttemptAt: time.Now(),
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err = tx.First(&delivery, id).Error; err != nil {
+			return err
+		}
+		if delivery.Aggregate == (model.Deposit{}).TableName() {
+			return syncCallbackStatus(tx, []int64{delivery.AggregateID})
+		}
+		return nil
+	})
+	return delivery, err
+}
+
+// syncCallbackStatus sets the callback status of the deposits from the deliveries of
+// the enabled subscriptions, failed with a failed one, pending with a pending one
+func syncCallbackStatus(tx *gorm.DB, depositIDs []int64) error {
+	columns := model.WebhookDelivery{}.Column()
+	for _, id := range depositIDs {
+		var statuses []int
+		err := tx.Model(&model.WebhookDelivery{}).
+			Joins(fmt.Sprintf("JOIN %[1]s ON %[1]s.id = %[2]s.%[3]s AND %[1]s.%[4]s = ?",
+				model.WebhookSubscription{}.TableName(), model.WebhookDelivery{}.TableName(),
+				columns.SubscriptionID, model.WebhookSubscription{}.Column().Enabled), true).
+			Where(fmt.Sprintf("%[1]s.%[2]s = ? AND %[1]s.%[3]s = ?", model.WebhookDelivery{}.TableName(), columns.Aggregate, columns.AggregateID),
+				model.Deposit{}.TableName(), id).
+			Distinct().
+			Pluck(fmt.Sprintf("%s.%s", model.WebhookDelivery{}.TableName(), columns.Status), &statuses).Error
+		if err != nil {
+			return err
+		}
+		status := model.CallbackStatusSuccess
+		for _, s := range statuses {
+			switch {
+			case s == model.WebhookDeliveryFailed:
+				status = model.CallbackStatusFailed
+			case s == model.WebhookDeliveryPending && status == model.CallbackStatusSuccess:
+				status = model.CallbackStatusPending
+			}
+		}
+		// an unchanged status is not written
+		err = tx.Model(&model.Deposit{}).
+			Where(fmt.Sprintf("id = ? AND %s <> ?", model.Deposit{}.Column().CallbackStatus), id, status).
+			Update(model.Deposit{}.Column().CallbackStatus, status).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newSecret() (string, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
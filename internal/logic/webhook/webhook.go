@@ -0,0 +1,178 @@
+// Package webhook notifies partner endpoints of the deposit and withdraw milestones.
+// The milestones are derived from the outbox events, every subscription gets one
+// hmac signed delivery per milestone and row, retried with backoff.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/tidwall/gjson"
+)
+
+// the milestones of a deposit and of a withdraw tx
+const (
+	EventDepositDetected   = "deposit.detected"
+	EventDepositConfirmed  = "deposit.confirmed"
+	EventDepositMinted     = "deposit.minted"
+	EventDepositFailed     = "deposit.failed"
+	EventWithdrawBroadcast = "withdraw.broadcast"
+	EventWithdrawConfirmed = "withdraw.confirmed"
+)
+
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Events are the milestones a subscription may filter
+var Events = []string{
+	EventDepositDetected, EventDepositConfirmed, EventDepositMinted, EventDepositFailed,
+	EventWithdrawBroadcast, EventWithdrawConfirmed,
+}
+
+var (
+	ErrUnknownEvent          = errors.New("unknown webhook event")
+	ErrInvalidSignature      = errors.New("invalid webhook signature")
+	ErrSignatureExpired      = errors.New("webhook signature expired")
+	ErrSubscriptionNotFound  = errors.New("webhook subscription not found")
+	ErrDeliveryNotFound      = errors.New("webhook delivery not found")
+	ErrInvalidSubscription   = errors.New("invalid webhook subscription")
+	errSubscriptionNotActive = errors.New("webhook subscription removed")
+)
+
+// the b2 tx status of a deposit which will not be minted without an operator
+var depositFailedStatus = map[int64]bool{
+	model.DepositB2TxStatusFailed:                true,
+	model.DepositB2TxStatusWaitMinedFailed:       true,
+	model.DepositB2TxStatusWaitMinedStatusFailed: true,
+	model.DepositB2TxStatusAAAddressNotFound:     true,
+}
+
+// Milestones returns the milestones reached by the row of an outbox event in the
+// order of the lifecycle, a row may have reached several since its last change
+func Milestones(aggregate string, eventType string, payload []byte) []string {
+	if eventType == model.OutboxEventDelete {
+		return nil
+	}
+	row := gjson.ParseBytes(payload)
+	var events []string
+	switch aggregate {
+	case model.Deposit{}.TableName():
+		events = append(events, EventDepositDetected)
+		status := row.Get(model.Deposit{}.Column().B2TxStatus).Int()
+		// the mint is sent once the abelian tx has its confirmations
+		if row.Get(model.Deposit{}.Column().B2TxHash).String() != "" || status == model.DepositB2TxStatusSuccess {
+			events = append(events, EventDepositConfirmed)
+		}
+		switch {
+		case row.Get(model.Deposit{}.Column().B2TxCheck).Int() == model.B2CheckStatusFailed || depositFailedStatus[status]:
+			events = append(events, EventDepositFailed)
+		case status == model.DepositB2TxStatusSuccess:
+			events = append(events, EventDepositMinted)
+		}
+	case model.WithdrawTx{}.TableName():
+		switch row.Get(model.WithdrawTx{}.Column().Status).Int() {
+		case model.BtcTxWithdrawBroadcastSuccess:
+			events = append(events, EventWithdrawBroadcast)
+		case model.BtcTxWithdrawConfirmed, model.BtcTxWithdrawSuccess:
+			// a failed bump of a withdraw tx never confirms, its status is failed
+			events = append(events, EventWithdrawBroadcast, EventWithdrawConfirmed)
+		}
+	}
+	return events
+}
+
+// ParseEvents checks the comma separated event filter of a subscription and returns it
+// normalized, deposit.* and withdraw.* select all events of a kind, empty selects all
+func ParseEvents(filter string) (string, error) {
+	var events []string
+	for _, event := range strings.Split(filter, ",") {
+		event = strings.TrimSpace(event)
+		if event == "" {
+			continue
+		}
+		known := event == "deposit.*" || event == "withdraw.*"
+		for _, e := range Events {
+			known = known || e == event
+		}
+		if !known {
+			return "", fmt.Errorf("%w %q, one of %s, deposit.* or withdraw.*", ErrUnknownEvent, event, strings.Join(Events, ", "))
+		}
+		events = append(events, event)
+	}
+	return strings.Join(events, ","), nil
+}
+
+// Matches reports whether the event filter of a subscription selects event
+func Matches(filter string, event string) bool {
+	if filter == "" {
+		return true
+	}
+	for _, e := range strings.Split(filter, ",") {
+		if e == event || (strings.HasSuffix(e, ".*") && strings.HasPrefix(event, strings.TrimSuffix(e, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// Notification is the posted json body of a delivery
+type Notification struct {
+	// ID is the delivery id, a redelivery has the id of the delivery
+	ID          int64           `json:"id"`
+	Event       string          `json:"event"`
+	Aggregate   string          `json:"aggregate"`
+	AggregateID int64           `json:"aggregate_id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Data        json.RawMessage `json:"data"`
+}
+
+// Sign returns the X-Webhook-Signature of body sent at timestamp, t=<unix>,v1=<hex>
+// where v1 is the hmac-sha256 of "<unix>.<body>" by the subscription secret
+func Sign(secret string, timestamp int64, body []byte) string {
+	t := strconv.FormatInt(timestamp, 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t + "."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%s,v1=%s", t, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// Verify checks the X-Webhook-Signature header of body, signed at most tolerance before now,
+// for the receivers of the webhooks
+func Verify(secret string, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var timestamp int64
+	var signature string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			t, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return ErrInvalidSignature
+			}
+			timestamp = t
+		case "v1":
+			signature = value
+		}
+	}
+	if timestamp == 0 || signature == "" {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(fmt.Sprintf("t=%d,v1=%s", timestamp, signature))) {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(timestamp, 0)); age > tolerance || age < -tolerance {
+		return ErrSignatureExpired
+	}
+	return nil
+}
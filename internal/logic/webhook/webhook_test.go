@@ -0,0 +1,286 @@
+package webhook_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/logic/webhook"
+	"github.com/b2network/b2-indexer/internal/migration"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/storage"
+	"github.com/b2network/b2-indexer/pkg/log"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func openSqlite(t *testing.T) *gorm.DB {
+	db, err := storage.Open(&config.Config{
+		DatabaseSource: "sqlite://" + filepath.Join(t.TempDir(), "indexer.db"),
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	migrator, err := migration.New(db, log.NewNopLogger())
+	require.NoError(t, err)
+	_, err = migrator.Up(0)
+	require.NoError(t, err)
+	return db
+}
+
+// receiver records the verified notifications, it answers status
+type receiver struct {
+	mu            sync.Mutex
+	secret        string
+	status        int
+	notifications []webhook.Notification
+	t             *testing.T
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	require.NoError(r.t, err)
+	require.NoError(r.t, webhook.Verify(r.secret, req.Header.Get(webhook.HeaderSignature), body, time.Now(), time.Minute))
+	var notification webhook.Notification
+	require.NoError(r.t, json.Unmarshal(body, &notification))
+	require.Equal(r.t, notification.Event, req.Header.Get(webhook.HeaderEvent))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notifications = append(r.notifications, notification)
+	w.WriteHeader(r.status)
+}
+
+func (r *receiver) events() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var events []string
+	for _, n := range r.notifications {
+		events = append(events, n.Event)
+	}
+	return events
+}
+
+func newDispatcher(db *gorm.DB, maxAttempts int) *webhook.Dispatcher {
+	return webhook.NewDispatcher(config.WebhookConfig{
+		MaxAttempts:  maxAttempts,
+		MinBackoff:   0,
+		MaxBackoff:   0,
+		Timeout:      5,
+		PollInterval: 1,
+	}, db, log.NewNopLogger())
+}
+
+func callbackStatus(t *testing.T, db *gorm.DB, id int64) int {
+	var deposit model.Deposit
+	require.NoError(t, db.First(&deposit, id).Error)
+	return deposit.CallbackStatus
+}
+
+func TestMilestones(t *testing.T) {
+	deposit := model.Deposit{}.TableName()
+	withdrawTx := model.WithdrawTx{}.TableName()
+	require.Equal(t, []string{webhook.EventDepositDetected},
+		webhook.Milestones(deposit, model.OutboxEventInsert, []byte(`{"b2_tx_status":1,"b2_tx_hash":""}`)))
+	require.Equal(t, []string{webhook.EventDepositDetected, webhook.EventDepositConfirmed},
+		webhook.Milestones(deposit, model.OutboxEventUpdate, []byte(`{"b2_tx_status":9,"b2_tx_hash":"0x01"}`)))
+	require.Equal(t, []string{webhook.EventDepositDetected, webhook.EventDepositConfirmed, webhook.EventDepositMinted},
+		webhook.Milestones(deposit, model.OutboxEventUpdate, []byte(`{"b2_tx_status":0,"b2_tx_hash":"0x01"}`)))
+	require.Equal(t, []string{webhook.EventDepositDetected, webhook.EventDepositFailed},
+		webhook.Milestones(deposit, model.OutboxEventUpdate, []byte(`{"b2_tx_status":10,"b2_tx_hash":""}`)))
+	require.Empty(t, webhook.Milestones(deposit, model.OutboxEventDelete, []byte(`{}`)))
+	require.Equal(t, []string{webhook.EventWithdrawBroadcast},
+		webhook.Milestones(withdrawTx, model.OutboxEventUpdate, []byte(`{"status":6}`)))
+	require.Equal(t, []string{webhook.EventWithdrawBroadcast, webhook.EventWithdrawConfirmed},
+		webhook.Milestones(withdrawTx, model.OutboxEventUpdate, []byte(`{"status":2}`)))
+	require.Empty(t, webhook.Milestones(withdrawTx, model.OutboxEventInsert, []byte(`{"status":1}`)))
+}
+
+func TestEventFilter(t *testing.T) {
+	events, err := webhook.ParseEvents(" deposit.minted, withdraw.* ,")
+	require.NoError(t, err)
+	require.Equal(t, "deposit.minted,withdraw.*", events)
+	require.True(t, webhook.Matches(events, webhook.EventDepositMinted))
+	require.True(t, webhook.Matches(events, webhook.EventWithdrawConfirmed))
+	require.False(t, webhook.Matches(events, webhook.EventDepositDetected))
+	require.True(t, webhook.Matches("", webhook.EventDepositDetected))
+	_, err = webhook.ParseEvents("deposit.refunded")
+	require.ErrorIs(t, err, webhook.ErrUnknownEvent)
+}
+
+func TestSignature(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	now := time.Unix(1700000000, 0)
+	header := webhook.Sign("secret", now.Unix(), body)
+	require.NoError(t, webhook.Verify("secret", header, body, now, time.Minute))
+	require.ErrorIs(t, webhook.Verify("other", header, body, now, time.Minute), webhook.ErrInvalidSignature)
+	require.ErrorIs(t, webhook.Verify("secret", header, []byte(`{"id":2}`), now, time.Minute), webhook.ErrInvalidSignature)
+	require.ErrorIs(t, webhook.Verify("secret", header, body, now.Add(time.Hour), time.Minute), webhook.ErrSignatureExpired)
+	require.ErrorIs(t, webhook.Verify("secret", "v1=00", body, now, time.Minute), webhook.ErrInvalidSignature)
+}
+
+func TestDispatcher(t *testing.T) {
+	db := openSqlite(t)
+	recv := &receiver{status: http.StatusOK, t: t}
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+
+	manager := webhook.NewManager(db)
+	sub, secret, err := manager.SaveSubscription(webhook.Subscription{Name: "partner", URL: srv.URL, Events: "deposit.*"})
+	require.NoError(t, err)
+	require.Len(t, secret, 64)
+	require.True(t, sub.Enabled)
+	recv.secret = secret
+	withdrawOnly := false
+	_, _, err = manager.SaveSubscription(webhook.Subscription{Name: "withdraws", URL: srv.URL, Events: "withdraw.*", Enabled: &withdrawOnly})
+	require.NoError(t, err)
+
+	deposit := model.Deposit{BtcTxHash: "tx", BtcValue: 10}
+	require.NoError(t, db.Create(&deposit).Error)
+	require.NoError(t, db.Model(&model.Deposit{}).Where("id = ?", deposit.ID).Updates(map[string]interface{}{
+		model.Deposit{}.Column().B2TxHash:   "0x01",
+		model.Deposit{}.Column().B2TxStatus: model.DepositB2TxStatusSuccess,
+	}).Error)
+
+	dispatcher := newDispatcher(db, 3)
+	notified, err := dispatcher.Notify()
+	require.NoError(t, err)
+	require.Equal(t, 2, notified)
+	require.Equal(t, model.CallbackStatusPending, callbackStatus(t, db, deposit.ID))
+
+	delivered, err := dispatcher.Deliver()
+	require.NoError(t, err)
+	require.Equal(t, 3, delivered)
+	require.Equal(t, []string{webhook.EventDepositDetected, webhook.EventDepositConfirmed, webhook.EventDepositMinted}, recv.events())
+	require.Equal(t, deposit.ID, recv.notifications[2].AggregateID)
+	require.JSONEq(t, `"0x01"`, string(mustGet(t, recv.notifications[2].Data, "b2_tx_hash")))
+	require.Equal(t, model.CallbackStatusSuccess, callbackStatus(t, db, deposit.ID))
+
+	// the callback status changes write no outbox events
+	var events int64
+	require.NoError(t, db.Model(&model.OutboxEvent{}).Count(&events).Error)
+	require.Equal(t, int64(2), events)
+	notified, err = dispatcher.Notify()
+	require.NoError(t, err)
+	require.Zero(t, notified)
+	delivered, err = dispatcher.Deliver()
+	require.NoError(t, err)
+	require.Zero(t, delivered)
+
+	deliveries, err := manager.Deliveries(webhook.DeliveryFilter{SubscriptionID: sub.ID, Status: model.WebhookDeliverySuccess})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 3)
+	require.Equal(t, http.StatusOK, deliveries[0].ResponseCode)
+	require.NotNil(t, deliveries[0].DeliveredAt)
+}
+
+func TestDispatcherRetry(t *testing.T) {
+	db := openSqlite(t)
+	recv := &receiver{status: http.StatusServiceUnavailable, t: t}
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+
+	manager := webhook.NewManager(db)
+	_, _, err := manager.SaveSubscription(webhook.Subscription{Name: "partner", URL: srv.URL, Secret: "secret", Events: webhook.EventDepositDetected})
+	require.NoError(t, err)
+	recv.secret = "secret"
+	deposit := model.Deposit{BtcTxHash: "tx", BtcValue: 10}
+	require.NoError(t, db.Create(&deposit).Error)
+
+	dispatcher := newDispatcher(db, 2)
+	_, err = dispatcher.Notify()
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = dispatcher.Deliver()
+		require.NoError(t, err)
+	}
+	// out of attempts after two
+	require.Len(t, recv.events(), 2)
+	deliveries, err := manager.Deliveries(webhook.DeliveryFilter{})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	require.Equal(t, model.WebhookDeliveryFailed, deliveries[0].Status)
+	require.Equal(t, 2, deliveries[0].Attempts)
+	require.Equal(t, http.StatusServiceUnavailable, deliveries[0].ResponseCode)
+	require.Contains(t, deliveries[0].LastError, "503")
+	require.Equal(t, model.CallbackStatusFailed, callbackStatus(t, db, deposit.ID))
+
+	// a redelivery gets a fresh attempt budget
+	recv.status = http.StatusNoContent
+	delivery, err := manager.Redeliver(deliveries[0].ID)
+	require.NoError(t, err)
+	require.Equal(t, model.WebhookDeliveryPending, delivery.Status)
+	require.Zero(t, delivery.Attempts)
+	require.Equal(t, model.CallbackStatusPending, callbackStatus(t, db, deposit.ID))
+	delivered, err := dispatcher.Deliver()
+	require.NoError(t, err)
+	require.Equal(t, 1, delivered)
+	require.Equal(t, model.CallbackStatusSuccess, callbackStatus(t, db, deposit.ID))
+
+	_, err = manager.Redeliver(100)
+	require.ErrorIs(t, err, webhook.ErrDeliveryNotFound)
+}
+
+func TestBackoff(t *testing.T) {
+	db := openSqlite(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	_, _, err := webhook.NewManager(db).SaveSubscription(webhook.Subscription{Name: "partner", URL: srv.URL})
+	require.NoError(t, err)
+	require.NoError(t, db.Create(&model.Deposit{BtcTxHash: "tx"}).Error)
+
+	dispatcher := webhook.NewDispatcher(config.WebhookConfig{MaxAttempts: 5, MinBackoff: 60, MaxBackoff: 90, Timeout: 5}, db, log.NewNopLogger())
+	_, err = dispatcher.Notify()
+	require.NoError(t, err)
+	for attempt, wait := range []time.Duration{time.Minute, 90 * time.Second} {
+		require.NoError(t, db.Model(&model.WebhookDelivery{}).Where("id = 1").
+			Update(model.WebhookDelivery{}.Column().NextAttemptAt, time.Now()).Error)
+		before := time.Now()
+		delivered, err := dispatcher.Deliver()
+		require.NoError(t, err)
+		require.Equal(t, 1, delivered)
+		// not due before the backoff
+		delivered, err = dispatcher.Deliver()
+		require.NoError(t, err)
+		require.Zero(t, delivered)
+		var delivery model.WebhookDelivery
+		require.NoError(t, db.First(&delivery, 1).Error)
+		require.Equal(t, attempt+1, delivery.Attempts)
+		require.WithinDuration(t, before.Add(wait), delivery.NextAttemptAt, 5*time.Second)
+	}
+}
+
+func TestSaveSubscription(t *testing.T) {
+	manager := webhook.NewManager(openSqlite(t))
+	_, _, err := manager.SaveSubscription(webhook.Subscription{Name: "partner", URL: "ftp://partner"})
+	require.ErrorIs(t, err, webhook.ErrInvalidSubscription)
+	_, _, err = manager.SaveSubscription(webhook.Subscription{Name: "partner", URL: "https://partner", Events: "deposit.lost"})
+	require.ErrorIs(t, err, webhook.ErrInvalidSubscription)
+
+	_, secret, err := manager.SaveSubscription(webhook.Subscription{Name: "partner", URL: "https://partner"})
+	require.NoError(t, err)
+	require.NotEmpty(t, secret)
+	disabled := false
+	sub, secret, err := manager.SaveSubscription(webhook.Subscription{Name: "partner", URL: "https://partner/hooks", Enabled: &disabled})
+	require.NoError(t, err)
+	require.Empty(t, secret)
+	require.Equal(t, "https://partner/hooks", sub.URL)
+	require.False(t, sub.Enabled)
+	subs, err := manager.Subscriptions()
+	require.NoError(t, err)
+	require.Len(t, subs, 1)
+}
+
+func mustGet(t *testing.T, data json.RawMessage, key string) json.RawMessage {
+	var row map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(data, &row))
+	return row[key]
+}
@@ -0,0 +1,184 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const (
+	Namespace = "abe"
+
+	RPCChainAbec = "abec"
+	RPCChainEVM  = "evm"
+
+	// parse error types of the indexer
+	ParseErrConfirmations = "confirmations"
+	ParseErrBlock         = "parse_block"
+	ParseErrHandleResults = "handle_results"
+	ParseErrSaveIndex     = "save_index"
+)
+
+// Registry holds the metrics served on /metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	// IndexHeight is the last block height saved in btc_index
+	IndexHeight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace, Subsystem: "indexer", Name: "index_height",
+		Help: "Last block height indexed.",
+	})
+	// LatestBlock is the latest block height of the abec node
+	LatestBlock = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace, Subsystem: "indexer", Name: "latest_block",
+		Help: "Latest block height of the node.",
+	})
+	// IndexLag is the blocks between the node latest block and the index height
+	IndexLag = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace, Subsystem: "indexer", Name: "lag_blocks",
+		Help: "Blocks the index is behind the node latest block.",
+	})
+	// BlocksIndexed counts the indexed blocks, its rate is the blocks per second
+	BlocksIndexed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace, Subsystem: "indexer", Name: "blocks_indexed_total",
+		Help: "Blocks indexed.",
+	})
+	// ParseErrors counts the indexer errors by type
+	ParseErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace, Subsystem: "indexer", Name: "parse_errors_total",
+		Help: "Indexer block parse errors by type.",
+	}, []string{"type"})
+
+	// Deposits is the deposits by b2_tx_status
+	Deposits = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace, Subsystem: "bridge", Name: "deposits",
+		Help: "Deposits by b2 tx status.",
+	}, []string{"status"})
+	// MintLatency is the seconds from the deposit block time to the l2 receipt
+	MintLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: Namespace, Subsystem: "bridge", Name: "mint_latency_seconds",
+		Help:    "Seconds from the deposit block time to the l2 mint receipt.",
+		Buckets: prometheus.ExponentialBuckets(30, 2, 12),
+	})
+	// GasSpent is the l2 gas fee paid by the bridge in wei
+	GasSpent = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace, Subsystem: "bridge", Name: "gas_spent_wei_total",
+		Help: "L2 gas fee paid by the bridge in wei.",
+	})
+	// HotWalletBalance is the balance of the bridge l2 sender in wei
+	HotWalletBalance = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace, Subsystem: "bridge", Name: "hot_wallet_balance_wei",
+		Help: "Balance of the bridge l2 sender account in wei.",
+	})
+
+	// Withdraws is the withdraws by status
+	Withdraws = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace, Subsystem: "withdraw", Name: "withdraws",
+		Help: "Withdraws by status.",
+	}, []string{"status"})
+	// WithdrawTxs is the withdraw txs by status
+	WithdrawTxs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace, Subsystem: "withdraw", Name: "txs",
+		Help: "Withdraw txs by status.",
+	}, []string{"status"})
+	// WithdrawFeeBumps counts the fee bumps of stuck withdraw txs by strategy
+	WithdrawFeeBumps = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace, Subsystem: "withdraw", Name: "fee_bumps_total",
+		Help: "Fee bumps of stuck withdraw txs by strategy.",
+	}, []string{"strategy"})
+
+	// OutboxPublishFailures counts the failed publish attempts of outbox events
+	OutboxPublishFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace, Subsystem: "outbox", Name: "publish_failures_total",
+		Help: "Failed publish attempts of outbox events.",
+	})
+	// OutboxParked is the outbox events parked after their last failed attempt
+	OutboxParked = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace, Subsystem: "outbox", Name: "parked_events",
+		Help: "Outbox events parked after max attempts, their rows wait for them.",
+	})
+
+	// ReconcileDiscrepancies is the discrepancies of the last reconciliation by kind
+	ReconcileDiscrepancies = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace, Subsystem: "reconcile", Name: "discrepancies",
+		Help: "Discrepancies of the last reconciliation run by kind.",
+	}, []string{"kind"})
+	// ReconcileSupplyDiff is the supply less the confirmed deposits less the paid withdraws of the last reconciliation
+	ReconcileSupplyDiff = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace, Subsystem: "reconcile", Name: "supply_diff",
+		Help: "Supply less the confirmed deposits less the paid withdraws of the last reconciliation run.",
+	})
+	// ReconcileLastRun is the unix time the last reconciliation finished
+	ReconcileLastRun = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace, Subsystem: "reconcile", Name: "last_run_timestamp_seconds",
+		Help: "Unix time the last reconciliation run finished.",
+	})
+
+	// ServiceRestarts counts the restarts of crashed services by service
+	ServiceRestarts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace, Subsystem: "supervisor", Name: "service_restarts_total",
+		Help: "Restarts of crashed services by service.",
+	}, []string{"service"})
+
+	// Leader is 1 while this replica holds the leader lease
+	Leader = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace, Subsystem: "leader", Name: "is_leader",
+		Help: "1 while this replica holds the leader lease and runs the writers.",
+	})
+	// LeaderTransitions counts the elections of this replica
+	LeaderTransitions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace, Subsystem: "leader", Name: "elections_total",
+		Help: "Times this replica acquired the leader lease.",
+	})
+
+	// RPCDuration is the rpc call latency by chain and method
+	RPCDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace, Subsystem: "rpc", Name: "duration_seconds",
+		Help:    "RPC call latency by chain and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"chain", "method"})
+	// RPCErrors counts the failed rpc calls by chain and method
+	RPCErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace, Subsystem: "rpc", Name: "errors_total",
+		Help: "Failed RPC calls by chain and method.",
+	}, []string{"chain", "method"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		IndexHeight, LatestBlock, IndexLag, BlocksIndexed, ParseErrors,
+		Deposits, MintLatency, GasSpent, HotWalletBalance,
+		Withdraws, WithdrawTxs, WithdrawFeeBumps,
+		OutboxPublishFailures, OutboxParked,
+		ReconcileDiscrepancies, ReconcileSupplyDiff, ReconcileLastRun,
+		ServiceRestarts, Leader, LeaderTransitions,
+		RPCDuration, RPCErrors,
+	)
+}
+
+// SetIndexHeight updates the index height, latest block and lag gauges
+func SetIndexHeight(indexHeight int64, latestBlock int64) {
+	IndexHeight.Set(float64(indexHeight))
+	LatestBlock.Set(float64(latestBlock))
+	IndexLag.Set(float64(latestBlock - indexHeight))
+}
+
+// SetStatusCounts replaces the values of a status gauge, statuses missing from counts are dropped
+func SetStatusCounts(gauge *prometheus.GaugeVec, counts map[int]int64) {
+	gauge.Reset()
+	for status, count := range counts {
+		gauge.WithLabelValues(strconv.Itoa(status)).Set(float64(count))
+	}
+}
+
+// ObserveRPC records the latency and the result of an rpc call started at start
+func ObserveRPC(chain string, method string, start time.Time, err error) {
+	RPCDuration.WithLabelValues(chain, method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		RPCErrors.WithLabelValues(chain, method).Inc()
+	}
+}
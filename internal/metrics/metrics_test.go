@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/b2network/b2-indexer/pkg/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetStatusCounts(t *testing.T) {
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_status"}, []string{"status"})
+	SetStatusCounts(gauge, map[int]int64{1: 3, 2: 5})
+	require.Equal(t, float64(5), testutil.ToFloat64(gauge.WithLabelValues("2")))
+
+	// statuses missing from the counts are dropped
+	SetStatusCounts(gauge, map[int]int64{2: 1})
+	require.Equal(t, 1, testutil.CollectAndCount(gauge))
+}
+
+func TestObserveRPC(t *testing.T) {
+	before := testutil.ToFloat64(RPCErrors.WithLabelValues("test", "getblock"))
+	ObserveRPC("test", "getblock", time.Now(), nil)
+	ObserveRPC("test", "getblock", time.Now(), errors.New("rpc err"))
+	require.Equal(t, before+1, testutil.ToFloat64(RPCErrors.WithLabelValues("test", "getblock")))
+}
+
+func TestRPCHTTPClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "eth_fail") {
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"fail"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer srv.Close()
+
+	client := NewRPCHTTPClient("test_evm")
+	post := func(body string) string {
+		resp, err := client.Post(srv.URL, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	// the response body is still readable by the caller
+	require.Contains(t, post(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`), `"result":"0x1"`)
+	post(`{"jsonrpc":"2.0","id":1,"method":"eth_fail"}`)
+
+	require.Equal(t, 0.0, testutil.ToFloat64(RPCErrors.WithLabelValues("test_evm", "eth_blockNumber")))
+	require.Equal(t, 1.0, testutil.ToFloat64(RPCErrors.WithLabelValues("test_evm", "eth_fail")))
+	require.Equal(t, "batch", rpcMethod([]byte(`[{"method":"eth_call"}]`)))
+}
+
+func TestServerWithoutMetrics(t *testing.T) {
+	probe := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+	for _, serveMetrics := range []bool{true, false} {
+		s := NewServer("0", serveMetrics, log.NewNopLogger())
+		s.Handle("/healthz", probe)
+
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		rec = httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		if serveMetrics {
+			require.Equal(t, http.StatusOK, rec.Code)
+		} else {
+			require.Equal(t, http.StatusNotFound, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+var errRPCResponse = errors.New("rpc error response")
+
+// rpcTransport observes the json-rpc calls sent through it by method
+type rpcTransport struct {
+	chain string
+	base  http.RoundTripper
+}
+
+// NewRPCHTTPClient returns an http client observing the json-rpc calls to chain
+func NewRPCHTTPClient(chain string) *http.Client {
+	return &http.Client{Transport: &rpcTransport{chain: chain, base: http.DefaultTransport}}
+}
+
+func (t *rpcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	method := "unknown"
+	if req.Body != nil && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			data, _ := io.ReadAll(body)
+			body.Close()
+			method = rpcMethod(data)
+		}
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		ObserveRPC(t.chain, method, start, err)
+		return nil, err
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		ObserveRPC(t.chain, method, start, err)
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	ObserveRPC(t.chain, method, start, rpcResponseError(resp.StatusCode, data))
+	return resp, nil
+}
+
+// rpcMethod returns the method of a json-rpc request, "batch" for batch requests
+func rpcMethod(data []byte) string {
+	root := gjson.ParseBytes(data)
+	if root.IsArray() {
+		return "batch"
+	}
+	if method := root.Get("method").String(); method != "" {
+		return method
+	}
+	return "unknown"
+}
+
+func rpcResponseError(statusCode int, data []byte) error {
+	if statusCode >= http.StatusBadRequest {
+		return fmt.Errorf("%w: status %d", errRPCResponse, statusCode)
+	}
+	root := gjson.ParseBytes(data)
+	if root.IsArray() {
+		for _, item := range root.Array() {
+			if errField := item.Get("error"); errField.Exists() && errField.Type != gjson.Null {
+				return errRPCResponse
+			}
+		}
+		return nil
+	}
+	if errField := root.Get("error"); errField.Exists() && errField.Type != gjson.Null {
+		return errRPCResponse
+	}
+	return nil
+}
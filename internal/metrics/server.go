@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/b2network/b2-indexer/pkg/log"
+	"github.com/cometbft/cometbft/libs/service"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	ServerName = "MetricsServer"
+
+	shutdownTimeout = 10 * time.Second
+)
+
+// Server serves the prometheus metrics on /metrics and the handlers added next to them
+type Server struct {
+	service.BaseService
+
+	mux    *http.ServeMux
+	server *http.Server
+	log    log.Logger
+}
+
+// NewServer returns a new metrics server instance listening on port, without serveMetrics
+// it only serves the handlers added by Handle
+func NewServer(port string, serveMetrics bool, log log.Logger) *Server {
+	mux := http.NewServeMux()
+	if serveMetrics {
+		mux.Handle("/metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+	}
+	s := &Server{mux: mux, log: log}
+	s.server = &http.Server{
+		Addr:              net.JoinHostPort("", port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	s.BaseService = *service.NewBaseService(nil, ServerName, s)
+	return s
+}
+
+// Handle serves handler on pattern next to the metrics, e.g. the health endpoints
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// OnStart implements service.Service by listening on the metrics port
+func (s *Server) OnStart() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	s.log.Infow("metrics server listening", "address", listener.Addr().String())
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.log.Errorw("metrics server serve err", "error", err)
+		}
+	}()
+	return nil
+}
+
+// OnStop implements service.Service by shutting down the metrics server
+func (s *Server) OnStop() {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		s.log.Errorw("metrics server shutdown err", "error", err)
+	}
+}
@@ -0,0 +1,343 @@
+package migration
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/pkg/log"
+	"gorm.io/gorm"
+)
+
+// lockID is the advisory lock serializing migrations of concurrent processes
+const lockID = 7_283_001
+
+//go:embed sql/*.sql
+var sqlFS embed.FS
+
+var fileRegexp = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+var (
+	ErrUnknownVersion = errors.New("unknown schema version")
+	ErrPending        = errors.New("pending schema migrations")
+	ErrNoMigration    = errors.New("no migration")
+	ErrSqliteDown     = errors.New("sqlite schema migrations can not be reverted, remove the db file instead")
+)
+
+// models are the tables of the migrations, a sqlite db has their schema
+var models = []interface{}{
+	&model.Deposit{}, &model.BtcIndex{}, &model.RollupDeposit{}, &model.RollupIndex{},
+	&model.Withdraw{}, &model.WithdrawTx{}, &model.WithdrawSign{}, &model.LeaderLease{},
+	&model.OutboxEvent{}, &model.WebhookSubscription{}, &model.WebhookDelivery{},
+	&model.ReconciliationReport{}, &model.ReconciliationDiscrepancy{},
+	&model.AdminAudit{},
+}
+
+const createTableSQL = `CREATE TABLE IF NOT EXISTS "schema_migrations" ("version" bigint,"name" varchar(256) NOT NULL DEFAULT '',"applied_at" timestamptz NOT NULL,PRIMARY KEY ("version"))`
+
+// Migration is a schema version with the sql upgrading to and downgrading from it
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is the state of a migration, AppliedAt is zero while pending
+type Status struct {
+	Version   int64     `json:"version"`
+	Name      string    `json:"name"`
+	Applied   bool      `json:"applied"`
+	AppliedAt time.Time `json:"applied_at,omitempty"`
+	// Unknown marks an applied version this build has no migration for
+	Unknown bool `json:"unknown,omitempty"`
+}
+
+// Migrator applies the migrations embedded in the binary, each in a transaction with its version record.
+// The sql files are postgres, a sqlite db is auto migrated to the models of this build by every version.
+type Migrator struct {
+	db         *gorm.DB
+	log        log.Logger
+	migrations []Migration
+}
+
+// New returns a migrator of the embedded migrations
+func New(db *gorm.DB, logger log.Logger) (*Migrator, error) {
+	migrations, err := load(sqlFS, "sql")
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, log: logger, migrations: migrations}, nil
+}
+
+// load reads the migrations of dir, versions must be 1, 2, 3... with an up and a down file
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		matches := fileRegexp.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return nil, fmt.Errorf("invalid migration file name %s", entry.Name())
+		}
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = m
+		}
+		if m.Name != matches[2] {
+			return nil, fmt.Errorf("migration %d has names %s and %s", version, m.Name, matches[2])
+		}
+		if matches[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			return nil, fmt.Errorf("missing migration %d", i+1)
+		}
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d needs an up and a down file", m.Version)
+		}
+	}
+	return migrations, nil
+}
+
+// Latest returns the schema version of this build
+func (m *Migrator) Latest() int64 {
+	return int64(len(m.migrations))
+}
+
+// Version returns the current schema version of the db, 0 before the first migration
+func (m *Migrator) Version() (int64, error) {
+	applied, err := m.applied(m.db)
+	if err != nil {
+		return 0, err
+	}
+	if len(applied) == 0 {
+		return 0, nil
+	}
+	return applied[len(applied)-1].Version, nil
+}
+
+// Check returns an error unless the db is at the schema version of this build,
+// the services refuse to start against another schema
+func (m *Migrator) Check() error {
+	applied, err := m.applied(m.db)
+	if err != nil {
+		return err
+	}
+	for _, record := range applied {
+		if record.Version > m.Latest() {
+			return fmt.Errorf("%w %d, this build knows up to %d", ErrUnknownVersion, record.Version, m.Latest())
+		}
+	}
+	if int64(len(applied)) != m.Latest() {
+		return fmt.Errorf("%w: schema version %d of %d, run `abe-indexer migrate up`", ErrPending, len(applied), m.Latest())
+	}
+	return nil
+}
+
+// Status returns the state of every migration
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied(m.db)
+	if err != nil {
+		return nil, err
+	}
+	appliedAt := make(map[int64]model.SchemaMigration, len(applied))
+	for _, record := range applied {
+		appliedAt[record.Version] = record
+	}
+	statusList := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if record, ok := appliedAt[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = record.AppliedAt
+		}
+		statusList = append(statusList, status)
+	}
+	for _, record := range applied {
+		if record.Version > m.Latest() {
+			statusList = append(statusList, Status{
+				Version:   record.Version,
+				Name:      record.Name,
+				Applied:   true,
+				AppliedAt: record.AppliedAt,
+				Unknown:   true,
+			})
+		}
+	}
+	return statusList, nil
+}
+
+// Up applies the pending migrations up to version target, 0 for the latest
+func (m *Migrator) Up(target int64) ([]Migration, error) {
+	if target == 0 {
+		target = m.Latest()
+	}
+	if target < 0 || target > m.Latest() {
+		return nil, fmt.Errorf("%w %d", ErrNoMigration, target)
+	}
+	var done []Migration
+	for _, migration := range m.migrations[:target] {
+		applied, err := m.step(migration, true)
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s up: %w", migration.Version, migration.Name, err)
+		}
+		if applied {
+			done = append(done, migration)
+		}
+	}
+	return done, nil
+}
+
+// Down reverts the last steps applied migrations
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	if m.sqlite() {
+		return nil, ErrSqliteDown
+	}
+	var done []Migration
+	for i := 0; i < steps; i++ {
+		version, err := m.Version()
+		if err != nil {
+			return done, err
+		}
+		if version == 0 {
+			break
+		}
+		if version > m.Latest() {
+			return done, fmt.Errorf("%w %d, this build knows up to %d", ErrUnknownVersion, version, m.Latest())
+		}
+		migration := m.migrations[version-1]
+		if _, err := m.step(migration, false); err != nil {
+			return done, fmt.Errorf("migration %d_%s down: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// step applies or reverts migration unless another process already did
+func (m *Migrator) step(migration Migration, up bool) (bool, error) {
+	changed := false
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		// a sqlite db is locked by its first write
+		if !m.sqlite() {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", lockID).Error; err != nil {
+				return err
+			}
+		}
+		if err := m.createTable(tx); err != nil {
+			return err
+		}
+		applied, err := m.applied(tx)
+		if err != nil {
+			return err
+		}
+		var version int64
+		if len(applied) > 0 {
+			version = applied[len(applied)-1].Version
+		}
+		if up {
+			if version >= migration.Version {
+				return nil
+			}
+			if version != migration.Version-1 {
+				return fmt.Errorf("schema version %d, expected %d", version, migration.Version-1)
+			}
+			if err := m.up(tx, migration); err != nil {
+				return err
+			}
+			err = tx.Create(&model.SchemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		} else {
+			if version != migration.Version {
+				return fmt.Errorf("schema version %d, expected %d", version, migration.Version)
+			}
+			if err := tx.Exec(migration.Down).Error; err != nil {
+				return err
+			}
+			err = tx.Where(fmt.Sprintf("%s = ?", model.SchemaMigration{}.Column().Version), migration.Version).
+				Delete(&model.SchemaMigration{}).Error
+		}
+		if err != nil {
+			return err
+		}
+		changed = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	if changed {
+		m.log.Infow("schema migration done", "version", migration.Version, "name", migration.Name, "up", up)
+	}
+	return changed, nil
+}
+
+// up applies migration, or the schema of the models on sqlite
+func (m *Migrator) up(tx *gorm.DB, migration Migration) error {
+	if m.sqlite() {
+		if err := tx.AutoMigrate(models...); err != nil {
+			return err
+		}
+		return sqliteOutboxTriggers(tx)
+	}
+	return tx.Exec(migration.Up).Error
+}
+
+// createTable creates the schema_migrations table, its sqlite time column must be
+// a datetime to scan as a time
+func (m *Migrator) createTable(tx *gorm.DB) error {
+	if m.sqlite() {
+		return tx.AutoMigrate(&model.SchemaMigration{})
+	}
+	return tx.Exec(createTableSQL).Error
+}
+
+func (m *Migrator) sqlite() bool {
+	return m.db.Dialector.Name() == "sqlite"
+}
+
+// applied returns the applied migrations by version
+func (m *Migrator) applied(db *gorm.DB) ([]model.SchemaMigration, error) {
+	if !db.Migrator().HasTable(&model.SchemaMigration{}) {
+		return nil, nil
+	}
+	var applied []model.SchemaMigration
+	err := db.Order(model.SchemaMigration{}.Column().Version).Find(&applied).Error
+	if err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
@@ -0,0 +1,122 @@
+package migration
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/pkg/log"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+func TestLoadEmbedded(t *testing.T) {
+	migrations, err := load(sqlFS, "sql")
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	for i, m := range migrations {
+		require.Equal(t, int64(i+1), m.Version)
+		require.NotEmpty(t, m.Up)
+		require.NotEmpty(t, m.Down)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		err   string
+	}{
+		{
+			name:  "file name",
+			files: fstest.MapFS{"sql/init.up.sql": {Data: []byte("SELECT 1")}},
+			err:   "invalid migration file name",
+		},
+		{
+			name: "missing version",
+			files: fstest.MapFS{
+				"sql/0002_b.up.sql":   {Data: []byte("SELECT 1")},
+				"sql/0002_b.down.sql": {Data: []byte("SELECT 1")},
+			},
+			err: "missing migration 1",
+		},
+		{
+			name:  "missing down",
+			files: fstest.MapFS{"sql/0001_a.up.sql": {Data: []byte("SELECT 1")}},
+			err:   "needs an up and a down file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load(tt.files, "sql")
+			require.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+// TestModelsMigrated fails when a model column is not created by a migration
+func TestModelsMigrated(t *testing.T) {
+	migrations, err := load(sqlFS, "sql")
+	require.NoError(t, err)
+	var statements []string
+	for _, m := range migrations {
+		statements = append(statements, strings.Split(m.Up, ";")...)
+	}
+	for _, m := range models {
+		s, err := schema.Parse(m, &sync.Map{}, schema.NamingStrategy{})
+		require.NoError(t, err)
+		for _, column := range s.DBNames {
+			found := false
+			for _, statement := range statements {
+				if strings.Contains(statement, `"`+s.Table+`"`) && strings.Contains(statement, `"`+column+`"`) &&
+					(strings.Contains(statement, "CREATE TABLE") || strings.Contains(statement, "ADD COLUMN")) {
+					found = true
+					break
+				}
+			}
+			require.True(t, found, "column %s.%s not migrated", s.Table, column)
+		}
+	}
+}
+
+func TestSqlite(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "indexer.db")), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	require.NoError(t, err)
+	migrator, err := New(db, log.NewNopLogger())
+	require.NoError(t, err)
+	require.ErrorIs(t, migrator.Check(), ErrPending)
+
+	done, err := migrator.Up(0)
+	require.NoError(t, err)
+	require.Len(t, done, int(migrator.Latest()))
+	require.NoError(t, migrator.Check())
+	for _, m := range models {
+		require.True(t, db.Migrator().HasTable(m))
+	}
+	require.NoError(t, db.Create(&model.Deposit{BtcTxHash: "tx", BtcTos: `["to"]`}).Error)
+	// the insert wrote its outbox event, json columns are nested
+	var event model.OutboxEvent
+	require.NoError(t, db.First(&event).Error)
+	require.Equal(t, model.Deposit{}.TableName(), event.Aggregate)
+	require.Equal(t, model.OutboxEventInsert, event.EventType)
+	require.False(t, event.CreatedAt.IsZero())
+	require.Equal(t, "tx", gjson.Get(string(event.Payload), "btc_tx_hash").String())
+	require.Equal(t, "to", gjson.Get(string(event.Payload), "btc_tos.0").String())
+
+	// up again is a no-op
+	done, err = migrator.Up(0)
+	require.NoError(t, err)
+	require.Empty(t, done)
+
+	_, err = migrator.Down(1)
+	require.ErrorIs(t, err, ErrSqliteDown)
+}
@@ -0,0 +1,70 @@
+package migration
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/b2network/b2-indexer/internal/model"
+	"gorm.io/gorm"
+)
+
+// outboxModels are the tables whose changes write outbox events, see 0006_outbox_event.up.sql
+var outboxModels = []interface{}{&model.Deposit{}, &model.Withdraw{}, &model.WithdrawTx{}}
+
+// outboxIgnoredColumns are the columns whose update alone writes no outbox event: the update
+// time and the webhook delivery state of a deposit, written by the webhook dispatcher
+var outboxIgnoredColumns = map[string]bool{"updated_at": true, model.Deposit{}.Column().CallbackStatus: true}
+
+// sqliteOutboxTriggers creates the sqlite triggers writing the outbox events. sqlite has
+// no row to json function, the payload lists the columns of the models, so the triggers
+// are recreated with every schema version.
+func sqliteOutboxTriggers(tx *gorm.DB) error {
+	for _, m := range outboxModels {
+		stmt := &gorm.Statement{DB: tx}
+		if err := stmt.Parse(m); err != nil {
+			return err
+		}
+		table := stmt.Schema.Table
+		for _, op := range []string{model.OutboxEventInsert, model.OutboxEventUpdate, model.OutboxEventDelete} {
+			row := "NEW"
+			if op == model.OutboxEventDelete {
+				row = "OLD"
+			}
+			var payload, changes []string
+			for _, field := range stmt.Schema.Fields {
+				if field.DBName == "" {
+					continue
+				}
+				if !outboxIgnoredColumns[field.DBName] {
+					changes = append(changes, fmt.Sprintf(`OLD."%[1]s" IS NOT NEW."%[1]s"`, field.DBName))
+				}
+				value := fmt.Sprintf(`%s."%s"`, row, field.DBName)
+				// json columns are nested documents like the jsonb of postgres
+				if field.FieldType == reflect.TypeOf(model.JSON("")) {
+					value = fmt.Sprintf("CASE WHEN json_valid(%s) THEN json(%s) ELSE %s END", value, value, value)
+				}
+				payload = append(payload, fmt.Sprintf("'%s', %s", field.DBName, value))
+			}
+			// an update writing the same values is no change
+			var when string
+			if op == model.OutboxEventUpdate {
+				when = "WHEN " + strings.Join(changes, " OR ") + " "
+			}
+			name := fmt.Sprintf("outbox_event_%s_%s", table, op)
+			sqls := []string{
+				fmt.Sprintf(`DROP TRIGGER IF EXISTS "%s"`, name),
+				fmt.Sprintf(`CREATE TRIGGER "%s" AFTER %s ON "%s" FOR EACH ROW %sBEGIN `+
+					`INSERT INTO "outbox_event" ("created_at","updated_at","aggregate","aggregate_id","event_type","payload") `+
+					`VALUES (strftime('%%Y-%%m-%%d %%H:%%M:%%f', 'now'), strftime('%%Y-%%m-%%d %%H:%%M:%%f', 'now'), '%s', %s."id", '%s', json_object(%s)); END`,
+					name, strings.ToUpper(op), table, when, table, row, op, strings.Join(payload, ", ")),
+			}
+			for _, sql := range sqls {
+				if err := tx.Exec(sql).Error; err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS "withdraw_tx";
+DROP TABLE IF EXISTS "withdraw_history";
+DROP TABLE IF EXISTS "rollup_index";
+DROP TABLE IF EXISTS "rollup_deposit_history";
+DROP TABLE IF EXISTS "btc_index";
+DROP TABLE IF EXISTS "deposit_history";
@@ -0,0 +1,57 @@
+-- tables as created by AutoMigrate before versioned migrations, existing
+-- databases are adopted as they are
+CREATE TABLE IF NOT EXISTS "deposit_history" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"btc_block_number" bigint,"btc_tx_index" bigint,"btc_tx_hash" text NOT NULL DEFAULT '',"btc_tx_type" SMALLINT DEFAULT 0,"btc_froms" jsonb,"btc_from" text NOT NULL DEFAULT '',"btc_tos" jsonb,"btc_to" text NOT NULL DEFAULT '',"btc_from_aa_address" text DEFAULT '',"btc_value" bigint DEFAULT 0,"b2_tx_from" text DEFAULT '',"b2_tx_hash" text NOT NULL DEFAULT '',"b2_tx_nonce" bigint DEFAULT 0,"b2_tx_status" SMALLINT DEFAULT 1,"b2_tx_retry" SMALLINT DEFAULT 0,"btc_block_time" timestamptz,"callback_status" SMALLINT DEFAULT 0,"listener_status" SMALLINT DEFAULT 0,"b2_tx_check" SMALLINT DEFAULT 1,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_deposit_history_btc_block_number" ON "deposit_history" ("btc_block_number");
+CREATE INDEX IF NOT EXISTS "idx_deposit_history_b2_tx_hash" ON "deposit_history" ("b2_tx_hash");
+CREATE INDEX IF NOT EXISTS "idx_deposit_history_btc_to" ON "deposit_history" ("btc_to");
+CREATE INDEX IF NOT EXISTS "idx_deposit_history_btc_from" ON "deposit_history" ("btc_from");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_deposit_history_btc_tx_hash" ON "deposit_history" ("btc_tx_hash");
+COMMENT ON COLUMN "deposit_history"."btc_block_number" IS 'bitcoin block number';
+COMMENT ON COLUMN "deposit_history"."btc_tx_index" IS 'bitcoin tx index';
+COMMENT ON COLUMN "deposit_history"."btc_tx_hash" IS 'bitcoin tx hash';
+COMMENT ON COLUMN "deposit_history"."btc_tx_type" IS 'btc tx type';
+COMMENT ON COLUMN "deposit_history"."btc_froms" IS 'bitcoin transfer, from may be multiple';
+COMMENT ON COLUMN "deposit_history"."btc_tos" IS 'bitcoin transfer, to may be multiple';
+COMMENT ON COLUMN "deposit_history"."btc_from_aa_address" IS 'from aa address';
+COMMENT ON COLUMN "deposit_history"."btc_value" IS 'bitcoin transfer value';
+COMMENT ON COLUMN "deposit_history"."b2_tx_from" IS 'from address';
+COMMENT ON COLUMN "deposit_history"."b2_tx_hash" IS 'b2 network tx hash';
+
+CREATE TABLE IF NOT EXISTS "btc_index" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"btc_index_block" bigint,"btc_index_tx" bigint,PRIMARY KEY ("id"));
+COMMENT ON COLUMN "btc_index"."btc_index_block" IS 'bitcoin index block';
+COMMENT ON COLUMN "btc_index"."btc_index_tx" IS 'bitcoin index tx';
+
+CREATE TABLE IF NOT EXISTS "rollup_deposit_history" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"btc_tx_hash" varchar(64) NOT NULL DEFAULT '',"btc_from_aa_address" varchar(42) DEFAULT '',"btc_value" bigint DEFAULT 0,"b2_block_number" bigint,"b2_block_hash" varchar(256),"b2_tx_from" varchar(42) DEFAULT '',"b2_tx_hash" varchar(256) DEFAULT '',"b2_tx_index" bigint,"b2_log_index" bigint,"status" smallint DEFAULT 1,PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_rollup_deposit_history_b2_tx_hash" ON "rollup_deposit_history" ("b2_tx_hash");
+COMMENT ON COLUMN "rollup_deposit_history"."btc_tx_hash" IS 'bitcoin tx hash';
+COMMENT ON COLUMN "rollup_deposit_history"."btc_from_aa_address" IS 'from aa address';
+COMMENT ON COLUMN "rollup_deposit_history"."btc_value" IS 'bitcoin transfer value';
+COMMENT ON COLUMN "rollup_deposit_history"."b2_block_number" IS 'b2 block number';
+COMMENT ON COLUMN "rollup_deposit_history"."b2_block_hash" IS 'b2 block hash';
+COMMENT ON COLUMN "rollup_deposit_history"."b2_tx_from" IS 'from address';
+COMMENT ON COLUMN "rollup_deposit_history"."b2_tx_hash" IS 'b2 network tx hash';
+COMMENT ON COLUMN "rollup_deposit_history"."b2_tx_index" IS 'b2 tx index';
+COMMENT ON COLUMN "rollup_deposit_history"."b2_log_index" IS 'b2 log index';
+
+CREATE TABLE IF NOT EXISTS "rollup_index" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"b2_index_block" bigint,"b2_index_tx" bigint,"b2_log_index" bigint,PRIMARY KEY ("id"));
+COMMENT ON COLUMN "rollup_index"."b2_index_block" IS 'b2 index block';
+COMMENT ON COLUMN "rollup_index"."b2_index_tx" IS 'b2 tx index';
+COMMENT ON COLUMN "rollup_index"."b2_log_index" IS 'b2 log index';
+
+CREATE TABLE IF NOT EXISTS "withdraw_history" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"btc_from" varchar(256) DEFAULT '',"btc_to" varchar(256) DEFAULT '',"btc_value" bigint DEFAULT 0,"b2_block_number" bigint,"b2_block_hash" varchar(256),"b2_tx_hash" varchar(256) DEFAULT '',"b2_tx_index" bigint,"b2_log_index" bigint,"status" smallint DEFAULT 1,PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_withdraw_history_b2_tx_hash" ON "withdraw_history" ("b2_tx_hash");
+CREATE INDEX IF NOT EXISTS "idx_withdraw_history_btc_to" ON "withdraw_history" ("btc_to");
+CREATE INDEX IF NOT EXISTS "idx_withdraw_history_btc_from" ON "withdraw_history" ("btc_from");
+COMMENT ON COLUMN "withdraw_history"."btc_value" IS 'bitcoin transfer value';
+COMMENT ON COLUMN "withdraw_history"."b2_block_number" IS 'b2 block number';
+COMMENT ON COLUMN "withdraw_history"."b2_block_hash" IS 'b2 block hash';
+COMMENT ON COLUMN "withdraw_history"."b2_tx_hash" IS 'b2 network tx hash';
+COMMENT ON COLUMN "withdraw_history"."b2_tx_index" IS 'b2 tx index';
+COMMENT ON COLUMN "withdraw_history"."b2_log_index" IS 'b2 log index';
+
+CREATE TABLE IF NOT EXISTS "withdraw_tx" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"btc_tx_id" varchar(256) DEFAULT '',"b2_tx_hashes" text DEFAULT '',"btc_tx" text DEFAULT '',"btc_tx_hash" varchar(256) DEFAULT '',"status" smallint DEFAULT 1,"reason" varchar(256) DEFAULT '',PRIMARY KEY ("id"));
+COMMENT ON COLUMN "withdraw_tx"."btc_tx_id" IS 'bitcoin tx id';
+COMMENT ON COLUMN "withdraw_tx"."b2_tx_hashes" IS 'bitcoin tx hash list';
+COMMENT ON COLUMN "withdraw_tx"."btc_tx" IS 'bitcoin tx';
+COMMENT ON COLUMN "withdraw_tx"."btc_tx_hash" IS 'bitcoin tx hash';
+COMMENT ON COLUMN "withdraw_tx"."reason" IS 'error reason';
@@ -0,0 +1,15 @@
+DROP TABLE IF EXISTS "withdraw_sign";
+
+DROP INDEX IF EXISTS "idx_withdraw_tx_replaces_id";
+ALTER TABLE "withdraw_tx" DROP COLUMN IF EXISTS "broadcast_at";
+ALTER TABLE "withdraw_tx" DROP COLUMN IF EXISTS "bump_count";
+ALTER TABLE "withdraw_tx" DROP COLUMN IF EXISTS "bump_type";
+ALTER TABLE "withdraw_tx" DROP COLUMN IF EXISTS "replaces_id";
+
+DROP INDEX IF EXISTS "idx_withdraw_history_refund_tx_hash";
+DROP INDEX IF EXISTS "idx_withdraw_history_risk_status";
+ALTER TABLE "withdraw_history" DROP COLUMN IF EXISTS "refund_tx_hash";
+ALTER TABLE "withdraw_history" DROP COLUMN IF EXISTS "risk_checked_at";
+ALTER TABLE "withdraw_history" DROP COLUMN IF EXISTS "risk_reviewer";
+ALTER TABLE "withdraw_history" DROP COLUMN IF EXISTS "risk_reason";
+ALTER TABLE "withdraw_history" DROP COLUMN IF EXISTS "risk_status";
@@ -0,0 +1,32 @@
+-- withdraw risk checks
+ALTER TABLE "withdraw_history" ADD COLUMN IF NOT EXISTS "risk_status" smallint DEFAULT 0;
+ALTER TABLE "withdraw_history" ADD COLUMN IF NOT EXISTS "risk_reason" varchar(256) DEFAULT '';
+ALTER TABLE "withdraw_history" ADD COLUMN IF NOT EXISTS "risk_reviewer" varchar(64) DEFAULT '';
+ALTER TABLE "withdraw_history" ADD COLUMN IF NOT EXISTS "risk_checked_at" timestamptz;
+ALTER TABLE "withdraw_history" ADD COLUMN IF NOT EXISTS "refund_tx_hash" varchar(256) DEFAULT '';
+CREATE INDEX IF NOT EXISTS "idx_withdraw_history_risk_status" ON "withdraw_history" ("risk_status");
+CREATE INDEX IF NOT EXISTS "idx_withdraw_history_refund_tx_hash" ON "withdraw_history" ("refund_tx_hash");
+COMMENT ON COLUMN "withdraw_history"."risk_status" IS 'risk check status';
+COMMENT ON COLUMN "withdraw_history"."risk_reason" IS 'risk check reason';
+COMMENT ON COLUMN "withdraw_history"."risk_reviewer" IS 'manual approval reviewer';
+COMMENT ON COLUMN "withdraw_history"."risk_checked_at" IS 'risk check time';
+COMMENT ON COLUMN "withdraw_history"."refund_tx_hash" IS 'l2 refund tx hash';
+
+-- withdraw tx fee bumps
+ALTER TABLE "withdraw_tx" ADD COLUMN IF NOT EXISTS "replaces_id" bigint DEFAULT 0;
+ALTER TABLE "withdraw_tx" ADD COLUMN IF NOT EXISTS "bump_type" smallint DEFAULT 0;
+ALTER TABLE "withdraw_tx" ADD COLUMN IF NOT EXISTS "bump_count" smallint DEFAULT 0;
+ALTER TABLE "withdraw_tx" ADD COLUMN IF NOT EXISTS "broadcast_at" timestamptz;
+CREATE INDEX IF NOT EXISTS "idx_withdraw_tx_replaces_id" ON "withdraw_tx" ("replaces_id");
+COMMENT ON COLUMN "withdraw_tx"."replaces_id" IS 'bumped withdraw tx id';
+COMMENT ON COLUMN "withdraw_tx"."bump_type" IS 'fee bump type';
+COMMENT ON COLUMN "withdraw_tx"."bump_count" IS 'fee bump count of the chain';
+COMMENT ON COLUMN "withdraw_tx"."broadcast_at" IS 'broadcast time';
+
+-- withdraw multisig signatures
+CREATE TABLE IF NOT EXISTS "withdraw_sign" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"withdraw_tx_id" bigint NOT NULL,"btc_tx_id" varchar(256) DEFAULT '',"signer" varchar(66) NOT NULL,"signs" text DEFAULT '',PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_withdraw_sign_signer" ON "withdraw_sign" ("withdraw_tx_id","signer");
+COMMENT ON COLUMN "withdraw_sign"."withdraw_tx_id" IS 'withdraw tx id';
+COMMENT ON COLUMN "withdraw_sign"."btc_tx_id" IS 'bitcoin tx id';
+COMMENT ON COLUMN "withdraw_sign"."signer" IS 'signer bitcoin public key';
+COMMENT ON COLUMN "withdraw_sign"."signs" IS 'signatures by tx input';
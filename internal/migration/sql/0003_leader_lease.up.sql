@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS "leader_lease" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"name" varchar(64) NOT NULL,"holder" varchar(256) NOT NULL DEFAULT '',"token" bigint NOT NULL DEFAULT 0,"expires_at" timestamptz NOT NULL,PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_leader_lease_name" ON "leader_lease" ("name");
+COMMENT ON COLUMN "leader_lease"."name" IS 'lease name';
+COMMENT ON COLUMN "leader_lease"."holder" IS 'replica holding the lease';
+COMMENT ON COLUMN "leader_lease"."token" IS 'fencing token';
+COMMENT ON COLUMN "leader_lease"."expires_at" IS 'lease expiry';
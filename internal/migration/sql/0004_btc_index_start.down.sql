@@ -0,0 +1,2 @@
+ALTER TABLE "btc_index" DROP COLUMN IF EXISTS "start_tx_index";
+ALTER TABLE "btc_index" DROP COLUMN IF EXISTS "start_height";
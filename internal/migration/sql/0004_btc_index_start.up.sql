@@ -0,0 +1,4 @@
+ALTER TABLE "btc_index" ADD COLUMN IF NOT EXISTS "start_height" bigint DEFAULT 0;
+ALTER TABLE "btc_index" ADD COLUMN IF NOT EXISTS "start_tx_index" bigint DEFAULT 0;
+COMMENT ON COLUMN "btc_index"."start_height" IS 'first indexed block';
+COMMENT ON COLUMN "btc_index"."start_tx_index" IS 'first indexed tx of the start block';
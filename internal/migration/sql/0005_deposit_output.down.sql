@@ -0,0 +1,4 @@
+-- fails while a tx has several deposits
+DROP INDEX IF EXISTS "idx_deposit_history_btc_tx_output";
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_deposit_history_btc_tx_hash" ON "deposit_history" ("btc_tx_hash");
+ALTER TABLE "deposit_history" DROP COLUMN IF EXISTS "btc_tx_output";
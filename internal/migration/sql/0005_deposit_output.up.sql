@@ -0,0 +1,5 @@
+-- a deposit is keyed by its tx and its index in the tx, a tx may hold several
+ALTER TABLE "deposit_history" ADD COLUMN IF NOT EXISTS "btc_tx_output" bigint NOT NULL DEFAULT 0;
+COMMENT ON COLUMN "deposit_history"."btc_tx_output" IS 'deposit index of the tx';
+DROP INDEX IF EXISTS "idx_deposit_history_btc_tx_hash";
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_deposit_history_btc_tx_output" ON "deposit_history" ("btc_tx_hash","btc_tx_output");
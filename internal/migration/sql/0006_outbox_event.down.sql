@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS "outbox_event_capture" ON "withdraw_tx";
+DROP TRIGGER IF EXISTS "outbox_event_capture" ON "withdraw_history";
+DROP TRIGGER IF EXISTS "outbox_event_capture" ON "deposit_history";
+DROP FUNCTION IF EXISTS "outbox_event_capture"();
+DROP TABLE IF EXISTS "outbox_event";
@@ -0,0 +1,43 @@
+-- deposit and withdraw change events, written by triggers in the transaction of
+-- the change and published by the outbox relay
+CREATE TABLE IF NOT EXISTS "outbox_event" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"aggregate" varchar(64) NOT NULL,"aggregate_id" bigint NOT NULL,"event_type" varchar(16) NOT NULL,"payload" jsonb,"published_at" timestamptz,"attempts" bigint NOT NULL DEFAULT 0,"last_error" varchar(512) DEFAULT '',"next_attempt_at" timestamptz,"parked_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_outbox_event_aggregate" ON "outbox_event" ("aggregate","aggregate_id");
+CREATE INDEX IF NOT EXISTS "idx_outbox_event_published_at" ON "outbox_event" ("published_at");
+CREATE INDEX IF NOT EXISTS "idx_outbox_event_parked_at" ON "outbox_event" ("parked_at");
+COMMENT ON COLUMN "outbox_event"."aggregate" IS 'changed table';
+COMMENT ON COLUMN "outbox_event"."aggregate_id" IS 'changed row id';
+COMMENT ON COLUMN "outbox_event"."event_type" IS 'insert, update or delete';
+COMMENT ON COLUMN "outbox_event"."payload" IS 'row after the change';
+COMMENT ON COLUMN "outbox_event"."published_at" IS 'publish time';
+COMMENT ON COLUMN "outbox_event"."attempts" IS 'failed publish attempts';
+COMMENT ON COLUMN "outbox_event"."last_error" IS 'last publish error';
+COMMENT ON COLUMN "outbox_event"."next_attempt_at" IS 'next publish attempt time';
+COMMENT ON COLUMN "outbox_event"."parked_at" IS 'dead letter time';
+
+CREATE OR REPLACE FUNCTION "outbox_event_capture"() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP = 'DELETE' THEN
+		INSERT INTO "outbox_event" ("created_at","updated_at","aggregate","aggregate_id","event_type","payload")
+		VALUES (now(), now(), TG_TABLE_NAME, OLD."id", 'delete', to_jsonb(OLD));
+		RETURN OLD;
+	END IF;
+	-- an update writing the same values is no change, nor one of the update time or the
+	-- webhook delivery state of a deposit only, the webhook dispatcher writes it
+	IF TG_OP = 'UPDATE' AND to_jsonb(OLD) - 'updated_at' - 'callback_status' = to_jsonb(NEW) - 'updated_at' - 'callback_status' THEN
+		RETURN NEW;
+	END IF;
+	INSERT INTO "outbox_event" ("created_at","updated_at","aggregate","aggregate_id","event_type","payload")
+	VALUES (now(), now(), TG_TABLE_NAME, NEW."id", lower(TG_OP), to_jsonb(NEW));
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS "outbox_event_capture" ON "deposit_history";
+CREATE TRIGGER "outbox_event_capture" AFTER INSERT OR UPDATE OR DELETE ON "deposit_history"
+	FOR EACH ROW EXECUTE FUNCTION "outbox_event_capture"();
+DROP TRIGGER IF EXISTS "outbox_event_capture" ON "withdraw_history";
+CREATE TRIGGER "outbox_event_capture" AFTER INSERT OR UPDATE OR DELETE ON "withdraw_history"
+	FOR EACH ROW EXECUTE FUNCTION "outbox_event_capture"();
+DROP TRIGGER IF EXISTS "outbox_event_capture" ON "withdraw_tx";
+CREATE TRIGGER "outbox_event_capture" AFTER INSERT OR UPDATE OR DELETE ON "withdraw_tx"
+	FOR EACH ROW EXECUTE FUNCTION "outbox_event_capture"();
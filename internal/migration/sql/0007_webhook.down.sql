@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS "idx_outbox_event_notified_at";
+ALTER TABLE "outbox_event" DROP COLUMN IF EXISTS "notified_at";
+DROP TABLE IF EXISTS "webhook_delivery";
+DROP TABLE IF EXISTS "webhook_subscription";
@@ -0,0 +1,29 @@
+-- partner webhooks of the deposit and withdraw milestones
+CREATE TABLE IF NOT EXISTS "webhook_subscription" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"name" varchar(64) NOT NULL,"url" varchar(512) NOT NULL,"secret" varchar(128) NOT NULL,"events" varchar(512) DEFAULT '',"enabled" boolean NOT NULL DEFAULT true,PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_webhook_subscription_name" ON "webhook_subscription" ("name");
+COMMENT ON COLUMN "webhook_subscription"."name" IS 'subscriber name';
+COMMENT ON COLUMN "webhook_subscription"."url" IS 'webhook url';
+COMMENT ON COLUMN "webhook_subscription"."secret" IS 'hmac signature key';
+COMMENT ON COLUMN "webhook_subscription"."events" IS 'event filter';
+COMMENT ON COLUMN "webhook_subscription"."enabled" IS 'deliveries created';
+
+CREATE TABLE IF NOT EXISTS "webhook_delivery" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"subscription_id" bigint NOT NULL,"event" varchar(64) NOT NULL,"aggregate" varchar(64) NOT NULL,"aggregate_id" bigint NOT NULL,"payload" jsonb,"status" smallint NOT NULL DEFAULT 1,"attempts" bigint NOT NULL DEFAULT 0,"next_attempt_at" timestamptz,"response_code" bigint DEFAULT 0,"last_error" varchar(512) DEFAULT '',"delivered_at" timestamptz,PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_webhook_delivery_event" ON "webhook_delivery" ("subscription_id","event","aggregate","aggregate_id");
+CREATE INDEX IF NOT EXISTS "idx_webhook_delivery_status" ON "webhook_delivery" ("status");
+COMMENT ON COLUMN "webhook_delivery"."subscription_id" IS 'webhook subscription id';
+COMMENT ON COLUMN "webhook_delivery"."event" IS 'milestone';
+COMMENT ON COLUMN "webhook_delivery"."aggregate" IS 'deposit or withdraw table';
+COMMENT ON COLUMN "webhook_delivery"."aggregate_id" IS 'deposit or withdraw row id';
+COMMENT ON COLUMN "webhook_delivery"."payload" IS 'row of the milestone';
+COMMENT ON COLUMN "webhook_delivery"."status" IS 'delivery status';
+COMMENT ON COLUMN "webhook_delivery"."attempts" IS 'delivery attempts';
+COMMENT ON COLUMN "webhook_delivery"."next_attempt_at" IS 'next delivery attempt time';
+COMMENT ON COLUMN "webhook_delivery"."response_code" IS 'last http status';
+COMMENT ON COLUMN "webhook_delivery"."last_error" IS 'last delivery error';
+COMMENT ON COLUMN "webhook_delivery"."delivered_at" IS 'delivery time';
+
+ALTER TABLE "outbox_event" ADD COLUMN IF NOT EXISTS "notified_at" timestamptz;
+-- the changes before the webhooks are not notified
+UPDATE "outbox_event" SET "notified_at" = now() WHERE "notified_at" IS NULL;
+CREATE INDEX IF NOT EXISTS "idx_outbox_event_notified_at" ON "outbox_event" ("notified_at");
+COMMENT ON COLUMN "outbox_event"."notified_at" IS 'webhook deliveries time';
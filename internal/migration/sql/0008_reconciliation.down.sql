@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "reconciliation_discrepancy";
+DROP TABLE IF EXISTS "reconciliation_report";
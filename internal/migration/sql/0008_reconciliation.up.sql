@@ -0,0 +1,30 @@
+-- reconciliation reports of the deposits and the l2 mints
+CREATE TABLE IF NOT EXISTS "reconciliation_report" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"started_at" timestamptz,"finished_at" timestamptz,"deposits" bigint NOT NULL DEFAULT 0,"mints" bigint NOT NULL DEFAULT 0,"burns" bigint NOT NULL DEFAULT 0,"confirmed_value" bigint NOT NULL DEFAULT 0,"minted_value" bigint NOT NULL DEFAULT 0,"burned_value" bigint NOT NULL DEFAULT 0,"in_flight_value" bigint NOT NULL DEFAULT 0,"paid_value" bigint NOT NULL DEFAULT 0,"paying_value" bigint NOT NULL DEFAULT 0,"supply_diff" bigint NOT NULL DEFAULT 0,"discrepancies" bigint NOT NULL DEFAULT 0,"status" smallint NOT NULL DEFAULT 1,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_reconciliation_report_status" ON "reconciliation_report" ("status");
+COMMENT ON COLUMN "reconciliation_report"."started_at" IS 'run start time';
+COMMENT ON COLUMN "reconciliation_report"."finished_at" IS 'run end time';
+COMMENT ON COLUMN "reconciliation_report"."deposits" IS 'deposits checked';
+COMMENT ON COLUMN "reconciliation_report"."mints" IS 'mint events checked';
+COMMENT ON COLUMN "reconciliation_report"."burns" IS 'burn events counted';
+COMMENT ON COLUMN "reconciliation_report"."confirmed_value" IS 'value of the minted deposits';
+COMMENT ON COLUMN "reconciliation_report"."minted_value" IS 'value of the mint events';
+COMMENT ON COLUMN "reconciliation_report"."burned_value" IS 'value of the burn events';
+COMMENT ON COLUMN "reconciliation_report"."in_flight_value" IS 'value of the mints not yet listened';
+COMMENT ON COLUMN "reconciliation_report"."paid_value" IS 'value of the paid withdraws';
+COMMENT ON COLUMN "reconciliation_report"."paying_value" IS 'value of the withdraws being paid';
+COMMENT ON COLUMN "reconciliation_report"."supply_diff" IS 'supply less expected supply';
+COMMENT ON COLUMN "reconciliation_report"."discrepancies" IS 'discrepancies found';
+COMMENT ON COLUMN "reconciliation_report"."status" IS 'report status';
+
+CREATE TABLE IF NOT EXISTS "reconciliation_discrepancy" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"report_id" bigint NOT NULL,"kind" varchar(32) NOT NULL,"deposit_id" bigint NOT NULL DEFAULT 0,"rollup_deposit_id" bigint NOT NULL DEFAULT 0,"btc_tx_hash" varchar(64) NOT NULL DEFAULT '',"b2_tx_hash" varchar(256) NOT NULL DEFAULT '',"expected" bigint NOT NULL DEFAULT 0,"actual" bigint NOT NULL DEFAULT 0,"detail" varchar(256) NOT NULL DEFAULT '',PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_reconciliation_discrepancy_report_id" ON "reconciliation_discrepancy" ("report_id");
+CREATE INDEX IF NOT EXISTS "idx_reconciliation_discrepancy_kind" ON "reconciliation_discrepancy" ("kind");
+COMMENT ON COLUMN "reconciliation_discrepancy"."report_id" IS 'reconciliation report id';
+COMMENT ON COLUMN "reconciliation_discrepancy"."kind" IS 'discrepancy kind';
+COMMENT ON COLUMN "reconciliation_discrepancy"."deposit_id" IS 'deposit_history id';
+COMMENT ON COLUMN "reconciliation_discrepancy"."rollup_deposit_id" IS 'rollup_deposit_history id';
+COMMENT ON COLUMN "reconciliation_discrepancy"."btc_tx_hash" IS 'abelian tx hash';
+COMMENT ON COLUMN "reconciliation_discrepancy"."b2_tx_hash" IS 'b2 network tx hash';
+COMMENT ON COLUMN "reconciliation_discrepancy"."expected" IS 'expected value';
+COMMENT ON COLUMN "reconciliation_discrepancy"."actual" IS 'actual value';
+COMMENT ON COLUMN "reconciliation_discrepancy"."detail" IS 'discrepancy detail';
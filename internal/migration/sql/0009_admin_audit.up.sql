@@ -0,0 +1,12 @@
+-- audit of the changes of the bridge state by the admin commands
+CREATE TABLE IF NOT EXISTS "admin_audit" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"operator" varchar(64) NOT NULL DEFAULT '',"action" varchar(64) NOT NULL,"target" varchar(128) NOT NULL DEFAULT '',"reason" varchar(256) NOT NULL DEFAULT '',"forced" boolean NOT NULL DEFAULT false,"before" jsonb,"after" jsonb,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_admin_audit_operator" ON "admin_audit" ("operator");
+CREATE INDEX IF NOT EXISTS "idx_admin_audit_action" ON "admin_audit" ("action");
+CREATE INDEX IF NOT EXISTS "idx_admin_audit_target" ON "admin_audit" ("target");
+COMMENT ON COLUMN "admin_audit"."operator" IS 'operator';
+COMMENT ON COLUMN "admin_audit"."action" IS 'admin action';
+COMMENT ON COLUMN "admin_audit"."target" IS 'changed row';
+COMMENT ON COLUMN "admin_audit"."reason" IS 'operator reason';
+COMMENT ON COLUMN "admin_audit"."forced" IS 'safety checks overridden';
+COMMENT ON COLUMN "admin_audit"."before" IS 'row before the change';
+COMMENT ON COLUMN "admin_audit"."after" IS 'row after the change';
@@ -0,0 +1,50 @@
+package model
+
+// admin actions repairing the bridge state
+const (
+	AdminActionDepositRetry   = "deposit.retry"
+	AdminActionDepositResolve = "deposit.mark_resolved"
+	AdminActionIndexSetCursor = "index.set_cursor"
+	AdminActionWithdrawRefund = "withdraw.mark_refunded"
+)
+
+// AdminAudit is a change of the bridge state by an operator, written in the transaction
+// of the change with the row before and after it
+type AdminAudit struct {
+	Base
+	Operator string `json:"operator" gorm:"type:varchar(64);not null;default:'';index;comment:operator"`
+	Action   string `json:"action" gorm:"type:varchar(64);not null;index;comment:admin action"`
+	// Target is the changed row as table:id
+	Target string `json:"target" gorm:"type:varchar(128);not null;default:'';index;comment:changed row"`
+	Reason string `json:"reason" gorm:"type:varchar(256);not null;default:'';comment:operator reason"`
+	// Forced reports whether the operator overrode the safety checks of the action
+	Forced bool `json:"forced" gorm:"not null;default:false;comment:safety checks overridden"`
+	Before JSON `json:"before" gorm:"comment:row before the change"`
+	After  JSON `json:"after" gorm:"comment:row after the change"`
+}
+
+func (AdminAudit) TableName() string {
+	return "admin_audit"
+}
+
+type AdminAuditColumns struct {
+	Operator string
+	Action   string
+	Target   string
+	Reason   string
+	Forced   string
+	Before   string
+	After    string
+}
+
+func (AdminAudit) Column() AdminAuditColumns {
+	return AdminAuditColumns{
+		Operator: "operator",
+		Action:   "action",
+		Target:   "target",
+		Reason:   "reason",
+		Forced:   "forced",
+		Before:   "before",
+		After:    "after",
+	}
+}
@@ -4,6 +4,9 @@ type BtcIndex struct {
 	Base
 	BtcIndexBlock int64 `json:"btc_index_block" gorm:"comment:bitcoin index block"`
 	BtcIndexTx    int64 `json:"btc_index_tx" gorm:"comment:bitcoin index tx"`
+	// StartHeight and StartTxIndex are the first block and tx indexed when the cursor was seeded
+	StartHeight  int64 `json:"start_height" gorm:"default:0;comment:first indexed block"`
+	StartTxIndex int64 `json:"start_tx_index" gorm:"default:0;comment:first indexed tx of the start block"`
 }
 
 func (BtcIndex) TableName() string {
@@ -8,7 +8,7 @@ type Context struct {
 	// Viper         *viper.Viper
 	Config        *config.Config
 	BitcoinConfig *config.BitcoinConfig
-	//HTTPConfig    *config.HTTPConfig
+	HTTPConfig    *config.HTTPConfig
 	// Logger        logger.Logger
 	// Db *gorm.DB
 }
@@ -23,11 +23,32 @@ const (
 	DepositB2TxStatusAAAddressNotFound                 // aa address not found,  Start process processing separately
 	DepositB2TxStatusIsPending
 	DepositB2TxStatusNonceToLow
+	DepositB2TxStatusResolved // resolved by an operator, not minted by the indexer
 )
 
+// DepositB2TxStatusNames are the b2 tx statuses by the names of the admin commands and the e2e scenarios
+var DepositB2TxStatusNames = map[string]int{
+	"success":                       DepositB2TxStatusSuccess,
+	"pending":                       DepositB2TxStatusPending,
+	"failed":                        DepositB2TxStatusFailed,
+	"wait_mined_failed":             DepositB2TxStatusWaitMinedFailed,
+	"tx_hash_exist":                 DepositB2TxStatusTxHashExist,
+	"wait_mined_status_failed":      DepositB2TxStatusWaitMinedStatusFailed,
+	"insufficient_balance":          DepositB2TxStatusInsufficientBalance,
+	"context_deadline_exceeded":     DepositB2TxStatusContextDeadlineExceeded,
+	"from_account_gas_insufficient": DepositB2TxStatusFromAccountGasInsufficient,
+	"wait_mined":                    DepositB2TxStatusWaitMined,
+	"aa_address_not_found":          DepositB2TxStatusAAAddressNotFound,
+	"is_pending":                    DepositB2TxStatusIsPending,
+	"nonce_too_low":                 DepositB2TxStatusNonceToLow,
+	"resolved":                      DepositB2TxStatusResolved,
+}
+
+// callback status, the delivery of the webhooks of the deposit
 const (
-	CallbackStatusSuccess = iota
-	CallbackStatusPending
+	CallbackStatusSuccess = iota // delivered, or no webhook
+	CallbackStatusPending        // webhooks waiting for delivery
+	CallbackStatusFailed         // a webhook out of delivery attempts
 )
 
 const (
@@ -45,11 +66,12 @@ type Deposit struct {
 	Base
 	BtcBlockNumber   int64     `json:"btc_block_number" gorm:"index;comment:bitcoin block number"`
 	BtcTxIndex       int64     `json:"btc_tx_index" gorm:"comment:bitcoin tx index"`
-	BtcTxHash        string    `json:"btc_tx_hash" gorm:"type:text;not null;default:'';uniqueIndex;comment:bitcoin tx hash"`
+	BtcTxHash        string    `json:"btc_tx_hash" gorm:"type:text;not null;default:'';uniqueIndex:idx_deposit_history_btc_tx_output,priority:1;comment:bitcoin tx hash"`
+	BtcTxOutput      int64     `json:"btc_tx_output" gorm:"not null;default:0;uniqueIndex:idx_deposit_history_btc_tx_output,priority:2;comment:deposit index of the tx"`
 	BtcTxType        int       `json:"btc_tx_type" gorm:"type:SMALLINT;default:0;comment:btc tx type"`
-	BtcFroms         string    `json:"btc_froms" gorm:"type:jsonb;comment:bitcoin transfer, from may be multiple"`
+	BtcFroms         JSON      `json:"btc_froms" gorm:"comment:bitcoin transfer, from may be multiple"`
 	BtcFrom          string    `json:"btc_from" gorm:"type:text;not null;default:'';index"`
-	BtcTos           string    `json:"btc_tos" gorm:"type:jsonb;comment:bitcoin transfer, to may be multiple"`
+	BtcTos           JSON      `json:"btc_tos" gorm:"comment:bitcoin transfer, to may be multiple"`
 	BtcTo            string    `json:"btc_to" gorm:"type:text;not null;default:'';index"`
 	BtcFromAAAddress string    `json:"btc_from_aa_address" gorm:"type:text;default:'';comment:from aa address"`
 	BtcValue         int64     `json:"btc_value" gorm:"default:0;comment:bitcoin transfer value"`
@@ -68,6 +90,7 @@ type DepositColumns struct {
 	BtcBlockNumber   string
 	BtcTxIndex       string
 	BtcTxHash        string
+	BtcTxOutput      string
 	BtcTxType        string
 	BtcFroms         string
 	BtcFrom          string
@@ -95,6 +118,7 @@ func (Deposit) Column() DepositColumns {
 		BtcBlockNumber:   "btc_block_number",
 		BtcTxIndex:       "btc_tx_index",
 		BtcTxHash:        "btc_tx_hash",
+		BtcTxOutput:      "btc_tx_output",
 		BtcTxType:        "btc_tx_type",
 		BtcFroms:         "btc_froms",
 		BtcFrom:          "btc_from",
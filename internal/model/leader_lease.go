@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+// LeaderLease is the lease of the replica running the writers, the token
+// increases on every change of leader and fences the writes of former leaders.
+// The indexer heartbeats are rows too, one per process, renewed with or without leader election.
+type LeaderLease struct {
+	Base
+	Name      string    `json:"name" gorm:"type:varchar(64);not null;uniqueIndex;comment:lease name"`
+	Holder    string    `json:"holder" gorm:"type:varchar(256);not null;default:'';comment:replica holding the lease"`
+	Token     int64     `json:"token" gorm:"not null;default:0;comment:fencing token"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null;comment:lease expiry"`
+}
+
+func (LeaderLease) TableName() string {
+	return "leader_lease"
+}
+
+type LeaderLeaseColumns struct {
+	Name      string
+	Holder    string
+	Token     string
+	ExpiresAt string
+}
+
+func (LeaderLease) Column() LeaderLeaseColumns {
+	return LeaderLeaseColumns{
+		Name:      "name",
+		Holder:    "holder",
+		Token:     "token",
+		ExpiresAt: "expires_at",
+	}
+}
@@ -0,0 +1,59 @@
+package model
+
+import "time"
+
+const (
+	OutboxEventInsert = "insert"
+	OutboxEventUpdate = "update"
+	OutboxEventDelete = "delete"
+)
+
+// OutboxEvent is a change of a deposit_history, withdraw_history or withdraw_tx row.
+// A trigger writes it in the transaction of the change, the outbox relay publishes it.
+type OutboxEvent struct {
+	Base
+	Aggregate   string     `json:"aggregate" gorm:"type:varchar(64);not null;index:idx_outbox_event_aggregate,priority:1;comment:changed table"`
+	AggregateID int64      `json:"aggregate_id" gorm:"not null;index:idx_outbox_event_aggregate,priority:2;comment:changed row id"`
+	EventType   string     `json:"event_type" gorm:"type:varchar(16);not null;comment:insert, update or delete"`
+	Payload     JSON       `json:"payload" gorm:"comment:row after the change"`
+	PublishedAt *time.Time `json:"published_at" gorm:"index;comment:publish time"`
+	Attempts    int        `json:"attempts" gorm:"not null;default:0;comment:failed publish attempts"`
+	LastError   string     `json:"last_error" gorm:"type:varchar(512);default:'';comment:last publish error"`
+	// NextAttemptAt is when a failed event is published again, ParkedAt when it failed for the last time
+	NextAttemptAt *time.Time `json:"next_attempt_at" gorm:"comment:next publish attempt time"`
+	ParkedAt      *time.Time `json:"parked_at" gorm:"index;comment:dead letter time"`
+	// NotifiedAt is when the webhook dispatcher created the deliveries of the event
+	NotifiedAt *time.Time `json:"notified_at" gorm:"index;comment:webhook deliveries time"`
+}
+
+func (OutboxEvent) TableName() string {
+	return "outbox_event"
+}
+
+type OutboxEventColumns struct {
+	Aggregate     string
+	AggregateID   string
+	EventType     string
+	Payload       string
+	PublishedAt   string
+	Attempts      string
+	LastError     string
+	NextAttemptAt string
+	ParkedAt      string
+	NotifiedAt    string
+}
+
+func (OutboxEvent) Column() OutboxEventColumns {
+	return OutboxEventColumns{
+		Aggregate:     "aggregate",
+		AggregateID:   "aggregate_id",
+		EventType:     "event_type",
+		Payload:       "payload",
+		PublishedAt:   "published_at",
+		Attempts:      "attempts",
+		LastError:     "last_error",
+		NextAttemptAt: "next_attempt_at",
+		ParkedAt:      "parked_at",
+		NotifiedAt:    "notified_at",
+	}
+}
@@ -0,0 +1,132 @@
+package model
+
+import "time"
+
+// reconciliation report status
+const (
+	ReconciliationStatusOK = iota + 1
+	ReconciliationStatusDiscrepancy
+)
+
+// reconciliation discrepancy kinds
+const (
+	// DiscrepancyMissingMint is a deposit without a mint event after the grace period
+	DiscrepancyMissingMint = "missing_mint"
+	// DiscrepancyOrphanMint is a mint event of no deposit
+	DiscrepancyOrphanMint = "orphan_mint"
+	// DiscrepancyDuplicateMint is a mint event beyond the deposits of its abelian tx
+	DiscrepancyDuplicateMint = "duplicate_mint"
+	// DiscrepancyMintMismatch is a mint event differing from its deposit by value, aa address or tx
+	DiscrepancyMintMismatch = "mint_mismatch"
+	// DiscrepancySupplyMismatch is a minted supply differing from the confirmed deposits
+	DiscrepancySupplyMismatch = "supply_mismatch"
+)
+
+// ReconciliationReport is a run of the reconciliation of the deposits and the l2 mints
+type ReconciliationReport struct {
+	Base
+	StartedAt  time.Time `json:"started_at" gorm:"comment:run start time"`
+	FinishedAt time.Time `json:"finished_at" gorm:"comment:run end time"`
+	Deposits   int64     `json:"deposits" gorm:"not null;default:0;comment:deposits checked"`
+	Mints      int64     `json:"mints" gorm:"not null;default:0;comment:mint events checked"`
+	Burns      int64     `json:"burns" gorm:"not null;default:0;comment:burn events counted"`
+	// ConfirmedValue is the value of the minted deposits, MintedValue and BurnedValue of the l2 events
+	ConfirmedValue int64 `json:"confirmed_value" gorm:"not null;default:0;comment:value of the minted deposits"`
+	MintedValue    int64 `json:"minted_value" gorm:"not null;default:0;comment:value of the mint events"`
+	BurnedValue    int64 `json:"burned_value" gorm:"not null;default:0;comment:value of the burn events"`
+	// InFlightValue is the value of the minted deposits in the grace period without a mint event yet
+	InFlightValue int64 `json:"in_flight_value" gorm:"not null;default:0;comment:value of the mints not yet listened"`
+	// PaidValue is the value of the withdraws paid out on abelian, PayingValue of the burns being paid
+	PaidValue   int64 `json:"paid_value" gorm:"not null;default:0;comment:value of the paid withdraws"`
+	PayingValue int64 `json:"paying_value" gorm:"not null;default:0;comment:value of the withdraws being paid"`
+	// SupplyDiff is the minted supply less the burns, less the confirmed deposits less the paid withdraws,
+	// beyond the in flight and paying values
+	SupplyDiff    int64 `json:"supply_diff" gorm:"not null;default:0;comment:supply less expected supply"`
+	Discrepancies int64 `json:"discrepancies" gorm:"not null;default:0;comment:discrepancies found"`
+	Status        int   `json:"status" gorm:"type:smallint;not null;default:1;index;comment:report status"`
+}
+
+func (ReconciliationReport) TableName() string {
+	return "reconciliation_report"
+}
+
+type ReconciliationReportColumns struct {
+	StartedAt      string
+	FinishedAt     string
+	Deposits       string
+	Mints          string
+	Burns          string
+	ConfirmedValue string
+	MintedValue    string
+	BurnedValue    string
+	InFlightValue  string
+	PaidValue      string
+	PayingValue    string
+	SupplyDiff     string
+	Discrepancies  string
+	Status         string
+}
+
+func (ReconciliationReport) Column() ReconciliationReportColumns {
+	return ReconciliationReportColumns{
+		StartedAt:      "started_at",
+		FinishedAt:     "finished_at",
+		Deposits:       "deposits",
+		Mints:          "mints",
+		Burns:          "burns",
+		ConfirmedValue: "confirmed_value",
+		MintedValue:    "minted_value",
+		BurnedValue:    "burned_value",
+		InFlightValue:  "in_flight_value",
+		PaidValue:      "paid_value",
+		PayingValue:    "paying_value",
+		SupplyDiff:     "supply_diff",
+		Discrepancies:  "discrepancies",
+		Status:         "status",
+	}
+}
+
+// ReconciliationDiscrepancy is a discrepancy found by a reconciliation run
+type ReconciliationDiscrepancy struct {
+	Base
+	ReportID        int64  `json:"report_id" gorm:"not null;index;comment:reconciliation report id"`
+	Kind            string `json:"kind" gorm:"type:varchar(32);not null;index;comment:discrepancy kind"`
+	DepositID       int64  `json:"deposit_id" gorm:"not null;default:0;comment:deposit_history id"`
+	RollupDepositID int64  `json:"rollup_deposit_id" gorm:"not null;default:0;comment:rollup_deposit_history id"`
+	BtcTxHash       string `json:"btc_tx_hash" gorm:"type:varchar(64);not null;default:'';comment:abelian tx hash"`
+	B2TxHash        string `json:"b2_tx_hash" gorm:"type:varchar(256);not null;default:'';comment:b2 network tx hash"`
+	// Expected is the value of the deposit, Actual of the mint event
+	Expected int64  `json:"expected" gorm:"not null;default:0;comment:expected value"`
+	Actual   int64  `json:"actual" gorm:"not null;default:0;comment:actual value"`
+	Detail   string `json:"detail" gorm:"type:varchar(256);not null;default:'';comment:discrepancy detail"`
+}
+
+func (ReconciliationDiscrepancy) TableName() string {
+	return "reconciliation_discrepancy"
+}
+
+type ReconciliationDiscrepancyColumns struct {
+	ReportID        string
+	Kind            string
+	DepositID       string
+	RollupDepositID string
+	BtcTxHash       string
+	B2TxHash        string
+	Expected        string
+	Actual          string
+	Detail          string
+}
+
+func (ReconciliationDiscrepancy) Column() ReconciliationDiscrepancyColumns {
+	return ReconciliationDiscrepancyColumns{
+		ReportID:        "report_id",
+		Kind:            "kind",
+		DepositID:       "deposit_id",
+		RollupDepositID: "rollup_deposit_id",
+		BtcTxHash:       "btc_tx_hash",
+		B2TxHash:        "b2_tx_hash",
+		Expected:        "expected",
+		Actual:          "actual",
+		Detail:          "detail",
+	}
+}
@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+// SchemaMigration records an applied schema migration
+type SchemaMigration struct {
+	Version   int64     `json:"version" gorm:"primaryKey;autoIncrement:false;comment:migration version"`
+	Name      string    `json:"name" gorm:"type:varchar(256);not null;default:'';comment:migration name"`
+	AppliedAt time.Time `json:"applied_at" gorm:"not null;comment:applied time"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+type SchemaMigrationColumns struct {
+	Version   string
+	Name      string
+	AppliedAt string
+}
+
+func (SchemaMigration) Column() SchemaMigrationColumns {
+	return SchemaMigrationColumns{
+		Version:   "version",
+		Name:      "name",
+		AppliedAt: "applied_at",
+	}
+}
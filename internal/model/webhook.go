@@ -0,0 +1,93 @@
+package model
+
+import "time"
+
+// webhook delivery status
+const (
+	WebhookDeliveryPending = iota + 1
+	WebhookDeliverySuccess
+	WebhookDeliveryFailed
+)
+
+// WebhookSubscription is a partner endpoint notified of the deposit and withdraw milestones
+type WebhookSubscription struct {
+	Base
+	Name string `json:"name" gorm:"type:varchar(64);not null;uniqueIndex;comment:subscriber name"`
+	URL  string `json:"url" gorm:"type:varchar(512);not null;comment:webhook url"`
+	// Secret is the hmac key of the signatures, never returned by the api after the subscription was created
+	Secret string `json:"-" gorm:"type:varchar(128);not null;comment:hmac signature key"`
+	// Events are the comma separated milestones sent, deposit.* or withdraw.* for all of one kind, empty for all
+	Events  string `json:"events" gorm:"type:varchar(512);default:'';comment:event filter"`
+	Enabled bool   `json:"enabled" gorm:"not null;default:true;comment:deliveries created"`
+}
+
+func (WebhookSubscription) TableName() string {
+	return "webhook_subscription"
+}
+
+type WebhookSubscriptionColumns struct {
+	Name    string
+	URL     string
+	Events  string
+	Enabled string
+}
+
+func (WebhookSubscription) Column() WebhookSubscriptionColumns {
+	return WebhookSubscriptionColumns{
+		Name:    "name",
+		URL:     "url",
+		Events:  "events",
+		Enabled: "enabled",
+	}
+}
+
+// WebhookDelivery is a milestone of a deposit or withdraw for a subscription, and its delivery state
+type WebhookDelivery struct {
+	Base
+	SubscriptionID int64  `json:"subscription_id" gorm:"not null;uniqueIndex:idx_webhook_delivery_event,priority:1;comment:webhook subscription id"`
+	Event          string `json:"event" gorm:"type:varchar(64);not null;uniqueIndex:idx_webhook_delivery_event,priority:2;comment:milestone"`
+	Aggregate      string `json:"aggregate" gorm:"type:varchar(64);not null;uniqueIndex:idx_webhook_delivery_event,priority:3;comment:deposit or withdraw table"`
+	AggregateID    int64  `json:"aggregate_id" gorm:"not null;uniqueIndex:idx_webhook_delivery_event,priority:4;comment:deposit or withdraw row id"`
+	// Payload is the row of the milestone, the data of the posted body
+	Payload       JSON       `json:"payload" gorm:"comment:row of the milestone"`
+	Status        int        `json:"status" gorm:"type:smallint;not null;default:1;index;comment:delivery status"`
+	Attempts      int        `json:"attempts" gorm:"not null;default:0;comment:delivery attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"comment:next delivery attempt time"`
+	ResponseCode  int        `json:"response_code" gorm:"default:0;comment:last http status"`
+	LastError     string     `json:"last_error" gorm:"type:varchar(512);default:'';comment:last delivery error"`
+	DeliveredAt   *time.Time `json:"delivered_at" gorm:"comment:delivery time"`
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhook_delivery"
+}
+
+type WebhookDeliveryColumns struct {
+	SubscriptionID string
+	Event          string
+	Aggregate      string
+	AggregateID    string
+	Payload        string
+	Status         string
+	Attempts       string
+	NextAttemptAt  string
+	ResponseCode   string
+	LastError      string
+	DeliveredAt    string
+}
+
+func (WebhookDelivery) Column() WebhookDeliveryColumns {
+	return WebhookDeliveryColumns{
+		SubscriptionID: "subscription_id",
+		Event:          "event",
+		Aggregate:      "aggregate",
+		AggregateID:    "aggregate_id",
+		Payload:        "payload",
+		Status:         "status",
+		Attempts:       "attempts",
+		NextAttemptAt:  "next_attempt_at",
+		ResponseCode:   "response_code",
+		LastError:      "last_error",
+		DeliveredAt:    "delivered_at",
+	}
+}
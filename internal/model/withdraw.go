@@ -1,6 +1,10 @@
 package model
 
-import "github.com/btcsuite/btcd/wire"
+import (
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+)
 
 // tx status sequence
 // 1.1 BtcTxWithdrawPending
@@ -9,6 +13,10 @@ import "github.com/btcsuite/btcd/wire"
 // 1.4 BtcTxWithdrawBroadcastSuccess/BtcTxWithdrawBroadcastFailed
 // 1.5 BtcTxWithdrawConfirmed
 // 1.6 BtcTxWithdrawSuccess/BtcTxWithdrawFailed
+// a withdraw tx bumped by a broadcast RBF replacement becomes BtcTxWithdrawReplaced,
+// BtcTxWithdrawDropped once a conflicting tx confirmed or the node forgot it.
+// a withdraw rejected by the risk engine is BtcTxWithdrawRejected, never paid, and
+// BtcTxWithdrawRefunded once the operators minted its burn back on l2
 const (
 	BtcTxWithdrawPending = iota + 1
 	BtcTxWithdrawSuccess
@@ -18,6 +26,19 @@ const (
 	BtcTxWithdrawBroadcastSuccess
 	BtcTxWithdrawBroadcastFailed
 	BtcTxWithdrawConfirmed
+	BtcTxWithdrawReplaced
+	BtcTxWithdrawDropped
+	BtcTxWithdrawRejected
+	BtcTxWithdrawRefunded
+)
+
+// withdraw risk status, only passed or approved pending withdraws are paid
+const (
+	WithdrawRiskUnchecked = iota
+	WithdrawRiskPassed
+	WithdrawRiskAwaitingApproval
+	WithdrawRiskApproved
+	WithdrawRiskRejected
 )
 
 type Withdraw struct {
@@ -31,6 +52,13 @@ type Withdraw struct {
 	B2TxIndex     uint   `json:"b2_tx_index" gorm:"type:bigint;comment:b2 tx index"`
 	B2LogIndex    uint   `json:"b2_log_index" gorm:"type:int;comment:b2 log index"`
 	Status        int    `json:"status" gorm:"type:smallint;default:1"`
+	RiskStatus    int    `json:"risk_status" gorm:"type:smallint;default:0;index;comment:risk check status"`
+	RiskReason    string `json:"risk_reason" gorm:"type:varchar(256);default:'';comment:risk check reason"`
+	RiskReviewer  string `json:"risk_reviewer" gorm:"type:varchar(64);default:'';comment:manual approval reviewer"`
+	// RefundTxHash is the l2 tx minting the burn of a rejected withdraw back
+	RefundTxHash string `json:"refund_tx_hash" gorm:"type:varchar(256);default:'';index;comment:l2 refund tx hash"`
+	// RiskCheckedAt is the time the withdraw passed or was approved, velocity limits count by it
+	RiskCheckedAt time.Time `json:"risk_checked_at" gorm:"comment:risk check time"`
 }
 
 type Sign struct {
@@ -92,6 +120,11 @@ type WithdrawColumns struct {
 	B2BlockNumber string
 	B2LogIndex    string
 	Status        string
+	RiskStatus    string
+	RiskReason    string
+	RiskReviewer  string
+	RiskCheckedAt string
+	RefundTxHash  string
 }
 
 func (Withdraw) TableName() string {
@@ -110,5 +143,10 @@ func (Withdraw) Column() WithdrawColumns {
 		B2BlockNumber: "b2_block_number",
 		B2LogIndex:    "b2_log_index",
 		Status:        "status",
+		RiskStatus:    "risk_status",
+		RiskReason:    "risk_reason",
+		RiskReviewer:  "risk_reviewer",
+		RiskCheckedAt: "risk_checked_at",
+		RefundTxHash:  "refund_tx_hash",
 	}
 }
@@ -0,0 +1,30 @@
+package model
+
+// WithdrawSign records the signatures a signer submitted for a withdraw tx
+type WithdrawSign struct {
+	Base
+	WithdrawTxID int64  `json:"withdraw_tx_id" gorm:"not null;uniqueIndex:idx_withdraw_sign_signer;comment:withdraw tx id"`
+	BtcTxID      string `json:"btc_tx_id" gorm:"type:varchar(256);default:'';comment:bitcoin tx id"`
+	Signer       string `json:"signer" gorm:"type:varchar(66);not null;uniqueIndex:idx_withdraw_sign_signer;comment:signer bitcoin public key"`
+	Signs        string `json:"signs" gorm:"type:text;default:'';comment:signatures by tx input"`
+}
+
+func (WithdrawSign) TableName() string {
+	return "withdraw_sign"
+}
+
+type WithdrawSignColumns struct {
+	WithdrawTxID string
+	BtcTxID      string
+	Signer       string
+	Signs        string
+}
+
+func (WithdrawSign) Column() WithdrawSignColumns {
+	return WithdrawSignColumns{
+		WithdrawTxID: "withdraw_tx_id",
+		BtcTxID:      "btc_tx_id",
+		Signer:       "signer",
+		Signs:        "signs",
+	}
+}
@@ -1,5 +1,13 @@
 package model
 
+import "time"
+
+const (
+	WithdrawTxBumpNone = iota // original withdraw tx
+	WithdrawTxBumpRBF         // replace by fee, spends the same inputs
+	WithdrawTxBumpCPFP        // child pays for parent, spends the parent change output
+)
+
 type WithdrawTx struct {
 	Base
 	BtcTxID    string `json:"btc_tx_id" gorm:"type:varchar(256);default:'';comment:bitcoin tx id"`
@@ -8,15 +16,24 @@ type WithdrawTx struct {
 	BtcTxHash  string `json:"btc_txHash" gorm:"type:varchar(256);default:'';comment:bitcoin tx hash"`
 	Status     int    `json:"status" gorm:"type:smallint;default:1"`
 	Reason     string `json:"reason" gorm:"type:varchar(256);default:'';comment:error reason"`
+	// ReplacesID is the id of the stuck withdraw tx this tx bumps
+	ReplacesID  int64     `json:"replaces_id" gorm:"default:0;index;comment:bumped withdraw tx id"`
+	BumpType    int       `json:"bump_type" gorm:"type:smallint;default:0;comment:fee bump type"`
+	BumpCount   int       `json:"bump_count" gorm:"type:smallint;default:0;comment:fee bump count of the chain"`
+	BroadcastAt time.Time `json:"broadcast_at" gorm:"comment:broadcast time"`
 }
 
 type WithdrawTxColumns struct {
-	BtcTxID    string
-	BtcTx      string
-	B2TxHashes string
-	BtcTxHash  string
-	Status     string
-	Reason     string
+	BtcTxID     string
+	BtcTx       string
+	B2TxHashes  string
+	BtcTxHash   string
+	Status      string
+	Reason      string
+	ReplacesID  string
+	BumpType    string
+	BumpCount   string
+	BroadcastAt string
 }
 
 func (WithdrawTx) TableName() string {
@@ -25,11 +42,15 @@ func (WithdrawTx) TableName() string {
 
 func (WithdrawTx) Column() WithdrawTxColumns {
 	return WithdrawTxColumns{
-		BtcTxID:    "btc_tx_id",
-		B2TxHashes: "b2_tx_Hashes",
-		BtcTx:      "btc_tx",
-		BtcTxHash:  "btc_tx_hash",
-		Status:     "status",
-		Reason:     "reason",
+		BtcTxID:     "btc_tx_id",
+		B2TxHashes:  "b2_tx_hashes",
+		BtcTx:       "btc_tx",
+		BtcTxHash:   "btc_tx_hash",
+		Status:      "status",
+		Reason:      "reason",
+		ReplacesID:  "replaces_id",
+		BumpType:    "bump_type",
+		BumpCount:   "bump_count",
+		BroadcastAt: "broadcast_at",
 	}
 }
@@ -0,0 +1,73 @@
+// Package outbox publishes the outbox events, the changes of the deposit and withdraw
+// rows the db triggers write in the transaction of each change, to a webhook, nats,
+// kafka, a file or stdout. An event is delivered at least once, the events of a row
+// in the order of the changes.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/model"
+)
+
+// Event is the published outbox event
+type Event struct {
+	ID int64 `json:"id"`
+	// Aggregate is the changed table, deposit_history, withdraw_history or withdraw_tx
+	Aggregate   string `json:"aggregate"`
+	AggregateID int64  `json:"aggregate_id"`
+	// Type is insert, update or delete
+	Type string `json:"type"`
+	// Payload is the row after the change, before a delete
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// NewEvent returns the published event of the outbox row
+func NewEvent(e model.OutboxEvent) Event {
+	payload := json.RawMessage(e.Payload)
+	if len(payload) == 0 {
+		payload = json.RawMessage("null")
+	}
+	return Event{
+		ID:          e.ID,
+		Aggregate:   e.Aggregate,
+		AggregateID: e.AggregateID,
+		Type:        e.EventType,
+		Payload:     payload,
+		CreatedAt:   e.CreatedAt,
+	}
+}
+
+// Key is the ordering key of the event, the events of a row share it
+func (e Event) Key() string {
+	return fmt.Sprintf("%s:%d", e.Aggregate, e.AggregateID)
+}
+
+// Sink publishes the events. Publish may be called again for a published event,
+// after a failed attempt or a restart, the consumers have to dedupe by event id.
+type Sink interface {
+	Publish(ctx context.Context, event Event) error
+	Close() error
+}
+
+// NewSink returns the sink of the outbox config
+func NewSink(cfg config.OutboxConfig) (Sink, error) {
+	switch cfg.Sink {
+	case config.OutboxSinkWebhook:
+		return newWebhookSink(cfg.SinkURL), nil
+	case config.OutboxSinkNATS:
+		return newNATSSink(cfg.SinkURL, cfg.SinkTopic)
+	case config.OutboxSinkKafka:
+		return newKafkaSink(cfg.SinkURL, cfg.SinkTopic), nil
+	case config.OutboxSinkFile:
+		return newFileSink(cfg.SinkURL)
+	case config.OutboxSinkStdout:
+		return newStdoutSink(), nil
+	}
+	return nil, fmt.Errorf("unsupported outbox sink %q", cfg.Sink)
+}
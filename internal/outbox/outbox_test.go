@@ -0,0 +1,256 @@
+package outbox_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/metrics"
+	"github.com/b2network/b2-indexer/internal/migration"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/outbox"
+	"github.com/b2network/b2-indexer/internal/storage"
+	"github.com/b2network/b2-indexer/pkg/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+	"gorm.io/gorm"
+)
+
+func openSqlite(t *testing.T) *gorm.DB {
+	db, err := storage.Open(&config.Config{
+		DatabaseSource: "sqlite://" + filepath.Join(t.TempDir(), "indexer.db"),
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	migrator, err := migration.New(db, log.NewNopLogger())
+	require.NoError(t, err)
+	_, err = migrator.Up(0)
+	require.NoError(t, err)
+	return db
+}
+
+// recordSink records the published events, the events of failKey fail
+type recordSink struct {
+	events  []outbox.Event
+	failKey string
+}
+
+func (s *recordSink) Publish(_ context.Context, event outbox.Event) error {
+	if event.Key() == s.failKey {
+		return errors.New("sink down")
+	}
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *recordSink) Close() error { return nil }
+
+func newRelay(db *gorm.DB, sink outbox.Sink) *outbox.Relay {
+	return outbox.NewRelay(config.OutboxConfig{BatchSize: 100, PollInterval: 1, PublishTimeout: 1, MaxAttempts: 20, MaxBackoff: 60}, sink, db, log.NewNopLogger())
+}
+
+// due makes the failed events due to be published again
+func due(t *testing.T, db *gorm.DB) {
+	require.NoError(t, db.Model(&model.OutboxEvent{}).Where("next_attempt_at IS NOT NULL").
+		Update("next_attempt_at", time.Now().Add(-time.Second)).Error)
+}
+
+func TestRelay(t *testing.T) {
+	db := openSqlite(t)
+	deposit := model.Deposit{BtcTxHash: "tx", BtcValue: 10}
+	require.NoError(t, db.Create(&deposit).Error)
+	withdraw := model.Withdraw{B2TxHash: "0x01", BtcTo: "to", BtcValue: 5}
+	require.NoError(t, db.Create(&withdraw).Error)
+	require.NoError(t, db.Model(&model.Deposit{}).Where("id = ?", deposit.ID).
+		Update(model.Deposit{}.Column().B2TxStatus, model.DepositB2TxStatusSuccess).Error)
+
+	sink := &recordSink{failKey: "withdraw_history:1"}
+	relay := newRelay(db, sink)
+	published, failed, err := relay.PublishPending()
+	require.NoError(t, err)
+	require.Equal(t, 2, published)
+	require.Equal(t, 1, failed)
+	require.Len(t, sink.events, 2)
+	require.Equal(t, model.OutboxEventInsert, sink.events[0].Type)
+	require.Equal(t, model.OutboxEventUpdate, sink.events[1].Type)
+	require.Equal(t, "deposit_history:1", sink.events[1].Key())
+	require.Equal(t, int64(model.DepositB2TxStatusSuccess), gjson.GetBytes(sink.events[1].Payload, "b2_tx_status").Int())
+
+	var failedEvent model.OutboxEvent
+	require.NoError(t, db.Where("aggregate = ?", "withdraw_history").First(&failedEvent).Error)
+	require.Nil(t, failedEvent.PublishedAt)
+	require.Equal(t, 1, failedEvent.Attempts)
+	require.Equal(t, "sink down", failedEvent.LastError)
+
+	require.NotNil(t, failedEvent.NextAttemptAt)
+	require.True(t, failedEvent.NextAttemptAt.After(time.Now()))
+
+	// the later events of a failed row wait for it
+	require.NoError(t, db.Model(&model.Withdraw{}).Where("id = ?", withdraw.ID).
+		Update(model.Withdraw{}.Column().Status, model.BtcTxWithdrawSuccess).Error)
+	published, failed, err = relay.PublishPending()
+	require.NoError(t, err)
+	require.Equal(t, 0, published)
+	require.Equal(t, 0, failed)
+	due(t, db)
+	published, failed, err = relay.PublishPending()
+	require.NoError(t, err)
+	require.Equal(t, 0, published)
+	require.Equal(t, 1, failed)
+
+	sink.failKey = ""
+	due(t, db)
+	published, failed, err = relay.PublishPending()
+	require.NoError(t, err)
+	require.Equal(t, 2, published)
+	require.Equal(t, 0, failed)
+	require.Equal(t, model.OutboxEventInsert, sink.events[2].Type)
+	require.Equal(t, model.OutboxEventUpdate, sink.events[3].Type)
+	require.Equal(t, "withdraw_history:1", sink.events[3].Key())
+
+	published, _, err = relay.PublishPending()
+	require.NoError(t, err)
+	require.Equal(t, 0, published)
+}
+
+func TestRelayPagesPastFailingRow(t *testing.T) {
+	db := openSqlite(t)
+	// the failing row has more pending events than a batch
+	withdraw := model.Withdraw{B2TxHash: "0x01", BtcTo: "to", BtcValue: 5}
+	require.NoError(t, db.Create(&withdraw).Error)
+	for _, status := range []int{model.BtcTxWithdrawSubmitTxMsg, model.BtcTxWithdrawSignatureCompleted, model.BtcTxWithdrawBroadcastSuccess} {
+		require.NoError(t, db.Model(&model.Withdraw{}).Where("id = ?", withdraw.ID).
+			Update(model.Withdraw{}.Column().Status, status).Error)
+	}
+	for i := 0; i < 5; i++ {
+		require.NoError(t, db.Create(&model.Deposit{BtcTxHash: fmt.Sprintf("tx%d", i), BtcValue: 10}).Error)
+	}
+
+	sink := &recordSink{failKey: "withdraw_history:1"}
+	relay := outbox.NewRelay(config.OutboxConfig{BatchSize: 3, PollInterval: 1, PublishTimeout: 1, MaxAttempts: 20, MaxBackoff: 60}, sink, db, log.NewNopLogger())
+	for _, want := range []int{2, 2, 1, 0} {
+		due(t, db)
+		published, failed, err := relay.PublishPending()
+		require.NoError(t, err)
+		require.Equal(t, want, published)
+		require.Equal(t, 1, failed)
+	}
+	require.Len(t, sink.events, 5)
+	for i, event := range sink.events {
+		require.Equal(t, fmt.Sprintf("deposit_history:%d", i+1), event.Key())
+	}
+
+	var pending int64
+	require.NoError(t, db.Model(&model.OutboxEvent{}).Where("published_at IS NULL").Count(&pending).Error)
+	require.Equal(t, int64(4), pending)
+}
+
+func TestRelayParksFailingEvent(t *testing.T) {
+	db := openSqlite(t)
+	withdraw := model.Withdraw{B2TxHash: "0x01", BtcTo: "to", BtcValue: 5}
+	require.NoError(t, db.Create(&withdraw).Error)
+	require.NoError(t, db.Model(&model.Withdraw{}).Where("id = ?", withdraw.ID).
+		Update(model.Withdraw{}.Column().Status, model.BtcTxWithdrawSuccess).Error)
+
+	sink := &recordSink{failKey: "withdraw_history:1"}
+	relay := outbox.NewRelay(config.OutboxConfig{BatchSize: 10, PollInterval: 1, PublishTimeout: 1, MaxAttempts: 3, MaxBackoff: 3}, sink, db, log.NewNopLogger())
+	// the wait doubles up to max backoff
+	var event model.OutboxEvent
+	for _, wait := range []time.Duration{time.Second, 2 * time.Second} {
+		start := time.Now()
+		_, failed, err := relay.PublishPending()
+		require.NoError(t, err)
+		require.Equal(t, 1, failed)
+		require.NoError(t, db.First(&event, 1).Error)
+		require.WithinRange(t, *event.NextAttemptAt, start.Add(wait), time.Now().Add(wait))
+		due(t, db)
+	}
+	_, failed, err := relay.PublishPending()
+	require.NoError(t, err)
+	require.Equal(t, 1, failed)
+	require.NoError(t, db.First(&event, 1).Error)
+	require.Equal(t, 3, event.Attempts)
+	require.NotNil(t, event.ParkedAt)
+
+	// a parked event is not retried, the later events of its row wait for it
+	sink.failKey = ""
+	published, failed, err := relay.PublishPending()
+	require.NoError(t, err)
+	require.Equal(t, 0, published)
+	require.Equal(t, 0, failed)
+	require.Equal(t, float64(1), testutil.ToFloat64(metrics.OutboxParked))
+
+	unparked, err := outbox.Unpark(db, "withdraw_history", withdraw.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), unparked)
+	published, _, err = relay.PublishPending()
+	require.NoError(t, err)
+	require.Equal(t, 2, published)
+	require.Equal(t, float64(0), testutil.ToFloat64(metrics.OutboxParked))
+}
+
+func TestReplay(t *testing.T) {
+	db := openSqlite(t)
+	for _, hash := range []string{"tx1", "tx2"} {
+		require.NoError(t, db.Create(&model.Deposit{BtcTxHash: hash}).Error)
+	}
+	_, _, err := newRelay(db, &recordSink{}).PublishPending()
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "events", "outbox.jsonl")
+	sink, err := outbox.NewSink(config.OutboxConfig{Sink: config.OutboxSinkFile, SinkURL: path})
+	require.NoError(t, err)
+	replayed, err := outbox.Replay(context.Background(), db, sink, outbox.ReplayFilter{Aggregate: "deposit_history", AggregateID: 2})
+	require.NoError(t, err)
+	require.Equal(t, 1, replayed)
+	replayed, err = outbox.Replay(context.Background(), db, sink, outbox.ReplayFilter{FromID: 1})
+	require.NoError(t, err)
+	require.Equal(t, 2, replayed)
+	require.NoError(t, sink.Close())
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	var ids []int64
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event outbox.Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		ids = append(ids, event.ID)
+	}
+	require.Equal(t, []int64{2, 1, 2}, ids)
+}
+
+func TestWebhookSink(t *testing.T) {
+	var got outbox.Event
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "deposit_history:7", r.Header.Get("X-Outbox-Event-Key"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink, err := outbox.NewSink(config.OutboxConfig{Sink: config.OutboxSinkWebhook, SinkURL: server.URL})
+	require.NoError(t, err)
+	defer sink.Close()
+	event := outbox.Event{ID: 3, Aggregate: "deposit_history", AggregateID: 7, Type: model.OutboxEventInsert, Payload: json.RawMessage(`{"id":7}`)}
+	require.NoError(t, sink.Publish(context.Background(), event))
+	require.Equal(t, event.ID, got.ID)
+	require.JSONEq(t, `{"id":7}`, string(got.Payload))
+
+	status = http.StatusServiceUnavailable
+	require.ErrorContains(t, sink.Publish(context.Background(), event), "webhook status 503")
+}
@@ -0,0 +1,232 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/metrics"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/supervisor"
+	"github.com/b2network/b2-indexer/pkg/log"
+	"github.com/cometbft/cometbft/libs/service"
+	"gorm.io/gorm"
+)
+
+const (
+	RelayServiceName = "OutboxRelayService"
+
+	// maxErrorLen is the size of outbox_event.last_error
+	maxErrorLen = 512
+)
+
+// Relay publishes the pending outbox events in id order and marks them published.
+// A failed event is retried after a backoff doubling from the poll interval and parked
+// after max attempts, the later events of its row wait for it and are skipped, the
+// other rows go on. A single relay keeps the order of the events of a row, with leader
+// election the leader runs it.
+type Relay struct {
+	service.BaseService
+
+	db             *gorm.DB
+	sink           Sink
+	batchSize      int
+	pollInterval   time.Duration
+	publishTimeout time.Duration
+	maxAttempts    int
+	maxBackoff     time.Duration
+	log            log.Logger
+	loops          *supervisor.Loops
+}
+
+// NewRelay returns a relay publishing the events of db to sink
+func NewRelay(cfg config.OutboxConfig, sink Sink, db *gorm.DB, log log.Logger) *Relay {
+	r := &Relay{
+		db:             db,
+		sink:           sink,
+		batchSize:      cfg.BatchSize,
+		pollInterval:   time.Duration(cfg.PollInterval) * time.Second,
+		publishTimeout: time.Duration(cfg.PublishTimeout) * time.Second,
+		maxAttempts:    cfg.MaxAttempts,
+		maxBackoff:     time.Duration(cfg.MaxBackoff) * time.Second,
+		log:            log,
+	}
+	r.BaseService = *service.NewBaseService(nil, RelayServiceName, r)
+	return r
+}
+
+// OnStart implements service.Service
+func (r *Relay) OnStart() error {
+	r.loops = supervisor.NewLoops()
+	r.loops.Go(r.relay)
+	return nil
+}
+
+// OnStop waits for the event being published
+func (r *Relay) OnStop() {
+	r.log.Warnf("Relay stopping...")
+	r.loops.Stop()
+}
+
+// Crashed implements supervisor.Service
+func (r *Relay) Crashed() <-chan struct{} {
+	return r.loops.Crashed()
+}
+
+// Err implements supervisor.Service
+func (r *Relay) Err() error {
+	return r.loops.Err()
+}
+
+// relay publishes the pending events until the service stops, a full batch is
+// followed by the next one right away
+func (r *Relay) relay() error {
+	for {
+		published, failed, err := r.PublishPending()
+		if err != nil {
+			r.log.Errorw("outbox relay failed to load events", "error", err)
+		}
+		wait := r.pollInterval
+		if err == nil && failed == 0 && published == r.batchSize {
+			wait = 0
+		}
+		if !r.loops.Sleep(wait) {
+			return nil
+		}
+	}
+}
+
+// PublishPending publishes up to a batch of pending events, it returns the number of
+// published and failed events. The events of a row with a failed event are left out of
+// the pages loaded after it, so a row failing for good does not fill the batches.
+func (r *Relay) PublishPending() (int, int, error) {
+	published, failed := 0, 0
+	now := time.Now()
+	// the rows with a failed event, their later events wait for the next poll
+	blocked := make(map[string]bool)
+	var blockedRows []model.OutboxEvent
+	var lastID int64
+	for published+failed < r.batchSize {
+		events, err := r.loadPending(lastID, blockedRows, now)
+		if err != nil {
+			return published, failed, err
+		}
+		for _, e := range events {
+			if published+failed >= r.batchSize {
+				break
+			}
+			lastID = e.ID
+			event := NewEvent(e)
+			if blocked[event.Key()] {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), r.publishTimeout)
+			err = r.sink.Publish(ctx, event)
+			cancel()
+			if err != nil {
+				blocked[event.Key()] = true
+				blockedRows = append(blockedRows, e)
+				failed++
+				metrics.OutboxPublishFailures.Inc()
+				r.log.Warnw("outbox event publish failed", "id", e.ID, "key", event.Key(), "attempts", e.Attempts+1, "error", err)
+				if err = r.markFailed(e, err); err != nil {
+					return published, failed, err
+				}
+				continue
+			}
+			// a crash before the mark publishes the event again
+			err = r.db.Model(&model.OutboxEvent{}).Where("id = ?", e.ID).Updates(map[string]interface{}{
+				model.OutboxEvent{}.Column().PublishedAt: time.Now(),
+			}).Error
+			if err != nil {
+				return published, failed, err
+			}
+			published++
+		}
+		if len(events) < r.batchSize {
+			break
+		}
+	}
+	if published > 0 || failed > 0 {
+		r.log.Infow("outbox events relayed", "published", published, "failed", failed)
+	}
+	var parked int64
+	if err := r.db.Model(&model.OutboxEvent{}).Where(fmt.Sprintf("%s IS NOT NULL", model.OutboxEvent{}.Column().ParkedAt)).Count(&parked).Error; err != nil {
+		return published, failed, err
+	}
+	metrics.OutboxParked.Set(float64(parked))
+	return published, failed, nil
+}
+
+// loadPending loads a page of the pending events due at now after afterID, but the events of
+// the blocked rows and the events behind a parked or not yet due event of their row
+func (r *Relay) loadPending(afterID int64, blockedRows []model.OutboxEvent, now time.Time) ([]model.OutboxEvent, error) {
+	columns := model.OutboxEvent{}.Column()
+	query := r.db.
+		Where(fmt.Sprintf("%s IS NULL AND %s IS NULL", columns.PublishedAt, columns.ParkedAt)).
+		Where(fmt.Sprintf("(%[1]s IS NULL OR %[1]s <= ?)", columns.NextAttemptAt), now).
+		Where("id > ?", afterID).
+		Where(fmt.Sprintf("NOT EXISTS (SELECT 1 FROM %[1]s w WHERE w.%[2]s = %[1]s.%[2]s AND w.%[3]s = %[1]s.%[3]s "+
+			"AND w.id < %[1]s.id AND w.%[4]s IS NULL AND (w.%[5]s IS NOT NULL OR w.%[6]s > ?))",
+			model.OutboxEvent{}.TableName(), columns.Aggregate, columns.AggregateID, columns.PublishedAt, columns.ParkedAt, columns.NextAttemptAt), now)
+	for _, row := range blockedRows {
+		query = query.Where(fmt.Sprintf("NOT (%s = ? AND %s = ?)", columns.Aggregate, columns.AggregateID), row.Aggregate, row.AggregateID)
+	}
+	var events []model.OutboxEvent
+	err := query.Order("id").Limit(r.batchSize).Find(&events).Error
+	return events, err
+}
+
+// markFailed records a failed attempt of e and the time of the next one, or parks e
+// after max attempts
+func (r *Relay) markFailed(e model.OutboxEvent, publishErr error) error {
+	reason := publishErr.Error()
+	if len(reason) > maxErrorLen {
+		reason = reason[:maxErrorLen]
+	}
+	attempts := e.Attempts + 1
+	now := time.Now()
+	updateFields := map[string]interface{}{
+		model.OutboxEvent{}.Column().Attempts:  attempts,
+		model.OutboxEvent{}.Column().LastError: reason,
+	}
+	if attempts >= r.maxAttempts {
+		updateFields[model.OutboxEvent{}.Column().ParkedAt] = now
+		r.log.Errorw("outbox event parked", "id", e.ID, "aggregate", e.Aggregate, "aggregateID", e.AggregateID, "attempts", attempts, "error", reason)
+	} else {
+		updateFields[model.OutboxEvent{}.Column().NextAttemptAt] = now.Add(r.backoff(attempts))
+	}
+	return r.db.Model(&model.OutboxEvent{}).Where("id = ?", e.ID).Updates(updateFields).Error
+}
+
+// backoff returns the wait after the attempts failed, doubling from the poll interval up to max backoff
+func (r *Relay) backoff(attempts int) time.Duration {
+	wait := r.pollInterval
+	for i := 1; i < attempts && wait < r.maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > r.maxBackoff {
+		wait = r.maxBackoff
+	}
+	return wait
+}
+
+// Unpark makes the parked events of aggregate and aggregateID pending again with their
+// attempts reset, of all rows when aggregate is empty, and returns their number
+func Unpark(db *gorm.DB, aggregate string, aggregateID int64) (int64, error) {
+	columns := model.OutboxEvent{}.Column()
+	query := db.Model(&model.OutboxEvent{}).Where(fmt.Sprintf("%s IS NOT NULL", columns.ParkedAt))
+	if aggregate != "" {
+		query = query.Where(fmt.Sprintf("%s = ?", columns.Aggregate), aggregate)
+	}
+	if aggregateID > 0 {
+		query = query.Where(fmt.Sprintf("%s = ?", columns.AggregateID), aggregateID)
+	}
+	result := query.Updates(map[string]interface{}{
+		columns.Attempts:      0,
+		columns.NextAttemptAt: nil,
+		columns.ParkedAt:      nil,
+	})
+	return result.RowsAffected, result.Error
+}
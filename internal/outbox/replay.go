@@ -0,0 +1,56 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/b2network/b2-indexer/internal/model"
+	"gorm.io/gorm"
+)
+
+// replayBatch is the number of events loaded at once by Replay
+const replayBatch = 500
+
+// ReplayFilter selects the events published again, the zero values match all
+type ReplayFilter struct {
+	FromID      int64
+	ToID        int64
+	Aggregate   string
+	AggregateID int64
+}
+
+// Replay publishes the events of filter again in id order, whether published or not,
+// and returns their number. It stops at the first failed publish, the events it
+// published are not marked and the pending ones are still published by the relay.
+func Replay(ctx context.Context, db *gorm.DB, sink Sink, filter ReplayFilter) (int, error) {
+	columns := model.OutboxEvent{}.Column()
+	query := db.Model(&model.OutboxEvent{})
+	if filter.ToID > 0 {
+		query = query.Where("id <= ?", filter.ToID)
+	}
+	if filter.Aggregate != "" {
+		query = query.Where(fmt.Sprintf("%s = ?", columns.Aggregate), filter.Aggregate)
+	}
+	if filter.AggregateID > 0 {
+		query = query.Where(fmt.Sprintf("%s = ?", columns.AggregateID), filter.AggregateID)
+	}
+	replayed := 0
+	lastID := filter.FromID - 1
+	for {
+		var events []model.OutboxEvent
+		err := query.Session(&gorm.Session{}).Where("id > ?", lastID).Order("id").Limit(replayBatch).Find(&events).Error
+		if err != nil {
+			return replayed, err
+		}
+		for _, e := range events {
+			if err = sink.Publish(ctx, NewEvent(e)); err != nil {
+				return replayed, fmt.Errorf("replay event %d: %w", e.ID, err)
+			}
+			replayed++
+			lastID = e.ID
+		}
+		if len(events) < replayBatch {
+			return replayed, nil
+		}
+	}
+}
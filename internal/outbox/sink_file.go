@@ -0,0 +1,57 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// writerSink writes every event as a json line, to a file or stdout
+type writerSink struct {
+	mu sync.Mutex
+	w  io.Writer
+	// file is synced after every event and closed with the sink, nil for stdout
+	file *os.File
+}
+
+// newFileSink appends the events to the file path
+func newFileSink(path string) (*writerSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &writerSink{w: file, file: file}, nil
+}
+
+func newStdoutSink() *writerSink {
+	return &writerSink{w: os.Stdout}
+}
+
+func (s *writerSink) Publish(_ context.Context, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err = s.w.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if s.file != nil {
+		return s.file.Sync()
+	}
+	return nil
+}
+
+func (s *writerSink) Close() error {
+	if s.file != nil {
+		return s.file.Close()
+	}
+	return nil
+}
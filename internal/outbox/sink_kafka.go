@@ -0,0 +1,44 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaSink writes every event to topic keyed by Event.Key, the events of a row go to
+// one partition in order. A write completes once all in-sync replicas have it.
+type kafkaSink struct {
+	writer *kafka.Writer
+}
+
+func newKafkaSink(brokers string, topic string) *kafkaSink {
+	var addrs []string
+	for _, broker := range strings.Split(brokers, ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			addrs = append(addrs, broker)
+		}
+	}
+	return &kafkaSink{writer: &kafka.Writer{
+		Addr:         kafka.TCP(addrs...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		// the relay publishes one event at a time
+		BatchSize: 1,
+	}}
+}
+
+func (s *kafkaSink) Publish(ctx context.Context, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return s.writer.WriteMessages(ctx, kafka.Message{Key: []byte(event.Key()), Value: data})
+}
+
+func (s *kafkaSink) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,42 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/nats-io/nats.go"
+)
+
+// natsSink publishes every event to the subject <topic>.<table>. The publish completes
+// once the server flushed it, a JetStream stream dedupes by the Nats-Msg-Id event id.
+type natsSink struct {
+	conn  *nats.Conn
+	topic string
+}
+
+func newNATSSink(url string, topic string) (*natsSink, error) {
+	conn, err := nats.Connect(url, nats.Name("b2-indexer-outbox"))
+	if err != nil {
+		return nil, err
+	}
+	return &natsSink{conn: conn, topic: topic}, nil
+}
+
+func (s *natsSink) Publish(ctx context.Context, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	msg := nats.NewMsg(s.topic + "." + event.Aggregate)
+	msg.Header.Set(nats.MsgIdHdr, strconv.FormatInt(event.ID, 10))
+	msg.Data = data
+	if err = s.conn.PublishMsg(msg); err != nil {
+		return err
+	}
+	return s.conn.FlushWithContext(ctx)
+}
+
+func (s *natsSink) Close() error {
+	return s.conn.Drain()
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/b2network/b2-indexer/pkg/crypto"
+)
+
+const (
+	HeaderSigner    = "X-Signer"
+	HeaderApprover  = "X-Approver"
+	HeaderTimestamp = "X-Timestamp"
+	HeaderSignature = "X-Signature"
+
+	maxRequestBodySize = 1 << 20
+)
+
+type signerContext string
+
+const (
+	signerContextKey   = signerContext("signer")
+	approverContextKey = signerContext("approver")
+)
+
+var (
+	ErrForbiddenIP       = errors.New("ip not allowed")
+	ErrUnauthorized      = errors.New("invalid signer request signature")
+	ErrSignerRequestTime = errors.New("signer request expired")
+)
+
+// SignerRequestMessage returns the message a signer or approver signs with its rsa key, sent in the X-Signature header
+func SignerRequestMessage(signer string, timestamp string, method string, requestURI string, body []byte) string {
+	return fmt.Sprintf("%s\n%s\n%s\n%s\n%s", signer, timestamp, method, requestURI, body)
+}
+
+// ipWhiteList rejects clients not in the configured ip white list, an empty list allows all
+func (s *Server) ipWhiteList(next http.Handler) http.Handler {
+	allowed := make(map[string]bool)
+	for _, ip := range strings.Split(s.httpCfg.IPWhiteList, ",") {
+		if ip = strings.TrimSpace(ip); ip != "" {
+			allowed[ip] = true
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(allowed) > 0 {
+			ip, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				ip = r.RemoteAddr
+			}
+			if !allowed[ip] {
+				s.log.Warnw("http server forbidden ip", "ip", ip, "path", r.URL.Path)
+				s.writeError(w, http.StatusForbidden, ErrForbiddenIP)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// signerAuth authenticates withdraw signers by the rsa signature of the request,
+// the rsa public key of a signer is configured in the order of the bridge public keys
+func (s *Server) signerAuth(next http.Handler) http.Handler {
+	return s.rsaAuth(HeaderSigner, signerContextKey, func(signer string) (string, bool) {
+		index := s.signer.SignerIndex(signer)
+		if index < 0 || index >= len(s.httpCfg.SignerKeys) {
+			return "", false
+		}
+		return s.httpCfg.SignerKeys[index], true
+	}, next)
+}
+
+// approverAuth authenticates withdraw approvers by the rsa signature of the request,
+// approver rsa public keys are configured as name:key
+func (s *Server) approverAuth(next http.Handler) http.Handler {
+	keys := make(map[string]string)
+	for _, approverKey := range s.httpCfg.ApproverKeys {
+		name, key, ok := strings.Cut(strings.TrimSpace(approverKey), ":")
+		if !ok || name == "" || key == "" {
+			s.log.Warnw("http server invalid approver key", "approverKey", approverKey)
+			continue
+		}
+		keys[name] = key
+	}
+	return s.rsaAuth(HeaderApprover, approverContextKey, func(approver string) (string, bool) {
+		key, ok := keys[approver]
+		return key, ok
+	}, next)
+}
+
+// rsaAuth verifies the rsa signature of the request by the caller named in header,
+// the caller name is stored in the request context under ctxKey
+func (s *Server) rsaAuth(header string, ctxKey signerContext, keyOf func(string) (string, bool), next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller := r.Header.Get(header)
+		timestamp := r.Header.Get(HeaderTimestamp)
+		key, ok := keyOf(caller)
+		if !ok {
+			s.writeError(w, http.StatusUnauthorized, ErrUnauthorized)
+			return
+		}
+		requestTime, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			s.writeError(w, http.StatusUnauthorized, ErrUnauthorized)
+			return
+		}
+		expire := time.Duration(s.httpCfg.SignerRequestExpire) * time.Second
+		if age := time.Since(time.Unix(requestTime, 0)); age > expire || age < -expire {
+			s.writeError(w, http.StatusUnauthorized, ErrSignerRequestTime)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBodySize))
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		message := SignerRequestMessage(caller, timestamp, r.Method, r.URL.RequestURI(), body)
+		err = crypto.RsaVerifyHex(message, r.Header.Get(HeaderSignature), key)
+		if err != nil {
+			s.log.Warnw("http server rsa auth failed", "header", header, "caller", caller, "error", err)
+			s.writeError(w, http.StatusUnauthorized, ErrUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKey, caller)))
+	})
+}
+
+func signerFromContext(ctx context.Context) string {
+	signer, _ := ctx.Value(signerContextKey).(string)
+	return signer
+}
+
+func approverFromContext(ctx context.Context) string {
+	approver, _ := ctx.Value(approverContextKey).(string)
+	return approver
+}
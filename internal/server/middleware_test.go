@@ -0,0 +1,153 @@
+package server
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/logic/indexer"
+	"github.com/b2network/b2-indexer/pkg/crypto"
+	"github.com/b2network/b2-indexer/pkg/log"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/stretchr/testify/require"
+)
+
+type testSigner struct {
+	pubKey     string
+	rsaPrivKey string
+}
+
+func newTestServer(t *testing.T, ipWhiteList string) (*Server, []testSigner) {
+	var signers []testSigner
+	bitcoinCfg := &config.BitcoinConfig{Bridge: config.BridgeConfig{MultisigNum: 2}}
+	httpCfg := &config.HTTPConfig{IPWhiteList: ipWhiteList, SignerRequestExpire: 300}
+	for i := 0; i < 3; i++ {
+		privKey, err := btcec.NewPrivateKey()
+		require.NoError(t, err)
+		rsaPrivKey, rsaPubKey, err := crypto.GenRsaKey(1024)
+		require.NoError(t, err)
+		signer := testSigner{pubKey: hex.EncodeToString(privKey.PubKey().SerializeCompressed()), rsaPrivKey: rsaPrivKey}
+		signers = append(signers, signer)
+		bitcoinCfg.Bridge.PublicKeys = append(bitcoinCfg.Bridge.PublicKeys, signer.pubKey)
+		httpCfg.SignerKeys = append(httpCfg.SignerKeys, rsaPubKey)
+	}
+	signer, err := indexer.NewWithdrawSigner(bitcoinCfg, nil, log.NewNopLogger())
+	require.NoError(t, err)
+	return NewServer(httpCfg, signer, nil, nil, nil, log.NewNopLogger()), signers
+}
+
+func signedRequest(t *testing.T, signer testSigner, timestamp time.Time, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/v1/withdraw/sign", strings.NewReader(body))
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	signature, err := crypto.RsaSignHex(SignerRequestMessage(signer.pubKey, ts, req.Method, req.URL.RequestURI(), []byte(body)), signer.rsaPrivKey)
+	require.NoError(t, err)
+	req.Header.Set(HeaderSigner, signer.pubKey)
+	req.Header.Set(HeaderTimestamp, ts)
+	req.Header.Set(HeaderSignature, signature)
+	return req
+}
+
+func TestSignerAuth(t *testing.T) {
+	s, signers := newTestServer(t, "")
+	var authSigner string
+	handler := s.signerAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authSigner = signerFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+	body := `{"btc_tx_id":"00"}`
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, signedRequest(t, signers[1], time.Now(), body))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, signers[1].pubKey, authSigner)
+
+	// signed with the rsa key of another signer
+	req := signedRequest(t, signers[0], time.Now(), body)
+	req.Header.Set(HeaderSigner, signers[1].pubKey)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// body changed after signing
+	req = signedRequest(t, signers[0], time.Now(), body)
+	req.Body = http.NoBody
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// expired request
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, signedRequest(t, signers[0], time.Now().Add(-time.Hour), body))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// unknown signer
+	req = signedRequest(t, signers[0], time.Now(), body)
+	req.Header.Set(HeaderSigner, "02"+strings.Repeat("00", 32))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestIPWhiteList(t *testing.T) {
+	s, _ := newTestServer(t, "10.0.0.1, 10.0.0.2")
+	handler := s.ipWhiteList(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/withdraw/sign/pending", nil)
+	req.RemoteAddr = "10.0.0.2:5000"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	req.RemoteAddr = "10.0.0.3:5000"
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestApproverAuth(t *testing.T) {
+	rsaPrivKey, rsaPubKey, err := crypto.GenRsaKey(1024)
+	require.NoError(t, err)
+	httpCfg := &config.HTTPConfig{ApproverKeys: []string{"alice:" + rsaPubKey, "invalid"}, SignerRequestExpire: 300}
+	s := NewServer(httpCfg, nil, nil, nil, nil, log.NewNopLogger())
+	var authApprover string
+	handler := s.approverAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authApprover = approverFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+	approverRequest := func(approver string) *http.Request {
+		body := `{"id":1}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/withdraw/approve", strings.NewReader(body))
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		signature, err := crypto.RsaSignHex(SignerRequestMessage(approver, ts, req.Method, req.URL.RequestURI(), []byte(body)), rsaPrivKey)
+		require.NoError(t, err)
+		req.Header.Set(HeaderApprover, approver)
+		req.Header.Set(HeaderTimestamp, ts)
+		req.Header.Set(HeaderSignature, signature)
+		return req
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, approverRequest("alice"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "alice", authApprover)
+
+	// unknown approver
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, approverRequest("bob"))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// signer headers do not authenticate approvers
+	req := approverRequest("alice")
+	req.Header.Del(HeaderApprover)
+	req.Header.Set(HeaderSigner, "alice")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
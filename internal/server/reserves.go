@@ -0,0 +1,27 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/b2network/b2-indexer/internal/logic/reserves"
+)
+
+// reservesReport serves the latest signed proof-of-reserves report, built at most every cache-ttl
+func (s *Server) reservesReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, errors.New(http.StatusText(http.StatusMethodNotAllowed)))
+		return
+	}
+	if s.reserves == nil {
+		s.writeError(w, http.StatusNotFound, reserves.ErrNoSignerKey)
+		return
+	}
+	signed, err := s.reserves.Latest(r.Context())
+	if err != nil {
+		s.log.Errorw("http server build reserves report err", "error", err)
+		s.writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	s.writeData(w, signed)
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/logic/indexer"
+	"github.com/b2network/b2-indexer/internal/logic/reserves"
+	"github.com/b2network/b2-indexer/internal/logic/risk"
+	"github.com/b2network/b2-indexer/internal/logic/webhook"
+	"github.com/b2network/b2-indexer/pkg/log"
+	"github.com/cometbft/cometbft/libs/service"
+)
+
+const (
+	HTTPServerName = "HTTPServer"
+
+	shutdownTimeout = 10 * time.Second
+)
+
+// Response is the json body of every api response
+type Response struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// Server serves the http api
+type Server struct {
+	service.BaseService
+
+	httpCfg  *config.HTTPConfig
+	signer   *indexer.WithdrawSigner
+	risk     *risk.Engine
+	webhooks *webhook.Manager
+	reserves *reserves.Reporter
+	server   *http.Server
+	log      log.Logger
+}
+
+// NewServer returns a new http api server instance.
+// A nil reporter serves no proof-of-reserves report.
+func NewServer(httpCfg *config.HTTPConfig, signer *indexer.WithdrawSigner, riskEngine *risk.Engine, webhooks *webhook.Manager,
+	reporter *reserves.Reporter, log log.Logger,
+) *Server {
+	s := &Server{httpCfg: httpCfg, signer: signer, risk: riskEngine, webhooks: webhooks, reserves: reporter, log: log}
+	s.server = &http.Server{
+		Addr:              net.JoinHostPort("", httpCfg.HTTPPort),
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	s.BaseService = *service.NewBaseService(nil, HTTPServerName, s)
+	return s
+}
+
+// Handler returns the api routes
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/v1/withdraw/sign/pending", s.signerAuth(http.HandlerFunc(s.pendingWithdrawTxs)))
+	mux.Handle("/v1/withdraw/sign", s.signerAuth(http.HandlerFunc(s.submitWithdrawSign)))
+	mux.Handle("/v1/withdraw/approval", s.approverAuth(http.HandlerFunc(s.awaitingApprovalWithdraws)))
+	mux.Handle("/v1/withdraw/approve", s.approverAuth(http.HandlerFunc(s.approveWithdraw)))
+	mux.Handle("/v1/withdraw/reject", s.approverAuth(http.HandlerFunc(s.rejectWithdraw)))
+	mux.Handle("/v1/webhook/subscriptions", s.approverAuth(http.HandlerFunc(s.webhookSubscriptions)))
+	mux.Handle("/v1/webhook/deliveries", s.approverAuth(http.HandlerFunc(s.webhookDeliveries)))
+	mux.Handle("/v1/webhook/redeliver", s.approverAuth(http.HandlerFunc(s.redeliverWebhook)))
+	mux.Handle("/v1/reserves", http.HandlerFunc(s.reservesReport))
+	return s.ipWhiteList(mux)
+}
+
+// OnStart implements service.Service by listening on the http port
+func (s *Server) OnStart() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	s.log.Infow("http server listening", "address", listener.Addr().String())
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.log.Errorw("http server serve err", "error", err)
+		}
+	}()
+	return nil
+}
+
+// OnStop implements service.Service by shutting down the http server
+func (s *Server) OnStop() {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		s.log.Errorw("http server shutdown err", "error", err)
+	}
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, resp Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		s.log.Errorw("http server write response err", "error", err)
+	}
+}
+
+func (s *Server) writeError(w http.ResponseWriter, status int, err error) {
+	s.writeJSON(w, status, Response{Code: status, Message: err.Error()})
+}
+
+func (s *Server) writeData(w http.ResponseWriter, data interface{}) {
+	s.writeJSON(w, http.StatusOK, Response{Code: 0, Message: "success", Data: data})
+}
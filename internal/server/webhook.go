@@ -0,0 +1,138 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/b2network/b2-indexer/internal/logic/webhook"
+	"github.com/b2network/b2-indexer/internal/model"
+)
+
+// SaveWebhookSubscriptionResponse is the saved subscription, with its secret when
+// it was generated or changed by the request
+type SaveWebhookSubscriptionResponse struct {
+	Subscription model.WebhookSubscription `json:"subscription"`
+	Secret       string                    `json:"secret,omitempty"`
+}
+
+// RedeliverWebhookRequest schedules a delivery again
+type RedeliverWebhookRequest struct {
+	ID int64 `json:"id"`
+}
+
+// webhookSubscriptions lists the subscriptions on GET, creates or updates one by name on POST
+func (s *Server) webhookSubscriptions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		subs, err := s.webhooks.Subscriptions()
+		if err != nil {
+			s.log.Errorw("http server get webhook subscriptions err", "error", err)
+			s.writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		s.writeData(w, subs)
+	case http.MethodPost:
+		var req webhook.Subscription
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		sub, secret, err := s.webhooks.SaveSubscription(req)
+		if err != nil {
+			s.log.Warnw("http server save webhook subscription err", "approver", approverFromContext(r.Context()), "name", req.Name, "error", err)
+			s.writeError(w, webhookErrorStatus(err), err)
+			return
+		}
+		s.log.Infow("webhook subscription saved", "approver", approverFromContext(r.Context()), "name", sub.Name, "url", sub.URL, "enabled", sub.Enabled)
+		s.writeData(w, SaveWebhookSubscriptionResponse{Subscription: sub, Secret: secret})
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, errors.New(http.StatusText(http.StatusMethodNotAllowed)))
+	}
+}
+
+// webhookDeliveries lists the latest deliveries, filtered by the subscription, event,
+// aggregate, aggregate_id and status query parameters
+func (s *Server) webhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, errors.New(http.StatusText(http.StatusMethodNotAllowed)))
+		return
+	}
+	query := r.URL.Query()
+	filter := webhook.DeliveryFilter{
+		Event:     query.Get("event"),
+		Aggregate: query.Get("aggregate"),
+	}
+	for key, value := range map[string]*int64{
+		"subscription": &filter.SubscriptionID,
+		"aggregate_id": &filter.AggregateID,
+	} {
+		if query.Get(key) == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(query.Get(key), 10, 64)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, errors.New("invalid "+key))
+			return
+		}
+		*value = n
+	}
+	for key, value := range map[string]*int{
+		"status": &filter.Status,
+		"limit":  &filter.Limit,
+	} {
+		if query.Get(key) == "" {
+			continue
+		}
+		n, err := strconv.Atoi(query.Get(key))
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, errors.New("invalid "+key))
+			return
+		}
+		*value = n
+	}
+	deliveries, err := s.webhooks.Deliveries(filter)
+	if err != nil {
+		s.log.Errorw("http server get webhook deliveries err", "error", err)
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.writeData(w, deliveries)
+}
+
+// redeliverWebhook schedules a delivery again with a fresh attempt budget
+func (s *Server) redeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, errors.New(http.StatusText(http.StatusMethodNotAllowed)))
+		return
+	}
+	var req RedeliverWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.ID <= 0 {
+		s.writeError(w, http.StatusBadRequest, errors.New("id is required"))
+		return
+	}
+	delivery, err := s.webhooks.Redeliver(req.ID)
+	if err != nil {
+		s.log.Warnw("http server redeliver webhook err", "approver", approverFromContext(r.Context()), "id", req.ID, "error", err)
+		s.writeError(w, webhookErrorStatus(err), err)
+		return
+	}
+	s.log.Infow("webhook redelivery scheduled", "approver", approverFromContext(r.Context()), "id", req.ID)
+	s.writeData(w, delivery)
+}
+
+func webhookErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, webhook.ErrInvalidSubscription):
+		return http.StatusBadRequest
+	case errors.Is(err, webhook.ErrDeliveryNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/b2network/b2-indexer/internal/logic/risk"
+	"github.com/b2network/b2-indexer/internal/model"
+)
+
+// ReviewWithdrawRequest approves or rejects a withdraw awaiting approval
+type ReviewWithdrawRequest struct {
+	ID     int64  `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// ReviewWithdrawResponse is the withdraw risk status after the review
+type ReviewWithdrawResponse struct {
+	ID         int64  `json:"id"`
+	RiskStatus int    `json:"risk_status"`
+	Reviewer   string `json:"reviewer"`
+}
+
+// awaitingApprovalWithdraws lists the withdraws held by the risk engine for manual approval
+func (s *Server) awaitingApprovalWithdraws(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, errors.New(http.StatusText(http.StatusMethodNotAllowed)))
+		return
+	}
+	withdrawList, err := s.risk.AwaitingApproval()
+	if err != nil {
+		s.log.Errorw("http server get awaiting approval withdraw err", "error", err)
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.writeData(w, withdrawList)
+}
+
+// approveWithdraw approves a withdraw by the authenticated approver
+func (s *Server) approveWithdraw(w http.ResponseWriter, r *http.Request) {
+	s.reviewWithdraw(w, r, false)
+}
+
+// rejectWithdraw rejects a withdraw by the authenticated approver
+func (s *Server) rejectWithdraw(w http.ResponseWriter, r *http.Request) {
+	s.reviewWithdraw(w, r, true)
+}
+
+func (s *Server) reviewWithdraw(w http.ResponseWriter, r *http.Request, reject bool) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, errors.New(http.StatusText(http.StatusMethodNotAllowed)))
+		return
+	}
+	var req ReviewWithdrawRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.ID <= 0 {
+		s.writeError(w, http.StatusBadRequest, errors.New("id is required"))
+		return
+	}
+
+	approver := approverFromContext(r.Context())
+	var withdraw *model.Withdraw
+	var err error
+	if reject {
+		withdraw, err = s.risk.Reject(req.ID, approver, req.Reason)
+	} else {
+		withdraw, err = s.risk.Approve(req.ID, approver)
+	}
+	if err != nil {
+		s.log.Warnw("http server review withdraw err", "approver", approver, "id", req.ID, "reject", reject, "error", err)
+		s.writeError(w, reviewErrorStatus(err), err)
+		return
+	}
+	s.writeData(w, ReviewWithdrawResponse{ID: req.ID, RiskStatus: withdraw.RiskStatus, Reviewer: approver})
+}
+
+func reviewErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, risk.ErrWithdrawNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, risk.ErrNotAwaitingApproval):
+		return http.StatusConflict
+	case errors.Is(err, risk.ErrReviewerRequired), errors.Is(err, risk.ErrReasonRequired):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/b2network/b2-indexer/internal/logic/indexer"
+	"github.com/b2network/b2-indexer/internal/model"
+)
+
+// SubmitWithdrawSignRequest carries the signatures of a signer for a withdraw tx,
+// either as a signed psbt or as signatures by tx input
+type SubmitWithdrawSignRequest struct {
+	BtcTxID string       `json:"btc_tx_id"`
+	Psbt    string       `json:"psbt"`
+	Signs   []model.Sign `json:"signs"`
+}
+
+// SubmitWithdrawSignResponse is the withdraw tx status after the submission
+type SubmitWithdrawSignResponse struct {
+	BtcTxID string `json:"btc_tx_id"`
+	Status  int    `json:"status"`
+}
+
+// pendingWithdrawTxs lists the withdraw psbts waiting for signatures
+func (s *Server) pendingWithdrawTxs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, errors.New(http.StatusText(http.StatusMethodNotAllowed)))
+		return
+	}
+	pendingList, err := s.signer.PendingWithdrawTxs()
+	if err != nil {
+		s.log.Errorw("http server get pending withdraw tx err", "error", err)
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.writeData(w, pendingList)
+}
+
+// submitWithdrawSign stores the signatures of the authenticated signer
+func (s *Server) submitWithdrawSign(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, errors.New(http.StatusText(http.StatusMethodNotAllowed)))
+		return
+	}
+	var req SubmitWithdrawSignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.BtcTxID == "" || (req.Psbt == "") == (len(req.Signs) == 0) {
+		s.writeError(w, http.StatusBadRequest, errors.New("btc_tx_id and one of psbt or signs are required"))
+		return
+	}
+
+	signer := signerFromContext(r.Context())
+	var withdrawTx *model.WithdrawTx
+	var err error
+	if req.Psbt != "" {
+		withdrawTx, err = s.signer.SubmitPsbt(signer, req.BtcTxID, req.Psbt)
+	} else {
+		withdrawTx, err = s.signer.SubmitSigns(signer, req.BtcTxID, req.Signs)
+	}
+	if err != nil {
+		s.log.Warnw("http server submit withdraw sign err", "signer", signer, "btcTxID", req.BtcTxID, "error", err)
+		s.writeError(w, submitErrorStatus(err), err)
+		return
+	}
+	s.writeData(w, SubmitWithdrawSignResponse{BtcTxID: withdrawTx.BtcTxID, Status: withdrawTx.Status})
+}
+
+func submitErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, indexer.ErrUnknownSigner):
+		return http.StatusForbidden
+	case errors.Is(err, indexer.ErrWithdrawTxNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, indexer.ErrWithdrawTxNotPending):
+		return http.StatusConflict
+	case errors.Is(err, indexer.ErrInvalidSign):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
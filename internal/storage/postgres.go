@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/b2network/b2-indexer/config"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// postgresDialect is the db of the replicas, rows are locked with select for update
+type postgresDialect struct{}
+
+func (postgresDialect) open(cfg *config.Config) (gorm.Dialector, error) {
+	return postgres.Open(cfg.DatabaseSource), nil
+}
+
+func (postgresDialect) pool(db *gorm.DB, cfg *config.Config) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	sqlDB.SetMaxIdleConns(cfg.DatabaseMaxIdleConns)
+	sqlDB.SetMaxOpenConns(cfg.DatabaseMaxOpenConns)
+	sqlDB.SetConnMaxLifetime(time.Duration(cfg.DatabaseConnMaxLifetime) * time.Second)
+	return nil
+}
+
+func (postgresDialect) lockForUpdate(tx *gorm.DB) *gorm.DB {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"})
+}
+
+func (postgresDialect) clock(d time.Duration) clause.Expr {
+	return gorm.Expr("now() + make_interval(secs => ?)", d.Seconds())
+}
+
+func (postgresDialect) after(column string, d time.Duration) clause.Expr {
+	return gorm.Expr(fmt.Sprintf("%s > now() + make_interval(secs => ?)", column), d.Seconds())
+}
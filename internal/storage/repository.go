@@ -0,0 +1,279 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Store is the db of the indexer, the repositories of a Transaction store run
+// within the transaction. The lookups return gorm.ErrRecordNotFound when no
+// row matches.
+type Store interface {
+	Deposits() DepositRepository
+	Withdraws() WithdrawRepository
+	Index() IndexRepository
+	Audits() AuditRepository
+	// Transaction commits the writes of fn, or rolls them back if it returns an error
+	Transaction(fn func(store Store) error) error
+}
+
+// DepositRepository stores the deposits of the abelian txs to the listen address
+type DepositRepository interface {
+	// ByOutput returns the deposit output of the abelian tx txHash
+	ByOutput(txHash string, output int64) (model.Deposit, error)
+	// LockByOutput returns the deposit output of the abelian tx txHash, locked until the
+	// end of the transaction
+	LockByOutput(txHash string, output int64) (model.Deposit, error)
+	// Create inserts deposit, IsDuplicateKey for a known tx output
+	Create(deposit *model.Deposit) error
+	// Upsert inserts deposit unless its tx output is known, a known deposit created by
+	// the callback and waiting for its listener gets the parsed fields of deposit, the
+	// others are kept. It reports whether a row was written.
+	Upsert(deposit *model.Deposit) (bool, error)
+	Update(id int64, fields map[string]interface{}) error
+}
+
+// WithdrawRepository stores the withdraws of the rollup and the abelian txs paying them
+type WithdrawRepository interface {
+	// LockByID returns the withdraw id, locked until the end of the transaction
+	LockByID(id int64) (model.Withdraw, error)
+	ByID(id int64) (model.Withdraw, error)
+	Update(id int64, fields map[string]interface{}) error
+	// LockTxByBtcTxID returns the withdraw tx of the abelian tx btcTxID, locked
+	// until the end of the transaction
+	LockTxByBtcTxID(btcTxID string) (model.WithdrawTx, error)
+	UpdateTx(id int64, fields map[string]interface{}) error
+	// SaveSign inserts the signatures of a signer or replaces its previous ones
+	SaveSign(sign *model.WithdrawSign) error
+}
+
+// IndexRepository stores the cursors of the abelian indexer and of the rollup listener
+type IndexRepository interface {
+	BtcIndex() (model.BtcIndex, error)
+	// LockBtcIndex returns the abelian cursor, locked until the end of the transaction
+	LockBtcIndex() (model.BtcIndex, error)
+	// SaveBtcIndex inserts or updates the abelian cursor
+	SaveBtcIndex(index *model.BtcIndex) error
+	RollupIndex() (model.RollupIndex, error)
+	// SaveRollupIndex inserts or updates the rollup cursor
+	SaveRollupIndex(index *model.RollupIndex) error
+	// Lease returns the leader_lease row name while a holder holds it by the db clock
+	Lease(name string) (model.LeaderLease, error)
+	// Heartbeats returns the leader_lease rows renewed by the running services, named
+	// prefix and their holder, the unexpired ones by the db clock if live
+	Heartbeats(prefix string, live bool) ([]model.LeaderLease, error)
+	// SaveHeartbeat inserts or renews the leader_lease row name of holder for ttl by the db clock
+	SaveHeartbeat(name string, holder string, ttl time.Duration) error
+	// DeleteHeartbeats deletes the rows named prefix expired for longer than retention
+	DeleteHeartbeats(prefix string, retention time.Duration) error
+}
+
+// AuditRepository stores the changes of the bridge state by the operators
+type AuditRepository interface {
+	Create(audit *model.AdminAudit) error
+}
+
+// New returns the store of db by the dialect it was opened with, postgres unless sqlite
+func New(db *gorm.DB) Store {
+	if db != nil && db.Dialector != nil && db.Dialector.Name() == config.DialectSqlite {
+		return NewSqlite(db)
+	}
+	return NewPostgres(db)
+}
+
+// NewPostgres returns the store of a postgres db
+func NewPostgres(db *gorm.DB) Store {
+	return &gormStore{db: db, dialect: postgresDialect{}}
+}
+
+// NewSqlite returns the store of a sqlite db
+func NewSqlite(db *gorm.DB) Store {
+	return &gormStore{db: db, dialect: sqliteDialect{}}
+}
+
+// gormStore implements the repositories on gorm, the dialect differences are in dialect
+type gormStore struct {
+	db      *gorm.DB
+	dialect dialect
+}
+
+func (s *gormStore) Deposits() DepositRepository   { return depositRepository{s} }
+func (s *gormStore) Withdraws() WithdrawRepository { return withdrawRepository{s} }
+func (s *gormStore) Index() IndexRepository        { return indexRepository{s} }
+func (s *gormStore) Audits() AuditRepository       { return auditRepository{s} }
+
+func (s *gormStore) Transaction(fn func(store Store) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&gormStore{db: tx, dialect: s.dialect})
+	})
+}
+
+type depositRepository struct{ *gormStore }
+
+func (r depositRepository) ByOutput(txHash string, output int64) (model.Deposit, error) {
+	var deposit model.Deposit
+	err := r.db.Where(fmt.Sprintf("%s = ?", model.Deposit{}.Column().BtcTxHash), txHash).
+		Where(fmt.Sprintf("%s = ?", model.Deposit{}.Column().BtcTxOutput), output).
+		First(&deposit).Error
+	return deposit, err
+}
+
+func (r depositRepository) LockByOutput(txHash string, output int64) (model.Deposit, error) {
+	var deposit model.Deposit
+	err := r.dialect.lockForUpdate(r.db).
+		Where(fmt.Sprintf("%s = ?", model.Deposit{}.Column().BtcTxHash), txHash).
+		Where(fmt.Sprintf("%s = ?", model.Deposit{}.Column().BtcTxOutput), output).
+		First(&deposit).Error
+	return deposit, err
+}
+
+func (r depositRepository) Create(deposit *model.Deposit) error {
+	return r.db.Create(deposit).Error
+}
+
+func (r depositRepository) Upsert(deposit *model.Deposit) (bool, error) {
+	columns := model.Deposit{}.Column()
+	existing := func(column string) clause.Column {
+		return clause.Column{Table: model.Deposit{}.TableName(), Name: column}
+	}
+	result := r.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: columns.BtcTxHash}, {Name: columns.BtcTxOutput}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			columns.BtcBlockNumber,
+			columns.BtcTxIndex,
+			columns.BtcFroms,
+			columns.BtcTos,
+			columns.BtcBlockTime,
+			columns.ListenerStatus,
+			"updated_at",
+		}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Eq{Column: existing(columns.ListenerStatus), Value: model.ListenerStatusPending},
+		}},
+	}).Create(deposit)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r depositRepository) Update(id int64, fields map[string]interface{}) error {
+	return r.db.Model(&model.Deposit{}).Where("id = ?", id).Updates(fields).Error
+}
+
+type withdrawRepository struct{ *gormStore }
+
+func (r withdrawRepository) LockByID(id int64) (model.Withdraw, error) {
+	var withdraw model.Withdraw
+	err := r.dialect.lockForUpdate(r.db).Where("id = ?", id).First(&withdraw).Error
+	return withdraw, err
+}
+
+func (r withdrawRepository) ByID(id int64) (model.Withdraw, error) {
+	var withdraw model.Withdraw
+	err := r.db.Where("id = ?", id).First(&withdraw).Error
+	return withdraw, err
+}
+
+func (r withdrawRepository) Update(id int64, fields map[string]interface{}) error {
+	return r.db.Model(&model.Withdraw{}).Where("id = ?", id).Updates(fields).Error
+}
+
+func (r withdrawRepository) LockTxByBtcTxID(btcTxID string) (model.WithdrawTx, error) {
+	var withdrawTx model.WithdrawTx
+	err := r.dialect.lockForUpdate(r.db).
+		Where(fmt.Sprintf("%s = ?", model.WithdrawTx{}.Column().BtcTxID), btcTxID).
+		First(&withdrawTx).Error
+	return withdrawTx, err
+}
+
+func (r withdrawRepository) UpdateTx(id int64, fields map[string]interface{}) error {
+	return r.db.Model(&model.WithdrawTx{}).Where("id = ?", id).Updates(fields).Error
+}
+
+func (r withdrawRepository) SaveSign(sign *model.WithdrawSign) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: model.WithdrawSign{}.Column().WithdrawTxID}, {Name: model.WithdrawSign{}.Column().Signer}},
+		DoUpdates: clause.AssignmentColumns([]string{model.WithdrawSign{}.Column().Signs, "updated_at"}),
+	}).Create(sign).Error
+}
+
+// the cursors are the row 1 of their table
+type indexRepository struct{ *gormStore }
+
+func (r indexRepository) BtcIndex() (model.BtcIndex, error) {
+	var index model.BtcIndex
+	err := r.db.First(&index, 1).Error
+	return index, err
+}
+
+func (r indexRepository) LockBtcIndex() (model.BtcIndex, error) {
+	var index model.BtcIndex
+	err := r.dialect.lockForUpdate(r.db).First(&index, 1).Error
+	return index, err
+}
+
+func (r indexRepository) SaveBtcIndex(index *model.BtcIndex) error {
+	return r.db.Save(index).Error
+}
+
+func (r indexRepository) RollupIndex() (model.RollupIndex, error) {
+	var index model.RollupIndex
+	err := r.db.First(&index, 1).Error
+	return index, err
+}
+
+func (r indexRepository) SaveRollupIndex(index *model.RollupIndex) error {
+	return r.db.Save(index).Error
+}
+
+func (r indexRepository) Lease(name string) (model.LeaderLease, error) {
+	columns := model.LeaderLease{}.Column()
+	var lease model.LeaderLease
+	err := r.db.
+		Where(fmt.Sprintf("%s = ? AND %s <> ''", columns.Name, columns.Holder), name).
+		Where(r.dialect.after(columns.ExpiresAt, 0)).
+		First(&lease).Error
+	return lease, err
+}
+
+func (r indexRepository) Heartbeats(prefix string, live bool) ([]model.LeaderLease, error) {
+	query := r.db.Where(fmt.Sprintf("%s LIKE ?", model.LeaderLease{}.Column().Name), prefix+"%")
+	if live {
+		query = query.Where(r.dialect.after(model.LeaderLease{}.Column().ExpiresAt, 0))
+	}
+	var leases []model.LeaderLease
+	err := query.Order("updated_at DESC").Find(&leases).Error
+	return leases, err
+}
+
+func (r indexRepository) SaveHeartbeat(name string, holder string, ttl time.Duration) error {
+	columns := model.LeaderLease{}.Column()
+	return r.db.Model(&model.LeaderLease{}).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: columns.Name}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			columns.Holder, columns.ExpiresAt, "updated_at",
+		}),
+	}).Create(map[string]interface{}{
+		columns.Name:      name,
+		columns.Holder:    holder,
+		columns.ExpiresAt: r.dialect.clock(ttl),
+		"created_at":      r.dialect.clock(0),
+		"updated_at":      r.dialect.clock(0),
+	}).Error
+}
+
+func (r indexRepository) DeleteHeartbeats(prefix string, retention time.Duration) error {
+	return r.db.Unscoped().
+		Where(fmt.Sprintf("%s LIKE ?", model.LeaderLease{}.Column().Name), prefix+"%").
+		Not(r.dialect.after(model.LeaderLease{}.Column().ExpiresAt, -retention)).
+		Delete(&model.LeaderLease{}).Error
+}
+
+type auditRepository struct{ *gormStore }
+
+func (r auditRepository) Create(audit *model.AdminAudit) error {
+	return r.db.Create(audit).Error
+}
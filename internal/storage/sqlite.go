@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// sqlitePragmas wait for the lock of another process instead of failing and let
+// the readers run along the writer
+const sqlitePragmas = "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)"
+
+// sqliteDialect is the db file of a single process, for local development and tests
+type sqliteDialect struct{}
+
+func (sqliteDialect) open(cfg *config.Config) (gorm.Dialector, error) {
+	file := cfg.SqlitePath()
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return nil, err
+	}
+	return sqlite.Open(file + sqlitePragmas), nil
+}
+
+// pool keeps a single connection, sqlite has one writer at a time and the
+// transactions queue for the connection instead of failing as busy
+func (sqliteDialect) pool(db *gorm.DB, _ *config.Config) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	sqlDB.SetMaxOpenConns(1)
+	return nil
+}
+
+// lockForUpdate leaves tx as is, the transaction holds the only connection
+func (sqliteDialect) lockForUpdate(tx *gorm.DB) *gorm.DB {
+	return tx
+}
+
+// clock is utc in the format of the outbox triggers
+func (sqliteDialect) clock(d time.Duration) clause.Expr {
+	return gorm.Expr("strftime('%Y-%m-%d %H:%M:%f', 'now', ?)", sqliteModifier(d))
+}
+
+// after compares julian days, the time columns written by gorm hold their time zone
+func (sqliteDialect) after(column string, d time.Duration) clause.Expr {
+	return gorm.Expr(fmt.Sprintf("julianday(%s) > julianday('now', ?)", column), sqliteModifier(d))
+}
+
+func sqliteModifier(d time.Duration) string {
+	return fmt.Sprintf("%+.3f seconds", d.Seconds())
+}
@@ -0,0 +1,100 @@
+// Package storage opens the db of database-source and stores the deposit, withdraw,
+// index and admin audit tables through repositories of the postgres and sqlite dialects.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/pkg/log"
+	sqlite "github.com/glebarez/go-sqlite"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	gormlog "gorm.io/gorm/logger"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// a failed connection is retried, the db server may still be starting
+const (
+	connectAttempts = 5
+	connectBackoff  = 2 * time.Second
+)
+
+// dialect is what the repositories of a db server differ in
+type dialect interface {
+	// open returns the gorm dialector of the source of cfg
+	open(cfg *config.Config) (gorm.Dialector, error)
+	// pool sets the connection limits of the db
+	pool(db *gorm.DB, cfg *config.Config) error
+	// lockForUpdate locks the rows read by tx until the end of the transaction
+	lockForUpdate(tx *gorm.DB) *gorm.DB
+	// clock returns the time d after the db clock, the hosts of the services may be off
+	clock(d time.Duration) clause.Expr
+	// after returns the condition of the time column being after the db clock plus d
+	after(column string, d time.Duration) clause.Expr
+}
+
+func dialectOf(name string) (dialect, error) {
+	switch name {
+	case config.DialectPostgres:
+		return postgresDialect{}, nil
+	case config.DialectSqlite:
+		return sqliteDialect{}, nil
+	}
+	return nil, fmt.Errorf("unsupported db dialect %q", name)
+}
+
+// Open connects to the db of database-source, the failed attempts are retried
+// with a growing backoff
+func Open(cfg *config.Config) (*gorm.DB, error) {
+	d, err := dialectOf(cfg.DatabaseDialect())
+	if err != nil {
+		return nil, err
+	}
+	dialector, err := d.open(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var db *gorm.DB
+	for attempt := 1; ; attempt++ {
+		db, err = gorm.Open(dialector, &gorm.Config{
+			Logger: gormlog.Default.LogMode(gormlog.Info),
+			// duplicate keys are gorm.ErrDuplicatedKey on every dialect
+			TranslateError: true,
+		})
+		if err == nil || attempt == connectAttempts {
+			break
+		}
+		log.Warnw("failed to connect db, retrying", "dialect", cfg.DatabaseDialect(), "attempt", attempt, "error", err)
+		time.Sleep(time.Duration(attempt) * connectBackoff)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = d.pool(db, cfg); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// IsDuplicateKey reports whether err is a unique constraint violation, whether
+// the db translates the errors of its driver or not
+func IsDuplicateKey(err error) bool {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// 23505 duplicate key value violates unique constraint
+		return pgErr.Code == "23505"
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE ||
+			sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package storage_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/b2network/b2-indexer/internal/migration"
+	"github.com/b2network/b2-indexer/internal/model"
+	"github.com/b2network/b2-indexer/internal/storage"
+	"github.com/b2network/b2-indexer/pkg/log"
+	"github.com/glebarez/sqlite"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func openSqlite(t *testing.T) *gorm.DB {
+	db, err := storage.Open(&config.Config{
+		DatabaseSource: "sqlite://" + filepath.Join(t.TempDir(), "data", "indexer.db"),
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	migrator, err := migration.New(db, log.NewNopLogger())
+	require.NoError(t, err)
+	_, err = migrator.Up(0)
+	require.NoError(t, err)
+	return db
+}
+
+func TestIsDuplicateKey(t *testing.T) {
+	require.True(t, storage.IsDuplicateKey(gorm.ErrDuplicatedKey))
+	require.True(t, storage.IsDuplicateKey(&pgconn.PgError{Code: "23505"}))
+	require.False(t, storage.IsDuplicateKey(&pgconn.PgError{Code: "23503"}))
+	require.False(t, storage.IsDuplicateKey(errors.New("23505")))
+	require.False(t, storage.IsDuplicateKey(nil))
+
+	// sqlite driver errors, translated by storage.Open or not
+	store := storage.New(openSqlite(t))
+	require.NoError(t, store.Deposits().Create(&model.Deposit{BtcTxHash: "tx"}))
+	err := store.Deposits().Create(&model.Deposit{BtcTxHash: "tx"})
+	require.ErrorIs(t, err, gorm.ErrDuplicatedKey)
+
+	raw, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "raw.db")), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, raw.AutoMigrate(&model.Deposit{}))
+	require.NoError(t, raw.Create(&model.Deposit{BtcTxHash: "tx"}).Error)
+	err = raw.Create(&model.Deposit{BtcTxHash: "tx"}).Error
+	require.NotErrorIs(t, err, gorm.ErrDuplicatedKey)
+	require.True(t, storage.IsDuplicateKey(err))
+}
+
+func TestSqliteStore(t *testing.T) {
+	db := openSqlite(t)
+	store := storage.New(db)
+
+	_, err := store.Index().BtcIndex()
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	index := model.BtcIndex{Base: model.Base{ID: 1}, BtcIndexBlock: 10}
+	require.NoError(t, store.Index().SaveBtcIndex(&index))
+	index.BtcIndexBlock = 11
+	require.NoError(t, store.Index().SaveBtcIndex(&index))
+	index, err = store.Index().BtcIndex()
+	require.NoError(t, err)
+	require.Equal(t, int64(11), index.BtcIndexBlock)
+
+	// the writes of a failed transaction are rolled back
+	errRollback := errors.New("rollback")
+	err = store.Transaction(func(store storage.Store) error {
+		deposit := model.Deposit{BtcTxHash: "tx", BtcFroms: `["from"]`, BtcTos: `["to"]`}
+		if err := store.Deposits().Create(&deposit); err != nil {
+			return err
+		}
+		index.BtcIndexBlock = 12
+		if err := store.Index().SaveBtcIndex(&index); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+	_, err = store.Deposits().ByOutput("tx", 0)
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	index, err = store.Index().BtcIndex()
+	require.NoError(t, err)
+	require.Equal(t, int64(11), index.BtcIndexBlock)
+
+	require.NoError(t, db.Create(&model.Withdraw{BtcTo: "to", BtcValue: 1}).Error)
+	var withdraw model.Withdraw
+	err = store.Transaction(func(store storage.Store) error {
+		locked, err := store.Withdraws().LockByID(1)
+		if err != nil {
+			return err
+		}
+		if err = store.Withdraws().Update(locked.ID, map[string]interface{}{model.Withdraw{}.Column().BtcValue: 2}); err != nil {
+			return err
+		}
+		withdraw, err = store.Withdraws().ByID(locked.ID)
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), withdraw.BtcValue)
+
+	// an audit is written with the change it records
+	err = store.Transaction(func(store storage.Store) error {
+		locked, err := store.Index().LockBtcIndex()
+		if err != nil {
+			return err
+		}
+		locked.BtcIndexBlock = 5
+		if err = store.Index().SaveBtcIndex(&locked); err != nil {
+			return err
+		}
+		return store.Audits().Create(&model.AdminAudit{Operator: "ops", Action: model.AdminActionIndexSetCursor, Target: "btc_index:1"})
+	})
+	require.NoError(t, err)
+	var audit model.AdminAudit
+	require.NoError(t, db.First(&audit).Error)
+	require.Equal(t, "btc_index:1", audit.Target)
+}
+
+func TestDepositUpsert(t *testing.T) {
+	store := storage.New(openSqlite(t))
+	deposits := store.Deposits()
+
+	// the outputs of a tx are distinct deposits
+	for output := int64(0); output < 2; output++ {
+		saved, err := deposits.Upsert(&model.Deposit{BtcTxHash: "tx", BtcTxOutput: output, BtcValue: 10 + output})
+		require.NoError(t, err)
+		require.True(t, saved)
+	}
+	require.ErrorIs(t, deposits.Create(&model.Deposit{BtcTxHash: "tx", BtcTxOutput: 1}), gorm.ErrDuplicatedKey)
+
+	// a known output is kept
+	saved, err := deposits.Upsert(&model.Deposit{BtcTxHash: "tx", BtcTxOutput: 1, BtcBlockNumber: 7})
+	require.NoError(t, err)
+	require.False(t, saved)
+	deposit, err := deposits.ByOutput("tx", 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(11), deposit.BtcValue)
+	require.Equal(t, int64(0), deposit.BtcBlockNumber)
+
+	// a deposit of the callback gets the parsed fields once
+	require.NoError(t, deposits.Create(&model.Deposit{
+		BtcTxHash:      "callback",
+		BtcValue:       5,
+		CallbackStatus: model.CallbackStatusSuccess,
+		ListenerStatus: model.ListenerStatusPending,
+	}))
+	parsed := model.Deposit{
+		BtcTxHash:      "callback",
+		BtcBlockNumber: 8,
+		BtcTxIndex:     2,
+		BtcValue:       6,
+		BtcTos:         `["to"]`,
+		ListenerStatus: model.ListenerStatusSuccess,
+	}
+	saved, err = deposits.Upsert(&parsed)
+	require.NoError(t, err)
+	require.True(t, saved)
+	deposit, err = deposits.ByOutput("callback", 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(8), deposit.BtcBlockNumber)
+	require.Equal(t, int64(2), deposit.BtcTxIndex)
+	require.Equal(t, model.JSON(`["to"]`), deposit.BtcTos)
+	require.Equal(t, model.ListenerStatusSuccess, deposit.ListenerStatus)
+	require.Equal(t, int64(5), deposit.BtcValue)
+
+	parsed.BtcBlockNumber = 9
+	saved, err = deposits.Upsert(&parsed)
+	require.NoError(t, err)
+	require.False(t, saved)
+}
@@ -0,0 +1,90 @@
+package supervisor
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Loops runs the loops of a service until it stops. A loop returning an error
+// or panicking crashes the service, the supervisor then restarts it.
+type Loops struct {
+	quit      chan struct{}
+	quitOnce  sync.Once
+	crashed   chan struct{}
+	crashOnce sync.Once
+	err       error
+	wg        sync.WaitGroup
+}
+
+// NewLoops returns loops ready to run
+func NewLoops() *Loops {
+	return &Loops{
+		quit:    make(chan struct{}),
+		crashed: make(chan struct{}),
+	}
+}
+
+// Go runs fn in a goroutine, fn returns when Quit is closed
+func (l *Loops) Go(fn func() error) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				l.crash(fmt.Errorf("panic: %v\n%s", r, debug.Stack()))
+			}
+		}()
+		if err := fn(); err != nil {
+			l.crash(err)
+		}
+	}()
+}
+
+func (l *Loops) crash(err error) {
+	l.crashOnce.Do(func() {
+		l.err = err
+		close(l.crashed)
+	})
+}
+
+// Quit is closed when the loops must return
+func (l *Loops) Quit() <-chan struct{} {
+	return l.quit
+}
+
+// Sleep waits for d, it returns false if the loops must return
+func (l *Loops) Sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-l.quit:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// Stop closes Quit and waits for the loops to finish their current work
+func (l *Loops) Stop() {
+	l.quitOnce.Do(func() {
+		close(l.quit)
+	})
+	l.wg.Wait()
+}
+
+// Crashed is closed when a loop crashed
+func (l *Loops) Crashed() <-chan struct{} {
+	return l.crashed
+}
+
+// Err returns the cause of the crash
+func (l *Loops) Err() error {
+	select {
+	case <-l.crashed:
+		return l.err
+	default:
+		return nil
+	}
+}
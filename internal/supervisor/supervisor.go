@@ -0,0 +1,179 @@
+package supervisor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/b2network/b2-indexer/internal/metrics"
+	"github.com/b2network/b2-indexer/pkg/log"
+	"github.com/cometbft/cometbft/libs/service"
+)
+
+const (
+	SupervisorName = "Supervisor"
+
+	DefaultMinBackoff      = 5 * time.Second
+	DefaultMaxBackoff      = 5 * time.Minute
+	DefaultShutdownTimeout = 2 * time.Minute
+)
+
+// Service is a service run by the supervisor, its loops report crashes
+type Service interface {
+	service.Service
+	// Crashed is closed when the service crashed, Err returns the cause
+	Crashed() <-chan struct{}
+	Err() error
+}
+
+// Factory creates a service instance, a crashed service is replaced by a new instance
+type Factory func() (Service, error)
+
+// Entry is a supervised service, it reports the state of the current instance
+type Entry struct {
+	name    string
+	factory Factory
+
+	mu      sync.RWMutex
+	current Service
+}
+
+// String implements health.Service
+func (e *Entry) String() string {
+	return e.name
+}
+
+// IsRunning implements health.Service
+func (e *Entry) IsRunning() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.current != nil && e.current.IsRunning()
+}
+
+func (e *Entry) set(svc Service) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.current = svc
+}
+
+// Supervisor starts services, restarts crashed services with backoff and stops them on shutdown
+type Supervisor struct {
+	service.BaseService
+
+	MinBackoff      time.Duration
+	MaxBackoff      time.Duration
+	ShutdownTimeout time.Duration
+
+	entries []*Entry
+	quit    chan struct{}
+	wg      sync.WaitGroup
+	log     log.Logger
+}
+
+// New returns a new supervisor instance.
+func New(log log.Logger) *Supervisor {
+	s := &Supervisor{
+		MinBackoff:      DefaultMinBackoff,
+		MaxBackoff:      DefaultMaxBackoff,
+		ShutdownTimeout: DefaultShutdownTimeout,
+		log:             log,
+	}
+	s.BaseService = *service.NewBaseService(nil, SupervisorName, s)
+	return s
+}
+
+// Add supervises the service created by factory, it must be called before Start
+func (s *Supervisor) Add(name string, factory Factory) *Entry {
+	entry := &Entry{name: name, factory: factory}
+	s.entries = append(s.entries, entry)
+	return entry
+}
+
+// OnStart implements service.Service by running the services
+func (s *Supervisor) OnStart() error {
+	s.quit = make(chan struct{})
+	for _, entry := range s.entries {
+		s.wg.Add(1)
+		go s.run(entry)
+	}
+	return nil
+}
+
+// OnStop implements service.Service by stopping the services,
+// it waits up to ShutdownTimeout for them to finish their current work
+func (s *Supervisor) OnStop() {
+	close(s.quit)
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		s.log.Infow("supervisor all services stopped")
+	case <-time.After(s.ShutdownTimeout):
+		s.log.Errorw("supervisor shutdown timeout, services still running", "timeout", s.ShutdownTimeout)
+	}
+}
+
+// OnReset implements service.Service, a supervisor stopped when its replica
+// lost the leader lease starts again on the next election
+func (s *Supervisor) OnReset() error {
+	return nil
+}
+
+// run starts the service of entry and restarts it until the supervisor stops
+func (s *Supervisor) run(entry *Entry) {
+	defer s.wg.Done()
+	backoff := s.MinBackoff
+	for {
+		startedAt := time.Now()
+		err := s.runOnce(entry)
+		if err == nil {
+			return
+		}
+		metrics.ServiceRestarts.WithLabelValues(entry.name).Inc()
+		// a service that ran for a while restarts fast again
+		if time.Since(startedAt) > s.MaxBackoff {
+			backoff = s.MinBackoff
+		}
+		s.log.Errorw("supervisor service crashed, restarting", "service", entry.name, "error", err, "backoff", backoff)
+		select {
+		case <-s.quit:
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > s.MaxBackoff {
+			backoff = s.MaxBackoff
+		}
+	}
+}
+
+// runOnce runs an instance of the service of entry, it returns nil when the supervisor stopped it
+func (s *Supervisor) runOnce(entry *Entry) error {
+	svc, err := entry.factory()
+	if err != nil {
+		return err
+	}
+	if err = svc.Start(); err != nil {
+		return err
+	}
+	entry.set(svc)
+	defer entry.set(nil)
+	s.log.Infow("supervisor service started", "service", entry.name)
+
+	select {
+	case <-s.quit:
+		if err := svc.Stop(); err != nil {
+			s.log.Errorw("supervisor stop service err", "service", entry.name, "error", err)
+		}
+		s.log.Infow("supervisor service stopped", "service", entry.name)
+		return nil
+	case <-svc.Crashed():
+		// stop the other loops of the crashed instance before replacing it
+		if err := svc.Stop(); err != nil {
+			s.log.Errorw("supervisor stop crashed service err", "service", entry.name, "error", err)
+		}
+		return svc.Err()
+	}
+}
@@ -0,0 +1,133 @@
+package supervisor
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/b2network/b2-indexer/pkg/log"
+	"github.com/cometbft/cometbft/libs/service"
+	"github.com/stretchr/testify/require"
+)
+
+type testService struct {
+	service.BaseService
+	loops *Loops
+	run   func(loops *Loops) error
+}
+
+func newTestService(run func(loops *Loops) error) *testService {
+	s := &testService{run: run}
+	s.BaseService = *service.NewBaseService(nil, "TestService", s)
+	return s
+}
+
+func (s *testService) OnStart() error {
+	s.loops = NewLoops()
+	s.loops.Go(func() error {
+		return s.run(s.loops)
+	})
+	return nil
+}
+
+func (s *testService) OnStop() {
+	s.loops.Stop()
+}
+
+func (s *testService) Crashed() <-chan struct{} {
+	return s.loops.Crashed()
+}
+
+func (s *testService) Err() error {
+	return s.loops.Err()
+}
+
+func newTestSupervisor() *Supervisor {
+	s := New(log.NewNopLogger())
+	s.MinBackoff = time.Millisecond
+	s.MaxBackoff = 10 * time.Millisecond
+	s.ShutdownTimeout = time.Second
+	return s
+}
+
+func TestLoopsStopWaitsForWork(t *testing.T) {
+	loops := NewLoops()
+	var finished atomic.Bool
+	loops.Go(func() error {
+		<-loops.Quit()
+		// in-flight work finishes after quit
+		time.Sleep(20 * time.Millisecond)
+		finished.Store(true)
+		return nil
+	})
+	loops.Stop()
+	require.True(t, finished.Load())
+	require.NoError(t, loops.Err())
+	require.False(t, loops.Sleep(time.Hour))
+}
+
+func TestLoopsCrash(t *testing.T) {
+	loops := NewLoops()
+	loops.Go(func() error {
+		panic("boom")
+	})
+	<-loops.Crashed()
+	require.ErrorContains(t, loops.Err(), "boom")
+	loops.Stop()
+}
+
+func TestSupervisorRestartsCrashedService(t *testing.T) {
+	sup := newTestSupervisor()
+	var starts atomic.Int32
+	entry := sup.Add("test", func() (Service, error) {
+		n := starts.Add(1)
+		return newTestService(func(loops *Loops) error {
+			if n < 3 {
+				return errors.New("crash")
+			}
+			<-loops.Quit()
+			return nil
+		}), nil
+	})
+	require.NoError(t, sup.Start())
+	require.Eventually(t, entry.IsRunning, time.Second, time.Millisecond)
+	require.Equal(t, int32(3), starts.Load())
+
+	require.NoError(t, sup.Stop())
+	require.False(t, entry.IsRunning())
+}
+
+func TestSupervisorRetriesFactory(t *testing.T) {
+	sup := newTestSupervisor()
+	var attempts atomic.Int32
+	entry := sup.Add("test", func() (Service, error) {
+		if attempts.Add(1) < 3 {
+			return nil, errors.New("node unreachable")
+		}
+		return newTestService(func(loops *Loops) error {
+			<-loops.Quit()
+			return nil
+		}), nil
+	})
+	require.NoError(t, sup.Start())
+	require.Eventually(t, entry.IsRunning, time.Second, time.Millisecond)
+	require.NoError(t, sup.Stop())
+}
+
+func TestSupervisorStopWaitsForServices(t *testing.T) {
+	sup := newTestSupervisor()
+	var finished atomic.Bool
+	entry := sup.Add("test", func() (Service, error) {
+		return newTestService(func(loops *Loops) error {
+			<-loops.Quit()
+			time.Sleep(20 * time.Millisecond)
+			finished.Store(true)
+			return nil
+		}), nil
+	})
+	require.NoError(t, sup.Start())
+	require.Eventually(t, entry.IsRunning, time.Second, time.Millisecond)
+	require.NoError(t, sup.Stop())
+	require.True(t, finished.Load())
+}
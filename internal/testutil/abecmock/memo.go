@@ -0,0 +1,31 @@
+package abecmock
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// memoPrefixLen is the length of the abec memo header before the json
+const memoPrefixLen = 8
+
+// Memo returns the hex abec memo of a json payload
+func Memo(payload []byte) string {
+	return hex.EncodeToString(append(make([]byte, memoPrefixLen), payload...))
+}
+
+// DepositMemo returns the hex memo of a bridge deposit of value to the listen address to
+func DepositMemo(from, to, receipt string, value int64) string {
+	payload, err := json.Marshal(map[string]string{
+		"action":   "deposit",
+		"protocol": "Mable",
+		"from":     from,
+		"to":       to,
+		"receipt":  receipt,
+		"value":    fmt.Sprintf("0x%x", value),
+	})
+	if err != nil {
+		panic(err)
+	}
+	return Memo(payload)
+}
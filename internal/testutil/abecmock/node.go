@@ -0,0 +1,369 @@
+// Package abecmock is an in-process abec json-rpc node for tests. It serves
+// getblockcount, getblockhash, getblockabe, getrawtransaction and getinfo from
+// scripted blocks, getbalancesabe of a set wallet balance, and supports reorgs and
+// error injection.
+package abecmock
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// abec json-rpc error codes
+const (
+	ErrCodeMisc       = -1
+	ErrCodeInvalidReq = -32600
+	ErrCodeNoMethod   = -32601
+	ErrCodeParams     = -32602
+	ErrCodeNotFound   = -5
+	ErrCodeOutOfRange = -8
+)
+
+// Error is a json-rpc error of the node
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d: %s", e.Code, e.Message)
+}
+
+// Tx is a scripted transaction, the block fields are filled by the node
+type Tx struct {
+	TxID string
+	// Memo is the hex memo, see DepositMemo
+	Memo string
+	Fee  float64
+}
+
+// Block is a block of the node
+type Block struct {
+	Height   int64
+	Hash     string
+	PrevHash string
+	Time     int64
+	Txs      []Tx
+}
+
+// Node is a fake abec node, the zero height block is the genesis block
+type Node struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	netID    int64
+	user     string
+	pass     string
+	blocks   []*Block
+	balance  string
+	fork     int
+	failures map[string][]failure
+	calls    map[string]int
+}
+
+type failure struct {
+	status int
+	err    *Error
+}
+
+// New starts a node with a genesis block, it is closed at the end of the test
+func New(t testing.TB) *Node {
+	n := &Node{
+		netID:    1,
+		balance:  "0",
+		failures: make(map[string][]failure),
+		calls:    make(map[string]int),
+	}
+	n.AddBlock()
+	n.server = httptest.NewServer(http.HandlerFunc(n.serveHTTP))
+	t.Cleanup(n.server.Close)
+	return n
+}
+
+// URL returns the rpc url of the node, a rpc-host with scheme used without rpc-port
+func (n *Node) URL() string {
+	return n.server.URL
+}
+
+// SetAuth requires the basic auth of user and pass
+func (n *Node) SetAuth(user, pass string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.user, n.pass = user, pass
+}
+
+// SetBalance sets the wallet balance in ABE answered by getbalancesabe, a json number
+func (n *Node) SetBalance(balance string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.balance = balance
+}
+
+// AddBlock appends a block of txs to the chain and returns it
+func (n *Node) AddBlock(txs ...Tx) Block {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	height := int64(len(n.blocks))
+	block := &Block{
+		Height: height,
+		Time:   1700000000 + height*256,
+		Txs:    txs,
+	}
+	if height > 0 {
+		block.PrevHash = n.blocks[height-1].Hash
+	}
+	block.Hash = n.blockHash(block)
+	n.blocks = append(n.blocks, block)
+	return *block
+}
+
+// AddBlocks appends count empty blocks
+func (n *Node) AddBlocks(count int) {
+	for i := 0; i < count; i++ {
+		n.AddBlock()
+	}
+}
+
+// Reorg drops the blocks from height on, the blocks added after get hashes
+// different from the dropped ones
+func (n *Node) Reorg(height int64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if height < 1 || height >= int64(len(n.blocks)) {
+		panic(fmt.Sprintf("abecmock: reorg height %d out of 1..%d", height, len(n.blocks)-1))
+	}
+	n.blocks = n.blocks[:height]
+	n.fork++
+}
+
+// Block returns the block at height of the current chain
+func (n *Node) Block(height int64) Block {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return *n.blocks[height]
+}
+
+// Height returns the tip height
+func (n *Node) Height() int64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return int64(len(n.blocks)) - 1
+}
+
+// Fail makes the next times calls of method return err, "" fails every method
+func (n *Node) Fail(method string, times int, err *Error) {
+	n.inject(method, times, failure{err: err})
+}
+
+// FailHTTP makes the next times calls of method answer the http status without a body
+func (n *Node) FailHTTP(method string, times int, status int) {
+	n.inject(method, times, failure{status: status})
+}
+
+func (n *Node) inject(method string, times int, f failure) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for i := 0; i < times; i++ {
+		n.failures[method] = append(n.failures[method], f)
+	}
+}
+
+// Calls returns the number of calls of method, failed ones included
+func (n *Node) Calls(method string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.calls[method]
+}
+
+// blockHash is unique per height, parent, txs and fork
+func (n *Node) blockHash(block *Block) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d/%s/%d", block.Height, block.PrevHash, n.fork)
+	for _, tx := range block.Txs {
+		fmt.Fprintf(h, "/%s", tx.TxID)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type request struct {
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+	ID     interface{}       `json:"id"`
+}
+
+type response struct {
+	Result interface{} `json:"result"`
+	Error  *Error      `json:"error"`
+	ID     interface{} `json:"id"`
+}
+
+func (n *Node) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	n.mu.Lock()
+	user, pass := n.user, n.pass
+	n.mu.Unlock()
+	if user != "" || pass != "" {
+		if u, p, ok := r.BasicAuth(); !ok || u != user || p != pass {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeJSON(w, response{Error: &Error{Code: ErrCodeInvalidReq, Message: err.Error()}})
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.calls[req.Method]++
+	if f, ok := n.nextFailure(req.Method); ok {
+		if f.status != 0 {
+			w.WriteHeader(f.status)
+			return
+		}
+		writeJSON(w, response{Error: f.err, ID: req.ID})
+		return
+	}
+	result, rpcErr := n.call(req.Method, req.Params)
+	writeJSON(w, response{Result: result, Error: rpcErr, ID: req.ID})
+}
+
+func (n *Node) nextFailure(method string) (failure, bool) {
+	for _, key := range []string{method, ""} {
+		if queue := n.failures[key]; len(queue) > 0 {
+			n.failures[key] = queue[1:]
+			return queue[0], true
+		}
+	}
+	return failure{}, false
+}
+
+func writeJSON(w http.ResponseWriter, resp response) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (n *Node) call(method string, params []json.RawMessage) (interface{}, *Error) {
+	tip := n.blocks[len(n.blocks)-1]
+	switch method {
+	case "getblockcount":
+		return tip.Height, nil
+	case "getinfo":
+		return map[string]interface{}{
+			"protocolversion": 70002,
+			"nodetype":        "FullNode",
+			"blocks":          tip.Height,
+			"version":         120500,
+			"bestblockhash":   tip.Hash,
+			"testnet":         true,
+			"netid":           n.netID,
+			"errors":          "",
+		}, nil
+	case "getbalancesabe":
+		return json.RawMessage("[" + n.balance + "]"), nil
+	case "getblockhash":
+		var height int64
+		if err := param(params, 0, &height); err != nil {
+			return nil, err
+		}
+		if height < 0 || height > tip.Height {
+			return nil, &Error{Code: ErrCodeOutOfRange, Message: "Block number out of range"}
+		}
+		return n.blocks[height].Hash, nil
+	case "getblockabe":
+		var hash string
+		if err := param(params, 0, &hash); err != nil {
+			return nil, err
+		}
+		for _, block := range n.blocks {
+			if block.Hash == hash {
+				return n.blockJSON(block), nil
+			}
+		}
+		return nil, &Error{Code: ErrCodeNotFound, Message: "Block not found"}
+	case "getrawtransaction":
+		var txID string
+		if err := param(params, 0, &txID); err != nil {
+			return nil, err
+		}
+		for _, block := range n.blocks {
+			for _, tx := range block.Txs {
+				if tx.TxID == txID {
+					return n.txJSON(block, tx), nil
+				}
+			}
+		}
+		return nil, &Error{Code: ErrCodeNotFound, Message: "No information available about transaction"}
+	}
+	return nil, &Error{Code: ErrCodeNoMethod, Message: "Method not found"}
+}
+
+func param(params []json.RawMessage, i int, v interface{}) *Error {
+	if i >= len(params) {
+		return &Error{Code: ErrCodeParams, Message: fmt.Sprintf("missing param %d", i)}
+	}
+	if err := json.Unmarshal(params[i], v); err != nil {
+		return &Error{Code: ErrCodeParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func (n *Node) confirmations(block *Block) int64 {
+	return int64(len(n.blocks)) - block.Height
+}
+
+func (n *Node) blockJSON(block *Block) map[string]interface{} {
+	txIDs := make([]string, 0, len(block.Txs))
+	rawTxs := make([]map[string]interface{}, 0, len(block.Txs))
+	for _, tx := range block.Txs {
+		txIDs = append(txIDs, tx.TxID)
+		rawTxs = append(rawTxs, n.txJSON(block, tx))
+	}
+	out := map[string]interface{}{
+		"height":            block.Height,
+		"confirmations":     n.confirmations(block),
+		"version":           1,
+		"time":              block.Time,
+		"hash":              block.Hash,
+		"previousblockhash": block.PrevHash,
+		"tx":                txIDs,
+		"rawTx":             rawTxs,
+	}
+	if block.Height+1 < int64(len(n.blocks)) {
+		out["nextblockhash"] = n.blocks[block.Height+1].Hash
+	}
+	return out
+}
+
+func (n *Node) txJSON(block *Block, tx Tx) map[string]interface{} {
+	return map[string]interface{}{
+		"txid":          tx.TxID,
+		"hash":          tx.TxID,
+		"time":          block.Time,
+		"blockhash":     block.Hash,
+		"blocktime":     block.Time,
+		"confirmations": n.confirmations(block),
+		"version":       1,
+		"fee":           tx.Fee,
+		"memo":          tx.Memo,
+		"vin":           []interface{}{},
+		"vout":          []interface{}{},
+	}
+}
@@ -0,0 +1,447 @@
+// Package evmsim is an in-process rollup for tests: a go-ethereum blockchain and
+// tx pool with a funded bridge key and a deployed wABEL contract, serving the
+// rpc calls of the bridge and the rollup listener. Blocks are mined by Commit or
+// AutoCommit.
+//
+// The contract is a hand written stand-in, not the compiled wABEL contract, whose
+// artifact is not in this repository. It only covers the mintWAbel call and the
+// MintWAbel event: a mint pays native value instead of minting the token, there are
+// no minter and burner roles, no burnWAbel and BurnWAbel event, no lock day and
+// staking rules and no InsufficientBalance custom error. Tests against it check the
+// bridge and listener handling of the mint tx, not the wABEL mint and burn semantics.
+package evmsim
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/b2network/b2-indexer/config"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/txpool"
+	"github.com/ethereum/go-ethereum/core/txpool/legacypool"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/gasestimator"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// wAbelBytecode is a stand-in of the wABEL contract of config.DefaultDepositAbi:
+// mintWAbel(to, amount, lockDay) sends amount wei of the contract balance to to and
+// emits MintWAbel(to, amount, lockDay), it reverts with "insufficient balance" above
+// the balance, other calls revert. The constructor arguments are ignored, the deploy
+// value funds the mints.
+//
+//	00 PUSH1 0x00 CALLDATALOAD PUSH1 0xe0 SHR PUSH4 0xb9ffbe67 EQ PUSH1 mint JUMPI
+//	0f PUSH1 0x00 DUP1 REVERT
+//	13 mint: JUMPDEST PUSH1 0x24 CALLDATALOAD DUP1 SELFBALANCE LT PUSH1 insufficient JUMPI
+//	1d PUSH1 0x00 DUP1 DUP1 DUP1 DUP5 PUSH1 0x04 CALLDATALOAD GAS CALL ISZERO PUSH1 fail JUMPI
+//	2c PUSH1 0x00 MSTORE PUSH1 0x44 CALLDATALOAD PUSH1 0x20 MSTORE
+//	35 PUSH1 0x04 CALLDATALOAD PUSH32 MintWAbel PUSH1 0x40 PUSH1 0x00 LOG2 STOP
+//	5f fail: JUMPDEST PUSH1 0x00 DUP1 REVERT
+//	64 insufficient: JUMPDEST revert Error("insufficient balance")
+//
+// The 12 byte init code prefix returns the runtime code.
+const wAbelBytecode = "609a600c600039609a6000f3" +
+	"60003560e01c63b9ffbe6714601357600080fd5b6024358047106064576000808080846004355af1" +
+	"15605f576000526044356020526004357f6631b5b7aa2f756a96856e36a5103bea74b5fec3820fa388" +
+	"8b11d1be7195db8060406000a2005b600080fd5b6308c379a060e01b6000526020600452601460245273" +
+	"696e73756666696369656e742062616c616e636560601b60445260646000fd"
+
+const gasLimit = 30_000_000
+
+var (
+	// Ether is 1e18 wei
+	Ether = new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+	// KeyFunds is the genesis balance of Key
+	KeyFunds = new(big.Int).Mul(big.NewInt(1000), Ether)
+	// ContractFunds is the deploy value of the wABEL contract
+	ContractFunds = new(big.Int).Mul(big.NewInt(100), Ether)
+)
+
+// Backend is a simulated rollup, it implements the EthClient of the bridge
+type Backend struct {
+	// Key is the funded bridge key, the deployer of the contract
+	Key      *ecdsa.PrivateKey
+	Contract common.Address
+
+	db     ethdb.Database
+	chain  *core.BlockChain
+	pool   *txpool.TxPool
+	config *params.ChainConfig
+
+	t    testing.TB
+	mu   sync.Mutex // serializes the commits
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New starts a backend with a funded Key and the wABEL contract deployed with
+// ContractFunds, it is closed at the end of the test
+func New(t testing.TB) *Backend {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &Backend{
+		Key:    key,
+		t:      t,
+		db:     rawdb.NewMemoryDatabase(),
+		config: params.AllEthashProtocolChanges,
+	}
+	genesis := &core.Genesis{
+		Config:   b.config,
+		GasLimit: gasLimit,
+		BaseFee:  big.NewInt(params.InitialBaseFee),
+		Alloc: types.GenesisAlloc{
+			crypto.PubkeyToAddress(key.PublicKey): {Balance: KeyFunds},
+		},
+	}
+	// archive mode writes every state to the db the blocks are generated from
+	cacheConfig := core.DefaultCacheConfigWithScheme(rawdb.HashScheme)
+	cacheConfig.TrieDirtyDisabled = true
+	b.chain, err = core.NewBlockChain(b.db, cacheConfig, genesis, nil, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	poolConfig := legacypool.DefaultConfig
+	poolConfig.Journal = ""
+	b.pool, err = txpool.New(poolConfig.PriceLimit, b.chain, []txpool.SubPool{legacypool.New(poolConfig, b.chain)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		b.StopAutoCommit()
+		_ = b.pool.Close()
+		b.chain.Stop()
+	})
+
+	if b.Contract, err = b.deploy(); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// deploy creates the wABEL contract with the constructor arguments of the abi
+func (b *Backend) deploy() (common.Address, error) {
+	contractAbi, err := abi.JSON(strings.NewReader(config.DefaultDepositAbi))
+	if err != nil {
+		return common.Address{}, err
+	}
+	code, err := hex.DecodeString(wAbelBytecode)
+	if err != nil {
+		return common.Address{}, err
+	}
+	args, err := contractAbi.Pack("", common.Address{}, common.Address{}, big.NewInt(0))
+	if err != nil {
+		return common.Address{}, err
+	}
+	ctx := context.Background()
+	from := crypto.PubkeyToAddress(b.Key.PublicKey)
+	nonce, err := b.PendingNonceAt(ctx, from)
+	if err != nil {
+		return common.Address{}, err
+	}
+	gasPrice, err := b.SuggestGasPrice(ctx)
+	if err != nil {
+		return common.Address{}, err
+	}
+	tx, err := types.SignTx(types.NewContractCreation(nonce, ContractFunds, 1_000_000, gasPrice, append(code, args...)),
+		types.LatestSigner(b.config), b.Key)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if err = b.SendTransaction(ctx, tx); err != nil {
+		return common.Address{}, err
+	}
+	if err = b.Commit(); err != nil {
+		return common.Address{}, err
+	}
+	receipt, err := b.TransactionReceipt(ctx, tx.Hash())
+	if err != nil {
+		return common.Address{}, err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return common.Address{}, errors.New("evmsim: wABEL deploy reverted")
+	}
+	return crypto.CreateAddress(from, nonce), nil
+}
+
+// PrivKeyHex returns the hex bridge key of the eth-priv-key config
+func (b *Backend) PrivKeyHex() string {
+	return hex.EncodeToString(crypto.FromECDSA(b.Key))
+}
+
+// Commit mines a block of the pending txs. The txs are checked against the parent
+// state, a tx below the nonce of its sender is left out, the pool drops it.
+func (b *Backend) Commit() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// the pool drops the txs mined or replaced since its last reset
+	if err := b.pool.Sync(); err != nil {
+		return fmt.Errorf("evmsim: sync pool: %w", err)
+	}
+	parent := b.chain.GetBlockByHash(b.chain.CurrentBlock().Hash())
+	state, err := b.chain.StateAt(parent.Root())
+	if err != nil {
+		return fmt.Errorf("evmsim: parent state: %w", err)
+	}
+	var txs []*types.Transaction
+	for from, lazies := range b.pool.Pending(txpool.PendingFilter{}) {
+		// the txs of a sender are sorted by nonce, the first gap ends them
+		next := state.GetNonce(from)
+		for _, lazy := range lazies {
+			tx := lazy.Resolve()
+			if tx == nil || tx.Nonce() < next {
+				continue
+			}
+			if tx.Nonce() > next {
+				break
+			}
+			txs = append(txs, tx)
+			next++
+		}
+	}
+	var addErr error
+	blocks, _ := core.GenerateChain(b.config, parent, ethash.NewFaker(), b.db, 1, func(_ int, gen *core.BlockGen) {
+		// AddTxWithChain panics on an invalid tx
+		defer func() {
+			if r := recover(); r != nil {
+				addErr = fmt.Errorf("evmsim: add tx: %v", r)
+			}
+		}()
+		for _, tx := range txs {
+			gen.AddTxWithChain(b.chain, tx)
+		}
+	})
+	if addErr != nil {
+		return addErr
+	}
+	if _, err = b.chain.InsertChain(blocks); err != nil {
+		return fmt.Errorf("evmsim: insert block: %w", err)
+	}
+	// the pool drops the mined txs on the new head
+	return b.pool.Sync()
+}
+
+// AutoCommit mines a block every interval until StopAutoCommit or a failed Commit,
+// whose error fails the test
+func (b *Backend) AutoCommit(interval time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stop != nil {
+		return
+	}
+	b.stop = make(chan struct{})
+	b.done = make(chan struct{})
+	go func(stop <-chan struct{}, done chan<- struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := b.Commit(); err != nil {
+					b.t.Errorf("evmsim: auto commit: %v", err)
+					return
+				}
+			}
+		}
+	}(b.stop, b.done)
+}
+
+// StopAutoCommit stops the AutoCommit mining, pending txs stay in the pool
+func (b *Backend) StopAutoCommit() {
+	b.mu.Lock()
+	stop, done := b.stop, b.done
+	b.stop, b.done = nil, nil
+	b.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+// Balance returns the balance of account at the latest block
+func (b *Backend) Balance(t testing.TB, account common.Address) *big.Int {
+	balance, err := b.BalanceAt(context.Background(), account, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return balance
+}
+
+// ChainID implements EthClient
+func (b *Backend) ChainID(context.Context) (*big.Int, error) {
+	return new(big.Int).Set(b.config.ChainID), nil
+}
+
+// BlockNumber implements EthClient
+func (b *Backend) BlockNumber(context.Context) (uint64, error) {
+	return b.chain.CurrentBlock().Number.Uint64(), nil
+}
+
+// BalanceAt implements EthClient, only the latest block is served
+func (b *Backend) BalanceAt(_ context.Context, account common.Address, _ *big.Int) (*big.Int, error) {
+	statedb, err := b.chain.State()
+	if err != nil {
+		return nil, err
+	}
+	return statedb.GetBalance(account).ToBig(), nil
+}
+
+// NonceAt implements EthClient, only the latest block is served
+func (b *Backend) NonceAt(_ context.Context, account common.Address, _ *big.Int) (uint64, error) {
+	statedb, err := b.chain.State()
+	if err != nil {
+		return 0, err
+	}
+	return statedb.GetNonce(account), nil
+}
+
+// CodeAt implements EthClient, only the latest block is served
+func (b *Backend) CodeAt(_ context.Context, account common.Address, _ *big.Int) ([]byte, error) {
+	statedb, err := b.chain.State()
+	if err != nil {
+		return nil, err
+	}
+	return statedb.GetCode(account), nil
+}
+
+// PendingNonceAt implements EthClient
+func (b *Backend) PendingNonceAt(_ context.Context, account common.Address) (uint64, error) {
+	return b.pool.Nonce(account), nil
+}
+
+// SuggestGasPrice implements EthClient, the base fee plus a 1 gwei tip
+func (b *Backend) SuggestGasPrice(context.Context) (*big.Int, error) {
+	return new(big.Int).Add(b.chain.CurrentBlock().BaseFee, big.NewInt(params.GWei)), nil
+}
+
+// EstimateGas implements EthClient, a revert is reported like the geth rpc
+func (b *Backend) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64, error) {
+	statedb, err := b.chain.State()
+	if err != nil {
+		return 0, err
+	}
+	value := msg.Value
+	if value == nil {
+		value = new(big.Int)
+	}
+	gasPrice := msg.GasPrice
+	if gasPrice == nil {
+		gasPrice = new(big.Int)
+	}
+	call := &core.Message{
+		From:              msg.From,
+		To:                msg.To,
+		Value:             value,
+		GasLimit:          msg.Gas,
+		GasPrice:          gasPrice,
+		GasFeeCap:         gasPrice,
+		GasTipCap:         gasPrice,
+		Data:              msg.Data,
+		SkipAccountChecks: true,
+	}
+	gas, revert, err := gasestimator.Estimate(ctx, call, &gasestimator.Options{
+		Config: b.config,
+		Chain:  b.chain,
+		Header: b.chain.CurrentBlock(),
+		State:  statedb,
+	}, gasLimit)
+	if err != nil {
+		if reason, unpackErr := abi.UnpackRevert(revert); unpackErr == nil {
+			return 0, fmt.Errorf("%w: %s", vm.ErrExecutionReverted, reason)
+		}
+		return 0, err
+	}
+	return gas, nil
+}
+
+// SendTransaction implements EthClient, the tx pool errors are the geth rpc ones
+func (b *Backend) SendTransaction(_ context.Context, tx *types.Transaction) error {
+	return b.pool.Add([]*types.Transaction{tx}, true, true)[0]
+}
+
+// TransactionByHash implements EthClient
+func (b *Backend) TransactionByHash(_ context.Context, hash common.Hash) (*types.Transaction, bool, error) {
+	if tx := b.pool.Get(hash); tx != nil {
+		return tx, true, nil
+	}
+	if tx, _, _, _ := rawdb.ReadTransaction(b.db, hash); tx != nil {
+		return tx, false, nil
+	}
+	return nil, false, ethereum.NotFound
+}
+
+// TransactionReceipt implements EthClient
+func (b *Backend) TransactionReceipt(_ context.Context, hash common.Hash) (*types.Receipt, error) {
+	_, blockHash, _, index := rawdb.ReadTransaction(b.db, hash)
+	if blockHash == (common.Hash{}) {
+		return nil, ethereum.NotFound
+	}
+	receipts := b.chain.GetReceiptsByHash(blockHash)
+	if index >= uint64(len(receipts)) {
+		return nil, ethereum.NotFound
+	}
+	return receipts[index], nil
+}
+
+// FilterLogs implements the EthClient of the rollup listener, only block ranges are served
+func (b *Backend) FilterLogs(_ context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	if q.BlockHash != nil {
+		return nil, errors.New("evmsim: block hash filter not supported")
+	}
+	from, to := uint64(0), b.chain.CurrentBlock().Number.Uint64()
+	if q.FromBlock != nil {
+		from = q.FromBlock.Uint64()
+	}
+	if q.ToBlock != nil && q.ToBlock.Sign() >= 0 && q.ToBlock.Uint64() < to {
+		to = q.ToBlock.Uint64()
+	}
+	var logs []types.Log
+	for number := from; number <= to; number++ {
+		for _, receipt := range b.chain.GetReceiptsByHash(b.chain.GetCanonicalHash(number)) {
+			for _, log := range receipt.Logs {
+				if matchLog(log, q) {
+					logs = append(logs, *log)
+				}
+			}
+		}
+	}
+	return logs, nil
+}
+
+// matchLog reports whether log has one of the addresses and of the topics of each position of q
+func matchLog(log *types.Log, q ethereum.FilterQuery) bool {
+	if len(q.Addresses) > 0 && !slices.Contains(q.Addresses, log.Address) {
+		return false
+	}
+	if len(q.Topics) > len(log.Topics) {
+		return false
+	}
+	for i, topics := range q.Topics {
+		if len(topics) > 0 && !slices.Contains(topics, log.Topics[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -2,6 +2,7 @@ package types
 
 import (
 	"context"
+	"math/big"
 
 	"github.com/ethereum/go-ethereum/core/types"
 )
@@ -19,4 +20,6 @@ type BitcoinBridge interface {
 	// TransactionByHash
 	TransactionByHash(hash string) (*types.Transaction, bool, error)
 	FromAddress() string
+	// FromBalance returns the balance of the from address in wei
+	FromBalance() (*big.Int, error)
 }
@@ -37,6 +37,8 @@ type BitcoinTxParseResult struct {
 	TxType string
 	// index is the index of the transaction in the block
 	Index int64
+	// output is the index of the deposit within the transaction, a tx may hold several
+	Output int64
 	// tos tx all to info
 	Tos []BitcoinTo
 }
@@ -5,8 +5,12 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"errors"
 )
 
+// ErrAesDecrypt is a ciphertext which is not of the key
+var ErrAesDecrypt = errors.New("aes decrypt: invalid ciphertext or key")
+
 func PKCS5Padding(plaintext []byte, blockSize int) []byte {
 	padding := blockSize - len(plaintext)%blockSize
 	padtext := bytes.Repeat([]byte{byte(padding)}, padding)
@@ -40,9 +44,18 @@ func AesDecrypt(crypted, key []byte) ([]byte, error) {
 	}
 
 	blockSize := block.BlockSize()
+	if len(crypted) == 0 || len(crypted)%blockSize != 0 {
+		return nil, ErrAesDecrypt
+	}
 	blockMode := cipher.NewCBCDecrypter(block, key[:blockSize])
 	origData := make([]byte, len(crypted))
 	blockMode.CryptBlocks(origData, crypted)
+	// a wrong key leaves an invalid padding
+	padding := int(origData[len(origData)-1])
+	if padding == 0 || padding > blockSize ||
+		!bytes.Equal(origData[len(origData)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, ErrAesDecrypt
+	}
 	origData = PKCS5UnPadding(origData)
 	return origData, nil
 }
@@ -1,12 +1,17 @@
 package crypto
 
 import (
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/hex"
+	"errors"
 )
 
+var ErrNotRsaKey = errors.New("not a rsa key")
+
 func RsaEncryptHex(originalData, publicKey string) (string, error) {
 	decodePubKey, err := hex.DecodeString(publicKey)
 	if err != nil {
@@ -61,3 +66,47 @@ func GenRsaKey(bits int) (privateKey, publicKey string, err error) {
 	publicKey = hex.EncodeToString(derPkix)
 	return
 }
+
+// RsaSignHex signs the sha256 digest of data with a hex PKCS8 private key, PKCS1v15
+func RsaSignHex(data, privateKey string) (string, error) {
+	decodePrivKey, err := hex.DecodeString(privateKey)
+	if err != nil {
+		return "", err
+	}
+	priKey, parseErr := x509.ParsePKCS8PrivateKey(decodePrivKey)
+	if parseErr != nil {
+		return "", parseErr
+	}
+	rsaKey, ok := priKey.(*rsa.PrivateKey)
+	if !ok {
+		return "", ErrNotRsaKey
+	}
+	digest := sha256.Sum256([]byte(data))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(signature), nil
+}
+
+// RsaVerifyHex verifies a RsaSignHex signature of data with a hex PKIX public key
+func RsaVerifyHex(data, signature, publicKey string) error {
+	decodeSignature, err := hex.DecodeString(signature)
+	if err != nil {
+		return err
+	}
+	decodePubKey, err := hex.DecodeString(publicKey)
+	if err != nil {
+		return err
+	}
+	pubKey, parseErr := x509.ParsePKIXPublicKey(decodePubKey)
+	if parseErr != nil {
+		return parseErr
+	}
+	rsaKey, ok := pubKey.(*rsa.PublicKey)
+	if !ok {
+		return ErrNotRsaKey
+	}
+	digest := sha256.Sum256([]byte(data))
+	return rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], decodeSignature)
+}
@@ -0,0 +1,52 @@
+package bridge
+
+import (
+	"encoding/json"
+
+	"github.com/b2network/b2-indexer/pkg/event"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	MintWAbelName = "MintWAbel"
+	MintWAbelHash = crypto.Keccak256([]byte("MintWAbel(address,uint256,uint256)"))
+)
+
+// MintWAbel is the event of a deposit mint of the wABEL contract, it has no abelian tx hash
+type MintWAbel struct {
+	ToAddress string          `json:"to_address"`
+	Amount    decimal.Decimal `json:"amount"`
+	LockDay   int64           `json:"lock_day"`
+}
+
+func (*MintWAbel) Name() string {
+	return MintWAbelName
+}
+
+func (*MintWAbel) EventHash() common.Hash {
+	return common.BytesToHash(MintWAbelHash)
+}
+
+func (t *MintWAbel) ToObj(data string) error {
+	err := json.Unmarshal([]byte(data), &t)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (*MintWAbel) Data(log types.Log) (string, error) {
+	mint := &MintWAbel{
+		ToAddress: event.TopicToAddress(log, 1).Hex(),
+		Amount:    event.DataToDecimal(log, 0, 0),
+		LockDay:   event.DataToInt64(log, 1),
+	}
+	data, err := event.ToJSON(mint)
+	if err != nil {
+		return "", err
+	}
+	return data, nil
+}
@@ -63,7 +63,7 @@ func (opt *Options) Validate() error {
 		errorMsg = append(errorMsg, fmt.Sprintf("Invalid level, should be one of %v", strings.Join(validLevels, ",")))
 	}
 	if len(errorMsg) != 0 {
-		return errors.New(strings.Join(validLevels, ";"))
+		return errors.New(strings.Join(errorMsg, ";"))
 	}
 	return nil
 }